@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/simonhayward/gkeepassxreader/agent"
+	"github.com/simonhayward/gkeepassxreader/core"
+	log "github.com/sirupsen/logrus"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+func socketPath() string {
+	if len(*agentSocket) > 0 {
+		return *agentSocket
+	}
+	return agent.DefaultSocketPath()
+}
+
+// agentKey returns the cached transformed master key or nil
+func agentKey(d *core.Database) []byte {
+	if *noAgent {
+		return nil
+	}
+
+	client := agent.NewClient(socketPath())
+	if !client.Available() {
+		return nil
+	}
+
+	key, err := client.Get(agent.DatabaseID(d.TransformSeed, d.TransformRounds))
+	if err != nil {
+		if err != agent.ErrNotFound {
+			log.Warnf("agent error: %s", err)
+		}
+		return nil
+	}
+
+	log.Debug("using transformed master key from agent")
+	return key
+}
+
+func runAgent(idleTimeout time.Duration) {
+	path := socketPath()
+
+	l, err := agent.Listen(path)
+	if err != nil {
+		log.Fatalf("agent error: %s", err)
+	}
+
+	server := agent.NewServer(idleTimeout)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		server.Close()
+		l.Close()
+	}()
+
+	fmt.Fprintf(os.Stderr, "%s=%s\n", agent.SocketEnv, path)
+
+	if err := server.Serve(l); err != nil {
+		log.Errorf("agent error: %s", err)
+	}
+
+	server.Close()
+	agent.RemoveSocket(path)
+}
+
+func unlock() {
+	if *db == nil {
+		kingpin.Fatalf("required flag --db not provided")
+	}
+
+	client := agent.NewClient(socketPath())
+	if !client.Available() {
+		log.Fatalf("agent not running on %s", socketPath())
+	}
+
+	*noAgent = true
+	reader := openDatabase()
+	defer reader.Close()
+
+	path, err := filepath.Abs((*db).Name())
+	if err != nil {
+		path = (*db).Name()
+	}
+
+	id := agent.DatabaseID(reader.Db.TransformSeed, reader.Db.TransformRounds)
+	if err := client.Put(id, path, reader.Db.TransformedMasterKey); err != nil {
+		log.Fatalf("agent error: %s", err)
+	}
+
+	fmt.Println("database unlocked")
+}
+
+func lock() {
+	if err := agent.NewClient(socketPath()).Lock(); err != nil {
+		log.Fatalf("agent error: %s", err)
+	}
+
+	fmt.Println("agent locked")
+}
+
+func status() {
+	resp, err := agent.NewClient(socketPath()).Status()
+	if err != nil {
+		log.Fatalf("agent error: %s", err)
+	}
+
+	fmt.Printf("agent running on %s, idle timeout %s\n", socketPath(), resp.IdleTimeout)
+	for _, d := range resp.Databases {
+		fmt.Printf("%s expires in %s\n", d.Path, d.ExpiresIn.Round(time.Second))
+	}
+	if len(resp.Databases) == 0 {
+		fmt.Println("no databases unlocked")
+	}
+}
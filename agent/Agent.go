@@ -0,0 +1,263 @@
+package agent
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/simonhayward/gkeepassxreader/secure"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	//OpGet fetches a cached key
+	OpGet = "get"
+	//OpPut caches a key
+	OpPut = "put"
+	//OpLock wipes all cached keys
+	OpLock = "lock"
+	//OpStatus lists cached keys
+	OpStatus = "status"
+
+	//DefaultIdleTimeout before a cached key is wiped
+	DefaultIdleTimeout = 15 * time.Minute
+
+	sweepInterval = time.Second
+)
+
+var (
+	//ErrNotFound is returned when no key is cached for a database
+	ErrNotFound = errors.New("key not cached")
+)
+
+//Request sent by the client to the agent
+type Request struct {
+	Op   string `json:"op"`
+	ID   string `json:"id,omitempty"`
+	Path string `json:"path,omitempty"`
+	Key  []byte `json:"key,omitempty"`
+}
+
+//Response returned by the agent
+type Response struct {
+	Error       string           `json:"error,omitempty"`
+	Key         []byte           `json:"key,omitempty"`
+	IdleTimeout time.Duration    `json:"idle_timeout,omitempty"`
+	Databases   []DatabaseStatus `json:"databases,omitempty"`
+}
+
+//DatabaseStatus describes a cached key without revealing it
+type DatabaseStatus struct {
+	ID        string        `json:"id"`
+	Path      string        `json:"path"`
+	ExpiresIn time.Duration `json:"expires_in"`
+}
+
+type cachedKey struct {
+	key      *secure.LockedBuffer
+	path     string
+	lastUsed time.Time
+}
+
+//Server holds transformed master keys in locked memory
+type Server struct {
+	IdleTimeout time.Duration
+	mu          sync.Mutex
+	keys        map[string]*cachedKey
+	done        chan struct{}
+	closeOnce   sync.Once
+}
+
+//DatabaseID identifies a database by the parameters its transformed key is derived from
+func DatabaseID(transformSeed []byte, rounds uint64) string {
+	r := make([]byte, 8)
+	binary.LittleEndian.PutUint64(r, rounds)
+
+	h := sha256.New()
+	h.Write(transformSeed)
+	h.Write(r)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+//NewServer with an idle timeout for cached keys
+func NewServer(idleTimeout time.Duration) *Server {
+	if idleTimeout <= 0 {
+		idleTimeout = DefaultIdleTimeout
+	}
+
+	return &Server{
+		IdleTimeout: idleTimeout,
+		keys:        make(map[string]*cachedKey),
+		done:        make(chan struct{}),
+	}
+}
+
+//Serve accepts connections until the listener is closed
+func (s *Server) Serve(l net.Listener) error {
+	go s.sweep()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			select {
+			case <-s.done:
+				return nil
+			default:
+			}
+			return fmt.Errorf("accept failed: %s", err)
+		}
+		go s.handle(conn)
+	}
+}
+
+//Close wipes all cached keys and stops the sweeper
+func (s *Server) Close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+	s.lock()
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+
+	if err := checkPeer(conn); err != nil {
+		log.Warnf("rejected connection: %s", err)
+		return
+	}
+
+	var req Request
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		log.Debugf("request decode failed: %s", err)
+		return
+	}
+	defer secure.Wipe(req.Key)
+
+	resp := s.process(&req)
+	defer secure.Wipe(resp.Key)
+
+	if err := json.NewEncoder(conn).Encode(resp); err != nil {
+		log.Debugf("response encode failed: %s", err)
+	}
+}
+
+func (s *Server) process(req *Request) *Response {
+	switch req.Op {
+	case OpGet:
+		key, err := s.get(req.ID)
+		if err != nil {
+			return &Response{Error: err.Error()}
+		}
+		return &Response{Key: key}
+	case OpPut:
+		if err := s.put(req.ID, req.Path, req.Key); err != nil {
+			return &Response{Error: err.Error()}
+		}
+		return &Response{}
+	case OpLock:
+		s.lock()
+		return &Response{}
+	case OpStatus:
+		return &Response{IdleTimeout: s.IdleTimeout, Databases: s.status()}
+	}
+	return &Response{Error: fmt.Sprintf("unknown operation: %s", req.Op)}
+}
+
+func (s *Server) get(id string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.keys[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	c.lastUsed = time.Now()
+	return append([]byte(nil), c.key.Bytes()...), nil
+}
+
+func (s *Server) put(id, path string, key []byte) error {
+	if len(id) == 0 || len(key) == 0 {
+		return errors.New("missing id or key")
+	}
+
+	locked, err := secure.NewLockedBufferFromBytes(key)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if c, ok := s.keys[id]; ok {
+		c.key.Destroy()
+	}
+	s.keys[id] = &cachedKey{key: locked, path: path, lastUsed: time.Now()}
+	return nil
+}
+
+func (s *Server) lock() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, c := range s.keys {
+		c.key.Destroy()
+		delete(s.keys, id)
+	}
+}
+
+func (s *Server) status() []DatabaseStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var databases []DatabaseStatus
+	for id, c := range s.keys {
+		databases = append(databases, DatabaseStatus{
+			ID:        id,
+			Path:      c.path,
+			ExpiresIn: s.IdleTimeout - time.Since(c.lastUsed),
+		})
+	}
+	return databases
+}
+
+func (s *Server) sweep() {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.expire()
+		}
+	}
+}
+
+func (s *Server) expire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, c := range s.keys {
+		if time.Since(c.lastUsed) >= s.IdleTimeout {
+			log.Debugf("idle timeout, wiping key: %s", id)
+			c.key.Destroy()
+			delete(s.keys, id)
+		}
+	}
+}
+
+//RemoveSocket removes the socket file on shutdown
+func RemoveSocket(path string) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.Warnf("unable to remove socket: %s", err)
+	}
+}
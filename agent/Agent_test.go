@@ -0,0 +1,193 @@
+package agent_test
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/simonhayward/gkeepassxreader/agent"
+)
+
+var _ = Describe("Agent", func() {
+
+	var (
+		dir    string
+		path   string
+		l      net.Listener
+		server *agent.Server
+		client *agent.Client
+		key    []byte
+		id     string
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "agent")
+		Expect(err).ToNot(HaveOccurred())
+
+		path = filepath.Join(dir, "sock", "agent.sock")
+		l, err = agent.Listen(path)
+		Expect(err).ToNot(HaveOccurred())
+
+		server = agent.NewServer(time.Minute)
+		go server.Serve(l)
+
+		client = agent.NewClient(path)
+		key = []byte("abcdefghijklmnopqrstuvwxyz123456")
+		id = agent.DatabaseID([]byte("transform seed"), 6000)
+	})
+
+	AfterEach(func() {
+		server.Close()
+		l.Close()
+		os.RemoveAll(dir)
+	})
+
+	Context("when listening", func() {
+		It("restricts the socket to the current user", func() {
+			fi, err := os.Stat(path)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fi.Mode().Perm()).To(Equal(os.FileMode(0600)))
+
+			fi, err = os.Stat(filepath.Dir(path))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fi.Mode().Perm()).To(Equal(os.FileMode(0700)))
+		})
+
+		It("refuses to start a second agent on the same socket", func() {
+			_, err := agent.Listen(path)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("when the socket directory can't be trusted", func() {
+
+		var (
+			planted string
+		)
+
+		BeforeEach(func() {
+			planted = filepath.Join(dir, "planted")
+			Expect(os.Mkdir(planted, 0700)).To(Succeed())
+		})
+
+		// listen as another user would on a socket in the planted directory,
+		// failing if a client connects
+		listenPlanted := func() string {
+			path := filepath.Join(planted, "agent.sock")
+			rogue, err := net.Listen("unix", path)
+			Expect(err).ToNot(HaveOccurred())
+			DeferCleanup(rogue.Close)
+			Expect(os.Chmod(path, 0777)).To(Succeed())
+
+			go func() {
+				defer GinkgoRecover()
+				conn, err := rogue.Accept()
+				if err == nil {
+					conn.Close()
+					Fail("client connected to a planted socket")
+				}
+			}()
+			return path
+		}
+
+		It("refuses a directory other users can access", func() {
+			path := listenPlanted()
+			Expect(os.Chmod(planted, 0755)).To(Succeed())
+
+			_, err := agent.Listen(path)
+			Expect(err).To(MatchError(ContainSubstring("has mode 755, not 700")))
+
+			client := agent.NewClient(path)
+			Expect(client.Available()).To(BeFalse())
+			Expect(client.Put(id, "db.kdbx", key)).To(MatchError(ContainSubstring("has mode 755, not 700")))
+			_, err = client.Get(id)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("refuses a link to a directory", func() {
+			listenPlanted()
+			link := filepath.Join(dir, "link")
+			Expect(os.Symlink(planted, link)).To(Succeed())
+
+			_, err := agent.Listen(filepath.Join(link, "other.sock"))
+			Expect(err).To(MatchError(ContainSubstring("is not a directory")))
+
+			client := agent.NewClient(filepath.Join(link, "agent.sock"))
+			Expect(client.Put(id, "db.kdbx", key)).To(MatchError(ContainSubstring("is not a directory")))
+		})
+
+		It("refuses a directory owned by another user", func() {
+			if os.Getuid() != 0 {
+				Skip("changing the owner of the directory needs root")
+			}
+			path := listenPlanted()
+			Expect(os.Chown(planted, 65534, 65534)).To(Succeed())
+
+			client := agent.NewClient(path)
+			Expect(client.Put(id, "db.kdbx", key)).To(MatchError(ContainSubstring("is owned by uid 65534")))
+		})
+	})
+
+	Context("when a key has been cached", func() {
+		It("returns the key", func() {
+			Expect(client.Available()).To(BeTrue())
+			Expect(client.Put(id, "db.kdbx", key)).To(Succeed())
+
+			cached, err := client.Get(id)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cached).To(Equal(key))
+		})
+
+		It("reports the database without the key", func() {
+			Expect(client.Put(id, "db.kdbx", key)).To(Succeed())
+
+			resp, err := client.Status()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.IdleTimeout).To(Equal(time.Minute))
+			Expect(resp.Databases).To(HaveLen(1))
+			Expect(resp.Databases[0].Path).To(Equal("db.kdbx"))
+			Expect(resp.Key).To(BeEmpty())
+		})
+
+		It("wipes the key when locked", func() {
+			Expect(client.Put(id, "db.kdbx", key)).To(Succeed())
+			Expect(client.Lock()).To(Succeed())
+
+			_, err := client.Get(id)
+			Expect(err).To(Equal(agent.ErrNotFound))
+		})
+	})
+
+	Context("when a key has not been used within the idle timeout", func() {
+		It("wipes the key", func() {
+			server.IdleTimeout = 10 * time.Millisecond
+			Expect(client.Put(id, "db.kdbx", key)).To(Succeed())
+
+			Eventually(func() error {
+				_, err := client.Get(id)
+				return err
+			}, 3*time.Second, 100*time.Millisecond).Should(Equal(agent.ErrNotFound))
+		})
+	})
+
+	Context("when no key has been cached", func() {
+		It("returns not found", func() {
+			_, err := client.Get(id)
+			Expect(err).To(Equal(agent.ErrNotFound))
+		})
+	})
+
+	Context("when identifying a database", func() {
+		It("depends on the transform seed and rounds", func() {
+			Expect(agent.DatabaseID([]byte("transform seed"), 6000)).To(Equal(id))
+			Expect(agent.DatabaseID([]byte("transform seed"), 6001)).ToNot(Equal(id))
+			Expect(agent.DatabaseID([]byte("other seed"), 6000)).ToNot(Equal(id))
+		})
+	})
+})
@@ -0,0 +1,114 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	dialTimeout = time.Second
+	ioTimeout   = 5 * time.Second
+)
+
+//Client talks to a running agent
+type Client struct {
+	SocketPath string
+}
+
+//NewClient for the agent listening on socketPath
+func NewClient(socketPath string) *Client {
+	return &Client{SocketPath: socketPath}
+}
+
+//Available reports whether an agent which can be trusted is listening
+func (c *Client) Available() bool {
+	conn, err := c.dial()
+	if err != nil {
+		log.Debugf("agent not available: %s", err)
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+//Get the cached transformed master key for a database
+func (c *Client) Get(id string) ([]byte, error) {
+	resp, err := c.call(&Request{Op: OpGet, ID: id})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Key, nil
+}
+
+//Put caches the transformed master key for a database
+func (c *Client) Put(id, path string, key []byte) error {
+	_, err := c.call(&Request{Op: OpPut, ID: id, Path: path, Key: key})
+	return err
+}
+
+//Lock wipes all keys held by the agent
+func (c *Client) Lock() error {
+	_, err := c.call(&Request{Op: OpLock})
+	return err
+}
+
+//Status of the agent and its cached keys
+func (c *Client) Status() (*Response, error) {
+	return c.call(&Request{Op: OpStatus})
+}
+
+func (c *Client) call(req *Request) (*Response, error) {
+	conn, err := c.dial()
+	if err != nil {
+		return nil, fmt.Errorf("agent not available: %s", err)
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(ioTimeout)); err != nil {
+		return nil, err
+	}
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, fmt.Errorf("agent request failed: %s", err)
+	}
+
+	resp := &Response{}
+	if err := json.NewDecoder(conn).Decode(resp); err != nil {
+		return nil, fmt.Errorf("agent response failed: %s", err)
+	}
+
+	if len(resp.Error) > 0 {
+		if resp.Error == ErrNotFound.Error() {
+			return nil, ErrNotFound
+		}
+		return nil, errors.New(resp.Error)
+	}
+
+	return resp, nil
+}
+
+// dial connects to the agent once its socket directory and the user it runs
+// as show it was started by the current user, so no key is sent to or taken
+// from anyone else
+func (c *Client) dial() (net.Conn, error) {
+	if err := checkSocketDir(filepath.Dir(c.SocketPath)); err != nil {
+		return nil, err
+	}
+
+	conn, err := net.DialTimeout("unix", c.SocketPath, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkPeer(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("untrusted agent: %s", err)
+	}
+	return conn, nil
+}
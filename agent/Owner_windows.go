@@ -0,0 +1,11 @@
+//go:build windows
+// +build windows
+
+package agent
+
+import "os"
+
+// fileOwner is not available, access to the socket directory is left to its ACL
+func fileOwner(fi os.FileInfo) (int, bool) {
+	return 0, false
+}
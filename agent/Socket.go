@@ -0,0 +1,76 @@
+package agent
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+)
+
+const (
+	//SocketEnv overrides the default socket path
+	SocketEnv = "GKEEPASSXREADER_AGENT_SOCK"
+
+	socketName = "agent.sock"
+)
+
+//DefaultSocketPath is per user, under XDG_RUNTIME_DIR when available
+func DefaultSocketPath() string {
+	if p := os.Getenv(SocketEnv); len(p) > 0 {
+		return p
+	}
+
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); len(dir) > 0 {
+		return filepath.Join(dir, "gkeepassxreader", socketName)
+	}
+
+	return filepath.Join(os.TempDir(), fmt.Sprintf("gkeepassxreader-%d", os.Getuid()), socketName)
+}
+
+//Listen on a unix socket only accessible by the current user
+func Listen(path string) (net.Listener, error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("unable to create socket directory: %s", err)
+	}
+
+	if err := checkSocketDir(dir); err != nil {
+		return nil, err
+	}
+
+	if NewClient(path).Available() {
+		return nil, fmt.Errorf("an agent is already listening on %s", path)
+	}
+	RemoveSocket(path)
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to listen: %s", err)
+	}
+
+	if err := os.Chmod(path, 0600); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("unable to set socket permissions: %s", err)
+	}
+
+	return l, nil
+}
+
+// checkSocketDir requires the directory of a socket to be a directory, not a
+// link to one, which belongs to the current user and no one else can access
+func checkSocketDir(dir string) error {
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		return fmt.Errorf("unable to stat socket directory: %s", err)
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("socket directory %s is not a directory", dir)
+	}
+	if uid, ok := fileOwner(fi); ok && uid != os.Getuid() {
+		return fmt.Errorf("socket directory %s is owned by uid %d, not %d", dir, uid, os.Getuid())
+	}
+	if fi.Mode().Perm() != 0700 {
+		return fmt.Errorf("socket directory %s has mode %o, not 700", dir, fi.Mode().Perm())
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/simonhayward/gkeepassxreader/audit"
+	"github.com/simonhayward/gkeepassxreader/format"
+	"github.com/simonhayward/gkeepassxreader/output"
+	log "github.com/sirupsen/logrus"
+)
+
+func auditDatabase(reader *format.KeePass2Reader, options audit.Options, breachedFile string, asJSON bool) {
+	if len(breachedFile) > 0 {
+		breached, err := audit.OpenBreached(breachedFile)
+		if err != nil {
+			log.Fatalf("audit error: %s", err)
+		}
+		defer breached.Close()
+		options.Breached = breached
+	}
+
+	entryService := entryService(reader)
+	entries, err := entryService.List()
+	if err != nil {
+		log.Fatalf("list database error: %s", err)
+	}
+	if err := entryService.Decode(entries); err != nil {
+		log.Fatalf("decode database error: %s", err)
+	}
+
+	report, err := audit.Audit(entries, options)
+	if err != nil {
+		log.Fatalf("audit error: %s", err)
+	}
+	if asJSON {
+		writeJSON(report)
+		return
+	}
+
+	// related entries are shown by title, passwords never are
+	titles := make(map[string]string)
+	for _, e := range entries {
+		if !e.Historical {
+			titles[e.UUID] = e.Title.String()
+		}
+	}
+
+	fields := &output.Data{Header: []string{"UUID", "Group", "Title", "History", "Check", "Detail"}}
+	for _, e := range report.Entries {
+		historical := ""
+		if e.Historical {
+			historical = "yes"
+		}
+		for _, f := range e.Findings {
+			detail := f.Detail
+			if len(f.Related) > 0 {
+				related := make([]string, len(f.Related))
+				for i, uuid := range f.Related {
+					related[i] = titles[uuid]
+				}
+				detail += ": " + strings.Join(related, ", ")
+			}
+			fields.Data = append(fields.Data, []string{e.UUID, e.Group, e.Title, historical, f.Check, detail})
+		}
+	}
+	if len(fields.Data) > 0 {
+		output.Table(fields.Header, fields.Data)
+	}
+
+	var counts []string
+	for _, check := range audit.Checks {
+		if n := report.Summary.Checks[check]; n > 0 {
+			counts = append(counts, fmt.Sprintf("%s %d", check, n))
+		}
+	}
+	fmt.Printf("score %d/100, %d of %d entries have findings", report.Summary.Score, report.Summary.WithFindings, report.Summary.Entries)
+	if len(counts) > 0 {
+		fmt.Printf(" (%s)", strings.Join(counts, ", "))
+	}
+	fmt.Println()
+}
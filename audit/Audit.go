@@ -0,0 +1,256 @@
+package audit
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/simonhayward/gkeepassxreader/format"
+)
+
+const (
+	//CheckEmpty entry has no password
+	CheckEmpty = "empty"
+	//CheckBreached password appears in a breach
+	CheckBreached = "breached"
+	//CheckShort password is shorter than the minimum length
+	CheckShort = "short"
+	//CheckWeak password strength is below the minimum score
+	CheckWeak = "weak"
+	//CheckReused password is used by another entry
+	CheckReused = "reused"
+	//CheckSimilar password is a small edit away from another entry's password
+	CheckSimilar = "similar"
+	//CheckContainsTitle password contains the entry title
+	CheckContainsTitle = "contains_title"
+	//CheckContainsUsername password contains the entry username
+	CheckContainsUsername = "contains_username"
+)
+
+//Checks in the order findings are reported
+var Checks = []string{CheckEmpty, CheckBreached, CheckShort, CheckWeak, CheckReused, CheckSimilar, CheckContainsTitle, CheckContainsUsername}
+
+// titles and usernames shorter than this are not looked for in passwords
+const minContainsLength = 3
+
+//Options of an audit
+type Options struct {
+	// passwords with fewer characters are short
+	MinLength int
+	// passwords scoring less are weak, 0 to 4
+	MinScore int
+	// passwords this many edits or fewer apart are similar, 0 disables the check
+	MaxDistance int
+	// breached passwords are looked up here when set
+	Breached BreachedPasswords
+}
+
+//DefaultOptions flag passwords under 12 characters, scoring under 3 or
+//within 2 edits of another
+var DefaultOptions = Options{MinLength: 12, MinScore: 3, MaxDistance: 2}
+
+//Finding is a problem with an entry's password. Related entries are given by
+//UUID, the password itself is never included.
+type Finding struct {
+	Check   string   `json:"check"`
+	Detail  string   `json:"detail,omitempty"`
+	Related []string `json:"related,omitempty"`
+}
+
+//EntryReport lists the findings of an entry
+type EntryReport struct {
+	UUID       string    `json:"uuid"`
+	Group      string    `json:"group"`
+	Title      string    `json:"title"`
+	Historical bool      `json:"historical"`
+	Strength   Strength  `json:"strength"`
+	Findings   []Finding `json:"findings"`
+}
+
+//Summary counts the entries audited and those with each finding
+type Summary struct {
+	// percentage of the audited entries without findings
+	Score        int            `json:"score"`
+	Entries      int            `json:"entries"`
+	WithFindings int            `json:"with_findings"`
+	Checks       map[string]int `json:"checks"`
+}
+
+//Report of an audit, only entries with findings are included
+type Report struct {
+	Summary Summary       `json:"summary"`
+	Entries []EntryReport `json:"entries"`
+}
+
+//Audit checks the passwords of the given entries, which must be decoded.
+//Historical entries are audited when included, a password is not counted as
+//reused or similar because of another version of the same entry.
+func Audit(entries []format.Entry, options Options) (Report, error) {
+	reports := make([]EntryReport, len(entries))
+	passwords := make([]string, len(entries))
+	for i := range entries {
+		e := &entries[i]
+		passwords[i] = e.Password.String()
+		reports[i] = EntryReport{
+			UUID:       e.UUID,
+			Group:      strings.Join(e.Path, "/"),
+			Title:      e.Title.String(),
+			Historical: e.Historical,
+			Strength:   PasswordStrength(passwords[i], e.Title.String(), e.Username.String()),
+			Findings:   []Finding{},
+		}
+	}
+
+	breached := make(map[string]int)
+	for i := range entries {
+		password := passwords[i]
+		r := &reports[i]
+
+		if len(password) == 0 {
+			r.Findings = append(r.Findings, Finding{Check: CheckEmpty})
+			continue
+		}
+
+		if options.Breached != nil {
+			// versions of an entry often share a password
+			count, ok := breached[password]
+			if !ok {
+				var err error
+				if count, err = options.Breached.Count(password); err != nil {
+					return Report{}, err
+				}
+				breached[password] = count
+			}
+			if count > 0 {
+				r.Findings = append(r.Findings, Finding{Check: CheckBreached, Detail: fmt.Sprintf("seen %d times", count)})
+			}
+		}
+
+		if n := utf8.RuneCountInString(password); n < options.MinLength {
+			r.Findings = append(r.Findings, Finding{Check: CheckShort, Detail: fmt.Sprintf("%d characters", n)})
+		}
+
+		if r.Strength.Score < options.MinScore {
+			r.Findings = append(r.Findings, Finding{Check: CheckWeak,
+				Detail: fmt.Sprintf("score %d, %.0f bits", r.Strength.Score, r.Strength.Entropy)})
+		}
+
+		// short passwords are all a few edits apart
+		checkSimilar := options.MaxDistance > 0 && utf8.RuneCountInString(password) > 2*options.MaxDistance
+
+		var reused, similar []string
+		for j := range entries {
+			if entries[j].UUID == entries[i].UUID || len(passwords[j]) == 0 {
+				continue
+			}
+			if passwords[j] == password {
+				reused = appendUnique(reused, entries[j].UUID)
+			} else if checkSimilar && editDistance(password, passwords[j], options.MaxDistance) <= options.MaxDistance {
+				similar = appendUnique(similar, entries[j].UUID)
+			}
+		}
+		if len(reused) > 0 {
+			r.Findings = append(r.Findings, Finding{Check: CheckReused, Detail: fmt.Sprintf("%d other entries", len(reused)), Related: reused})
+		}
+		if len(similar) > 0 {
+			r.Findings = append(r.Findings, Finding{Check: CheckSimilar, Detail: fmt.Sprintf("%d other entries", len(similar)), Related: similar})
+		}
+
+		lower := strings.ToLower(password)
+		if title := strings.ToLower(entries[i].Title.String()); utf8.RuneCountInString(title) >= minContainsLength && strings.Contains(lower, title) {
+			r.Findings = append(r.Findings, Finding{Check: CheckContainsTitle})
+		}
+		if username := strings.ToLower(entries[i].Username.String()); utf8.RuneCountInString(username) >= minContainsLength && strings.Contains(lower, username) {
+			r.Findings = append(r.Findings, Finding{Check: CheckContainsUsername})
+		}
+	}
+
+	report := Report{
+		Summary: Summary{Entries: len(entries), Checks: make(map[string]int)},
+		Entries: []EntryReport{},
+	}
+	for _, check := range Checks {
+		report.Summary.Checks[check] = 0
+	}
+	for _, r := range reports {
+		if len(r.Findings) == 0 {
+			continue
+		}
+		report.Entries = append(report.Entries, r)
+		for _, f := range r.Findings {
+			report.Summary.Checks[f.Check]++
+		}
+	}
+	report.Summary.WithFindings = len(report.Entries)
+	report.Summary.Score = 100
+	if len(entries) > 0 {
+		report.Summary.Score = 100 * (len(entries) - len(report.Entries)) / len(entries)
+	}
+
+	sort.SliceStable(report.Entries, func(i, j int) bool {
+		a, b := report.Entries[i], report.Entries[j]
+		if a.Group != b.Group {
+			return a.Group < b.Group
+		}
+		if a.Title != b.Title {
+			return a.Title < b.Title
+		}
+		return !a.Historical && b.Historical
+	})
+
+	return report, nil
+}
+
+// editDistance is the Levenshtein distance between a and b, once it is
+// certain to exceed max, max+1 is returned
+func editDistance(a, b string, max int) int {
+	ra, rb := []rune(a), []rune(b)
+	if d := len(ra) - len(rb); d > max || -d > max {
+		return max + 1
+	}
+
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if cur[j] < rowMin {
+				rowMin = cur[j]
+			}
+		}
+		if rowMin > max {
+			return max + 1
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+func minInt(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
+
+func appendUnique(s []string, v string) []string {
+	for _, e := range s {
+		if e == v {
+			return s
+		}
+	}
+	return append(s, v)
+}
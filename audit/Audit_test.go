@@ -0,0 +1,124 @@
+package audit_test
+
+import (
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/simonhayward/gkeepassxreader/audit"
+	"github.com/simonhayward/gkeepassxreader/format"
+)
+
+var _ = Describe("Audit", func() {
+
+	entry := func(uuid, title, username, password string, historical bool) format.Entry {
+		return format.Entry{
+			UUID:       uuid,
+			Path:       []string{"Root"},
+			Title:      &format.EntryValue{PlainText: title},
+			Username:   &format.EntryValue{PlainText: username},
+			Password:   &format.EntryValue{PlainText: password},
+			Historical: historical,
+		}
+	}
+
+	run := func(entries []format.Entry, options audit.Options) audit.Report {
+		report, err := audit.Audit(entries, options)
+		Expect(err).ToNot(HaveOccurred())
+		return report
+	}
+
+	checks := func(r audit.EntryReport) []string {
+		var c []string
+		for _, f := range r.Findings {
+			c = append(c, f.Check)
+		}
+		return c
+	}
+
+	Context("when every password is strong and unique", func() {
+		It("reports no findings and a full score", func() {
+			report := run([]format.Entry{
+				entry("1", "Mail", "alice", "x7$Kq9!mPz#2Lw", false),
+				entry("2", "Bank", "alice", "Hf8&wQ2@zL5!vR", false),
+			}, audit.DefaultOptions)
+			Expect(report.Entries).To(BeEmpty())
+			Expect(report.Summary.Score).To(Equal(100))
+			Expect(report.Summary.Entries).To(Equal(2))
+		})
+	})
+
+	Context("when passwords have problems", func() {
+		var report audit.Report
+		BeforeEach(func() {
+			report = run([]format.Entry{
+				entry("1", "Mail", "alice", "x7$Kq9!mPz#2Lw", false),
+				entry("2", "Bank", "alice", "x7$Kq9!mPz#2Lw", false),
+				entry("3", "Shop", "alice", "x7$Kq9!mPz#2Lx", false),
+				entry("4", "Blank", "bob", "", false),
+				entry("5", "Forum", "carol", "carolForum!", false),
+				entry("1", "Mail", "alice", "x7$Kq9!mPz#2Lw", true),
+			}, audit.DefaultOptions)
+		})
+
+		findings := func(uuid string) []audit.Finding {
+			for _, r := range report.Entries {
+				if r.UUID == uuid && !r.Historical {
+					return r.Findings
+				}
+			}
+			return nil
+		}
+
+		It("reports reuse by other entries only", func() {
+			Expect(findings("1")).To(ContainElement(audit.Finding{Check: audit.CheckReused, Detail: "1 other entries", Related: []string{"2"}}))
+		})
+
+		It("reports near duplicates", func() {
+			Expect(findings("3")).To(Equal([]audit.Finding{{Check: audit.CheckSimilar, Detail: "2 other entries", Related: []string{"1", "2"}}}))
+		})
+
+		It("reports empty passwords without other checks", func() {
+			Expect(findings("4")).To(Equal([]audit.Finding{{Check: audit.CheckEmpty}}))
+		})
+
+		It("reports short and weak passwords containing the title or username", func() {
+			var forum audit.EntryReport
+			for _, r := range report.Entries {
+				if r.UUID == "5" {
+					forum = r
+				}
+			}
+			Expect(checks(forum)).To(Equal([]string{audit.CheckShort, audit.CheckWeak, audit.CheckContainsTitle, audit.CheckContainsUsername}))
+		})
+
+		It("summarises the findings", func() {
+			Expect(report.Summary.Entries).To(Equal(6))
+			Expect(report.Summary.WithFindings).To(Equal(6))
+			Expect(report.Summary.Score).To(Equal(0))
+			Expect(report.Summary.Checks[audit.CheckEmpty]).To(Equal(1))
+			Expect(report.Summary.Checks[audit.CheckContainsUsername]).To(Equal(1))
+		})
+
+		It("never includes a password in the json", func() {
+			data, err := json.Marshal(report)
+			Expect(err).ToNot(HaveOccurred())
+			for _, password := range []string{"x7$Kq9!mPz#2Lw", "x7$Kq9!mPz#2Lx", "carolForum!"} {
+				Expect(string(data)).ToNot(ContainSubstring(password))
+			}
+		})
+	})
+
+	Context("when the similar check is disabled", func() {
+		It("does not compare passwords by edit distance", func() {
+			options := audit.DefaultOptions
+			options.MaxDistance = 0
+			report := run([]format.Entry{
+				entry("1", "Mail", "alice", "x7$Kq9!mPz#2Lw", false),
+				entry("2", "Shop", "alice", "x7$Kq9!mPz#2Lx", false),
+			}, options)
+			Expect(report.Entries).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,261 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/md4"
+)
+
+const (
+	//HashSHA1 passwords are hashed with SHA-1
+	HashSHA1 = "sha1"
+	//HashNTLM passwords are hashed with NTLM, MD4 of the UTF-16LE password
+	HashNTLM = "ntlm"
+
+	// k-anonymity ranges are named by the first characters of the hash
+	rangePrefixLength = 5
+	// longest line read from a hash file
+	maxHashLine = 256
+)
+
+// hex lengths of each hash
+var hashLengths = map[int]string{sha1.Size * 2: HashSHA1, md4.Size * 2: HashNTLM}
+
+//BreachedPasswords looks up how often passwords appear in breaches
+type BreachedPasswords interface {
+	// Count returns the times password was seen, 0 when it was not
+	Count(password string) (int, error)
+	Close() error
+}
+
+//OpenBreached opens a Pwned Passwords file of hashes ordered by hash or a
+//directory of k-anonymity range files named by hash prefix, laid out as the
+//range API serves them. SHA-1 or NTLM hashes are detected from the data.
+func OpenBreached(path string) (BreachedPasswords, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "breached passwords")
+	}
+	if fi.IsDir() {
+		return &rangeDirectory{dir: path}, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "breached passwords")
+	}
+	line, _, err := readLineAt(f, 0)
+	if err != nil {
+		f.Close()
+		return nil, errors.Wrapf(err, "breached passwords %s", path)
+	}
+	hash, _, err := parseHashLine(line)
+	if err != nil {
+		f.Close()
+		return nil, errors.Wrapf(err, "breached passwords %s", path)
+	}
+	return &hashFile{f: f, size: fi.Size(), hash: hashLengths[len(hash)]}, nil
+}
+
+//HashPassword returns the upper case hex hash used by Pwned Passwords
+func HashPassword(password, hash string) string {
+	var sum []byte
+	switch hash {
+	case HashNTLM:
+		h := md4.New()
+		for _, u := range utf16.Encode([]rune(password)) {
+			binary.Write(h, binary.LittleEndian, u)
+		}
+		sum = h.Sum(nil)
+	default:
+		s := sha1.Sum([]byte(password))
+		sum = s[:]
+	}
+	return strings.ToUpper(hex.EncodeToString(sum))
+}
+
+// hashFile is searched by bisecting byte offsets, only a few lines are read
+// for each lookup so the file can be many gigabytes
+type hashFile struct {
+	f    *os.File
+	size int64
+	hash string
+}
+
+func (h *hashFile) Count(password string) (int, error) {
+	target := HashPassword(password, h.hash)
+
+	// the line for target, when present, starts in [lo, hi)
+	lo, hi := int64(0), h.size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		line, start, err := h.lineFrom(mid)
+		if err != nil {
+			return 0, err
+		}
+		if line == nil || start >= hi {
+			hi = mid
+			continue
+		}
+
+		hash, count, err := parseHashLine(line)
+		if err != nil {
+			return 0, errors.Wrapf(err, "breached passwords offset %d", start)
+		}
+		switch strings.Compare(hash, target) {
+		case 0:
+			return count, nil
+		case -1:
+			lo = start + int64(len(line))
+		default:
+			hi = mid
+		}
+	}
+	return 0, nil
+}
+
+// lineFrom returns the first line starting at or after offset with its start
+func (h *hashFile) lineFrom(offset int64) ([]byte, int64, error) {
+	if offset > 0 {
+		// skip the rest of the line offset falls in
+		_, end, err := readLineAt(h.f, offset-1)
+		if err != nil {
+			return nil, 0, err
+		}
+		offset = end
+	}
+	if offset >= h.size {
+		return nil, offset, nil
+	}
+	line, _, err := readLineAt(h.f, offset)
+	return line, offset, err
+}
+
+func (h *hashFile) Close() error {
+	return h.f.Close()
+}
+
+// readLineAt returns the line from offset, including the newline, and the
+// offset after it
+func readLineAt(r io.ReaderAt, offset int64) ([]byte, int64, error) {
+	buf := make([]byte, maxHashLine)
+	n, err := r.ReadAt(buf, offset)
+	if err != nil && err != io.EOF {
+		return nil, 0, err
+	}
+	buf = buf[:n]
+	if i := bytes.IndexByte(buf, '\n'); i >= 0 {
+		buf = buf[:i+1]
+	} else if n == maxHashLine {
+		return nil, 0, errors.Errorf("line at offset %d is too long", offset)
+	}
+	return buf, offset + int64(len(buf)), nil
+}
+
+// parseHashLine parses HASH:COUNT
+func parseHashLine(line []byte) (string, int, error) {
+	s := strings.TrimSpace(string(line))
+	i := strings.IndexByte(s, ':')
+	if i < 0 {
+		return "", 0, errors.Errorf("invalid line: %q", s)
+	}
+	count, err := strconv.Atoi(s[i+1:])
+	if err != nil {
+		return "", 0, errors.Errorf("invalid count: %q", s)
+	}
+	hash := strings.ToUpper(s[:i])
+	if _, ok := hashLengths[len(hash)]; !ok {
+		return "", 0, errors.Errorf("invalid hash: %q", s)
+	}
+	return hash, count, nil
+}
+
+// rangeDirectory holds a file of hash suffixes for each hash prefix, the hash
+// is known from the length of the suffixes
+type rangeDirectory struct {
+	dir string
+}
+
+func (d *rangeDirectory) Count(password string) (int, error) {
+	for _, hash := range []string{HashSHA1, HashNTLM} {
+		target := HashPassword(password, hash)
+		prefix, suffix := target[:rangePrefixLength], target[rangePrefixLength:]
+
+		f, err := d.open(prefix)
+		if err != nil {
+			return 0, err
+		}
+		if f == nil {
+			continue
+		}
+
+		count, ok, err := searchRange(f, len(suffix), suffix)
+		f.Close()
+		if err != nil {
+			return 0, errors.Wrapf(err, "breached passwords range %s", prefix)
+		}
+		if ok {
+			return count, nil
+		}
+	}
+	return 0, nil
+}
+
+// open returns the range file of prefix, nil when there is none
+func (d *rangeDirectory) open(prefix string) (*os.File, error) {
+	for _, name := range []string{
+		filepath.Join(d.dir, "range", prefix),
+		filepath.Join(d.dir, prefix),
+		filepath.Join(d.dir, prefix+".txt"),
+		filepath.Join(d.dir, strings.ToLower(prefix)),
+	} {
+		f, err := os.Open(name)
+		if err == nil {
+			return f, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, errors.Wrap(err, "breached passwords")
+		}
+	}
+	return nil, nil
+}
+
+func (d *rangeDirectory) Close() error {
+	return nil
+}
+
+// searchRange scans a range for suffix, ok is false when the range holds
+// suffixes of another length so belongs to another hash
+func searchRange(r io.Reader, length int, suffix string) (count int, ok bool, err error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		s := strings.TrimSpace(scanner.Text())
+		if len(s) == 0 {
+			continue
+		}
+		i := strings.IndexByte(s, ':')
+		if i != length {
+			return 0, false, nil
+		}
+		if strings.EqualFold(s[:i], suffix) {
+			// padding lines have a count of 0
+			count, err := strconv.Atoi(s[i+1:])
+			if err != nil {
+				return 0, false, errors.Errorf("invalid count: %q", s)
+			}
+			return count, true, nil
+		}
+	}
+	return 0, true, scanner.Err()
+}
@@ -0,0 +1,125 @@
+package audit_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/simonhayward/gkeepassxreader/audit"
+	"github.com/simonhayward/gkeepassxreader/format"
+)
+
+var _ = Describe("Breached", func() {
+
+	// hashes of filler passwords and some known ones, seen i+1 times
+	hashes := func(hash string, known ...string) map[string]int {
+		counts := make(map[string]int)
+		for i := 0; i < 500; i++ {
+			counts[audit.HashPassword(fmt.Sprintf("filler-%d", i), hash)] = i + 1
+		}
+		for i, password := range known {
+			counts[audit.HashPassword(password, hash)] = 1000 + i
+		}
+		return counts
+	}
+
+	writeOrdered := func(name string, counts map[string]int) string {
+		var lines []string
+		for h, c := range counts {
+			lines = append(lines, fmt.Sprintf("%s:%d\r\n", h, c))
+		}
+		sort.Strings(lines)
+		path := filepath.Join(GinkgoT().TempDir(), name)
+		Expect(ioutil.WriteFile(path, []byte(strings.Join(lines, "")), 0600)).To(Succeed())
+		return path
+	}
+
+	writeRanges := func(counts map[string]int) string {
+		dir := GinkgoT().TempDir()
+		Expect(os.Mkdir(filepath.Join(dir, "range"), 0700)).To(Succeed())
+		ranges := make(map[string][]string)
+		for h, c := range counts {
+			ranges[h[:5]] = append(ranges[h[:5]], fmt.Sprintf("%s:%d\r\n", h[5:], c))
+		}
+		for prefix, lines := range ranges {
+			sort.Strings(lines)
+			Expect(ioutil.WriteFile(filepath.Join(dir, "range", prefix), []byte(strings.Join(lines, "")), 0600)).To(Succeed())
+		}
+		return dir
+	}
+
+	It("hashes passwords as Pwned Passwords does", func() {
+		Expect(audit.HashPassword("password", audit.HashSHA1)).To(Equal("5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8"))
+		Expect(audit.HashPassword("password", audit.HashNTLM)).To(Equal("8846F7EAEE8FB117AD06BDD830B7586C"))
+	})
+
+	for _, hash := range []string{audit.HashSHA1, audit.HashNTLM} {
+		hash := hash
+
+		Context("when searching an ordered "+hash+" file", func() {
+			It("returns the count of every breached password and 0 otherwise", func() {
+				counts := hashes(hash, "password", "letmein")
+				breached, err := audit.OpenBreached(writeOrdered("pwned.txt", counts))
+				Expect(err).ToNot(HaveOccurred())
+				defer breached.Close()
+
+				for i := 0; i < 500; i += 7 {
+					Expect(breached.Count(fmt.Sprintf("filler-%d", i))).To(Equal(i+1), fmt.Sprintf("filler-%d", i))
+				}
+				Expect(breached.Count("password")).To(Equal(1000))
+				Expect(breached.Count("letmein")).To(Equal(1001))
+				Expect(breached.Count("x7$Kq9!mPz#2Lw")).To(Equal(0))
+			})
+		})
+
+		Context("when searching a "+hash+" range directory", func() {
+			It("returns the count of every breached password and 0 otherwise", func() {
+				breached, err := audit.OpenBreached(writeRanges(hashes(hash, "password")))
+				Expect(err).ToNot(HaveOccurred())
+				defer breached.Close()
+
+				Expect(breached.Count("filler-42")).To(Equal(43))
+				Expect(breached.Count("password")).To(Equal(1000))
+				Expect(breached.Count("x7$Kq9!mPz#2Lw")).To(Equal(0))
+			})
+		})
+	}
+
+	It("treats padding lines as not breached", func() {
+		h := audit.HashPassword("password", audit.HashSHA1)
+		breached, err := audit.OpenBreached(writeRanges(map[string]int{h: 0}))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(breached.Count("password")).To(Equal(0))
+	})
+
+	It("rejects a file which is not a hash list", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "notes.txt")
+		Expect(ioutil.WriteFile(path, []byte("hello\n"), 0600)).To(Succeed())
+		_, err := audit.OpenBreached(path)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("reports breached passwords in an audit", func() {
+		breached, err := audit.OpenBreached(writeOrdered("pwned.txt", hashes(audit.HashSHA1, "x7$Kq9!mPz#2Lw")))
+		Expect(err).ToNot(HaveOccurred())
+		defer breached.Close()
+
+		options := audit.DefaultOptions
+		options.Breached = breached
+		report, err := audit.Audit([]format.Entry{{
+			UUID:     "1",
+			Title:    &format.EntryValue{PlainText: "Mail"},
+			Password: &format.EntryValue{PlainText: "x7$Kq9!mPz#2Lw"},
+		}}, options)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report.Entries).To(HaveLen(1))
+		Expect(report.Entries[0].Findings).To(Equal([]audit.Finding{{Check: audit.CheckBreached, Detail: "seen 1000 times"}}))
+		Expect(report.Summary.Checks[audit.CheckBreached]).To(Equal(1))
+	})
+})
@@ -0,0 +1,184 @@
+package audit
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/simonhayward/gkeepassxreader/format"
+)
+
+const day = 24 * time.Hour
+
+//ExpiringEntry is an entry which has expired or expires soon
+type ExpiringEntry struct {
+	UUID     string    `json:"uuid"`
+	Group    string    `json:"group"`
+	Title    string    `json:"title"`
+	Username string    `json:"username"`
+	Expiry   time.Time `json:"expiry"`
+	Expired  bool      `json:"expired"`
+	// whole days until expiry, negative once expired
+	Days int `json:"days"`
+}
+
+//StaleEntry is an entry whose password has not changed for a while
+type StaleEntry struct {
+	UUID            string    `json:"uuid"`
+	Group           string    `json:"group"`
+	Title           string    `json:"title"`
+	Username        string    `json:"username"`
+	PasswordChanged time.Time `json:"password_changed"`
+	// whole days since the password changed
+	Days int `json:"days"`
+}
+
+//ParseAge parses a number of days (30d), weeks (2w) or a duration (12h)
+func ParseAge(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	for suffix, unit := range map[string]time.Duration{"d": day, "w": 7 * day} {
+		if !strings.HasSuffix(s, suffix) {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(s, suffix))
+		if err != nil || n < 0 {
+			return 0, errors.Errorf("invalid age: %s", s)
+		}
+		return time.Duration(n) * unit, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, errors.Errorf("invalid age: %s", s)
+	}
+	return d, nil
+}
+
+//Expiring returns the entries which expired or expire within the given
+//duration of now, soonest first. Historical entries are ignored, an entry
+//which expires but whose expiry time could not be parsed is an error.
+func Expiring(entries []format.Entry, now time.Time, within time.Duration) ([]ExpiringEntry, error) {
+	expiring := []ExpiringEntry{}
+	for i := range entries {
+		e := &entries[i]
+		if e.Historical || !e.Times.Expires {
+			continue
+		}
+		if err := e.Times.Check(format.TimeExpiry); err != nil {
+			return nil, errors.Wrapf(err, "entry %s", e.UUID)
+		}
+		if e.Times.Expiry.After(now.Add(within)) {
+			continue
+		}
+		expiring = append(expiring, ExpiringEntry{
+			UUID:     e.UUID,
+			Group:    strings.Join(e.Path, "/"),
+			Title:    e.Title.String(),
+			Username: e.Username.String(),
+			Expiry:   e.Times.Expiry,
+			Expired:  !e.Times.Expiry.After(now),
+			Days:     days(e.Times.Expiry.Sub(now)),
+		})
+	}
+
+	sort.SliceStable(expiring, func(i, j int) bool {
+		return expiring[i].Expiry.Before(expiring[j].Expiry)
+	})
+	return expiring, nil
+}
+
+//Stale returns the entries whose password last changed more than the given
+//duration before now, oldest first. Entries must include history with
+//passwords decoded, see PasswordChanged.
+func Stale(entries []format.Entry, now time.Time, olderThan time.Duration) ([]StaleEntry, error) {
+	changed, err := PasswordChanged(entries)
+	if err != nil {
+		return nil, err
+	}
+
+	stale := []StaleEntry{}
+	for i := range entries {
+		e := &entries[i]
+		if e.Historical {
+			continue
+		}
+		t := changed[e.UUID]
+		if t.IsZero() || now.Sub(t) <= olderThan {
+			continue
+		}
+		stale = append(stale, StaleEntry{
+			UUID:            e.UUID,
+			Group:           strings.Join(e.Path, "/"),
+			Title:           e.Title.String(),
+			Username:        e.Username.String(),
+			PasswordChanged: t,
+			Days:            days(now.Sub(t)),
+		})
+	}
+
+	sort.SliceStable(stale, func(i, j int) bool {
+		return stale[i].PasswordChanged.Before(stale[j].PasswordChanged)
+	})
+	return stale, nil
+}
+
+//PasswordChanged returns when the current password of each entry was set, by
+//UUID. History is walked back from the current entry to the oldest version
+//with the same password, when no version has a different password the entry's
+//creation time is used. An entry whose creation or modification times could
+//not be parsed is an error.
+func PasswordChanged(entries []format.Entry) (map[string]time.Time, error) {
+	versions := make(map[string][]*format.Entry)
+	for i := range entries {
+		if err := entries[i].Times.Check(format.TimeCreated, format.TimeModified); err != nil {
+			return nil, errors.Wrapf(err, "entry %s", entries[i].UUID)
+		}
+		versions[entries[i].UUID] = append(versions[entries[i].UUID], &entries[i])
+	}
+
+	changed := make(map[string]time.Time)
+	for uuid, v := range versions {
+		var current *format.Entry
+		var history []*format.Entry
+		for _, e := range v {
+			if e.Historical {
+				history = append(history, e)
+			} else {
+				current = e
+			}
+		}
+		if current == nil {
+			continue
+		}
+
+		// newest first
+		sort.SliceStable(history, func(i, j int) bool {
+			return history[i].Times.Modified.After(history[j].Times.Modified)
+		})
+
+		t := current.Times.Modified
+		changedInHistory := false
+		for _, h := range history {
+			if h.Password.String() != current.Password.String() {
+				changedInHistory = true
+				break
+			}
+			t = h.Times.Modified
+		}
+		if !changedInHistory && !current.Times.Created.IsZero() {
+			t = current.Times.Created
+		}
+		changed[uuid] = t
+	}
+	return changed, nil
+}
+
+func days(d time.Duration) int {
+	if d < 0 {
+		return -int((-d) / day)
+	}
+	return int(d / day)
+}
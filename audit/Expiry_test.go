@@ -0,0 +1,129 @@
+package audit_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/simonhayward/gkeepassxreader/audit"
+	"github.com/simonhayward/gkeepassxreader/format"
+)
+
+var _ = Describe("Expiry", func() {
+
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	entry := func(uuid, title, password string, historical bool, times format.Times) format.Entry {
+		return format.Entry{
+			UUID:       uuid,
+			Path:       []string{"Root", "Email"},
+			Title:      &format.EntryValue{PlainText: title},
+			Password:   &format.EntryValue{PlainText: password},
+			Historical: historical,
+			Times:      times,
+		}
+	}
+
+	Context("when parsing an age", func() {
+		It("accepts days, weeks and durations", func() {
+			for s, d := range map[string]time.Duration{"30d": 30 * 24 * time.Hour, "2w": 14 * 24 * time.Hour, "12h": 12 * time.Hour, "0d": 0} {
+				age, err := audit.ParseAge(s)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(age).To(Equal(d))
+			}
+		})
+
+		It("rejects invalid ages", func() {
+			for _, s := range []string{"", "d", "-1d", "30x", "1.5d"} {
+				_, err := audit.ParseAge(s)
+				Expect(err).To(HaveOccurred(), s)
+			}
+		})
+	})
+
+	Context("when listing expiring entries", func() {
+		It("returns expired entries and those expiring within the duration soonest first", func() {
+			entries := []format.Entry{
+				entry("1", "Later", "a", false, format.Times{Expires: true, Expiry: now.Add(10 * 24 * time.Hour)}),
+				entry("2", "Expired", "b", false, format.Times{Expires: true, Expiry: now.Add(-3 * 24 * time.Hour)}),
+				entry("3", "Far", "c", false, format.Times{Expires: true, Expiry: now.Add(60 * 24 * time.Hour)}),
+				entry("4", "Never", "d", false, format.Times{Expiry: now.Add(-24 * time.Hour)}),
+				entry("2", "Expired", "b", true, format.Times{Expires: true, Expiry: now.Add(-30 * 24 * time.Hour)}),
+			}
+
+			expiring, err := audit.Expiring(entries, now, 30*24*time.Hour)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(expiring).To(HaveLen(2))
+			Expect(expiring[0]).To(Equal(audit.ExpiringEntry{UUID: "2", Group: "Root/Email", Title: "Expired",
+				Expiry: now.Add(-3 * 24 * time.Hour), Expired: true, Days: -3}))
+			Expect(expiring[1].Title).To(Equal("Later"))
+			Expect(expiring[1].Expired).To(BeFalse())
+			Expect(expiring[1].Days).To(Equal(10))
+		})
+
+		It("returns an empty list when nothing expires", func() {
+			expiring, err := audit.Expiring(nil, now, 0)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(expiring).To(BeEmpty())
+			Expect(expiring).ToNot(BeNil())
+		})
+
+		It("fails when the expiry time of an expiring entry is invalid", func() {
+			entries := []format.Entry{
+				entry("1", "Never", "a", false, format.Times{Invalid: []string{format.TimeExpiry}}),
+			}
+			_, err := audit.Expiring(entries, now, 0)
+			Expect(err).ToNot(HaveOccurred())
+
+			entries = append(entries, entry("2", "Broken", "b", false, format.Times{Expires: true, Invalid: []string{format.TimeExpiry}}))
+			_, err = audit.Expiring(entries, now, 0)
+			Expect(err).To(MatchError("entry 2: invalid ExpiryTime"))
+		})
+	})
+
+	Context("when finding when a password changed", func() {
+		It("walks history back to the last different password", func() {
+			entries := []format.Entry{
+				entry("1", "Mail", "new", false, format.Times{Created: now.AddDate(-3, 0, 0), Modified: now.AddDate(0, -1, 0)}),
+				entry("1", "Mail", "old", true, format.Times{Modified: now.AddDate(-2, 0, 0)}),
+				entry("1", "Mail", "new", true, format.Times{Modified: now.AddDate(-1, 0, 0)}),
+			}
+			Expect(audit.PasswordChanged(entries)).To(Equal(map[string]time.Time{"1": now.AddDate(-1, 0, 0)}))
+		})
+
+		It("uses the creation time when the password never changed", func() {
+			entries := []format.Entry{
+				entry("1", "Mail", "same", false, format.Times{Created: now.AddDate(-3, 0, 0), Modified: now.AddDate(0, -1, 0)}),
+				entry("1", "Mail", "same", true, format.Times{Modified: now.AddDate(-2, 0, 0)}),
+			}
+			Expect(audit.PasswordChanged(entries)).To(Equal(map[string]time.Time{"1": now.AddDate(-3, 0, 0)}))
+		})
+	})
+
+	Context("when listing stale entries", func() {
+		It("returns passwords older than the duration oldest first", func() {
+			entries := []format.Entry{
+				entry("1", "Recent", "a", false, format.Times{Created: now.AddDate(0, -1, 0), Modified: now.AddDate(0, -1, 0)}),
+				entry("2", "Old", "b", false, format.Times{Created: now.AddDate(-2, 0, 0), Modified: now.AddDate(0, -1, 0)}),
+				entry("3", "Older", "c", false, format.Times{Created: now.AddDate(-3, 0, 0), Modified: now.AddDate(0, -2, 0)}),
+			}
+
+			stale, err := audit.Stale(entries, now, 365*24*time.Hour)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stale).To(HaveLen(2))
+			Expect(stale[0].Title).To(Equal("Older"))
+			Expect(stale[1]).To(Equal(audit.StaleEntry{UUID: "2", Group: "Root/Email", Title: "Old",
+				PasswordChanged: now.AddDate(-2, 0, 0), Days: 731}))
+		})
+
+		It("fails when a modification time in history is invalid", func() {
+			entries := []format.Entry{
+				entry("1", "Mail", "new", false, format.Times{Created: now.AddDate(-3, 0, 0), Modified: now.AddDate(0, -1, 0)}),
+				entry("1", "Mail", "old", true, format.Times{Invalid: []string{format.TimeModified}}),
+			}
+			_, err := audit.Stale(entries, now, 365*24*time.Hour)
+			Expect(err).To(MatchError("entry 1: invalid LastModificationTime"))
+		})
+	})
+})
@@ -0,0 +1,213 @@
+package audit
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+//Strength of a password estimated from the cheapest way to guess it, in the
+//manner of zxcvbn
+type Strength struct {
+	// log2 of the estimated guesses
+	Entropy float64 `json:"entropy"`
+	// 0 (too guessable) to 4 (very unguessable)
+	Score int `json:"score"`
+}
+
+// keyboard rows searched for runs such as qwerty or 7410
+var keyboardRows = []string{
+	"`1234567890-=", "qwertyuiop[]\\", "asdfghjkl;'", "zxcvbnm,./",
+	"1qaz", "2wsx", "3edc", "4rfv", "5tgb", "6yhn", "7ujm", "8ik,", "9ol.", "0p;/",
+	"789", "456", "123", "741", "852", "963", "0123456789",
+}
+
+var l33t = strings.NewReplacer("4", "a", "@", "a", "8", "b", "(", "c", "3", "e", "6", "g", "1", "i", "!", "i", "|", "l",
+	"0", "o", "$", "s", "5", "s", "7", "t", "+", "t", "2", "z")
+
+const (
+	minMatchLength = 3
+	yearGuesses    = 120
+)
+
+//PasswordStrength estimates the strength of a password. The password is split
+//into the sequence of dictionary words, repeats, sequences, keyboard runs,
+//years and brute forced characters needing the fewest guesses. User inputs,
+//such as the title and username, are guessed before any dictionary word.
+func PasswordStrength(password string, userInputs ...string) Strength {
+	runes := []rune(password)
+	n := len(runes)
+	if n == 0 {
+		return Strength{}
+	}
+
+	cardinality := float64(bruteForceCardinality(runes))
+
+	inputs := make(map[string]bool)
+	for _, input := range userInputs {
+		if len(input) > 0 {
+			inputs[strings.ToLower(input)] = true
+		}
+	}
+
+	// best[i] is the fewest log10 guesses for runes[:i] split into segments[i]
+	best := make([]float64, n+1)
+	segments := make([]int, n+1)
+	for i := 1; i <= n; i++ {
+		best[i] = math.Inf(1)
+		for j := 0; j < i; j++ {
+			guesses := math.Log10(cardinality) * float64(i-j)
+			if i-j >= minMatchLength {
+				if g, ok := matchGuesses(runes[j:i], cardinality, inputs); ok && g < guesses {
+					guesses = g
+				}
+			}
+			total := best[j] + guesses
+			// each extra segment adds to the ways the pieces can be combined
+			if segments[j] > 0 {
+				total += math.Log10(float64(segments[j] + 1))
+			}
+			if total < best[i] {
+				best[i], segments[i] = total, segments[j]+1
+			}
+		}
+	}
+
+	log10 := best[n]
+	return Strength{Entropy: math.Round(log10*math.Log2(10)*10) / 10, Score: score(log10)}
+}
+
+// matchGuesses returns the log10 guesses of the whole of s as a single pattern
+func matchGuesses(s []rune, cardinality float64, inputs map[string]bool) (float64, bool) {
+	word := string(s)
+	lower := strings.ToLower(word)
+	guesses := math.Inf(1)
+	found := false
+
+	variations := 0.0
+	if lower != word {
+		// capitalised or upper case words are tried first
+		variations = math.Log10(2)
+		if strings.ToUpper(word) != word && !unicode.IsUpper(s[0]) {
+			variations = math.Log10(float64(len(s)))
+		}
+	}
+
+	wordRank := func(word string) (int, bool) {
+		if inputs[word] {
+			return 1, true
+		}
+		r, ok := commonWords[word]
+		return r, ok
+	}
+
+	if rank, ok := wordRank(lower); ok {
+		guesses, found = math.Log10(float64(rank))+variations, true
+	}
+	if unl33t := l33t.Replace(lower); unl33t != lower {
+		if rank, ok := wordRank(unl33t); ok {
+			guesses, found = math.Min(guesses, math.Log10(float64(rank))+variations+math.Log10(float64(len(s)))), true
+		}
+	}
+
+	if isRepeat(s) {
+		guesses, found = math.Min(guesses, math.Log10(cardinality*float64(len(s)))), true
+	}
+	if isSequence(s) {
+		guesses, found = math.Min(guesses, math.Log10(26*float64(len(s)))), true
+	}
+	if isKeyboardRun(lower) {
+		guesses, found = math.Min(guesses, math.Log10(40*float64(len(s)))+variations), true
+	}
+	if isYear(word) {
+		guesses, found = math.Min(guesses, math.Log10(yearGuesses)), true
+	}
+
+	return guesses, found
+}
+
+func isRepeat(s []rune) bool {
+	for _, r := range s[1:] {
+		if r != s[0] {
+			return false
+		}
+	}
+	return true
+}
+
+func isSequence(s []rune) bool {
+	step := s[1] - s[0]
+	if step != 1 && step != -1 {
+		return false
+	}
+	for i := 2; i < len(s); i++ {
+		if s[i]-s[i-1] != step {
+			return false
+		}
+	}
+	return true
+}
+
+func isKeyboardRun(s string) bool {
+	reversed := []rune(s)
+	for i, j := 0, len(reversed)-1; i < j; i, j = i+1, j-1 {
+		reversed[i], reversed[j] = reversed[j], reversed[i]
+	}
+	for _, row := range keyboardRows {
+		if strings.Contains(row, s) || strings.Contains(row, string(reversed)) {
+			return true
+		}
+	}
+	return false
+}
+
+func isYear(s string) bool {
+	return len(s) == 4 && (strings.HasPrefix(s, "19") || strings.HasPrefix(s, "20")) &&
+		strings.IndexFunc(s, func(r rune) bool { return r < '0' || r > '9' }) < 0
+}
+
+// bruteForceCardinality is the size of the alphabet of the character classes used
+func bruteForceCardinality(s []rune) int {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < unicode.MaxASCII:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	cardinality := 0
+	for _, class := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.used {
+			cardinality += class.size
+		}
+	}
+	return cardinality
+}
+
+// score uses the zxcvbn thresholds on log10 guesses
+func score(log10 float64) int {
+	switch {
+	case log10 < 3:
+		return 0
+	case log10 < 6:
+		return 1
+	case log10 < 8:
+		return 2
+	case log10 < 10:
+		return 3
+	default:
+		return 4
+	}
+}
@@ -0,0 +1,35 @@
+package audit_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/simonhayward/gkeepassxreader/audit"
+)
+
+var _ = Describe("Strength", func() {
+
+	It("scores an empty password zero", func() {
+		Expect(audit.PasswordStrength("")).To(Equal(audit.Strength{}))
+	})
+
+	It("scores common passwords and patterns as too guessable", func() {
+		for _, password := range []string{"password", "P@ssw0rd", "Password1", "qwerty123", "aaaaaaaaaaaa", "abcdef", "2019"} {
+			Expect(audit.PasswordStrength(password).Score).To(Equal(0), password)
+		}
+	})
+
+	It("scores long random passwords and passphrases as very unguessable", func() {
+		for _, password := range []string{"x7$Kq9!mPz#2Lw", "correcthorsebatterystaple"} {
+			Expect(audit.PasswordStrength(password).Score).To(Equal(4), password)
+		}
+	})
+
+	It("guesses user inputs first", func() {
+		Expect(audit.PasswordStrength("carolForum!", "Forum", "carol").Score).To(BeNumerically("<", audit.PasswordStrength("carolForum!").Score))
+	})
+
+	It("scores a common word less than random characters of the same length", func() {
+		Expect(audit.PasswordStrength("sunshine").Entropy).To(BeNumerically("<", audit.PasswordStrength("snuhsien").Entropy))
+	})
+})
@@ -0,0 +1,31 @@
+package audit
+
+// the most common passwords and words, most common first
+var commonWordList = []string{
+	"123456", "password", "12345678", "qwerty", "123456789", "12345", "1234", "111111", "1234567", "dragon",
+	"123123", "baseball", "abc123", "football", "monkey", "letmein", "696969", "shadow", "master", "666666",
+	"qwertyuiop", "123321", "mustang", "1234567890", "michael", "654321", "superman", "1qaz2wsx", "7777777", "121212",
+	"000000", "qazwsx", "123qwe", "killer", "trustno1", "jordan", "jennifer", "zxcvbnm", "asdfgh", "hunter",
+	"buster", "soccer", "harley", "batman", "andrew", "tigger", "sunshine", "iloveyou", "2000", "charlie",
+	"robert", "thomas", "hockey", "ranger", "daniel", "starwars", "klaster", "112233", "george", "computer",
+	"michelle", "jessica", "pepper", "1111", "zxcvbn", "555555", "11111111", "131313", "freedom", "777777",
+	"pass", "maggie", "159753", "aaaaaa", "ginger", "princess", "joshua", "cheese", "amanda", "summer",
+	"love", "ashley", "nicole", "chelsea", "biteme", "matthew", "access", "yankees", "987654321", "dallas",
+	"austin", "thunder", "taylor", "matrix", "admin", "welcome", "login", "passw0rd", "secret", "changeme",
+	"default", "root", "toor", "guest", "test", "user", "hello", "flower", "money", "shadow1",
+	"winter", "spring", "autumn", "monday", "friday", "january", "london", "paris", "berlin", "google",
+	"facebook", "apple", "samsung", "microsoft", "linux", "windows", "server", "oracle", "mysql", "database",
+	"company", "office", "family", "orange", "purple", "yellow", "silver", "golden", "diamond", "angel",
+	"lovely", "happy", "baby", "girl", "boy", "king", "queen", "star", "life", "cookie",
+}
+
+// commonWords ranks each common word, 1 is the most common
+var commonWords = func() map[string]int {
+	words := make(map[string]int, len(commonWordList))
+	for i, w := range commonWordList {
+		if _, ok := words[w]; !ok {
+			words[w] = i + 1
+		}
+	}
+	return words
+}()
@@ -1,7 +1,13 @@
 package core
 
 import (
+	"context"
+	"crypto/rand"
+
+	"github.com/pkg/errors"
+	"github.com/simonhayward/gkeepassxreader/cryptos"
 	"github.com/simonhayward/gkeepassxreader/keys"
+	"github.com/simonhayward/gkeepassxreader/secure"
 )
 
 //UUID represents the unqiue identifier
@@ -37,6 +43,8 @@ type Database struct {
 	TransformRounds      uint64
 	TransformedMasterKey []byte
 	Key                  *keys.CompositeKey
+	LegacyKey            bool
+	transformedKey       *secure.LockedBuffer
 }
 
 // NewDatabase with default values
@@ -52,18 +60,75 @@ func NewDatabase() *Database {
 
 //SetKey sets up key transformation
 func (d *Database) SetKey(key *keys.CompositeKey, transformSeed []byte) error {
+	return d.SetKeyContext(context.Background(), key, transformSeed, nil)
+}
+
+//SetKeyContext is SetKey stopping early with ctx's error when ctx is done,
+//progress is called with the transform rounds done when not nil
+func (d *Database) SetKeyContext(ctx context.Context, key *keys.CompositeKey, transformSeed []byte, progress cryptos.RoundsProgress) error {
 
 	var transformedMasterKey []byte
 
-	transformedMasterKey, err := key.Transform(transformSeed, d.TransformRounds)
+	transform := key.TransformContext
+	if d.LegacyKey {
+		transform = key.TransformLegacyContext
+	}
+
+	transformedMasterKey, err := transform(ctx, transformSeed, d.TransformRounds, progress)
 
 	if err != nil {
 		return err
 	}
 
+	if err := d.SetTransformedMasterKey(transformedMasterKey); err != nil {
+		return err
+	}
+
 	d.Key = key
 	d.TransformSeed = transformSeed
-	d.TransformedMasterKey = transformedMasterKey
 
 	return nil
 }
+
+//Rekey replaces the composite key, a new transform seed is generated and the
+//previous key wiped
+func (d *Database) Rekey(key *keys.CompositeKey) error {
+	transformSeed := make([]byte, 32)
+	if _, err := rand.Read(transformSeed); err != nil {
+		return errors.Wrap(err, "unable to generate transform seed")
+	}
+
+	previous := d.Key
+	if err := d.SetKey(key, transformSeed); err != nil {
+		return err
+	}
+	if previous != nil && previous != key {
+		previous.Wipe()
+	}
+	return nil
+}
+
+//SetTransformedMasterKey moves the key into locked memory
+func (d *Database) SetTransformedMasterKey(key []byte) error {
+	buf, err := secure.NewLockedBufferFromBytes(key)
+	if err != nil {
+		return err
+	}
+
+	d.transformedKey.Destroy()
+	d.transformedKey = buf
+	d.TransformedMasterKey = buf.Bytes()
+
+	return nil
+}
+
+//Wipe destroys the transformed master key and the composite key
+func (d *Database) Wipe() {
+	d.transformedKey.Destroy()
+	d.transformedKey = nil
+	d.TransformedMasterKey = nil
+
+	if d.Key != nil {
+		d.Key.Wipe()
+	}
+}
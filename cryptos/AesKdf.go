@@ -0,0 +1,171 @@
+package cryptos
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"fmt"
+	"runtime"
+
+	"github.com/simonhayward/gkeepassxreader/secure"
+)
+
+const (
+	// AES-KDF transforms a 32 byte key as two independent 16 byte blocks
+	aesKdfKeySize = 2 * aes.BlockSize
+	// rounds between checks for cancellation, a few milliseconds of work
+	aesKdfBatch = 1 << 16
+	// rounds of each unrolled step
+	aesKdfUnroll = 8
+)
+
+//RoundsProgress is called with the rounds done so far
+type RoundsProgress func(done uint64)
+
+//KeyTransformer transforms a whole key, stopping early when ctx is done.
+//Progress may be nil.
+type KeyTransformer interface {
+	TransformKey(ctx context.Context, key []byte, seed []byte, rounds uint64, progress RoundsProgress) ([]byte, error)
+}
+
+//TransformKey encrypts both halves of the key rounds times
+func (a *AesEcbEncrypter) TransformKey(ctx context.Context, key []byte, seed []byte, rounds uint64, progress RoundsProgress) ([]byte, error) {
+	return AesKdf(ctx, key, seed, rounds, progress)
+}
+
+//AesKdf encrypts both 16 byte halves of a 32 byte key with AES-256 in ECB
+//mode, keyed by the seed, rounds times. When GOMAXPROCS allows, each half is
+//encrypted on its own goroutine, otherwise the halves are encrypted in turn so
+//the two independent chains overlap in the CPU. ctx is checked and progress,
+//when not nil, called between batches of rounds.
+func AesKdf(ctx context.Context, key []byte, seed []byte, rounds uint64, progress RoundsProgress) ([]byte, error) {
+	if len(key) != aesKdfKeySize {
+		return nil, fmt.Errorf("key size error, expected: %d received: %d", aesKdfKeySize, len(key))
+	}
+
+	block, err := aes.NewCipher(seed)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create cipher block: %s", err)
+	}
+
+	// fixed size arrays so slicing them needs no bounds checks
+	var left, right [aes.BlockSize]byte
+	copy(left[:], key[:aes.BlockSize])
+	copy(right[:], key[aes.BlockSize:])
+	l, r := left[:], right[:]
+
+	if runtime.GOMAXPROCS(0) > 1 {
+		err = aesKdfParallel(ctx, block, seed, l, r, rounds, progress)
+	} else {
+		err = aesKdfBatches(ctx, rounds, progress, func(batch uint64) {
+			aesKdfInterleaved(block, l, r, batch)
+		})
+	}
+	if err != nil {
+		secure.Wipe(l)
+		secure.Wipe(r)
+		return nil, err
+	}
+
+	result := make([]byte, 0, aesKdfKeySize)
+	result = append(result, left[:]...)
+	result = append(result, right[:]...)
+	secure.Wipe(l)
+	secure.Wipe(r)
+	return result, nil
+}
+
+// aesKdfParallel encrypts the left half on another goroutine with its own
+// cipher.Block, progress follows the right half
+func aesKdfParallel(ctx context.Context, block cipher.Block, seed, l, r []byte, rounds uint64, progress RoundsProgress) error {
+	leftBlock, err := aes.NewCipher(seed)
+	if err != nil {
+		return fmt.Errorf("unable to create cipher block: %s", err)
+	}
+
+	leftErr := make(chan error, 1)
+	go func() {
+		leftErr <- aesKdfBatches(ctx, rounds, nil, func(batch uint64) {
+			aesKdfChain(leftBlock, l, batch)
+		})
+	}()
+	err = aesKdfBatches(ctx, rounds, progress, func(batch uint64) {
+		aesKdfChain(block, r, batch)
+	})
+	if errLeft := <-leftErr; err == nil {
+		err = errLeft
+	}
+	return err
+}
+
+// aesKdfBatches calls transform with batches of the rounds, checking ctx and
+// reporting progress in between
+func aesKdfBatches(ctx context.Context, rounds uint64, progress RoundsProgress, transform func(batch uint64)) error {
+	done := ctx.Done()
+	var completed uint64
+	for rounds > 0 {
+		if done != nil {
+			select {
+			case <-done:
+				return ctx.Err()
+			default:
+			}
+		}
+
+		batch := uint64(aesKdfBatch)
+		if rounds < batch {
+			batch = rounds
+		}
+		rounds -= batch
+		transform(batch)
+
+		completed += batch
+		if progress != nil {
+			progress(completed)
+		}
+	}
+	return nil
+}
+
+// aesKdfInterleaved encrypts both halves rounds times, in turn
+func aesKdfInterleaved(block cipher.Block, l, r []byte, rounds uint64) {
+	for n := rounds / aesKdfUnroll; n > 0; n-- {
+		block.Encrypt(l, l)
+		block.Encrypt(r, r)
+		block.Encrypt(l, l)
+		block.Encrypt(r, r)
+		block.Encrypt(l, l)
+		block.Encrypt(r, r)
+		block.Encrypt(l, l)
+		block.Encrypt(r, r)
+		block.Encrypt(l, l)
+		block.Encrypt(r, r)
+		block.Encrypt(l, l)
+		block.Encrypt(r, r)
+		block.Encrypt(l, l)
+		block.Encrypt(r, r)
+		block.Encrypt(l, l)
+		block.Encrypt(r, r)
+	}
+	for n := rounds % aesKdfUnroll; n > 0; n-- {
+		block.Encrypt(l, l)
+		block.Encrypt(r, r)
+	}
+}
+
+// aesKdfChain encrypts one half rounds times
+func aesKdfChain(block cipher.Block, b []byte, rounds uint64) {
+	for n := rounds / aesKdfUnroll; n > 0; n-- {
+		block.Encrypt(b, b)
+		block.Encrypt(b, b)
+		block.Encrypt(b, b)
+		block.Encrypt(b, b)
+		block.Encrypt(b, b)
+		block.Encrypt(b, b)
+		block.Encrypt(b, b)
+		block.Encrypt(b, b)
+	}
+	for n := rounds % aesKdfUnroll; n > 0; n-- {
+		block.Encrypt(b, b)
+	}
+}
@@ -0,0 +1,156 @@
+package cryptos_test
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/simonhayward/gkeepassxreader/cryptos"
+)
+
+// rounds of the default KeePassXC 2.x AES-KDF benchmark
+const benchmarkRounds = uint64(6000000)
+
+var (
+	kdfKey = []byte{
+		0x60, 0x3d, 0xeb, 0x10, 0x15, 0xca, 0x71, 0xbe, 0x2b, 0x73, 0xae, 0xf0, 0x85, 0x7d, 0x77, 0x81,
+		0x1f, 0x35, 0x2c, 0x07, 0x3b, 0x61, 0x08, 0xd7, 0x2d, 0x98, 0x10, 0xa3, 0x09, 0x14, 0xdf, 0xf4,
+	}
+	kdfSeed = []byte("abcdefghijklmnopqrstuvwxyz123456")
+)
+
+// encodeHalves is the transform as CompositeKey ran it before AesKdf
+func encodeHalves(key, seed []byte, rounds uint64) ([]byte, error) {
+	var left, right []byte
+	var errLeft, errRight error
+	var wg sync.WaitGroup
+	encrypter := &cryptos.AesEcbEncrypter{}
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		errLeft = encrypter.Encode(key[:16], seed, rounds, &left)
+	}()
+	go func() {
+		defer wg.Done()
+		errRight = encrypter.Encode(key[16:], seed, rounds, &right)
+	}()
+	wg.Wait()
+
+	if errLeft != nil {
+		return nil, errLeft
+	}
+	if errRight != nil {
+		return nil, errRight
+	}
+	return append(left, right...), nil
+}
+
+// withGOMAXPROCS runs fn with the halves interleaved when procs is 1 and on
+// separate goroutines otherwise
+func withGOMAXPROCS(procs int, fn func()) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(procs))
+	fn()
+}
+
+var _ = Describe("AesKdf", func() {
+
+	DescribeTable("matches Encode of both halves",
+		func(procs int, rounds uint64) {
+			expected, err := encodeHalves(kdfKey, kdfSeed, rounds)
+			Expect(err).ToNot(HaveOccurred())
+
+			withGOMAXPROCS(procs, func() {
+				out, err := cryptos.AesKdf(context.Background(), kdfKey, kdfSeed, rounds, nil)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(out).To(Equal(expected))
+			})
+		},
+		Entry("one round", 1, uint64(1)),
+		Entry("less than one unrolled step", 1, uint64(7)),
+		Entry("not a multiple of the unrolled step", 1, uint64(6003)),
+		Entry("more than one batch", 1, uint64(1<<16+13)),
+		Entry("one round in parallel", 2, uint64(1)),
+		Entry("not a multiple of the unrolled step in parallel", 2, uint64(6003)),
+		Entry("more than one batch in parallel", 2, uint64(1<<16+13)),
+	)
+
+	It("does not change the key", func() {
+		key := append([]byte(nil), kdfKey...)
+		_, err := cryptos.AesKdf(context.Background(), key, kdfSeed, 100, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(key).To(Equal(kdfKey))
+	})
+
+	It("returns the key for zero rounds", func() {
+		out, err := cryptos.AesKdf(context.Background(), kdfKey, kdfSeed, 0, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(out).To(Equal(kdfKey))
+	})
+
+	It("returns an error for an invalid key or seed", func() {
+		_, err := cryptos.AesKdf(context.Background(), kdfKey[:16], kdfSeed, 100, nil)
+		Expect(err).To(HaveOccurred())
+		_, err = cryptos.AesKdf(context.Background(), kdfKey, kdfSeed[:3], 100, nil)
+		Expect(err).To(HaveOccurred())
+	})
+
+	DescribeTable("stops when the context is cancelled",
+		func(procs int) {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			withGOMAXPROCS(procs, func() {
+				out, err := cryptos.AesKdf(ctx, kdfKey, kdfSeed, 1<<40, nil)
+				Expect(err).To(MatchError(context.Canceled))
+				Expect(out).To(BeNil())
+			})
+		},
+		Entry("interleaved", 1),
+		Entry("in parallel", 2),
+	)
+
+	DescribeTable("reports the rounds done after each batch",
+		func(procs int) {
+			var done []uint64
+			withGOMAXPROCS(procs, func() {
+				_, err := cryptos.AesKdf(context.Background(), kdfKey, kdfSeed, 2<<16+5, func(n uint64) {
+					done = append(done, n)
+				})
+				Expect(err).ToNot(HaveOccurred())
+			})
+			Expect(done).To(Equal([]uint64{1 << 16, 2 << 16, 2<<16 + 5}))
+		},
+		Entry("interleaved", 1),
+		Entry("in parallel", 2),
+	)
+
+	It("is used by AesEcbEncrypter as a KeyTransformer", func() {
+		var t cryptos.KeyTransformer = &cryptos.AesEcbEncrypter{}
+		out, err := t.TransformKey(context.Background(), kdfKey, kdfSeed, 1000, nil)
+		Expect(err).ToNot(HaveOccurred())
+		expected, _ := encodeHalves(kdfKey, kdfSeed, 1000)
+		Expect(out).To(Equal(expected))
+	})
+})
+
+// BenchmarkAesKdf interleaves the halves with -cpu 1 and runs them in parallel
+// otherwise, compare with BenchmarkEncode using -cpu 1,2,4
+func BenchmarkAesKdf(b *testing.B) {
+	ctx := context.Background()
+	for i := 0; i < b.N; i++ {
+		if _, err := cryptos.AesKdf(ctx, kdfKey, kdfSeed, benchmarkRounds, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncode(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		if _, err := encodeHalves(kdfKey, kdfSeed, benchmarkRounds); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
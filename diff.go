@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/simonhayward/gkeepassxreader/diff"
+	"github.com/simonhayward/gkeepassxreader/output"
+	log "github.com/sirupsen/logrus"
+)
+
+func diffDatabases(a, b *os.File, secrets string, asJSON bool) {
+	keyA := sharedKey(masterKey)
+	readerA := openDatabaseFile(a, keyA)
+	defer readerA.Close()
+
+	// the second database shares the first's key unless its own is given
+	readerB := openDatabaseFile(b, diffBCredentials.key(b.Name(), keyA))
+	defer readerB.Close()
+
+	snapshotA, err := diff.NewSnapshot(readerA.XMLReader)
+	if err != nil {
+		log.Fatalf("diff error: %s: %s", a.Name(), err)
+	}
+	snapshotB, err := diff.NewSnapshot(readerB.XMLReader)
+	if err != nil {
+		log.Fatalf("diff error: %s: %s", b.Name(), err)
+	}
+
+	// both databases are hashed with the first's key so their hashes match
+	hashed := diff.NewSecrets(secrets, readerA.Db.TransformedMasterKey)
+	defer hashed.Wipe()
+
+	report := diff.Compare(snapshotA, snapshotB, hashed)
+
+	if asJSON {
+		writeJSON(report)
+		return
+	}
+
+	if report.Empty() {
+		fmt.Println("no differences")
+		return
+	}
+
+	if len(report.Groups) > 0 {
+		fields := &output.Data{Header: []string{"Change", "Group", "Field", "Old", "New"}}
+		for _, g := range report.Groups {
+			fields.Data = append(fields.Data, changeRows([]string{g.Change, g.Path}, g.Fields)...)
+		}
+		output.Table(fields.Header, fields.Data)
+	}
+
+	if len(report.Entries) > 0 {
+		fields := &output.Data{Header: []string{"Change", "Group", "Title", "Field", "Old", "New"}}
+		for _, e := range report.Entries {
+			fields.Data = append(fields.Data, changeRows([]string{e.Change, e.Group, e.Title}, e.Fields)...)
+		}
+		output.Table(fields.Header, fields.Data)
+	}
+
+	fmt.Printf("%d groups and %d entries changed\n", len(report.Groups), len(report.Entries))
+}
+
+// changeRows returns a row per changed field, the leading columns are only
+// filled in on the first
+func changeRows(columns []string, changes []diff.FieldChange) [][]string {
+	if len(changes) == 0 {
+		return [][]string{append(columns, "", "", "")}
+	}
+
+	var rows [][]string
+	for i, c := range changes {
+		row := make([]string, len(columns))
+		if i == 0 {
+			copy(row, columns)
+		}
+		rows = append(rows, append(row, c.Field, c.Old, c.New))
+	}
+	return rows
+}
+
+// textconv writes the database as text for git, which passes the file to convert
+func textconv(f *os.File, secrets string) {
+	reader := openDatabaseFile(f, masterKey)
+	defer reader.Close()
+
+	snapshot, err := diff.NewSnapshot(reader.XMLReader)
+	if err != nil {
+		log.Fatalf("textconv error: %s", err)
+	}
+
+	hashed := diff.NewSecrets(secrets, reader.Db.TransformedMasterKey)
+	defer hashed.Wipe()
+
+	if err := diff.Dump(os.Stdout, snapshot, hashed); err != nil {
+		log.Fatalf("textconv error: %s", err)
+	}
+}
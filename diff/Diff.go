@@ -0,0 +1,375 @@
+package diff
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/simonhayward/gkeepassxreader/format"
+	"github.com/simonhayward/gkeepassxreader/secure"
+)
+
+const (
+	//SecretsMask replaces secrets with asterisks
+	SecretsMask = "mask"
+	//SecretsHash shows a truncated keyed hash of secrets so changes are visible
+	SecretsHash = "hash"
+	//SecretsReveal shows secrets in plain text
+	SecretsReveal = "reveal"
+)
+
+//SecretModes supported by Compare and Dump
+var SecretModes = []string{SecretsMask, SecretsHash, SecretsReveal}
+
+//Secrets is how secrets are shown. Hashes are HMAC-SHA256 keyed by the
+//transformed master key of a database, so a weak password can't be looked up
+//and hashes only match those made with the same key, i.e. the same master key
+//and transform seed.
+type Secrets struct {
+	Mode string
+	key  []byte
+}
+
+//NewSecrets shows secrets in mode, hashed with a key derived from the
+//transformed master key
+func NewSecrets(mode string, transformedMasterKey []byte) *Secrets {
+	mac := hmac.New(sha256.New, transformedMasterKey)
+	mac.Write([]byte(secretsHashContext))
+	return &Secrets{Mode: mode, key: mac.Sum(nil)}
+}
+
+//Wipe destroys the hash key
+func (s *Secrets) Wipe() {
+	secure.Wipe(s.key)
+}
+
+// mode is mask unless secrets are configured
+func (s *Secrets) mode() string {
+	if s == nil {
+		return SecretsMask
+	}
+	return s.Mode
+}
+
+// hash returns the truncated keyed hash of data
+func (s *Secrets) hash(data []byte) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write(data)
+	return "hmac:" + hex.EncodeToString(mac.Sum(nil))[:hashLength]
+}
+
+const (
+	//ChangeAdded only exists in the second database
+	ChangeAdded = "added"
+	//ChangeRemoved only exists in the first database
+	ChangeRemoved = "removed"
+	//ChangeMoved only the group or parent group changed
+	ChangeMoved = "moved"
+	//ChangeModified fields changed, possibly along with the group
+	ChangeModified = "modified"
+)
+
+const (
+	// field names reported for group changes and moved entries
+	fieldGroup  = "Group"
+	fieldName   = "Name"
+	fieldParent = "Parent"
+	fieldTags   = "Tags"
+
+	attachmentPrefix = "Attachment "
+	mask             = "********"
+	hashLength       = 12
+
+	// derives the hash key from the transformed master key, which isn't used
+	// as is
+	secretsHashContext = "gkeepassxreader secrets hash"
+)
+
+//FieldChange is a single changed value, secrets are shown as configured
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+//GroupChange describes an added, removed, moved or renamed group
+type GroupChange struct {
+	Change string        `json:"change"`
+	UUID   string        `json:"uuid"`
+	Path   string        `json:"path"`
+	Fields []FieldChange `json:"fields,omitempty"`
+}
+
+//EntryChange describes an added, removed, moved or modified entry
+type EntryChange struct {
+	Change string        `json:"change"`
+	UUID   string        `json:"uuid"`
+	Group  string        `json:"group"`
+	Title  string        `json:"title"`
+	Fields []FieldChange `json:"fields,omitempty"`
+}
+
+//Report lists the changes from one database to another
+type Report struct {
+	Groups  []GroupChange `json:"groups"`
+	Entries []EntryChange `json:"entries"`
+}
+
+//Empty reports whether the databases are the same
+func (r *Report) Empty() bool {
+	return len(r.Groups) == 0 && len(r.Entries) == 0
+}
+
+//Snapshot is the current content of a database, historical entries are not included
+type Snapshot struct {
+	Groups  []format.Group
+	Entries []format.Entry
+}
+
+//NewSnapshot lists the groups and entries, every protected value is decrypted
+func NewSnapshot(xmlReader *format.KeePass2XmlReader) (*Snapshot, error) {
+	groups, err := xmlReader.Groups()
+	if err != nil {
+		return nil, errors.Wrap(err, "list groups failed")
+	}
+
+	entryService := &format.EntryServiceOp{XMLReader: xmlReader}
+	entries, err := entryService.List()
+	if err != nil {
+		return nil, errors.Wrap(err, "list entries failed")
+	}
+	if err := entryService.Decode(entries); err != nil {
+		return nil, errors.Wrap(err, "decode entries failed")
+	}
+
+	return &Snapshot{Groups: groups, Entries: entries}, nil
+}
+
+//Compare matches groups and entries by UUID and reports what changed from a to b
+func Compare(a, b *Snapshot, secrets *Secrets) *Report {
+	report := &Report{
+		Groups:  []GroupChange{},
+		Entries: []EntryChange{},
+	}
+
+	aGroups, bGroups := groupsByUUID(a.Groups), groupsByUUID(b.Groups)
+	for _, g := range a.Groups {
+		if _, ok := bGroups[g.UUID]; !ok {
+			report.Groups = append(report.Groups, GroupChange{Change: ChangeRemoved, UUID: g.UUID, Path: path(g.Path)})
+		}
+	}
+	for _, g := range b.Groups {
+		old, ok := aGroups[g.UUID]
+		if !ok {
+			report.Groups = append(report.Groups, GroupChange{Change: ChangeAdded, UUID: g.UUID, Path: path(g.Path)})
+			continue
+		}
+
+		var fields []FieldChange
+		if old.Name != g.Name {
+			fields = append(fields, FieldChange{Field: fieldName, Old: old.Name, New: g.Name})
+		}
+		if old.ParentUUID != g.ParentUUID {
+			fields = append(fields, FieldChange{Field: fieldParent, Old: path(parent(old.Path)), New: path(parent(g.Path))})
+		}
+		if len(fields) > 0 {
+			report.Groups = append(report.Groups, GroupChange{Change: change(fields), UUID: g.UUID, Path: path(g.Path), Fields: fields})
+		}
+	}
+
+	aEntries := make(map[string]*format.Entry)
+	for i := range a.Entries {
+		aEntries[a.Entries[i].UUID] = &a.Entries[i]
+	}
+	bEntries := make(map[string]*format.Entry)
+	for i := range b.Entries {
+		bEntries[b.Entries[i].UUID] = &b.Entries[i]
+	}
+
+	for i := range a.Entries {
+		e := &a.Entries[i]
+		if _, ok := bEntries[e.UUID]; !ok {
+			report.Entries = append(report.Entries, EntryChange{Change: ChangeRemoved, UUID: e.UUID, Group: path(e.Path), Title: e.Title.String()})
+		}
+	}
+	for i := range b.Entries {
+		e := &b.Entries[i]
+		old, ok := aEntries[e.UUID]
+		if !ok {
+			report.Entries = append(report.Entries, EntryChange{Change: ChangeAdded, UUID: e.UUID, Group: path(e.Path), Title: e.Title.String()})
+			continue
+		}
+
+		var fields []FieldChange
+		if old.GroupUUID != e.GroupUUID {
+			fields = append(fields, FieldChange{Field: fieldGroup, Old: path(old.Path), New: path(e.Path)})
+		}
+		fields = append(fields, Entries(old, e, secrets)...)
+		if len(fields) > 0 {
+			report.Entries = append(report.Entries, EntryChange{Change: change(fields), UUID: e.UUID, Group: path(e.Path), Title: e.Title.String(), Fields: fields})
+		}
+	}
+
+	sort.SliceStable(report.Groups, func(i, j int) bool {
+		return report.Groups[i].Path < report.Groups[j].Path
+	})
+	sort.SliceStable(report.Entries, func(i, j int) bool {
+		if report.Entries[i].Group != report.Entries[j].Group {
+			return report.Entries[i].Group < report.Entries[j].Group
+		}
+		return report.Entries[i].Title < report.Entries[j].Title
+	})
+
+	return report
+}
+
+//Entries returns the changed fields, custom fields, tags and attachments
+//between two versions of an entry. The group is not compared.
+func Entries(a, b *format.Entry, secrets *Secrets) []FieldChange {
+	var fields []FieldChange
+
+	aValues, bValues := values(a), values(b)
+	for _, key := range keys(a, b) {
+		av, bv := aValues[key], bValues[key]
+		if av.String() == bv.String() {
+			continue
+		}
+		secret := key == "Password" || (av != nil && av.Protected) || (bv != nil && bv.Protected)
+		fields = append(fields, FieldChange{
+			Field: key,
+			Old:   Value(av, secret, secrets),
+			New:   Value(bv, secret, secrets),
+		})
+	}
+
+	if aTags, bTags := strings.Join(a.Tags, ", "), strings.Join(b.Tags, ", "); aTags != bTags {
+		fields = append(fields, FieldChange{Field: fieldTags, Old: aTags, New: bTags})
+	}
+
+	aAttachments, bAttachments := attachments(a), attachments(b)
+	for _, name := range attachmentNames(a, b) {
+		aa, ba := aAttachments[name], bAttachments[name]
+		if aa != nil && ba != nil && string(aa.Data) == string(ba.Data) {
+			continue
+		}
+		fields = append(fields, FieldChange{
+			Field: attachmentPrefix + name,
+			Old:   Attachment(aa, secrets),
+			New:   Attachment(ba, secrets),
+		})
+	}
+
+	return fields
+}
+
+//Value formats an entry value, secrets are masked or hashed unless revealed
+func Value(ev *format.EntryValue, secret bool, secrets *Secrets) string {
+	v := ev.String()
+	if !secret || len(v) == 0 {
+		return v
+	}
+
+	switch secrets.mode() {
+	case SecretsReveal:
+		return v
+	case SecretsHash:
+		return secrets.hash([]byte(v))
+	}
+	return mask
+}
+
+//Attachment describes an attachment by its size, and hash unless masked
+func Attachment(a *format.Attachment, secrets *Secrets) string {
+	if a == nil {
+		return ""
+	}
+	if secrets.mode() == SecretsMask {
+		return fmt.Sprintf("%d bytes", len(a.Data))
+	}
+	return fmt.Sprintf("%d bytes %s", len(a.Data), secrets.hash(a.Data))
+}
+
+// change is moved when the group is the only change
+func change(fields []FieldChange) string {
+	if len(fields) == 1 && (fields[0].Field == fieldGroup || fields[0].Field == fieldParent) {
+		return ChangeMoved
+	}
+	return ChangeModified
+}
+
+func groupsByUUID(groups []format.Group) map[string]format.Group {
+	m := make(map[string]format.Group)
+	for _, g := range groups {
+		m[g.UUID] = g
+	}
+	return m
+}
+
+// values by field name, custom fields included
+func values(e *format.Entry) map[string]*format.EntryValue {
+	m := map[string]*format.EntryValue{
+		"Title":    e.Title,
+		"UserName": e.Username,
+		"Password": e.Password,
+		"URL":      e.URL,
+		"Notes":    e.Notes,
+	}
+	for _, f := range e.Fields {
+		m[f.Key] = f.Value
+	}
+	return m
+}
+
+// keys returns the standard fields followed by the custom fields of b then
+// those only in a
+func keys(a, b *format.Entry) []string {
+	names := []string{"Title", "UserName", "Password", "URL", "Notes"}
+	seen := make(map[string]bool)
+	for _, e := range []*format.Entry{b, a} {
+		for _, f := range e.Fields {
+			if !seen[f.Key] {
+				seen[f.Key] = true
+				names = append(names, f.Key)
+			}
+		}
+	}
+	return names
+}
+
+func attachments(e *format.Entry) map[string]*format.Attachment {
+	m := make(map[string]*format.Attachment)
+	for i := range e.Attachments {
+		m[e.Attachments[i].Name] = &e.Attachments[i]
+	}
+	return m
+}
+
+func attachmentNames(a, b *format.Entry) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, e := range []*format.Entry{b, a} {
+		for _, at := range e.Attachments {
+			if !seen[at.Name] {
+				seen[at.Name] = true
+				names = append(names, at.Name)
+			}
+		}
+	}
+	return names
+}
+
+func parent(p []string) []string {
+	if len(p) == 0 {
+		return nil
+	}
+	return p[:len(p)-1]
+}
+
+func path(p []string) string {
+	return strings.Join(p, "/")
+}
@@ -0,0 +1,148 @@
+package diff_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/simonhayward/gkeepassxreader/diff"
+	"github.com/simonhayward/gkeepassxreader/format"
+	"github.com/simonhayward/gkeepassxreader/keys"
+)
+
+func value(v string, protected bool) *format.EntryValue {
+	return &format.EntryValue{PlainText: v, Protected: protected}
+}
+
+func entry(uuid, groupUUID string, path []string, title, password string) format.Entry {
+	return format.Entry{
+		UUID:      uuid,
+		GroupUUID: groupUUID,
+		Path:      path,
+		Title:     value(title, false),
+		Username:  value("user", false),
+		Password:  value(password, true),
+		URL:       value("", false),
+		Notes:     value("", false),
+	}
+}
+
+// secrets in mode, hashed with the key of a database
+func secrets(mode string) *diff.Secrets {
+	return diff.NewSecrets(mode, bytes.Repeat([]byte{0x42}, 32))
+}
+
+var _ = Describe("Diff", func() {
+
+	var a, b *diff.Snapshot
+
+	BeforeEach(func() {
+		a = &diff.Snapshot{
+			Groups: []format.Group{
+				{UUID: "r", Name: "Root", Path: []string{"Root"}},
+				{UUID: "g1", ParentUUID: "r", Name: "Email", Path: []string{"Root", "Email"}},
+				{UUID: "g2", ParentUUID: "r", Name: "Old", Path: []string{"Root", "Old"}},
+			},
+			Entries: []format.Entry{
+				entry("e1", "g1", []string{"Root", "Email"}, "Mail", "pw1"),
+				entry("e2", "r", []string{"Root"}, "Bank", "pw2"),
+				entry("e3", "g2", []string{"Root", "Old"}, "Gone", "pw3"),
+			},
+		}
+		b = &diff.Snapshot{
+			Groups: []format.Group{
+				{UUID: "r", Name: "Root", Path: []string{"Root"}},
+				{UUID: "g1", ParentUUID: "r", Name: "Mail", Path: []string{"Root", "Mail"}},
+				{UUID: "g3", ParentUUID: "r", Name: "New", Path: []string{"Root", "New"}},
+			},
+			Entries: []format.Entry{
+				entry("e1", "g1", []string{"Root", "Mail"}, "Mail", "changed"),
+				entry("e2", "g3", []string{"Root", "New"}, "Bank", "pw2"),
+				entry("e4", "r", []string{"Root"}, "Added", "pw4"),
+			},
+		}
+		b.Entries[0].Fields = []format.Field{{Key: "PIN", Value: value("1234", true)}}
+		b.Entries[0].Attachments = []format.Attachment{{Name: "key.txt", Data: []byte("key")}}
+	})
+
+	Context("when comparing two snapshots", func() {
+		It("reports added, removed, moved and renamed groups", func() {
+			report := diff.Compare(a, b, secrets(diff.SecretsMask))
+			Expect(report.Groups).To(Equal([]diff.GroupChange{
+				{Change: diff.ChangeModified, UUID: "g1", Path: "Root/Mail", Fields: []diff.FieldChange{{Field: "Name", Old: "Email", New: "Mail"}}},
+				{Change: diff.ChangeAdded, UUID: "g3", Path: "Root/New"},
+				{Change: diff.ChangeRemoved, UUID: "g2", Path: "Root/Old"},
+			}))
+		})
+
+		It("reports added, removed, moved and modified entries with masked secrets", func() {
+			report := diff.Compare(a, b, secrets(diff.SecretsMask))
+			Expect(report.Entries).To(Equal([]diff.EntryChange{
+				{Change: diff.ChangeAdded, UUID: "e4", Group: "Root", Title: "Added"},
+				{Change: diff.ChangeModified, UUID: "e1", Group: "Root/Mail", Title: "Mail", Fields: []diff.FieldChange{
+					{Field: "Password", Old: "********", New: "********"},
+					{Field: "PIN", Old: "", New: "********"},
+					{Field: "Attachment key.txt", Old: "", New: "3 bytes"},
+				}},
+				{Change: diff.ChangeMoved, UUID: "e2", Group: "Root/New", Title: "Bank", Fields: []diff.FieldChange{
+					{Field: "Group", Old: "Root", New: "Root/New"},
+				}},
+				{Change: diff.ChangeRemoved, UUID: "e3", Group: "Root/Old", Title: "Gone"},
+			}))
+		})
+
+		It("hashes or reveals secrets when asked", func() {
+			hashed := diff.Compare(a, b, secrets(diff.SecretsHash)).Entries[1].Fields[0]
+			Expect(hashed.Old).To(HavePrefix("hmac:"))
+			Expect(hashed.Old).To(HaveLen(len("hmac:") + 12))
+			Expect(hashed.Old).ToNot(Equal(hashed.New))
+
+			revealed := diff.Compare(a, b, secrets(diff.SecretsReveal)).Entries[1].Fields[0]
+			Expect(revealed).To(Equal(diff.FieldChange{Field: "Password", Old: "pw1", New: "changed"}))
+		})
+
+		It("hashes secrets with the key of the database", func() {
+			unkeyed := sha256.Sum256([]byte("pw1"))
+			hashed := diff.Value(value("pw1", true), true, secrets(diff.SecretsHash))
+			Expect(hashed).ToNot(ContainSubstring(hex.EncodeToString(unkeyed[:])[:12]))
+			Expect(diff.Value(value("pw1", true), true, secrets(diff.SecretsHash))).To(Equal(hashed))
+
+			other := diff.NewSecrets(diff.SecretsHash, bytes.Repeat([]byte{0x43}, 32))
+			Expect(diff.Value(value("pw1", true), true, other)).ToNot(Equal(hashed))
+		})
+
+		It("reports nothing for the same snapshot", func() {
+			Expect(diff.Compare(a, a, secrets(diff.SecretsMask)).Empty()).To(BeTrue())
+		})
+	})
+
+	Context("when dumping a database", func() {
+		It("lists groups and entries with secrets masked", func() {
+			db, err := os.Open("../format/test_data/ProtectedStrings.kdbx")
+			Expect(err).ToNot(HaveOccurred())
+			defer db.Close()
+
+			reader, err := format.OpenDatabase(keys.MasterKey("masterpw", nil), db)
+			Expect(err).ToNot(HaveOccurred())
+			defer reader.Close()
+
+			snapshot, err := diff.NewSnapshot(reader.XMLReader)
+			Expect(err).ToNot(HaveOccurred())
+
+			buf := &bytes.Buffer{}
+			Expect(diff.Dump(buf, snapshot, secrets(diff.SecretsMask))).To(Succeed())
+			Expect(buf.String()).To(Equal("Group: Protected [6b47462542a92a49ab1a80a15392c6c9]\n" +
+				"\tEntry: Sample Entry [a8370aa88afd3c4593ce981eafb789c8]\n" +
+				"\t\tUserName: Protected User Name\n" +
+				"\t\tPassword: ********\n" +
+				"\t\tURL: http://www.somesite.com/\n" +
+				"\t\tNotes: Notes\n" +
+				"\t\tTestProtected: ********\n" +
+				"\t\tTestUnprotected: DEF\n"))
+		})
+	})
+})
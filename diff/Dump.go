@@ -0,0 +1,69 @@
+package diff
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/simonhayward/gkeepassxreader/format"
+)
+
+//Dump writes a stable plain text listing of the snapshot for line based
+//tools, e.g. as a git textconv filter. Groups are sorted by path and entries
+//by title within their group, secrets are shown as configured.
+func Dump(w io.Writer, s *Snapshot, secrets *Secrets) error {
+	bw := bufio.NewWriter(w)
+
+	groups := append([]format.Group(nil), s.Groups...)
+	sort.SliceStable(groups, func(i, j int) bool {
+		return path(groups[i].Path) < path(groups[j].Path)
+	})
+
+	entries := make(map[string][]*format.Entry)
+	for i := range s.Entries {
+		e := &s.Entries[i]
+		entries[e.GroupUUID] = append(entries[e.GroupUUID], e)
+	}
+
+	for _, g := range groups {
+		fmt.Fprintf(bw, "Group: %s [%s]\n", path(g.Path), g.UUID)
+
+		groupEntries := entries[g.UUID]
+		sort.SliceStable(groupEntries, func(i, j int) bool {
+			if ti, tj := groupEntries[i].Title.String(), groupEntries[j].Title.String(); ti != tj {
+				return ti < tj
+			}
+			return groupEntries[i].UUID < groupEntries[j].UUID
+		})
+
+		for _, e := range groupEntries {
+			fmt.Fprintf(bw, "\tEntry: %s [%s]\n", e.Title.String(), e.UUID)
+
+			v := values(e)
+			for _, key := range keys(e, e) {
+				if key == "Title" || len(v[key].String()) == 0 {
+					continue
+				}
+				secret := key == "Password" || v[key].Protected
+				dumpValue(bw, key, Value(v[key], secret, secrets))
+			}
+			for i := range e.Attachments {
+				dumpValue(bw, attachmentPrefix+e.Attachments[i].Name, Attachment(&e.Attachments[i], secrets))
+			}
+		}
+	}
+
+	return bw.Flush()
+}
+
+// dumpValue indents continuation lines of multi line values
+func dumpValue(w io.Writer, key, value string) {
+	value = strings.Replace(value, "\r\n", "\n", -1)
+	lines := strings.Split(strings.TrimRight(value, "\n"), "\n")
+	fmt.Fprintf(w, "\t\t%s: %s\n", key, lines[0])
+	for _, line := range lines[1:] {
+		fmt.Fprintf(w, "\t\t\t%s\n", line)
+	}
+}
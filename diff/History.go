@@ -0,0 +1,35 @@
+package diff
+
+import (
+	"time"
+
+	"github.com/simonhayward/gkeepassxreader/format"
+)
+
+//Revision is a version of an entry and the fields changed from the version
+//before. Revisions are numbered back from the current entry, which is 0.
+type Revision struct {
+	Revision int           `json:"revision"`
+	Modified time.Time     `json:"modified"`
+	Fields   []FieldChange `json:"fields"`
+}
+
+//History compares each revision of an entry with the one before, the first
+//with an empty entry. Revisions are given and returned oldest first.
+func History(revisions []format.Entry, secrets *Secrets) []Revision {
+	history := []Revision{}
+	previous := &format.Entry{}
+	for i := range revisions {
+		fields := Entries(previous, &revisions[i], secrets)
+		if fields == nil {
+			fields = []FieldChange{}
+		}
+		history = append(history, Revision{
+			Revision: len(revisions) - 1 - i,
+			Modified: revisions[i].Times.Modified,
+			Fields:   fields,
+		})
+		previous = &revisions[i]
+	}
+	return history
+}
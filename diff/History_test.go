@@ -0,0 +1,45 @@
+package diff_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/simonhayward/gkeepassxreader/diff"
+	"github.com/simonhayward/gkeepassxreader/format"
+)
+
+var _ = Describe("History", func() {
+
+	It("numbers revisions back from the current entry and diffs each with the one before", func() {
+		first := entry("e1", "g1", []string{"Root"}, "Mail", "old")
+		first.Times.Modified = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		second := entry("e1", "g1", []string{"Root"}, "Mail", "new")
+		second.Times.Modified = time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)
+		current := entry("e1", "g1", []string{"Root"}, "Email", "new")
+		current.Times.Modified = time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+
+		history := diff.History([]format.Entry{first, second, current}, secrets(diff.SecretsMask))
+		Expect(history).To(Equal([]diff.Revision{
+			{Revision: 2, Modified: first.Times.Modified, Fields: []diff.FieldChange{
+				{Field: "Title", Old: "", New: "Mail"},
+				{Field: "UserName", Old: "", New: "user"},
+				{Field: "Password", Old: "", New: "********"},
+			}},
+			{Revision: 1, Modified: second.Times.Modified, Fields: []diff.FieldChange{
+				{Field: "Password", Old: "********", New: "********"},
+			}},
+			{Revision: 0, Modified: current.Times.Modified, Fields: []diff.FieldChange{
+				{Field: "Title", Old: "Mail", New: "Email"},
+			}},
+		}))
+	})
+
+	It("reports an unchanged revision with no fields", func() {
+		e := entry("e1", "g1", []string{"Root"}, "Mail", "pw")
+		history := diff.History([]format.Entry{e, e}, secrets(diff.SecretsReveal))
+		Expect(history[1].Fields).To(BeEmpty())
+		Expect(history[0].Fields).To(ContainElement(diff.FieldChange{Field: "Password", Old: "", New: "pw"}))
+	})
+})
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/simonhayward/gkeepassxreader/format"
+	"github.com/simonhayward/gkeepassxreader/keys"
+	log "github.com/sirupsen/logrus"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+// optionalString is a flag value which stays nil unless given, so a field can
+// be set to an empty value
+type optionalString struct {
+	value *string
+}
+
+func (o *optionalString) Set(s string) error {
+	o.value = &s
+	return nil
+}
+
+func (o *optionalString) String() string {
+	if o.value == nil {
+		return ""
+	}
+	return *o.value
+}
+
+func optionalFlag(flag *kingpin.FlagClause) *optionalString {
+	o := &optionalString{}
+	flag.SetValue(o)
+	return o
+}
+
+// entryValue returns nil for a flag which was not given
+func (o *optionalString) entryValue() *format.EntryValue {
+	if o.value == nil {
+		return nil
+	}
+	return &format.EntryValue{PlainText: *o.value}
+}
+
+// entryPassword generates a password or prompts for one
+func entryPassword(title string, generate bool, g *generatorFlags, clipboard bool) *format.EntryValue {
+	if generate {
+		generated := g.generate()
+		if clipboard {
+			copyToClipboard(generated.Value)
+			fmt.Printf("password copied to clipboard, %.1f bits of entropy\n", generated.Entropy)
+		} else {
+			fmt.Printf("password generated, %.1f bits of entropy\n", generated.Entropy)
+		}
+		return &format.EntryValue{PlainText: generated.Value, Protected: true}
+	}
+
+	source := keys.NewPasswordSource()
+	source.Prompt = "Password for " + title + ": "
+	password, err := source.Password()
+	if err != nil {
+		log.Fatalf("password error: %s", err)
+	}
+	return &format.EntryValue{PlainText: password, Protected: true}
+}
+
+func addEntry(reader *format.KeePass2Reader, title, group string, username, url, notes *optionalString, tags []string, generate bool, g *generatorFlags, clipboard bool) {
+	xmlFile, err := reader.XMLReader.Decrypted()
+	if err != nil {
+		log.Fatalf("decrypt database error: %s", err)
+	}
+
+	e := &format.Entry{
+		Path:     splitGroup(group),
+		Title:    &format.EntryValue{PlainText: title},
+		Username: username.entryValue(),
+		URL:      url.entryValue(),
+		Notes:    notes.entryValue(),
+		Tags:     format.EditTags(nil, tags, nil),
+		Password: entryPassword(title, generate, g, clipboard),
+	}
+
+	uuid, err := xmlFile.AddEntry(e)
+	if err != nil {
+		log.Fatalf("add entry error: %s", err)
+	}
+
+	saveDatabase((*db).Name(), reader, xmlFile)
+	fmt.Printf("added %s [%s]\n", title, uuid)
+}
+
+func editEntry(reader *format.KeePass2Reader, term string, title, username, url, notes *optionalString, addTags, removeTags []string, password, generate bool, g *generatorFlags, clipboard bool) {
+	// the current version is edited, never a historical one
+	service := &format.EntryServiceOp{XMLReader: reader.XMLReader, RecycledEntries: *recycled}
+	entry, err := service.SearchByTerm(term)
+	if err != nil {
+		log.Fatalf("search database error: %s", err)
+	}
+	if entry == nil {
+		log.Fatalf("Search term: '%s' not found\n", term)
+	}
+
+	changes := &format.Entry{
+		Title:    title.entryValue(),
+		Username: username.entryValue(),
+		URL:      url.entryValue(),
+		Notes:    notes.entryValue(),
+	}
+	if len(addTags) > 0 || len(removeTags) > 0 {
+		changes.Tags = format.EditTags(entry.Tags, addTags, removeTags)
+	}
+	if password || generate {
+		changes.Password = entryPassword(entry.Title.String(), generate, g, clipboard)
+	}
+
+	xmlFile, err := reader.XMLReader.Decrypted()
+	if err != nil {
+		log.Fatalf("decrypt database error: %s", err)
+	}
+	if err := xmlFile.EditEntry(entry.UUID, changes); err != nil {
+		log.Fatalf("edit entry error: %s", err)
+	}
+
+	saveDatabase((*db).Name(), reader, xmlFile)
+	fmt.Printf("updated %s [%s], the previous version is kept in history\n", entry.Title.String(), entry.UUID)
+}
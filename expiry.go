@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/simonhayward/gkeepassxreader/audit"
+	"github.com/simonhayward/gkeepassxreader/format"
+	"github.com/simonhayward/gkeepassxreader/output"
+	log "github.com/sirupsen/logrus"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+func expiring(reader *format.KeePass2Reader, within string, asJSON bool) {
+	d, err := audit.ParseAge(within)
+	if err != nil {
+		kingpin.Fatalf("%s", err)
+	}
+
+	entries, err := entryService(reader).List()
+	if err != nil {
+		log.Fatalf("list database error: %s", err)
+	}
+
+	expiring, err := audit.Expiring(entries, time.Now(), d)
+	if err != nil {
+		log.Fatalf("expiring error: %s", err)
+	}
+	if asJSON {
+		writeJSON(expiring)
+		return
+	}
+
+	fields := &output.Data{Header: []string{"UUID", "Group", "Title", "Username", "Expiry", "Days"}}
+	for _, e := range expiring {
+		status := strconv.Itoa(e.Days)
+		if e.Expired {
+			status = "expired"
+		}
+		fields.Data = append(fields.Data, []string{e.UUID, e.Group, e.Title, e.Username, e.Expiry.Local().Format("2006-01-02 15:04"), status})
+	}
+	output.Table(fields.Header, fields.Data)
+	fmt.Printf("%d entries expired or expiring\n", len(expiring))
+}
+
+func stale(reader *format.KeePass2Reader, olderThan string, asJSON bool) {
+	d, err := audit.ParseAge(olderThan)
+	if err != nil {
+		kingpin.Fatalf("%s", err)
+	}
+
+	// history is needed to find when each password changed
+	entryService := &format.EntryServiceOp{XMLReader: reader.XMLReader, HistoricalEntries: true, RecycledEntries: *recycled}
+	entries, err := entryService.List()
+	if err != nil {
+		log.Fatalf("list database error: %s", err)
+	}
+	if err := entryService.Decode(entries); err != nil {
+		log.Fatalf("decode database error: %s", err)
+	}
+
+	stale, err := audit.Stale(entries, time.Now(), d)
+	if err != nil {
+		log.Fatalf("stale error: %s", err)
+	}
+	if asJSON {
+		writeJSON(stale)
+		return
+	}
+
+	fields := &output.Data{Header: []string{"UUID", "Group", "Title", "Username", "Password Changed", "Days"}}
+	for _, e := range stale {
+		fields.Data = append(fields.Data, []string{e.UUID, e.Group, e.Title, e.Username, e.PasswordChanged.Local().Format("2006-01-02 15:04"), strconv.Itoa(e.Days)})
+	}
+	output.Table(fields.Header, fields.Data)
+	fmt.Printf("%d entries with passwords older than %s\n", len(stale), olderThan)
+}
+
+// writeJSON writes v indented to stdout
+func writeJSON(v interface{}) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Fatalf("json error: %s", err)
+	}
+}
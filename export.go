@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/simonhayward/gkeepassxreader/format"
+	"github.com/simonhayward/gkeepassxreader/output"
+	log "github.com/sirupsen/logrus"
+)
+
+func export(reader *format.KeePass2Reader, name, exportFormat string) {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		log.Fatalf("unable to create export file: %s", err)
+	}
+
+	// an existing file keeps its mode when truncated
+	if err := f.Chmod(0600); err != nil {
+		f.Close()
+		log.Fatalf("unable to set export file mode: %s", err)
+	}
+
+	if err := output.Export(f, reader.XMLReader, exportFormat); err != nil {
+		f.Close()
+		os.Remove(name)
+		log.Fatalf("export error: %s", err)
+	}
+
+	if err := f.Close(); err != nil {
+		log.Fatalf("unable to write export file: %s", err)
+	}
+
+	fmt.Printf("%s export written to %s\n", exportFormat, name)
+}
@@ -0,0 +1,83 @@
+package format
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+//EditEntry changes the entry with the given hex UUID, each non nil standard
+//field of changes replaces the entry's value, as do non nil Tags. The
+//previous version is kept in the entry's history and the modification time
+//updated. f must be decrypted, see Decrypted.
+func (f *KeePass2XmlFile) EditEntry(uuid string, changes *Entry) error {
+	e, err := f.entry(uuid)
+	if err != nil {
+		return err
+	}
+
+	previous := cloneEntry(e)
+	previous.HistoryEntries = nil
+
+	for _, field := range []struct {
+		key       string
+		value     *EntryValue
+		protected bool
+	}{
+		{"Title", changes.Title, false},
+		{"UserName", changes.Username, false},
+		{"Password", changes.Password, true},
+		{"URL", changes.URL, false},
+		{"Notes", changes.Notes, false},
+	} {
+		if field.value != nil {
+			setString(e, field.key, field.value.String(), field.protected)
+		}
+	}
+
+	if changes.Tags != nil {
+		e.Tags = formatTags(changes.Tags)
+	}
+
+	e.HistoryEntries = append(e.HistoryEntries, previous)
+	touch(e, time.Now())
+	return nil
+}
+
+// entry returns the current entry with the given hex UUID
+func (f *KeePass2XmlFile) entry(uuid string) (*entry, error) {
+	b, err := hex.DecodeString(uuid)
+	if err != nil {
+		return nil, errors.Errorf("invalid uuid: %s", uuid)
+	}
+	g, idx := f.findEntry(base64.StdEncoding.EncodeToString(b))
+	if g == nil {
+		return nil, errors.Errorf("entry %s not found", uuid)
+	}
+	return &g.Entry[idx], nil
+}
+
+// setString sets the value of a string field, protection is kept for an
+// existing field
+func setString(e *entry, key, value string, protected bool) {
+	for i := range e.StringEntry {
+		if e.StringEntry[i].Key == key {
+			e.StringEntry[i].Value.Data = value
+			return
+		}
+	}
+	e.StringEntry = append(e.StringEntry, newStringEntry(key, &EntryValue{PlainText: value}, protected))
+}
+
+// touch records a modification of e
+func touch(e *entry, now time.Time) {
+	if e.Times == nil {
+		e.Times = newTimes(now)
+		return
+	}
+	t := formatTime(now)
+	e.Times.LastModificationTime = t
+	e.Times.LastAccessTime = t
+}
@@ -0,0 +1,39 @@
+package format_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/simonhayward/gkeepassxreader/format"
+)
+
+var _ = Describe("Edit", func() {
+
+	Context("when editing an entry", func() {
+		It("replaces the given fields and keeps the old version in history", func() {
+			f := mergeFile(mergeGroup(1, "Root", "2020-01-01T00:00:00Z",
+				mergeEntry(2, "Mail", "2020-01-01T00:00:00Z", "2020-01-01T00:00:00Z")), "")
+
+			Expect(f.EditEntry(mergeHexUUID(2), &format.Entry{
+				Title:    &format.EntryValue{PlainText: "Email"},
+				Password: &format.EntryValue{PlainText: "secret"},
+			})).To(Succeed())
+
+			entries := mergedEntries(f)
+			Expect(entries).To(HaveKey("Email"))
+			Expect(entries["Email"].Times.Modified.Year()).To(BeNumerically(">", 2020))
+			Expect(historyTitles(f, mergeHexUUID(2))).To(Equal([]string{"Mail"}))
+
+			service := &format.EntryServiceOp{XMLReader: &format.KeePass2XmlReader{KeePass2XmlFile: *f}}
+			list, err := service.List()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(service.Decode(list)).To(Succeed())
+			Expect(list[0].Password.String()).To(Equal("secret"))
+		})
+
+		It("fails when the entry does not exist", func() {
+			f := mergeFile(mergeGroup(1, "Root", "2020-01-01T00:00:00Z"), "")
+			Expect(f.EditEntry(mergeHexUUID(9), &format.Entry{})).To(MatchError(ContainSubstring("not found")))
+		})
+	})
+})
@@ -2,30 +2,119 @@ package format
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/pkg/errors"
+	"github.com/simonhayward/gkeepassxreader/secure"
 )
 
-//EntryValue represents an individual entry value
+//EntryValue represents an individual entry value. A decrypted protected value
+//is held only in locked memory, PlainText is the value of every other one.
+//String and Bytes return the plaintext of either.
 type EntryValue struct {
 	Data         string
 	Protected    bool
 	PlainText    string
 	RandomOffset int
 	CipherText   []byte
+	buf          *secure.LockedBuffer
+}
+
+//SetPlainText moves plaintext into locked memory, replacing any previous value
+func (ev *EntryValue) SetPlainText(plaintext []byte) error {
+	buf, err := secure.NewSharedLockedBufferFromBytes(plaintext)
+	if err != nil {
+		return errors.Wrap(err, "locked buffer allocation failed")
+	}
+
+	ev.Wipe()
+	ev.buf = buf
+	ev.PlainText = ""
+	return nil
+}
+
+//String returns a copy of the plaintext, which stays valid after Wipe, a nil
+//value is empty
+func (ev *EntryValue) String() string {
+	if ev == nil {
+		return ""
+	}
+	if ev.buf != nil {
+		return string(ev.buf.Bytes())
+	}
+	return ev.PlainText
+}
+
+//Bytes returns the plaintext without copying a decrypted value out of locked
+//memory, it is only valid until Wipe and mustn't be modified
+func (ev *EntryValue) Bytes() []byte {
+	if ev == nil {
+		return nil
+	}
+	if ev.buf != nil {
+		return ev.buf.Bytes()
+	}
+	return []byte(ev.PlainText)
+}
+
+//Wipe destroys the decrypted value
+func (ev *EntryValue) Wipe() {
+	if ev.buf == nil {
+		return
+	}
+	ev.buf.Destroy()
+	ev.buf = nil
+}
+
+const (
+	//OTPField is the custom field KeePassXC stores an otpauth URI in
+	OTPField = "otp"
+	//TOTPSeedField is the legacy KeePassXC TOTP seed field
+	TOTPSeedField = "TOTP Seed"
+	//TOTPSettingsField is the legacy KeePassXC TOTP settings field
+	TOTPSettingsField = "TOTP Settings"
+)
+
+//Attachment represents a file attached to an entry
+type Attachment struct {
+	Name string
+	Data []byte
+}
+
+//Field represents a custom string field
+type Field struct {
+	Key   string
+	Value *EntryValue
 }
 
 // Entry represents a single Entry
 type Entry struct {
-	Group      string
-	Title      *EntryValue
-	Username   *EntryValue
-	Password   *EntryValue
-	URL        *EntryValue
-	Notes      *EntryValue
-	UUID       string
-	Historical bool
+	Group       string
+	GroupUUID   string
+	Path        []string
+	Title       *EntryValue
+	Username    *EntryValue
+	Password    *EntryValue
+	URL         *EntryValue
+	Notes       *EntryValue
+	UUID        string
+	Fields      []Field
+	Attachments []Attachment
+	Tags        []string
+	Times       Times
+	Historical  bool
+	Recycled    bool
+}
+
+//Field returns the custom field with the given key or nil
+func (e *Entry) Field(key string) *EntryValue {
+	for _, f := range e.Fields {
+		if f.Key == key {
+			return f.Value
+		}
+	}
+	return nil
 }
 
 //Entries represents a collection of Entry
@@ -35,6 +124,7 @@ type Entries []Entry
 type EntryServiceOp struct {
 	XMLReader         *KeePass2XmlReader
 	HistoricalEntries bool
+	RecycledEntries   bool
 }
 
 //EntryService is an interface for interfacing with individual entries
@@ -42,6 +132,8 @@ type EntryService interface {
 	List() ([]Entry, error)
 	SearchByTerm(searchTerm string) (*Entry, error)
 	Search(searchTerm string, entries []Entry) int
+	Decode(entries []Entry) error
+	Revisions(searchTerm string) ([]Entry, error)
 }
 
 var _ EntryService = &EntryServiceOp{}
@@ -57,6 +149,9 @@ func (s *EntryServiceOp) List() ([]Entry, error) {
 	if !s.HistoricalEntries {
 		entries = removeHistorical(entries)
 	}
+	if !s.RecycledEntries {
+		entries = removeRecycled(entries)
+	}
 
 	if err := decodeEntries(s.XMLReader, entries, false); err != nil {
 		return nil, err
@@ -77,6 +172,9 @@ func (s *EntryServiceOp) SearchByTerm(searchTerm string) (*Entry, error) {
 	if !s.HistoricalEntries {
 		entries = removeHistorical(entries)
 	}
+	if !s.RecycledEntries {
+		entries = removeRecycled(entries)
+	}
 
 	// decode all titles
 	for _, e := range entries {
@@ -100,11 +198,60 @@ func (s *EntryServiceOp) SearchByTerm(searchTerm string) (*Entry, error) {
 	return nil, nil
 }
 
+//Revisions returns every version of the entry matching the search term with
+//all values decoded, oldest first and the current entry last. Nil is returned
+//when nothing matches.
+func (s *EntryServiceOp) Revisions(searchTerm string) ([]Entry, error) {
+	entries := []Entry{}
+	randomBytesOffset := 0
+	if err := s.XMLReader.ReadGroups(&entries, s.XMLReader.KeePass2XmlFile.Root.Groups, &randomBytesOffset); err != nil {
+		return nil, fmt.Errorf("unable to read groups: %s", err)
+	}
+
+	current := removeHistorical(entries)
+	if !s.RecycledEntries {
+		current = removeRecycled(current)
+	}
+	for _, e := range current {
+		if e.Title.Protected {
+			if err := decodeEntryValue(s.XMLReader, e.Title); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	idx := s.Search(searchTerm, current)
+	if idx >= len(current) {
+		return nil, nil
+	}
+
+	var revisions []Entry
+	for _, e := range entries {
+		if e.Historical && e.UUID == current[idx].UUID {
+			revisions = append(revisions, e)
+		}
+	}
+	sort.SliceStable(revisions, func(i, j int) bool {
+		return revisions[i].Times.Modified.Before(revisions[j].Times.Modified)
+	})
+	revisions = append(revisions, current[idx])
+
+	if err := decodeEntries(s.XMLReader, revisions, true); err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+//Decode decrypts every protected value of the given entries, passwords included
+func (s *EntryServiceOp) Decode(entries []Entry) error {
+	return decodeEntries(s.XMLReader, entries, true)
+}
+
 //Search queries the given entries to find a match
 func (s *EntryServiceOp) Search(searchTerm string, entries []Entry) int {
 	var titles, uuids []string
 	for _, e := range entries {
-		titles = append(titles, e.Title.PlainText)
+		titles = append(titles, e.Title.String())
 		uuids = append(uuids, e.UUID)
 	}
 
@@ -174,6 +321,9 @@ func decodeEntries(xmlReader *KeePass2XmlReader, entries []Entry, decodePassword
 
 		if decodePassword {
 			entryValues = append(entryValues, entries[idx].Password)
+			for _, f := range entries[idx].Fields {
+				entryValues = append(entryValues, f.Value)
+			}
 		}
 
 		for _, ev := range entryValues {
@@ -194,10 +344,88 @@ func decodeEntryValue(xmlReader *KeePass2XmlReader, eValue *EntryValue) error {
 	if err != nil {
 		return errors.Wrap(err, "entry value decode failed")
 	}
-	eValue.PlainText = string(plaintext)
+	if err := eValue.SetPlainText(plaintext); err != nil {
+		return err
+	}
+	xmlReader.track(eValue)
+	return nil
+}
+
+const (
+	//SortTitle sorts by title
+	SortTitle = "title"
+	//SortCreated sorts newest first
+	SortCreated = "created"
+	//SortModified sorts most recently modified first
+	SortModified = "modified"
+	//SortAccessed sorts most recently accessed first
+	SortAccessed = "accessed"
+	//SortExpiry sorts the soonest to expire first, entries which never expire last
+	SortExpiry = "expiry"
+)
+
+//SortFields supported by SortEntries
+var SortFields = []string{SortTitle, SortCreated, SortModified, SortAccessed, SortExpiry}
+
+//SortEntries sorts in place, entries which compare equal keep their order. An
+//entry whose time to sort by could not be parsed is an error.
+func SortEntries(entries []Entry, by string) error {
+	var less func(a, b *Entry) bool
+	var timeName string
+	switch by {
+	case SortTitle:
+		less = func(a, b *Entry) bool {
+			return strings.ToLower(a.Title.String()) < strings.ToLower(b.Title.String())
+		}
+	case SortCreated:
+		timeName = TimeCreated
+		less = func(a, b *Entry) bool { return a.Times.Created.After(b.Times.Created) }
+	case SortModified:
+		timeName = TimeModified
+		less = func(a, b *Entry) bool { return a.Times.Modified.After(b.Times.Modified) }
+	case SortAccessed:
+		timeName = TimeAccessed
+		less = func(a, b *Entry) bool { return a.Times.Accessed.After(b.Times.Accessed) }
+	case SortExpiry:
+		timeName = TimeExpiry
+		less = func(a, b *Entry) bool {
+			if a.Times.Expires != b.Times.Expires {
+				return a.Times.Expires
+			}
+			return a.Times.Expires && a.Times.Expiry.Before(b.Times.Expiry)
+		}
+	default:
+		return errors.Errorf("unknown sort field: %s", by)
+	}
+
+	if len(timeName) > 0 {
+		for i := range entries {
+			// the expiry time of an entry which never expires isn't compared
+			if timeName == TimeExpiry && !entries[i].Times.Expires {
+				continue
+			}
+			if err := entries[i].Times.Check(timeName); err != nil {
+				return errors.Wrapf(err, "cannot sort by %s, entry %s", by, entries[i].UUID)
+			}
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return less(&entries[i], &entries[j])
+	})
 	return nil
 }
 
+func removeRecycled(entries []Entry) []Entry {
+	var notRecycled []Entry
+	for _, e := range entries {
+		if !e.Recycled {
+			notRecycled = append(notRecycled, e)
+		}
+	}
+	return notRecycled
+}
+
 func removeHistorical(entries []Entry) []Entry {
 	var notHistorical []Entry
 	for _, e := range entries {
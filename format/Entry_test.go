@@ -2,6 +2,7 @@ package format_test
 
 import (
 	"os"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -157,23 +158,67 @@ var _ = Describe("Search", func() {
 
 			Expect(entry.Title.Protected).To(Equal(false))
 			Expect(entry.Title.Data).To(Equal("Mynew email address"))
-			Expect(entry.Title.PlainText).To(Equal("Mynew email address"))
+			Expect(entry.Title.String()).To(Equal("Mynew email address"))
 
 			Expect(entry.Password.Data).To(Equal("DfjoK9i3kcH0JUggt6LX9Q=="))
-			Expect(entry.Password.PlainText).To(Equal("3MAVouuiK2g6Qi5Q"))
+			Expect(entry.Password.String()).To(Equal("3MAVouuiK2g6Qi5Q"))
 			Expect(entry.Password.Protected).To(Equal(true))
 
 			Expect(entry.URL.Data).To(Equal(""))
-			Expect(entry.URL.PlainText).To(Equal(""))
+			Expect(entry.URL.String()).To(Equal(""))
 			Expect(entry.URL.Protected).To(Equal(false))
 
 			Expect(entry.Username.Data).To(Equal("test@test.com"))
-			Expect(entry.Username.PlainText).To(Equal("test@test.com"))
+			Expect(entry.Username.String()).To(Equal("test@test.com"))
 			Expect(entry.Username.Protected).To(Equal(false))
 		})
 	})
 })
 
+var _ = Describe("Revisions", func() {
+
+	var entryService *format.EntryServiceOp
+
+	BeforeEach(func() {
+		db, err := os.Open("test_data/HistoryTitle.kdbx")
+		Expect(err).ToNot(HaveOccurred())
+
+		reader, err := format.OpenDatabase(keys.MasterKey("password", nil), db)
+		Expect(err).ToNot(HaveOccurred())
+		entryService = &format.EntryServiceOp{XMLReader: reader.XMLReader}
+	})
+
+	Context("when searching for an entry with history", func() {
+		It("returns every version oldest first with the current entry last", func() {
+			revisions, err := entryService.Revisions("My personal email address")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(revisions).To(HaveLen(7))
+
+			var titles []string
+			for i, r := range revisions {
+				Expect(r.UUID).To(Equal("691e6c3ca94fc70a14e68317650cfba7"))
+				Expect(r.Historical).To(Equal(i < 6))
+				if i > 0 {
+					Expect(r.Times.Modified).ToNot(BeTemporally("<", revisions[i-1].Times.Modified))
+				}
+				titles = append(titles, r.Title.String())
+			}
+			Expect(titles[0]).To(Equal("My email address"))
+			Expect(titles[4:]).To(Equal([]string{"Mynew email address", "My new email address", "My personal email address"}))
+
+			Expect(revisions[4].Password.String()).To(Equal("3MAVouuiK2g6Qi5Q"))
+		})
+	})
+
+	Context("when searching for a historical title", func() {
+		It("returns nil as only current entries are matched", func() {
+			revisions, err := entryService.Revisions("Mynew email address")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(revisions).To(BeNil())
+		})
+	})
+})
+
 var _ = Describe("Entries", func() {
 
 	var (
@@ -254,7 +299,7 @@ var _ = Describe("Entries", func() {
 					Data:         "u8PhlyS8ep0VjyRUP8Su88c=",
 					Protected:    true,
 					PlainText:    "",
-					RandomOffset: 17,
+					RandomOffset: 20,
 					CipherText:   []byte{187, 195, 225, 151, 36, 188, 122, 157, 21, 143, 36, 84, 63, 196, 174, 243, 199},
 				},
 				format.EntryValue{
@@ -271,23 +316,51 @@ var _ = Describe("Entries", func() {
 
 			expectedEntries := []format.Entry{
 				format.Entry{
-					Group:      "Protected",
-					Title:      &entryValues[0],
-					Username:   &entryValues[1],
-					Password:   &entryValues[2],
-					URL:        &entryValues[3],
-					Notes:      &entryValues[4],
-					UUID:       "a8370aa88afd3c4593ce981eafb789c8",
+					Group:     "Protected",
+					Title:     &entryValues[0],
+					Username:  &entryValues[1],
+					Password:  &entryValues[2],
+					URL:       &entryValues[3],
+					Notes:     &entryValues[4],
+					UUID:      "a8370aa88afd3c4593ce981eafb789c8",
+					GroupUUID: "6b47462542a92a49ab1a80a15392c6c9",
+					Path:      []string{"Protected"},
+					Times: format.Times{
+						Created:         time.Date(2011, time.June, 29, 16, 43, 9, 0, time.UTC),
+						Modified:        time.Date(2011, time.June, 29, 16, 48, 53, 0, time.UTC),
+						Accessed:        time.Date(2011, time.June, 29, 16, 49, 2, 0, time.UTC),
+						Expiry:          time.Date(2011, time.June, 29, 16, 41, 38, 0, time.UTC),
+						UsageCount:      4,
+						LocationChanged: time.Date(2011, time.June, 29, 16, 43, 9, 0, time.UTC),
+					},
+					Fields: []format.Field{
+						{Key: "TestProtected", Value: &format.EntryValue{Data: "0Ovd", Protected: true, RandomOffset: 17, CipherText: []byte{208, 235, 221}}},
+						{Key: "TestUnprotected", Value: &format.EntryValue{Data: "DEF", PlainText: "DEF"}},
+					},
 					Historical: false,
 				},
 				format.Entry{
-					Group:      "Protected",
-					Title:      &entryValues[5],
-					Username:   &entryValues[6],
-					Password:   &entryValues[7],
-					URL:        &entryValues[8],
-					Notes:      &entryValues[9],
-					UUID:       "a8370aa88afd3c4593ce981eafb789c8",
+					Group:     "Protected",
+					Title:     &entryValues[5],
+					Username:  &entryValues[6],
+					Password:  &entryValues[7],
+					URL:       &entryValues[8],
+					Notes:     &entryValues[9],
+					UUID:      "a8370aa88afd3c4593ce981eafb789c8",
+					GroupUUID: "6b47462542a92a49ab1a80a15392c6c9",
+					Path:      []string{"Protected"},
+					Times: format.Times{
+						Created:         time.Date(2011, time.June, 29, 16, 43, 9, 0, time.UTC),
+						Modified:        time.Date(2011, time.June, 29, 16, 48, 48, 0, time.UTC),
+						Accessed:        time.Date(2011, time.June, 29, 16, 48, 48, 0, time.UTC),
+						Expiry:          time.Date(2011, time.June, 29, 16, 41, 38, 0, time.UTC),
+						UsageCount:      2,
+						LocationChanged: time.Date(2011, time.June, 29, 16, 43, 9, 0, time.UTC),
+					},
+					Fields: []format.Field{
+						{Key: "TestProtected", Value: &format.EntryValue{Data: "s1vr", Protected: true, RandomOffset: 37, CipherText: []byte{179, 91, 235}}},
+						{Key: "TestUnprotected", Value: &format.EntryValue{Data: "DEF", PlainText: "DEF"}},
+					},
 					Historical: true,
 				},
 			}
@@ -372,24 +445,38 @@ var _ = Describe("Entries", func() {
 				},
 			}
 
+			exampleTimes := format.Times{
+				Created:         time.Date(2013, time.November, 11, 18, 49, 1, 0, time.UTC),
+				Modified:        time.Date(2013, time.November, 11, 18, 49, 1, 0, time.UTC),
+				Accessed:        time.Date(2013, time.November, 11, 18, 49, 1, 0, time.UTC),
+				Expiry:          time.Date(2013, time.November, 11, 18, 47, 58, 0, time.UTC),
+				LocationChanged: time.Date(2013, time.November, 11, 18, 49, 1, 0, time.UTC),
+			}
+
 			expectedEntries := []format.Entry{
 				format.Entry{
-					Group:    "example",
-					Title:    &entryValues[0],
-					Username: &entryValues[1],
-					Password: &entryValues[2],
-					URL:      &entryValues[3],
-					Notes:    &entryValues[4],
-					UUID:     "640c38611c3ea4489ced361f54e43dbe",
+					Group:     "example",
+					Title:     &entryValues[0],
+					Username:  &entryValues[1],
+					Password:  &entryValues[2],
+					URL:       &entryValues[3],
+					Notes:     &entryValues[4],
+					UUID:      "640c38611c3ea4489ced361f54e43dbe",
+					GroupUUID: "9f7ae746fbce1744af3eb8a2157afe4e",
+					Path:      []string{"example"},
+					Times:     exampleTimes,
 				},
 				format.Entry{
-					Group:    "example",
-					Title:    &entryValues[5],
-					Username: &entryValues[6],
-					Password: &entryValues[7],
-					URL:      &entryValues[8],
-					Notes:    nil,
-					UUID:     "db8e52f8c86d7d468ecd53d4c2fe0a31",
+					Group:     "example",
+					Title:     &entryValues[5],
+					Username:  &entryValues[6],
+					Password:  &entryValues[7],
+					URL:       &entryValues[8],
+					Notes:     nil,
+					UUID:      "db8e52f8c86d7d468ecd53d4c2fe0a31",
+					GroupUUID: "9f7ae746fbce1744af3eb8a2157afe4e",
+					Path:      []string{"example"},
+					Times:     exampleTimes,
 				},
 			}
 
@@ -415,18 +502,18 @@ var _ = Describe("Entries", func() {
 
 			Expect(listEntries[0].Title.Protected).To(Equal(false))
 			Expect(listEntries[0].Title.Data).To(Equal("Sample Entry"))
-			Expect(listEntries[0].Title.PlainText).To(Equal("Sample Entry"))
+			Expect(listEntries[0].Title.String()).To(Equal("Sample Entry"))
 
 			Expect(listEntries[0].Password.Data).To(Equal("Password"))
-			Expect(listEntries[0].Password.PlainText).To(Equal("Password"))
+			Expect(listEntries[0].Password.String()).To(Equal("Password"))
 			Expect(listEntries[0].Password.Protected).To(Equal(false))
 
 			Expect(listEntries[0].URL.Data).To(Equal("YtgAIKYL4ggH0nzaFP4srWV+GC8A1B0I"))
-			Expect(listEntries[0].URL.PlainText).To(Equal("http://www.somesite.com/"))
+			Expect(listEntries[0].URL.String()).To(Equal("http://www.somesite.com/"))
 			Expect(listEntries[0].URL.Protected).To(Equal(true))
 
 			Expect(listEntries[0].Username.Data).To(Equal("VK3dahCqvgR8"))
-			Expect(listEntries[0].Username.PlainText).To(Equal("User Name"))
+			Expect(listEntries[0].Username.String()).To(Equal("User Name"))
 			Expect(listEntries[0].Username.Protected).To(Equal(true))
 		})
 	})
@@ -452,18 +539,18 @@ var _ = Describe("Entries", func() {
 
 			Expect(listEntries[0].Title.Protected).To(Equal(false))
 			Expect(listEntries[0].Title.Data).To(Equal("My email address"))
-			Expect(listEntries[0].Title.PlainText).To(Equal("My email address"))
+			Expect(listEntries[0].Title.String()).To(Equal("My email address"))
 
 			Expect(listEntries[0].Password.Data).To(Equal("tzAeMlvTMXTm6Ebq2B6p+A=="))
-			Expect(listEntries[0].Password.PlainText).To(Equal(""))
+			Expect(listEntries[0].Password.String()).To(Equal(""))
 			Expect(listEntries[0].Password.Protected).To(Equal(true))
 
 			Expect(listEntries[0].URL.Data).To(Equal(""))
-			Expect(listEntries[0].URL.PlainText).To(Equal(""))
+			Expect(listEntries[0].URL.String()).To(Equal(""))
 			Expect(listEntries[0].URL.Protected).To(Equal(false))
 
 			Expect(listEntries[0].Username.Data).To(Equal("test@test.com"))
-			Expect(listEntries[0].Username.PlainText).To(Equal("test@test.com"))
+			Expect(listEntries[0].Username.String()).To(Equal("test@test.com"))
 			Expect(listEntries[0].Username.Protected).To(Equal(false))
 		})
 	})
@@ -493,4 +580,50 @@ var _ = Describe("Entries", func() {
 			Expect(listEntries[3].Historical).To(Equal(true))
 		})
 	})
+
+	Context("when sorting entries", func() {
+		entry := func(title string, modified time.Time, expires bool) format.Entry {
+			return format.Entry{
+				Title: &format.EntryValue{PlainText: title},
+				Times: format.Times{Modified: modified, Expiry: modified, Expires: expires},
+			}
+		}
+		titles := func(entries []format.Entry) []string {
+			var t []string
+			for _, e := range entries {
+				t = append(t, e.Title.String())
+			}
+			return t
+		}
+
+		It("sorts by title, modification and expiry", func() {
+			entries := []format.Entry{
+				entry("b", time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), false),
+				entry("C", time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC), true),
+				entry("a", time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), true),
+			}
+
+			Expect(format.SortEntries(entries, format.SortTitle)).To(Succeed())
+			Expect(titles(entries)).To(Equal([]string{"a", "b", "C"}))
+
+			Expect(format.SortEntries(entries, format.SortModified)).To(Succeed())
+			Expect(titles(entries)).To(Equal([]string{"C", "a", "b"}))
+
+			Expect(format.SortEntries(entries, format.SortExpiry)).To(Succeed())
+			Expect(titles(entries)).To(Equal([]string{"a", "C", "b"}))
+
+			Expect(format.SortEntries(entries, "colour")).ToNot(Succeed())
+		})
+
+		It("fails only when sorting by a time which could not be parsed", func() {
+			broken := entry("d", time.Time{}, false)
+			broken.UUID = "0d"
+			broken.Times.Invalid = []string{format.TimeModified}
+			entries := []format.Entry{entry("b", time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), false), broken}
+
+			Expect(format.SortEntries(entries, format.SortTitle)).To(Succeed())
+			Expect(format.SortEntries(entries, format.SortExpiry)).To(Succeed())
+			Expect(format.SortEntries(entries, format.SortModified)).To(MatchError("cannot sort by modified, entry 0d: invalid LastModificationTime"))
+		})
+	})
 })
@@ -0,0 +1,222 @@
+package format_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/simonhayward/gkeepassxreader/format"
+	"github.com/simonhayward/gkeepassxreader/streams"
+)
+
+const (
+	// blocks of the seeds are small so they hold several
+	fuzzBlockSize = 1024
+	// keeps inputs claiming large blocks quick to reject
+	fuzzMaxBlockSize = 1024 * 1024
+)
+
+var (
+	fuzzKey = bytes.Repeat([]byte{0x42}, 32)
+	fuzzIV  = bytes.Repeat([]byte{0x24}, aes.BlockSize)
+)
+
+// testData returns the contents of the test databases matching pattern
+func testData(f *testing.F, pattern string) [][]byte {
+	names, err := filepath.Glob(filepath.Join("test_data", pattern))
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	var files [][]byte
+	for _, name := range names {
+		b, err := ioutil.ReadFile(name)
+		if err != nil {
+			f.Fatal(err)
+		}
+		files = append(files, b)
+	}
+	return files
+}
+
+// hashedBlocks splits data into blocks of size as KeePass does
+func hashedBlocks(data []byte, size int) []byte {
+	buf := &bytes.Buffer{}
+	var index uint32
+	for ; len(data) > 0; index++ {
+		n := len(data)
+		if n > size {
+			n = size
+		}
+		hash := sha256.Sum256(data[:n])
+		binary.Write(buf, binary.LittleEndian, index)
+		buf.Write(hash[:])
+		binary.Write(buf, binary.LittleEndian, uint32(n))
+		buf.Write(data[:n])
+		data = data[n:]
+	}
+
+	binary.Write(buf, binary.LittleEndian, index)
+	buf.Write(make([]byte, sha256.Size))
+	binary.Write(buf, binary.LittleEndian, uint32(0))
+	return buf.Bytes()
+}
+
+// encrypt pads data to whole cipher blocks and encrypts it with the fuzz key
+func encrypt(data []byte) []byte {
+	block, err := aes.NewCipher(fuzzKey)
+	if err != nil {
+		panic(err)
+	}
+
+	padded := make([]byte, (len(data)+aes.BlockSize-1)/aes.BlockSize*aes.BlockSize)
+	copy(padded, data)
+	cipher.NewCBCEncrypter(block, fuzzIV).CryptBlocks(padded, padded)
+	return padded
+}
+
+// decryptStream returns a stream decrypting ciphertext with the fuzz key
+func decryptStream(t *testing.T, ciphertext []byte) *streams.SymmetricCipherStream {
+	block, err := aes.NewCipher(fuzzKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := streams.NewSymmetricCipherStream(block, fuzzIV, bytes.NewReader(ciphertext), streams.DirectionDecrypt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func FuzzReadHeader(f *testing.F) {
+	for _, b := range testData(f, "*.kdbx") {
+		f.Add(b)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		reader := format.NewKeePass2Reader()
+		defer reader.Close()
+
+		if err := reader.ReadHeader(bytes.NewReader(data)); err != nil {
+			return
+		}
+		if len(reader.Db.TransformSeed) != 32 {
+			t.Fatalf("header read with a transform seed of %d bytes", len(reader.Db.TransformSeed))
+		}
+	})
+}
+
+func FuzzHashedBlock(f *testing.F) {
+	for _, b := range testData(f, "*.xml") {
+		blocks := hashedBlocks(b, fuzzBlockSize)
+		f.Add(blocks)
+		f.Add(blocks[:len(blocks)/2])
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ciphertext := encrypt(data)
+
+		cipherStream := decryptStream(t, ciphertext)
+		hashBlock := streams.NewHashedBlock(cipherStream.BlockMode, cipherStream)
+		hashBlock.MaxBlockSize = fuzzMaxBlockSize
+
+		var result []byte
+		for {
+			n, err := hashBlock.ReadData(&result, 65500)
+			if err != nil || n == 0 {
+				break
+			}
+		}
+		if len(result) > len(ciphertext) {
+			t.Fatalf("read %d bytes from a stream of %d", len(result), len(ciphertext))
+		}
+
+		cipherStream = decryptStream(t, ciphertext)
+		hashBlock = streams.NewHashedBlock(cipherStream.BlockMode, cipherStream)
+		hashBlock.MaxBlockSize = fuzzMaxBlockSize
+
+		for {
+			block, blockData, err := hashBlock.ReadBlock()
+			if err != nil || block == nil {
+				break
+			}
+			if block.Size != uint32(len(blockData)) || block.Size > fuzzMaxBlockSize {
+				t.Fatalf("block %d of %d bytes read with %d", block.Index, block.Size, len(blockData))
+			}
+		}
+	})
+}
+
+func FuzzSymmetricCipherStream(f *testing.F) {
+	for _, b := range testData(f, "*") {
+		f.Add(b, uint16(32))
+		f.Add(b, uint16(65500))
+	}
+	f.Add([]byte{}, uint16(1))
+
+	f.Fuzz(func(t *testing.T, data []byte, chunk uint16) {
+		if chunk == 0 {
+			return
+		}
+
+		// the plaintext is decrypted whatever the chunks read
+		ciphertext := encrypt(data)
+		cipherStream := decryptStream(t, ciphertext)
+		var plaintext []byte
+		for {
+			buf := make([]byte, chunk)
+			n, err := cipherStream.ReadData(&buf, int(chunk))
+			if err != nil || n == 0 {
+				break
+			}
+			plaintext = append(plaintext, buf[:n]...)
+		}
+		if len(plaintext) < len(data) || !bytes.Equal(plaintext[:len(data)], data) {
+			t.Fatalf("decrypted %d bytes which don't match", len(plaintext))
+		}
+
+		// data itself need not be whole cipher blocks
+		cipherStream = decryptStream(t, data)
+		read := 0
+		for {
+			buf := make([]byte, chunk)
+			n, err := cipherStream.ReadData(&buf, int(chunk))
+			if err != nil || n == 0 {
+				break
+			}
+			read += n
+		}
+		if read > len(data) {
+			t.Fatalf("read %d bytes from a stream of %d", read, len(data))
+		}
+	})
+}
+
+func FuzzXMLReader(f *testing.F) {
+	for _, b := range testData(f, "*.xml") {
+		f.Add(b)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var key [32]byte
+		reader, err := format.NewKeePass2XmlReader(bytes.NewReader(data), &key)
+		if err != nil {
+			return
+		}
+		defer reader.Wipe()
+
+		reader.Groups()
+		entryService := &format.EntryServiceOp{XMLReader: reader}
+		entries, err := entryService.List()
+		if err != nil {
+			return
+		}
+		entryService.Decode(entries)
+	})
+}
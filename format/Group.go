@@ -0,0 +1,57 @@
+package format
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+//Group represents a single group, UUIDs are hex encoded
+type Group struct {
+	UUID       string
+	ParentUUID string
+	Name       string
+	Path       []string
+	Times      Times
+}
+
+//Groups lists every group depth first, the root group included
+func (k *KeePass2XmlReader) Groups() ([]Group, error) {
+	var groups []Group
+	if err := readGroupTree(&groups, k.KeePass2XmlFile.Root.Groups, "", nil); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+func readGroupTree(groups *[]Group, rGroups []group, parentUUID string, parentPath []string) error {
+	for _, g := range rGroups {
+		uuid, err := base64.StdEncoding.DecodeString(g.UUID)
+		if err != nil {
+			return errors.Wrap(err, "base64 decode for group uuid failed")
+		}
+
+		times := g.Times.parse()
+		if len(times.Invalid) > 0 {
+			log.Debugf("group %x has invalid times, kept as zero: %s", uuid, strings.Join(times.Invalid, ", "))
+		}
+
+		path := append(append([]string(nil), parentPath...), g.Name)
+		hexUUID := hex.EncodeToString(uuid)
+		*groups = append(*groups, Group{
+			UUID:       hexUUID,
+			ParentUUID: parentUUID,
+			Name:       g.Name,
+			Path:       path,
+			Times:      times,
+		})
+
+		if err := readGroupTree(groups, g.Groups, hexUUID, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package format
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/simonhayward/gkeepassxreader/secure"
+)
+
+const (
+	// bytes a resynchronised inflater must produce which look like xml
+	resyncCheckSize = 512
+	// deflate block types, fixed Huffman blocks aren't resynchronised on as
+	// almost any bits decode as one
+	deflateStored  = 0
+	deflateDynamic = 2
+	// the most literal/length and distance codes of a dynamic block
+	deflateMaxLitCodes  = 286
+	deflateMaxDistCodes = 30
+	// history a deflate block can refer back to
+	deflateWindowSize = 32 * 1024
+	// the checksum and size which follow the deflate stream
+	gzipTrailerSize = 8
+)
+
+// salvageInflate decompresses a gzip stream whose data from damaged onwards
+// may be corrupt. The inflater is run through the damage and, should it fail,
+// restarted at the next deflate block found after the failure, so only the
+// deflate blocks around the damage are lost. The history those blocks refer
+// back to is lost too, it is inflated as spaces. Returns the output, how much
+// of it was inflated before the damage and the first error.
+func salvageInflate(data []byte, damaged int) ([]byte, int, error) {
+	r := bytes.NewReader(data)
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "gzip new reader failed")
+	}
+	defer zr.Close()
+	// a bytes.Reader is read byte by byte, the deflate stream starts here
+	start := int64(len(data) - r.Len())
+
+	out, firstErr := inflate(zr, nil)
+	if firstErr != nil {
+		firstErr = errors.Wrap(firstErr, "gzip read failed")
+	}
+
+	lostHistory := bytes.Repeat([]byte(" "), deflateWindowSize)
+	from, stopped := stoppedAt(firstErr, start*8, int64(len(data)-r.Len())*8, len(data))
+	for candidate := int64(-1); stopped; {
+		// never resynchronise on the same block twice
+		if from <= candidate {
+			from = candidate + 1
+		}
+		var br *bitReader
+		var fr io.Reader
+		var prefix []byte
+		if candidate, br, fr, prefix = resyncInflate(data, from, lostHistory); fr == nil {
+			break
+		}
+		var err error
+		out, err = inflate(fr, append(out, prefix...))
+		from, stopped = stoppedAt(err, candidate, br.pos, len(data))
+	}
+
+	return out, inflatedBefore(data, damaged, len(out)), firstErr
+}
+
+// inflate appends everything r inflates to out
+func inflate(r io.Reader, out []byte) ([]byte, error) {
+	buf := make([]byte, 32*1024)
+	defer secure.Wipe(buf)
+	for {
+		n, err := r.Read(buf)
+		out = append(out, buf[:n]...)
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return out, err
+		}
+	}
+}
+
+// inflatedBefore is how much of the output inflates from the data before the
+// damage, the inflater flushes what it has when the input runs out
+func inflatedBefore(data []byte, damaged, inflated int) int {
+	if damaged >= len(data) {
+		return inflated
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data[:damaged]))
+	if err != nil {
+		return 0
+	}
+	defer zr.Close()
+	out, _ := inflate(zr, nil)
+	defer secure.Wipe(out)
+	if len(out) > inflated {
+		return inflated
+	}
+	return len(out)
+}
+
+// stoppedAt is the bit offset an inflater started at the bit offset start
+// stopped at before the end of the stream, having read up to the bit offset
+// read, and whether it stopped early
+func stoppedAt(err error, start, read int64, size int) (int64, bool) {
+	if corrupt, ok := errors.Cause(err).(flate.CorruptInputError); ok {
+		return start + int64(corrupt)*8, true
+	}
+	// damaged data can also decode as the final block, which ends the stream
+	// before the trailer
+	return read, (read+7)/8 < int64(size-gzipTrailerSize)
+}
+
+// resyncInflate finds the first deflate block after the bit offset from which
+// inflates to xml with the given history. Returns its offset, the reader of
+// the data and the inflater, positioned after the checked output, and that
+// output. The inflater is nil when no block is found.
+func resyncInflate(data []byte, from int64, dict []byte) (int64, *bitReader, io.Reader, []byte) {
+	fr := flate.NewReader(bytes.NewReader(nil))
+	check := make([]byte, resyncCheckSize)
+	for pos := from; pos+3 <= int64(len(data))*8; pos++ {
+		if !deflateHeader(data, pos) {
+			continue
+		}
+
+		br := &bitReader{data: data, pos: pos}
+		if err := fr.(flate.Resetter).Reset(br, dict); err != nil {
+			continue
+		}
+		n, err := io.ReadFull(fr, check)
+		// a short read is the end of the stream
+		if err != nil && err != io.ErrUnexpectedEOF {
+			continue
+		}
+		if looksLikeXML(check[:n]) {
+			return pos, br, fr, check[:n]
+		}
+	}
+	return 0, nil, nil, nil
+}
+
+// deflateHeader is whether the bits at pos could start a stored or dynamic
+// deflate block
+func deflateHeader(data []byte, pos int64) bool {
+	r := &bitReader{data: data, pos: pos}
+	r.bits(1) // final block
+	switch r.bits(2) {
+	case deflateStored:
+		// the length and its complement follow at the next byte
+		i := (r.pos + 7) / 8
+		if i+4 > int64(len(data)) {
+			return false
+		}
+		length := uint16(data[i]) | uint16(data[i+1])<<8
+		complement := uint16(data[i+2]) | uint16(data[i+3])<<8
+		return length == ^complement
+	case deflateDynamic:
+		return r.bits(5)+257 <= deflateMaxLitCodes && r.bits(5)+1 <= deflateMaxDistCodes
+	}
+	return false
+}
+
+// looksLikeXML is whether inflated output is text, control characters and
+// bytes which are never UTF-8 show an inflater started on garbage
+func looksLikeXML(b []byte) bool {
+	for _, c := range b {
+		if c < 0x20 && c != '\t' && c != '\n' && c != '\r' || c == 0xC0 || c == 0xC1 || c >= 0xF5 {
+			return false
+		}
+	}
+	return len(b) > 0
+}
+
+// bitReader reads bytes starting at a bit offset, as deflate blocks aren't
+// byte aligned, the bits past the end of data are zero
+type bitReader struct {
+	data []byte
+	pos  int64
+}
+
+// bits reads n bits least significant first, as deflate packs them
+func (b *bitReader) bits(n int) int {
+	v := 0
+	for i := 0; i < n; i++ {
+		if byteIndex := b.pos / 8; byteIndex < int64(len(b.data)) && b.data[byteIndex]&(1<<uint(b.pos%8)) != 0 {
+			v |= 1 << uint(i)
+		}
+		b.pos++
+	}
+	return v
+}
+
+func (b *bitReader) ReadByte() (byte, error) {
+	if b.pos/8 >= int64(len(b.data)) {
+		return 0, io.EOF
+	}
+	return byte(b.bits(8)), nil
+}
+
+func (b *bitReader) Read(p []byte) (int, error) {
+	for n := range p {
+		c, err := b.ReadByte()
+		if err != nil {
+			return n, err
+		}
+		p[n] = c
+	}
+	return len(p), nil
+}
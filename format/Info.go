@@ -0,0 +1,162 @@
+package format
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/simonhayward/gkeepassxreader/core"
+)
+
+const (
+	//FormatKeePass2 KeePass 2.x database (.kdbx)
+	FormatKeePass2 = "KeePass 2"
+	//FormatKeePass1 KeePass 1.x database (.kdb)
+	FormatKeePass1 = "KeePass 1"
+
+	// KDBX 3 databases only use AES-KDF, c9d9f39a628a4460bf740d08c18a4fea
+	kdfAesUUID = "c9d9f39a628a4460bf740d08c18a4fea"
+	kdfAesName = "AES-KDF"
+)
+
+// inner random stream ids of the header
+var innerStreamNames = map[uint32]string{0: "none", 1: "ArcFour", keepass2Salsa20: "Salsa20", 3: "ChaCha20"}
+
+//KDFInfo describes the key derivation function
+type KDFInfo struct {
+	Name   string `json:"name"`
+	UUID   string `json:"uuid"`
+	Rounds uint64 `json:"rounds"`
+}
+
+//Info describes a database, its header, metadata and contents. Change
+//intervals are in days, -1 when disabled.
+type Info struct {
+	Format               string     `json:"format"`
+	Version              string     `json:"version"`
+	Cipher               string     `json:"cipher"`
+	CipherUUID           string     `json:"cipher_uuid"`
+	Compression          string     `json:"compression"`
+	KDF                  KDFInfo    `json:"kdf"`
+	InnerStream          string     `json:"inner_stream,omitempty"`
+	Generator            string     `json:"generator,omitempty"`
+	DatabaseName         string     `json:"database_name,omitempty"`
+	Description          string     `json:"description,omitempty"`
+	DefaultUserName      string     `json:"default_user_name,omitempty"`
+	MasterKeyChanged     *time.Time `json:"master_key_changed,omitempty"`
+	MasterKeyChangeRec   int        `json:"master_key_change_rec"`
+	MasterKeyChangeForce int        `json:"master_key_change_force"`
+	Groups               int        `json:"groups"`
+	Entries              int        `json:"entries"`
+	HistoricalEntries    int        `json:"historical_entries"`
+	RecycledEntries      int        `json:"recycled_entries"`
+	Attachments          int        `json:"attachments"`
+	AttachmentBytes      int64      `json:"attachment_bytes"`
+}
+
+//Info returns the description of a database which has been read
+func (k *KeePass2Reader) Info() (*Info, error) {
+	if k.XMLReader == nil {
+		return nil, errors.New("database not read")
+	}
+
+	info := &Info{
+		Format:      FormatKeePass2,
+		Version:     fmt.Sprintf("%d.%d", k.fileVersion>>16, k.fileVersion&0xFFFF),
+		Cipher:      cipherName(k.Db.Cipher.Data),
+		CipherUUID:  hex.EncodeToString(k.Db.Cipher.Data),
+		Compression: "none",
+		KDF:         KDFInfo{Name: kdfAesName, UUID: kdfAesUUID, Rounds: k.Db.TransformRounds},
+		InnerStream: innerStreamNames[k.innerStreamID],
+	}
+	if k.Db.CompressionAlgo == core.CompressionGzip {
+		info.Compression = "gzip"
+	}
+	if k.keepass1 != nil {
+		info.Format = FormatKeePass1
+		info.Version = fmt.Sprintf("%d.%d", k.keepass1.Version>>16, k.keepass1.Version&0xFFFF)
+		info.InnerStream = ""
+	}
+
+	if err := k.XMLReader.info(info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// info adds the metadata and counts of the xml file
+func (k *KeePass2XmlReader) info(info *Info) error {
+	m := k.KeePass2XmlFile.Meta
+	info.Generator = m.Generator
+	info.DatabaseName = m.DatabaseName
+	info.Description = m.Description
+	info.DefaultUserName = m.DefaultUserName
+
+	changed, err := parseTime(m.MasterKeyChanged)
+	if err != nil {
+		return errors.Wrap(err, "master key changed")
+	}
+	if !changed.IsZero() {
+		info.MasterKeyChanged = &changed
+	}
+	if info.MasterKeyChangeRec, err = changeInterval(m.MasterKeyChangeRec); err != nil {
+		return errors.Wrap(err, "master key change recommended")
+	}
+	if info.MasterKeyChangeForce, err = changeInterval(m.MasterKeyChangeForce); err != nil {
+		return errors.Wrap(err, "master key change forced")
+	}
+
+	groups, err := k.Groups()
+	if err != nil {
+		return err
+	}
+	info.Groups = len(groups)
+
+	entries, err := (&EntryServiceOp{XMLReader: k, HistoricalEntries: true, RecycledEntries: true}).List()
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		switch {
+		case e.Historical:
+			info.HistoricalEntries++
+			continue
+		case e.Recycled:
+			info.RecycledEntries++
+		default:
+			info.Entries++
+		}
+		for _, a := range e.Attachments {
+			info.Attachments++
+			info.AttachmentBytes += int64(len(a.Data))
+		}
+	}
+	return nil
+}
+
+// changeInterval parses a number of days, -1 when not set
+func changeInterval(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if len(s) == 0 {
+		return -1, nil
+	}
+	days, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, errors.Errorf("invalid interval: %s", s)
+	}
+	return days, nil
+}
+
+func cipherName(uuid []byte) string {
+	switch {
+	case bytes.Equal(uuid, core.Keepass2CipherAes):
+		return "AES-256"
+	case bytes.Equal(uuid, Keepass1CipherTwofish):
+		return "Twofish"
+	}
+	return "unknown"
+}
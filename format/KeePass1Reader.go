@@ -0,0 +1,512 @@
+package format
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/simonhayward/gkeepassxreader/core"
+	"github.com/simonhayward/gkeepassxreader/secure"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/twofish"
+)
+
+const (
+	keepass1HeaderSize = 124
+	// type and size preceding the data of a group or entry field
+	keepass1FieldHeaderSize = 2 + 4
+
+	keepass1FileVersion     uint32 = 0x00030004
+	keepass1FileVersionMask uint32 = 0xFFFFFF00
+
+	// Flags
+	keepass1FlagRijndael = 2
+	keepass1FlagTwofish  = 8
+
+	// Group and entry field types
+	keepass1FieldComment      = 0x0000
+	keepass1FieldEnd          = 0xFFFF
+	keepass1GroupID           = 0x0001
+	keepass1GroupName         = 0x0002
+	keepass1GroupLevel        = 0x0008
+	keepass1EntryUUID         = 0x0001
+	keepass1EntryGroupID      = 0x0002
+	keepass1EntryImage        = 0x0003
+	keepass1EntryTitle        = 0x0004
+	keepass1EntryURL          = 0x0005
+	keepass1EntryUsername     = 0x0006
+	keepass1EntryPassword     = 0x0007
+	keepass1EntryNotes        = 0x0008
+	keepass1EntryCreation     = 0x0009
+	keepass1EntryModification = 0x000A
+	keepass1EntryAccess       = 0x000B
+	keepass1EntryExpiry       = 0x000C
+	keepass1EntryBinaryDesc   = 0x000D
+	keepass1EntryBinaryData   = 0x000E
+
+	keepass1MetaStreamDesc = "bin-stream"
+)
+
+var (
+	// Keepass1CipherTwofish is not a KeePass 2 cipher, it identifies a KeePass 1 Twofish database
+	Keepass1CipherTwofish = []byte{0xad, 0x68, 0xf2, 0x9f, 0x57, 0x6f, 0x4b, 0xb9, 0xa3, 0x6a, 0xd4, 0x7a, 0xf9, 0x65, 0x34, 0x6c}
+
+	keepass1NeverExpires = time.Date(2999, 12, 28, 23, 59, 59, 0, time.UTC)
+
+	errKeePass1WrongKey = errors.New("Wrong key or database file is corrupt")
+)
+
+//KeePass1Reader reads legacy KeePass 1.x (.kdb) databases into the KeePass 2 XML model
+type KeePass1Reader struct {
+	Db           *core.Database
+	XMLReader    *KeePass2XmlReader
+	Version      uint32
+	flags        uint32
+	masterSeed   []byte
+	encryptionIV []byte
+	numGroups    uint32
+	numEntries   uint32
+	contentsHash []byte
+}
+
+type keepass1Group struct {
+	id     uint32
+	name   string
+	level  uint16
+	groups []*keepass1Group
+	xml    *group
+}
+
+type keepass1Entry struct {
+	uuid       []byte
+	groupID    uint32
+	image      uint32
+	title      string
+	url        string
+	username   string
+	password   []byte
+	notes      string
+	created    time.Time
+	modified   time.Time
+	accessed   time.Time
+	expiry     time.Time
+	binaryDesc string
+	binaryData []byte
+}
+
+//NewKeePass1Reader reads into the given database
+func NewKeePass1Reader(db *core.Database) *KeePass1Reader {
+	return &KeePass1Reader{
+		Db: db,
+	}
+}
+
+//ReadHeader reads the fixed size header following the signatures
+func (k *KeePass1Reader) ReadHeader(db io.Reader) error {
+	header := make([]byte, keepass1HeaderSize-8)
+	if _, err := io.ReadFull(db, header); err != nil {
+		return errors.Wrap(err, "unable to read KeePass 1 header")
+	}
+
+	r := bytes.NewReader(header)
+	read := func(data interface{}) error {
+		return binary.Read(r, binary.LittleEndian, data)
+	}
+
+	k.masterSeed = make([]byte, 16)
+	k.encryptionIV = make([]byte, 16)
+	k.contentsHash = make([]byte, 32)
+	transformSeed := make([]byte, 32)
+	var rounds uint32
+
+	for _, field := range []interface{}{&k.flags, &k.Version, k.masterSeed, k.encryptionIV,
+		&k.numGroups, &k.numEntries, k.contentsHash, transformSeed, &rounds} {
+		if err := read(field); err != nil {
+			return errors.Wrap(err, "KeePass 1 header read failed")
+		}
+	}
+
+	if k.Version&keepass1FileVersionMask != keepass1FileVersion&keepass1FileVersionMask {
+		return errors.New("unsupported KeePass 1 database version")
+	}
+
+	switch {
+	case k.flags&keepass1FlagRijndael != 0:
+		k.Db.Cipher = core.UUID{Data: core.Keepass2CipherAes}
+	case k.flags&keepass1FlagTwofish != 0:
+		k.Db.Cipher = core.UUID{Data: Keepass1CipherTwofish}
+	default:
+		return errors.New("unsupported KeePass 1 cipher")
+	}
+
+	if rounds == 0 {
+		return errors.New("invalid transform rounds")
+	}
+
+	k.Db.LegacyKey = true
+	k.Db.CompressionAlgo = core.CompressionNone
+	k.Db.TransformSeed = transformSeed
+	k.Db.TransformRounds = uint64(rounds)
+
+	log.Debugf("KeePass 1 database version: %x groups: %d entries: %d", k.Version, k.numGroups, k.numEntries)
+	return nil
+}
+
+//ReadPayload decrypts and parses the groups and entries
+func (k *KeePass1Reader) ReadPayload(db *os.File) error {
+	encrypted, err := ioutil.ReadAll(db)
+	if err != nil {
+		return errors.Wrap(err, "unable to read KeePass 1 content")
+	}
+	return k.decrypt(encrypted)
+}
+
+// decrypt the content following the header with the transformed master key,
+// errKeePass1WrongKey is returned when it isn't the key of the database
+func (k *KeePass1Reader) decrypt(encrypted []byte) error {
+	if len(k.Db.TransformedMasterKey) == 0 {
+		return errors.New("missing transformed master key")
+	}
+
+	h := sha256.New()
+	h.Write(k.masterSeed)
+	h.Write(k.Db.TransformedMasterKey)
+	finalKey := h.Sum(nil)
+
+	var block cipher.Block
+	var err error
+	if bytes.Equal(k.Db.Cipher.Data, Keepass1CipherTwofish) {
+		block, err = twofish.NewCipher(finalKey)
+	} else {
+		block, err = aes.NewCipher(finalKey)
+	}
+	secure.Wipe(finalKey)
+	if err != nil {
+		return errors.Wrap(err, "New cipher error")
+	}
+
+	if len(encrypted) == 0 || len(encrypted)%block.BlockSize() != 0 {
+		return errKeePass1WrongKey
+	}
+
+	content := make([]byte, len(encrypted))
+	cipher.NewCBCDecrypter(block, k.encryptionIV).CryptBlocks(content, encrypted)
+	defer secure.Wipe(content)
+
+	content, err = unpad(content, block.BlockSize())
+	if err != nil {
+		return errKeePass1WrongKey
+	}
+
+	contentsHash := sha256.Sum256(content)
+	if !bytes.Equal(contentsHash[:], k.contentsHash) {
+		return errKeePass1WrongKey
+	}
+
+	// every group and entry takes at least the end field, a count beyond the
+	// content is corrupt and mustn't size the slices
+	if (uint64(k.numGroups)+uint64(k.numEntries))*keepass1FieldHeaderSize > uint64(len(content)) {
+		return errors.New("group and entry counts exceed the content")
+	}
+
+	r := bytes.NewReader(content)
+
+	groups := make([]*keepass1Group, 0, k.numGroups)
+	for i := uint32(0); i < k.numGroups; i++ {
+		g, err := readKeePass1Group(r)
+		if err != nil {
+			return errors.Wrapf(err, "group %d", i)
+		}
+		groups = append(groups, g)
+	}
+
+	entries := make([]*keepass1Entry, 0, k.numEntries)
+	for i := uint32(0); i < k.numEntries; i++ {
+		e, err := readKeePass1Entry(r)
+		if err != nil {
+			return errors.Wrapf(err, "entry %d", i)
+		}
+		entries = append(entries, e)
+	}
+
+	k.XMLReader, err = k.buildXML(groups, entries)
+	for _, e := range entries {
+		secure.Wipe(e.password)
+	}
+	return err
+}
+
+// unpad removes PKCS#7 padding
+func unpad(b []byte, blockSize int) ([]byte, error) {
+	if len(b) == 0 {
+		return nil, errors.New("empty content")
+	}
+	padLen := int(b[len(b)-1])
+	if padLen == 0 || padLen > blockSize || padLen > len(b) {
+		return nil, errors.New("invalid padding")
+	}
+	for _, p := range b[len(b)-padLen:] {
+		if int(p) != padLen {
+			return nil, errors.New("invalid padding")
+		}
+	}
+	return b[:len(b)-padLen], nil
+}
+
+// readKeePass1Field returns the field type and its data
+func readKeePass1Field(r *bytes.Reader) (uint16, []byte, error) {
+	var fieldType uint16
+	var fieldSize uint32
+	if err := binary.Read(r, binary.LittleEndian, &fieldType); err != nil {
+		return 0, nil, errors.Wrap(err, "invalid field type")
+	}
+	if err := binary.Read(r, binary.LittleEndian, &fieldSize); err != nil {
+		return 0, nil, errors.Wrap(err, "invalid field size")
+	}
+	if int64(fieldSize) > int64(r.Len()) {
+		return 0, nil, errors.Errorf("field size %d exceeds remaining data", fieldSize)
+	}
+
+	data := make([]byte, fieldSize)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return 0, nil, errors.Wrap(err, "invalid field data")
+	}
+	return fieldType, data, nil
+}
+
+func readKeePass1Group(r *bytes.Reader) (*keepass1Group, error) {
+	g := &keepass1Group{}
+	for {
+		fieldType, data, err := readKeePass1Field(r)
+		if err != nil {
+			return nil, err
+		}
+
+		switch fieldType {
+		case keepass1FieldEnd:
+			return g, nil
+		case keepass1GroupID:
+			if len(data) != 4 {
+				return nil, errors.New("invalid group id size")
+			}
+			g.id = binary.LittleEndian.Uint32(data)
+		case keepass1GroupName:
+			g.name = keepass1String(data)
+		case keepass1GroupLevel:
+			if len(data) != 2 {
+				return nil, errors.New("invalid group level size")
+			}
+			g.level = binary.LittleEndian.Uint16(data)
+		}
+	}
+}
+
+func readKeePass1Entry(r *bytes.Reader) (*keepass1Entry, error) {
+	e := &keepass1Entry{}
+	for {
+		fieldType, data, err := readKeePass1Field(r)
+		if err != nil {
+			return nil, err
+		}
+
+		switch fieldType {
+		case keepass1FieldEnd:
+			return e, nil
+		case keepass1FieldComment:
+		case keepass1EntryUUID:
+			if len(data) != core.UUIDLength {
+				return nil, errors.New("invalid entry uuid size")
+			}
+			e.uuid = data
+		case keepass1EntryGroupID:
+			if len(data) != 4 {
+				return nil, errors.New("invalid entry group id size")
+			}
+			e.groupID = binary.LittleEndian.Uint32(data)
+		case keepass1EntryImage:
+			if len(data) != 4 {
+				return nil, errors.New("invalid entry image size")
+			}
+			e.image = binary.LittleEndian.Uint32(data)
+		case keepass1EntryTitle:
+			e.title = keepass1String(data)
+		case keepass1EntryURL:
+			e.url = keepass1String(data)
+		case keepass1EntryUsername:
+			e.username = keepass1String(data)
+		case keepass1EntryPassword:
+			e.password = bytes.TrimRight(data, "\x00")
+		case keepass1EntryNotes:
+			e.notes = keepass1String(data)
+		case keepass1EntryCreation:
+			e.created, err = keepass1Time(data)
+		case keepass1EntryModification:
+			e.modified, err = keepass1Time(data)
+		case keepass1EntryAccess:
+			e.accessed, err = keepass1Time(data)
+		case keepass1EntryExpiry:
+			e.expiry, err = keepass1Time(data)
+		case keepass1EntryBinaryDesc:
+			e.binaryDesc = keepass1String(data)
+		case keepass1EntryBinaryData:
+			e.binaryData = data
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// keepass1String removes the null terminator
+func keepass1String(b []byte) string {
+	return string(bytes.TrimRight(b, "\x00"))
+}
+
+// keepass1Time unpacks the 5 byte date and time
+func keepass1Time(b []byte) (time.Time, error) {
+	if len(b) != 5 {
+		return time.Time{}, errors.New("invalid time size")
+	}
+
+	year := int(b[0])<<6 | int(b[1])>>2
+	month := time.Month((int(b[1])&0x03)<<2 | int(b[2])>>6)
+	day := (int(b[2]) >> 1) & 0x1F
+	hour := (int(b[2])&0x01)<<4 | int(b[3])>>4
+	minute := (int(b[3])&0x0F)<<2 | int(b[4])>>6
+	second := int(b[4]) & 0x3F
+
+	return time.Date(year, month, day, hour, minute, second, 0, time.UTC), nil
+}
+
+// times maps the entry times, KeePass 1 marks entries which never expire
+// with a fixed expiry time
+func (e *keepass1Entry) times() *times {
+	t := &times{
+		CreationTime:         formatTime(e.created),
+		LastModificationTime: formatTime(e.modified),
+		LastAccessTime:       formatTime(e.accessed),
+		ExpiryTime:           formatTime(e.expiry),
+		Expires:              "True",
+		LocationChanged:      formatTime(e.modified),
+	}
+	if e.expiry.IsZero() || e.expiry.Equal(keepass1NeverExpires) {
+		t.Expires = "False"
+	}
+	return t
+}
+
+// isMetaStream identifies entries KeePass 1 uses to store its own settings
+func (e *keepass1Entry) isMetaStream() bool {
+	return e.binaryDesc == keepass1MetaStreamDesc && e.title == "Meta-Info" &&
+		e.username == "SYSTEM" && e.url == "$" && len(e.binaryData) > 0
+}
+
+// buildXML maps the groups and entries into the KeePass 2 model, passwords are
+// protected with a random inner stream just as they are in a KeePass 2 database
+func (k *KeePass1Reader) buildXML(groups []*keepass1Group, entries []*keepass1Entry) (*KeePass2XmlReader, error) {
+	var randomKey [32]byte
+	if _, err := rand.Read(randomKey[:]); err != nil {
+		return nil, errors.Wrap(err, "unable to generate stream key")
+	}
+
+	xmlReader := &KeePass2XmlReader{
+		KeePass2RandomStream: NewKeePass2RandomStream(innerStreamSalsa20Iv, &randomKey),
+	}
+
+	byID := make(map[uint32]*keepass1Group)
+	var roots []*keepass1Group
+	var parents []*keepass1Group
+
+	for _, g := range groups {
+		byID[g.id] = g
+		for len(parents) > int(g.level) {
+			parents = parents[:len(parents)-1]
+		}
+		if len(parents) == 0 {
+			roots = append(roots, g)
+		} else {
+			parent := parents[len(parents)-1]
+			parent.groups = append(parent.groups, g)
+		}
+		parents = append(parents, g)
+	}
+
+	for _, e := range entries {
+		if e.isMetaStream() {
+			log.Debugf("skipping meta stream entry: %s", e.notes)
+			continue
+		}
+
+		g, ok := byID[e.groupID]
+		if !ok {
+			return nil, errors.Errorf("entry references unknown group: %d", e.groupID)
+		}
+		if g.xml == nil {
+			g.xml = &group{}
+		}
+
+		xe := entry{
+			UUID:  base64.StdEncoding.EncodeToString(e.uuid),
+			Times: e.times(),
+			StringEntry: []stringEntry{
+				{Key: "Title", Value: value{Data: e.title}},
+				{Key: "UserName", Value: value{Data: e.username}},
+				{Key: "Password", Value: value{Data: string(e.password), Protected: "True"}},
+				{Key: "URL", Value: value{Data: e.url}},
+				{Key: "Notes", Value: value{Data: e.notes}},
+			},
+		}
+
+		if len(e.binaryDesc) > 0 && len(e.binaryData) > 0 {
+			ref := strconv.Itoa(len(xmlReader.KeePass2XmlFile.Meta.Binaries))
+			xmlReader.KeePass2XmlFile.Meta.Binaries = append(xmlReader.KeePass2XmlFile.Meta.Binaries, metaBinary{
+				ID:   ref,
+				Data: base64.StdEncoding.EncodeToString(e.binaryData),
+			})
+			xe.Binaries = append(xe.Binaries, entryBinary{Key: e.binaryDesc, Value: binaryRef{Ref: ref}})
+		}
+
+		g.xml.Entry = append(g.xml.Entry, xe)
+	}
+
+	var build func(groups []*keepass1Group) []group
+	build = func(groups []*keepass1Group) []group {
+		var result []group
+		for _, g := range groups {
+			xg := group{}
+			if g.xml != nil {
+				xg = *g.xml
+			}
+			xg.UUID = keepass1GroupUUID(g.id)
+			xg.Name = g.name
+			xg.Groups = build(g.groups)
+			result = append(result, xg)
+		}
+		return result
+	}
+
+	xmlReader.KeePass2XmlFile.Root.Groups = build(roots)
+
+	if err := protectValues(&xmlReader.KeePass2XmlFile, xmlReader.KeePass2RandomStream); err != nil {
+		return nil, err
+	}
+
+	return xmlReader, nil
+}
+
+// keepass1GroupUUID derives a stable UUID from the group id
+func keepass1GroupUUID(id uint32) string {
+	uuid := make([]byte, core.UUIDLength)
+	binary.LittleEndian.PutUint32(uuid, id)
+	return base64.StdEncoding.EncodeToString(uuid)
+}
@@ -0,0 +1,371 @@
+package format_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"golang.org/x/crypto/twofish"
+
+	"github.com/simonhayward/gkeepassxreader/core"
+	"github.com/simonhayward/gkeepassxreader/format"
+	"github.com/simonhayward/gkeepassxreader/keys"
+)
+
+const (
+	kdbFlagRijndael = 2
+	kdbFlagTwofish  = 8
+)
+
+type kdbFields struct {
+	bytes.Buffer
+}
+
+func (f *kdbFields) field(fieldType uint16, data []byte) {
+	binary.Write(f, binary.LittleEndian, fieldType)
+	binary.Write(f, binary.LittleEndian, uint32(len(data)))
+	f.Write(data)
+}
+
+func (f *kdbFields) uint32Field(fieldType uint16, v uint32) {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, v)
+	f.field(fieldType, b)
+}
+
+func (f *kdbFields) stringField(fieldType uint16, s string) {
+	f.field(fieldType, append([]byte(s), 0))
+}
+
+func (f *kdbFields) group(id uint32, name string, level uint16) {
+	f.uint32Field(0x0001, id)
+	f.stringField(0x0002, name)
+	b := make([]byte, 2)
+	binary.LittleEndian.PutUint16(b, level)
+	f.field(0x0008, b)
+	f.field(0xFFFF, nil)
+}
+
+func (f *kdbFields) entry(uuid byte, groupID uint32, title, username, password, url, notes, binaryDesc string, binaryData []byte) {
+	f.field(0x0001, bytes.Repeat([]byte{uuid}, 16))
+	f.uint32Field(0x0002, groupID)
+	f.uint32Field(0x0003, 0)
+	f.stringField(0x0004, title)
+	f.stringField(0x0005, url)
+	f.stringField(0x0006, username)
+	f.stringField(0x0007, password)
+	f.stringField(0x0008, notes)
+	// 2021-03-04 05:06:07
+	f.field(0x0009, []byte{0x1F, 0x94, 0xC8, 0x51, 0x87})
+	f.stringField(0x000D, binaryDesc)
+	f.field(0x000E, binaryData)
+	f.field(0xFFFF, nil)
+}
+
+// writeKdb encrypts a KeePass 1 database with the raw composite key
+func writeKdb(flags uint32, rawKey []byte) *os.File {
+	contents := &kdbFields{}
+	contents.group(1, "General", 0)
+	contents.group(2, "Internet", 1)
+	contents.group(3, "Email", 0)
+	contents.entry(0xAA, 2, "KDB Entry", "kdbuser", "kdbsecret", "https://example.com/", "kdb notes", "attach.txt", []byte("attached data"))
+	contents.entry(0xBB, 3, "Mail", "mailuser", "mailsecret", "", "", "", nil)
+	contents.entry(0xCC, 1, "Meta-Info", "SYSTEM", "", "$", "KPX_GROUP_TREE_STATE", "bin-stream", []byte{0x01})
+
+	masterSeed := bytes.Repeat([]byte{0x11}, 16)
+	iv := bytes.Repeat([]byte{0x22}, 16)
+	transformSeed := bytes.Repeat([]byte{0x33}, 32)
+	rounds := uint32(100)
+
+	transformBlock, err := aes.NewCipher(transformSeed)
+	Expect(err).ToNot(HaveOccurred())
+	transformed := append([]byte(nil), rawKey...)
+	for i := uint32(0); i < rounds; i++ {
+		transformBlock.Encrypt(transformed[:16], transformed[:16])
+		transformBlock.Encrypt(transformed[16:], transformed[16:])
+	}
+	transformedKey := sha256.Sum256(transformed)
+	finalKey := sha256.Sum256(append(append([]byte(nil), masterSeed...), transformedKey[:]...))
+
+	var block cipher.Block
+	if flags&kdbFlagTwofish != 0 {
+		block, err = twofish.NewCipher(finalKey[:])
+	} else {
+		block, err = aes.NewCipher(finalKey[:])
+	}
+	Expect(err).ToNot(HaveOccurred())
+
+	plaintext := contents.Bytes()
+	contentsHash := sha256.Sum256(plaintext)
+	padLen := block.BlockSize() - len(plaintext)%block.BlockSize()
+	plaintext = append(plaintext, bytes.Repeat([]byte{byte(padLen)}, padLen)...)
+	encrypted := make([]byte, len(plaintext))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, plaintext)
+
+	header := &bytes.Buffer{}
+	for _, v := range []interface{}{uint32(0x9AA2D903), uint32(0xB54BFB65), flags, uint32(0x00030004),
+		masterSeed, iv, uint32(3), uint32(3), contentsHash[:], transformSeed, rounds} {
+		binary.Write(header, binary.LittleEndian, v)
+	}
+
+	f, err := ioutil.TempFile("", "keepass1-*.kdb")
+	Expect(err).ToNot(HaveOccurred())
+	_, err = f.Write(append(header.Bytes(), encrypted...))
+	Expect(err).ToNot(HaveOccurred())
+	_, err = f.Seek(0, 0)
+	Expect(err).ToNot(HaveOccurred())
+	return f
+}
+
+var _ = Describe("KeePass 1 databases", func() {
+
+	var (
+		entryService *format.EntryServiceOp
+		db           *os.File
+	)
+
+	BeforeEach(func() {
+		entryService = &format.EntryServiceOp{}
+	})
+
+	AfterEach(func() {
+		db.Close()
+		os.Remove(db.Name())
+	})
+
+	passwordKey := func(password string) []byte {
+		k := sha256.Sum256([]byte(password))
+		return k[:]
+	}
+
+	Context("when opening an AES database", func() {
+		It("succeeds and maps groups, entries and attachments", func() {
+			db = writeKdb(kdbFlagRijndael, passwordKey("kdbpw"))
+
+			reader, err := format.OpenDatabase(keys.MasterKey("kdbpw", nil), db)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(reader.IsKeePass1()).To(BeTrue())
+			Expect(reader.Db.Cipher.Data).To(Equal(core.Keepass2CipherAes))
+
+			entryService.XMLReader = reader.XMLReader
+			entries, err := entryService.List()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entries).To(HaveLen(2))
+			Expect(entries[0].Group).To(Equal("Internet"))
+			Expect(entries[1].Group).To(Equal("Email"))
+
+			entry, err := entryService.SearchByTerm("KDB Entry")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entry).ToNot(BeNil())
+			Expect(entry.UUID).To(Equal(hex.EncodeToString(bytes.Repeat([]byte{0xAA}, 16))))
+			Expect(entry.Username.String()).To(Equal("kdbuser"))
+			Expect(entry.Password.Protected).To(BeTrue())
+			Expect(entry.Password.String()).To(Equal("kdbsecret"))
+			Expect(entry.URL.String()).To(Equal("https://example.com/"))
+			Expect(entry.Notes.String()).To(Equal("kdb notes"))
+			Expect(entry.Attachments).To(Equal([]format.Attachment{{Name: "attach.txt", Data: []byte("attached data")}}))
+			Expect(entry.Times.Created).To(Equal(time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)))
+			Expect(entry.Times.Expires).To(BeFalse())
+
+			entry, err = entryService.SearchByTerm("Mail")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entry.Password.String()).To(Equal("mailsecret"))
+
+			entry, err = entryService.SearchByTerm("Meta-Info")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entry).To(BeNil())
+		})
+
+		It("fails with the wrong password", func() {
+			db = writeKdb(kdbFlagRijndael, passwordKey("kdbpw"))
+
+			_, err := format.OpenDatabase(keys.MasterKey("wrong", nil), db)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("fails with a challenge-response key", func() {
+			db = writeKdb(kdbFlagRijndael, passwordKey("kdbpw"))
+
+			hmacKey, err := keys.NewHmacSha1Key(bytes.Repeat([]byte{0x0b}, keys.HmacSha1SecretSize))
+			Expect(err).ToNot(HaveOccurred())
+			key := keys.MasterKey("kdbpw", nil)
+			key.AddChallengeResponseKey(hmacKey)
+
+			_, err = format.OpenDatabase(key, db)
+			Expect(err).To(MatchError(ContainSubstring("KeePass 1 databases don't support challenge-response keys")))
+		})
+
+		It("fails when the header counts more groups than the content holds", func() {
+			db = writeKdb(kdbFlagRijndael, passwordKey("kdbpw"))
+			// the group count follows the signatures, flags, version, seed and iv
+			_, err := db.WriteAt([]byte{0xFF, 0xFF, 0xFF, 0xFF}, 48)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = format.OpenDatabase(keys.MasterKey("kdbpw", nil), db)
+			Expect(err).To(MatchError(ContainSubstring("group and entry counts exceed the content")))
+		})
+	})
+
+	Context("when opening a Twofish database", func() {
+		It("succeeds", func() {
+			db = writeKdb(kdbFlagTwofish, passwordKey("kdbpw"))
+
+			reader, err := format.OpenDatabase(keys.MasterKey("kdbpw", nil), db)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(reader.Db.Cipher.Data).To(Equal(format.Keepass1CipherTwofish))
+
+			info, err := reader.Info()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(info.Format).To(Equal(format.FormatKeePass1))
+			Expect(info.Cipher).To(Equal("Twofish"))
+			Expect(info.Compression).To(Equal("none"))
+			Expect(info.Entries).To(Equal(2))
+
+			entryService.XMLReader = reader.XMLReader
+			entry, err := entryService.SearchByTerm("KDB Entry")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entry.Password.String()).To(Equal("kdbsecret"))
+		})
+	})
+
+	Context("when opening a database whose password isn't ASCII", func() {
+		It("succeeds with the password hashed as UTF-8", func() {
+			db = writeKdb(kdbFlagRijndael, passwordKey("pässwörd"))
+
+			_, err := format.OpenDatabase(keys.MasterKey("pässwörd", nil), db)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("succeeds with the password hashed as Windows-1252", func() {
+			// "pässwörd" as KeePass 1.x and KeePassX 0.4 encode it
+			db = writeKdb(kdbFlagRijndael, passwordKey("p\xe4ssw\xf6rd"))
+
+			reader, err := format.OpenDatabase(keys.MasterKey("pässwörd", nil), db)
+			Expect(err).ToNot(HaveOccurred())
+
+			entryService.XMLReader = reader.XMLReader
+			entry, err := entryService.SearchByTerm("KDB Entry")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entry.Password.String()).To(Equal("kdbsecret"))
+		})
+
+		It("fails with the wrong password", func() {
+			db = writeKdb(kdbFlagRijndael, passwordKey("p\xe4ssw\xf6rd"))
+
+			_, err := format.OpenDatabase(keys.MasterKey("pässwort", nil), db)
+			Expect(err).To(MatchError(ContainSubstring("Wrong key or database file is corrupt")))
+		})
+	})
+
+	Context("when opening a database with a password and key file", func() {
+		It("succeeds", func() {
+			fileKey := bytes.Repeat([]byte{0x44}, 32)
+			keyFile, err := ioutil.TempFile("", "keepass1-key")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(keyFile.Name())
+			defer keyFile.Close()
+			_, err = keyFile.WriteString(hex.EncodeToString(fileKey))
+			Expect(err).ToNot(HaveOccurred())
+
+			rawKey := sha256.Sum256(append(passwordKey("kdbpw"), fileKey...))
+			db = writeKdb(kdbFlagRijndael, rawKey[:])
+
+			reader, err := format.OpenDatabase(keys.MasterKey("kdbpw", keyFile), db)
+			Expect(err).ToNot(HaveOccurred())
+
+			entryService.XMLReader = reader.XMLReader
+			entry, err := entryService.SearchByTerm("KDB Entry")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entry.Password.String()).To(Equal("kdbsecret"))
+		})
+	})
+})
+
+// the test databases are written by test_data/GenerateKdb.go rather than
+// KeePass 1.x itself
+var _ = Describe("KeePass 1 test databases", func() {
+
+	DescribeTable("reads the groups, entries and attachments and hides the meta streams",
+		func(name, cipher string) {
+			db, err := os.Open(name)
+			Expect(err).ToNot(HaveOccurred())
+			defer db.Close()
+
+			reader, err := format.OpenDatabase(keys.MasterKey("masterpw", nil), db)
+			Expect(err).ToNot(HaveOccurred())
+			defer reader.Close()
+
+			info, err := reader.Info()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(info.Format).To(Equal(format.FormatKeePass1))
+			Expect(info.Cipher).To(Equal(cipher))
+			Expect(info.KDF.Rounds).To(Equal(uint64(6000)))
+			Expect(info.Groups).To(Equal(3))
+			Expect(info.Entries).To(Equal(3))
+
+			groups, err := reader.XMLReader.Groups()
+			Expect(err).ToNot(HaveOccurred())
+			var paths []string
+			for _, g := range groups {
+				paths = append(paths, strings.Join(g.Path, "/"))
+			}
+			Expect(paths).To(Equal([]string{"Internet", "Internet/Forums", "eMail"}))
+
+			entryService := &format.EntryServiceOp{XMLReader: reader.XMLReader}
+			entries, err := entryService.List()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entryService.Decode(entries)).To(Succeed())
+			Expect(entries).To(HaveLen(3))
+
+			sample := entries[0]
+			Expect(sample.Title.String()).To(Equal("Sample Entry"))
+			Expect(sample.Group).To(Equal("Internet"))
+			Expect(sample.UUID).To(Equal(strings.Repeat("11", 16)))
+			Expect(sample.Username.String()).To(Equal("User Name"))
+			Expect(sample.Password.String()).To(Equal("Password"))
+			Expect(sample.URL.String()).To(Equal("http://www.example.com/"))
+			Expect(sample.Notes.String()).To(Equal("Notes\r\nover two lines"))
+			Expect(sample.Times.Created).To(Equal(time.Date(2009, 6, 14, 10, 20, 30, 0, time.UTC)))
+			Expect(sample.Times.Modified).To(Equal(time.Date(2010, 2, 3, 4, 5, 6, 0, time.UTC)))
+			Expect(sample.Times.Expires).To(BeFalse())
+
+			forum := entries[1]
+			Expect(forum.Title.String()).To(Equal("Café Forum"))
+			Expect(forum.Path).To(Equal([]string{"Internet", "Forums"}))
+			Expect(forum.Username.String()).To(Equal("jürgen"))
+			Expect(forum.Password.String()).To(Equal("pässwörd"))
+			Expect(forum.Attachments).To(Equal([]format.Attachment{{Name: "readme.txt", Data: []byte("attached file contents\n")}}))
+
+			mail := entries[2]
+			Expect(mail.Title.String()).To(Equal("Mail Account"))
+			Expect(mail.Group).To(Equal("eMail"))
+			Expect(mail.Password.String()).To(Equal("mailpass"))
+			Expect(mail.Times.Expires).To(BeTrue())
+			Expect(mail.Times.Expiry).To(Equal(time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)))
+
+			entry, err := entryService.SearchByTerm("Meta-Info")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entry).To(BeNil())
+		},
+		Entry("AES", "test_data/Basic.kdb", "AES-256"),
+		Entry("Twofish", "test_data/Twofish.kdb", "Twofish"),
+	)
+
+	It("fails with the wrong password", func() {
+		db, err := os.Open("test_data/Basic.kdb")
+		Expect(err).ToNot(HaveOccurred())
+		defer db.Close()
+
+		_, err = format.OpenDatabase(keys.MasterKey("wrong", nil), db)
+		Expect(err).To(MatchError(ContainSubstring("Wrong key or database file is corrupt")))
+	})
+})
@@ -1,6 +1,7 @@
 package format
 
 import (
+	"github.com/simonhayward/gkeepassxreader/secure"
 	"github.com/simonhayward/gkeepassxreader/streams"
 )
 
@@ -35,6 +36,13 @@ func (r *KeePass2RandomStream) Process(offset int, ciphertext []byte) ([]byte, e
 	for i := 0; i < len(ciphertext); i++ {
 		result[i] = ciphertext[i] ^ randomData[i]
 	}
+	secure.Wipe(r.buffer)
 
 	return result, nil
 }
+
+//Wipe destroys the stream key
+func (r *KeePass2RandomStream) Wipe() {
+	secure.Wipe(r.buffer)
+	r.cipherStream.Wipe()
+}
@@ -3,10 +3,10 @@ package format
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"crypto/aes"
 	"crypto/sha256"
 	"encoding/binary"
-	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
@@ -14,6 +14,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/simonhayward/gkeepassxreader/core"
 	"github.com/simonhayward/gkeepassxreader/keys"
+	"github.com/simonhayward/gkeepassxreader/secure"
 	"github.com/simonhayward/gkeepassxreader/streams"
 	log "github.com/sirupsen/logrus"
 )
@@ -57,21 +58,34 @@ type KeePass2Reader struct {
 	streamStartBytes   []byte
 	protectedStreamKey []byte
 	headerStoredData   []byte
+	version            uint32
+	fileVersion        uint32
+	innerStreamID      uint32
+	keepass1           *KeePass1Reader
+	//Limits bound the header and blocks read
+	Limits Limits
 }
 
 //NewKeePass2Reader with default values
 func NewKeePass2Reader() *KeePass2Reader {
 	return &KeePass2Reader{
-		Db: core.NewDatabase(),
+		Db:     core.NewDatabase(),
+		Limits: DefaultLimits,
 	}
 }
 
 // OpenDatabase with key
 func OpenDatabase(masterKey *keys.CompositeKey, dbFile *os.File) (*KeePass2Reader, error) {
+	return OpenDatabaseContext(context.Background(), masterKey, dbFile, nil)
+}
+
+//OpenDatabaseContext is OpenDatabase stopping early with ctx's error when ctx
+//is done, progress is reported when not nil
+func OpenDatabaseContext(ctx context.Context, masterKey *keys.CompositeKey, dbFile *os.File, progress ProgressFunc) (*KeePass2Reader, error) {
 	k := NewKeePass2Reader()
-	err := k.ReadDatabase(dbFile, masterKey)
+	err := k.ReadDatabaseContext(ctx, dbFile, masterKey, progress)
 	if err != nil {
-		return nil, fmt.Errorf("read database error: %s", err.Error())
+		return nil, errors.Wrap(err, "read database error")
 	}
 
 	return k, nil
@@ -79,11 +93,53 @@ func OpenDatabase(masterKey *keys.CompositeKey, dbFile *os.File) (*KeePass2Reade
 
 //ReadDatabase reads the input database
 func (k *KeePass2Reader) ReadDatabase(db *os.File, compositeKey *keys.CompositeKey) error {
+	return k.ReadDatabaseContext(context.Background(), db, compositeKey, nil)
+}
+
+//ReadDatabaseContext is ReadDatabase stopping early with ctx's error when ctx
+//is done, progress is reported when not nil
+func (k *KeePass2Reader) ReadDatabaseContext(ctx context.Context, db *os.File, compositeKey *keys.CompositeKey, progress ProgressFunc) error {
+
+	if err := k.ReadHeader(db); err != nil {
+		return err
+	}
+
+	if err := k.TransformKey(ctx, compositeKey, progress); err != nil {
+		return errors.Wrap(err, "Unable to calculate master key")
+	}
+
+	return k.ReadPayloadContext(ctx, db, compositeKey, progress)
+}
+
+//TransformKey transforms the composite key with the seed and rounds of the
+//header which has been read, progress is reported when not nil
+func (k *KeePass2Reader) TransformKey(ctx context.Context, compositeKey *keys.CompositeKey, progress ProgressFunc) error {
+	if err := k.checkChallengeResponse(compositeKey); err != nil {
+		return err
+	}
+
+	rounds := k.Db.TransformRounds
+	if progress == nil {
+		return k.Db.SetKeyContext(ctx, compositeKey, k.Db.TransformSeed, nil)
+	}
+
+	progress(Progress{Stage: StageKDF, KDFRounds: rounds})
+	return k.Db.SetKeyContext(ctx, compositeKey, k.Db.TransformSeed, func(done uint64) {
+		progress(Progress{Stage: StageKDF, KDFRounds: rounds, KDFDone: done})
+	})
+}
+
+//ReadHeader reads and checks the unencrypted database header
+func (k *KeePass2Reader) ReadHeader(db io.Reader) error {
 
 	if err := k.CheckSignature(db); err != nil {
 		return errors.Wrap(err, "Signature check failed")
 	}
 
+	if k.keepass1 != nil {
+		return k.keepass1.ReadHeader(db)
+	}
+
 	version, err := k.CheckVersion(db)
 	if err != nil {
 		return errors.Wrap(err, "Version check failed")
@@ -103,37 +159,49 @@ func (k *KeePass2Reader) ReadDatabase(db *os.File, compositeKey *keys.CompositeK
 		return errors.Wrap(err, "Header check failed")
 	}
 
-	if err := k.Db.SetKey(compositeKey, k.transformSeed); err != nil {
-		return errors.Wrap(err, "Unable to calculate master key")
-	}
+	k.version = version
+	k.Db.TransformSeed = k.transformSeed
 
-	h := sha256.New()
-	h.Write(k.masterSeed)
-	h.Write(k.Db.TransformedMasterKey)
-	finalKey := h.Sum(nil)
+	return nil
+}
 
-	block, err := aes.NewCipher(finalKey)
-	if err != nil {
-		return errors.Wrap(err, "New AES Cipher error")
-	}
+//ReadPayload decrypts the database body with the transformed master key, any
+//challenge-response components of the composite key are challenged with the master seed
+func (k *KeePass2Reader) ReadPayload(db *os.File, compositeKey *keys.CompositeKey) error {
+	return k.ReadPayloadContext(context.Background(), db, compositeKey, nil)
+}
 
-	cipherStream, err := streams.NewSymmetricCipherStream(block, k.encryptionIV, db, streams.DirectionDecrypt)
-	if err != nil {
-		return errors.Wrap(err, "Cipher stream error")
+//ReadPayloadContext is ReadPayload stopping early with ctx's error when ctx is
+//done, progress is reported when not nil
+func (k *KeePass2Reader) ReadPayloadContext(ctx context.Context, db *os.File, compositeKey *keys.CompositeKey, progress ProgressFunc) error {
+
+	if err := ctx.Err(); err != nil {
+		return err
 	}
 
-	var realStart []byte
-	cipherStream.ReadData(&realStart, 32)
+	if k.keepass1 != nil {
+		if err := k.checkChallengeResponse(compositeKey); err != nil {
+			return err
+		}
+		if err := k.readKeePass1Payload(ctx, db, compositeKey, progress); err != nil {
+			return err
+		}
+		k.XMLReader = k.keepass1.XMLReader
+		progress.report(Progress{Stage: StageParse, EntriesParsed: countEntries(k.XMLReader.KeePass2XmlFile.Root.Groups)})
+		return nil
+	}
 
-	if !bytes.Equal(realStart, k.streamStartBytes) {
-		return errors.New("Wrong key or database file is corrupt")
+	cipherStream, err := k.decryptStream(db, compositeKey)
+	if err != nil {
+		return err
 	}
 
-	hashBlock := streams.NewHashedBlock(cipherStream.BlockMode, cipherStream)
+	hashBlock := k.hashedBlock(ctx, cipherStream)
 	var result []byte
 	var bytesRead int
 	byteChunks := 65500  // reads into result in byte chunks sizes
 
+	progress.report(Progress{Stage: StageDecrypt})
 	for {
 		bytesRead, err = hashBlock.ReadData(&result, byteChunks)
 		log.Debugf("bytes read from hashBlock: %d", bytesRead)
@@ -144,6 +212,7 @@ func (k *KeePass2Reader) ReadDatabase(db *os.File, compositeKey *keys.CompositeK
 		if bytesRead == 0 {
 			break
 		}
+		progress.report(Progress{Stage: StageDecrypt, BytesDecrypted: int64(len(result))})
 	}
 
 	var xmlDevice io.Reader
@@ -156,11 +225,10 @@ func (k *KeePass2Reader) ReadDatabase(db *os.File, compositeKey *keys.CompositeK
 
 		buf := bytes.NewBuffer(result)
 		zr, err := gzip.NewReader(buf)
-		defer zr.Close()
-
 		if err != nil {
 			return errors.Wrap(err, "gzip new reader failed")
 		}
+		defer zr.Close()
 
 		b, err := ioutil.ReadAll(zr)
 		if err != nil {
@@ -170,18 +238,25 @@ func (k *KeePass2Reader) ReadDatabase(db *os.File, compositeKey *keys.CompositeK
 		xmlDevice = bytes.NewReader(b)
 	}
 
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	progress.report(Progress{Stage: StageParse})
 	randomKey := sha256.Sum256(k.protectedStreamKey)
+	secure.Wipe(k.protectedStreamKey)
 	k.XMLReader, err = NewKeePass2XmlReader(xmlDevice, &randomKey)
 	if err != nil {
 		return errors.Wrap(err, "keepass2xml reader creation failed")
 	}
+	progress.report(Progress{Stage: StageParse, EntriesParsed: countEntries(k.XMLReader.KeePass2XmlFile.Root.Groups)})
 
 	xmlHeaderHash, err := k.XMLReader.HeaderHash()
 	if err != nil {
 		return errors.Wrap(err, "xml header hash error")
 	}
 
-	if !(version < keepass2FileVersion || len(xmlHeaderHash) > 0) {
+	if !(k.version < keepass2FileVersion || len(xmlHeaderHash) > 0) {
 		return errors.New("xml header hash error")
 	}
 
@@ -198,11 +273,109 @@ func (k *KeePass2Reader) ReadDatabase(db *os.File, compositeKey *keys.CompositeK
 	return nil
 }
 
+// decryptStream returns the decrypted payload after its start bytes have been
+// checked
+func (k *KeePass2Reader) decryptStream(db *os.File, compositeKey *keys.CompositeKey) (*streams.SymmetricCipherStream, error) {
+	if len(k.Db.TransformedMasterKey) == 0 {
+		return nil, errors.New("missing transformed master key")
+	}
+
+	challengeResponse, err := compositeKey.Challenge(k.masterSeed)
+	if err != nil {
+		return nil, errors.Wrap(err, "Challenge-response failed")
+	}
+	defer secure.Wipe(challengeResponse)
+
+	h := sha256.New()
+	h.Write(k.masterSeed)
+	h.Write(challengeResponse)
+	h.Write(k.Db.TransformedMasterKey)
+	finalKey := h.Sum(nil)
+
+	block, err := aes.NewCipher(finalKey)
+	secure.Wipe(finalKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "New AES Cipher error")
+	}
+
+	cipherStream, err := streams.NewSymmetricCipherStream(block, k.encryptionIV, db, streams.DirectionDecrypt)
+	if err != nil {
+		return nil, errors.Wrap(err, "Cipher stream error")
+	}
+
+	var realStart []byte
+	cipherStream.ReadData(&realStart, 32)
+
+	if !bytes.Equal(realStart, k.streamStartBytes) {
+		return nil, errors.New("Wrong key or database file is corrupt")
+	}
+
+	return cipherStream, nil
+}
+
+// hashedBlock reads the blocks of the decrypted payload within the limits
+func (k *KeePass2Reader) hashedBlock(ctx context.Context, cipherStream *streams.SymmetricCipherStream) *streams.HashedBlock {
+	hashBlock := streams.NewHashedBlockContext(ctx, cipherStream.BlockMode, cipherStream)
+	hashBlock.MaxBlockSize = k.Limits.MaxBlockSize
+	return hashBlock
+}
+
+// readKeePass1Payload decrypts a KeePass 1 database. KeePass 1.x and KeePassX
+// 0.4 hash a password which isn't ASCII encoded as Windows-1252, so when the
+// UTF-8 key is wrong the key is transformed again with that encoding.
+func (k *KeePass2Reader) readKeePass1Payload(ctx context.Context, db *os.File, compositeKey *keys.CompositeKey, progress ProgressFunc) error {
+	encrypted, err := ioutil.ReadAll(db)
+	if err != nil {
+		return errors.Wrap(err, "unable to read KeePass 1 content")
+	}
+
+	err = k.keepass1.decrypt(encrypted)
+	if err != errKeePass1WrongKey {
+		return err
+	}
+
+	windows1252 := compositeKey.Windows1252()
+	if windows1252 == nil {
+		return err
+	}
+
+	log.Debug("wrong key, trying the password encoded as Windows-1252")
+	if err := k.TransformKey(ctx, windows1252, progress); err != nil {
+		return errors.Wrap(err, "Unable to calculate master key")
+	}
+	return k.keepass1.decrypt(encrypted)
+}
+
+// checkChallengeResponse rejects challenge-response components which KeePass 1
+// databases have no master seed challenge for, rather than ignoring them
+func (k *KeePass2Reader) checkChallengeResponse(compositeKey *keys.CompositeKey) error {
+	if k.keepass1 != nil && compositeKey.HasChallengeResponse() {
+		return errors.New("KeePass 1 databases don't support challenge-response keys")
+	}
+	return nil
+}
+
+//IsKeePass1 reports whether a legacy KeePass 1 database (.kdb) is being read
+func (k *KeePass2Reader) IsKeePass1() bool {
+	return k.keepass1 != nil
+}
+
+//Close wipes the keys and all decrypted values
+func (k *KeePass2Reader) Close() {
+	if k.Db != nil {
+		k.Db.Wipe()
+	}
+	if k.XMLReader != nil {
+		k.XMLReader.Wipe()
+	}
+	secure.Wipe(k.protectedStreamKey)
+}
+
 //CheckSignature inspects to see if this is a valid keepass database
-func (k *KeePass2Reader) CheckSignature(db *os.File) error {
+func (k *KeePass2Reader) CheckSignature(db io.Reader) error {
 
 	signature1Bytes := make([]byte, 4)
-	_, err := db.Read(signature1Bytes)
+	_, err := io.ReadFull(db, signature1Bytes)
 
 	if err != nil {
 		return errors.Wrap(err, "unable to read signature1")
@@ -221,7 +394,7 @@ func (k *KeePass2Reader) CheckSignature(db *os.File) error {
 	}
 
 	signature2Bytes := make([]byte, 4)
-	_, err = db.Read(signature2Bytes)
+	_, err = io.ReadFull(db, signature2Bytes)
 
 	if err != nil {
 		return errors.Wrap(err, "unable to read signature2")
@@ -236,7 +409,8 @@ func (k *KeePass2Reader) CheckSignature(db *os.File) error {
 	}
 
 	if signature2 == keepass1Signature2 {
-		return errors.New("the selected file is an old KeePass 1 database (.kdb)")
+		log.Debug("KeePass 1 database (.kdb)")
+		k.keepass1 = NewKeePass1Reader(k.Db)
 	} else if signature2 != keepass2Signature2 {
 		return errors.New("not a KeePass database")
 	}
@@ -245,9 +419,9 @@ func (k *KeePass2Reader) CheckSignature(db *os.File) error {
 }
 
 //CheckVersion validates the keepass version supported
-func (k *KeePass2Reader) CheckVersion(db *os.File) (uint32, error) {
+func (k *KeePass2Reader) CheckVersion(db io.Reader) (uint32, error) {
 	versionBytes := make([]byte, 4)
-	_, err := db.Read(versionBytes)
+	_, err := io.ReadFull(db, versionBytes)
 
 	if err != nil {
 		return 0, errors.Wrap(err, "unable to read version")
@@ -262,6 +436,7 @@ func (k *KeePass2Reader) CheckVersion(db *os.File) (uint32, error) {
 		return 0, errors.Wrap(err, "binary.Read failed")
 	}
 
+	k.fileVersion = version
 	version = version & keepass2FileVersionCriticalMask
 
 	var maxVersion = keepass2FileVersion & keepass2FileVersionCriticalMask
@@ -288,11 +463,11 @@ func (k *KeePass2Reader) CheckHeaders() error {
 }
 
 // ReadHeaders extracts the headers of the database
-func (k *KeePass2Reader) ReadHeaders(db *os.File) (bool, error) {
+func (k *KeePass2Reader) ReadHeaders(db io.Reader) (bool, error) {
 	headerEnd := false
 
 	fieldIDArray := make([]byte, 1)
-	_, err := db.Read(fieldIDArray)
+	_, err := io.ReadFull(db, fieldIDArray)
 
 	if err != nil {
 		return false, errors.Wrap(err, "unable to read fieldIDArray")
@@ -316,14 +491,17 @@ func (k *KeePass2Reader) ReadHeaders(db *os.File) (bool, error) {
 
 	log.Debugf("header field length: %d", fieldLen)
 
+	if int(fieldLen) > k.Limits.MaxHeaderFieldSize {
+		return false, errors.Errorf("header field length %d exceeds the limit of %d", fieldLen, k.Limits.MaxHeaderFieldSize)
+	}
+	if len(k.headerStoredData)+int(fieldLen) > k.Limits.MaxHeaderSize {
+		return false, errors.Errorf("header exceeds the limit of %d bytes", k.Limits.MaxHeaderSize)
+	}
+
 	var fieldData []byte
 	if fieldLen != 0 {
 		fieldData = make([]byte, int(fieldLen))
-		n, err := db.Read(fieldData)
-		if err != nil {
-			return false, errors.New("unable to read field length")
-		}
-		if n != int(fieldLen) {
+		if _, err := io.ReadFull(db, fieldData); err != nil {
 			return false, errors.New("invalid header data length")
 		}
 	}
@@ -334,6 +512,8 @@ func (k *KeePass2Reader) ReadHeaders(db *os.File) (bool, error) {
 	case keepass2EndOfHeader:
 		headerEnd = true
 		log.Debugf("end of header: %d", fieldID)
+	case keepass2Comment:
+		log.Debugf("ignoring comment: %d", fieldID)
 	case keepass2CipherID:
 		log.Debugf("setting cipher: FieldID: %d fieldData len: %d", fieldID, len(fieldData))
 		if err = k.setCipher(fieldData); err != nil {
@@ -380,8 +560,7 @@ func (k *KeePass2Reader) ReadHeaders(db *os.File) (bool, error) {
 			return false, errors.Wrap(err, "innerRandomStreamID not set")
 		}
 	default:
-		log.Errorf("unknown header field read: id=%d", fieldID)
-		return false, errors.Wrapf(err, "unknown header field: %d", fieldID)
+		return false, errors.Errorf("unknown header field: %d", fieldID)
 	}
 
 	return !headerEnd, nil
@@ -505,5 +684,6 @@ func (k *KeePass2Reader) setInnerRandomStreamID(b []byte) error {
 	}
 
 	log.Debugf("setting inner random stream id: %d", id)
+	k.innerStreamID = id
 	return nil
 }
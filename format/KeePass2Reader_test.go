@@ -1,7 +1,11 @@
 package format_test
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"os"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -44,14 +48,63 @@ var _ = Describe("Databases", func() {
 
 			Expect(entry.Group).To(Equal("Protected"))
 			Expect(entry.UUID).To(Equal("a8370aa88afd3c4593ce981eafb789c8"))
-			Expect(entry.Username.PlainText).To(Equal("Protected User Name"))
-			Expect(entry.URL.PlainText).To(Equal("http://www.somesite.com/"))
-			Expect(entry.Notes.PlainText).To(Equal("Notes"))
-			Expect(entry.Password.PlainText).To(Equal("ProtectedPassword"))
+			Expect(entry.Username.String()).To(Equal("Protected User Name"))
+			Expect(entry.URL.String()).To(Equal("http://www.somesite.com/"))
+			Expect(entry.Notes.String()).To(Equal("Notes"))
+			Expect(entry.Password.String()).To(Equal("ProtectedPassword"))
 
 		})
 	})
 
+	Context("when describing a database", func() {
+		It("reports the header, metadata and counts", func() {
+			db, err := os.Open("test_data/ProtectedStrings.kdbx")
+			Expect(err).ToNot(HaveOccurred())
+
+			reader, err := format.OpenDatabase(keys.MasterKey("masterpw", nil), db)
+			Expect(err).ToNot(HaveOccurred())
+
+			info, err := reader.Info()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(info.Format).To(Equal(format.FormatKeePass2))
+			Expect(info.Version).To(Equal("3.1"))
+			Expect(info.Cipher).To(Equal("AES-256"))
+			Expect(info.Compression).To(Equal("gzip"))
+			Expect(info.KDF).To(Equal(format.KDFInfo{Name: "AES-KDF", UUID: "c9d9f39a628a4460bf740d08c18a4fea", Rounds: 6000}))
+			Expect(info.InnerStream).To(Equal("Salsa20"))
+			Expect(info.Generator).To(Equal("KeePass"))
+			Expect(info.DatabaseName).To(Equal("Protected Strings Test"))
+			Expect(*info.MasterKeyChanged).To(Equal(time.Date(2011, 6, 29, 16, 41, 58, 0, time.UTC)))
+			Expect(info.MasterKeyChangeRec).To(Equal(-1))
+			Expect(info.MasterKeyChangeForce).To(Equal(-1))
+			Expect(info.Groups).To(Equal(1))
+			Expect(info.Entries).To(Equal(1))
+			Expect(info.HistoricalEntries).To(Equal(1))
+			Expect(info.RecycledEntries).To(Equal(0))
+		})
+
+		It("writes snake case json keys", func() {
+			db, err := os.Open("test_data/ProtectedStrings.kdbx")
+			Expect(err).ToNot(HaveOccurred())
+
+			reader, err := format.OpenDatabase(keys.MasterKey("masterpw", nil), db)
+			Expect(err).ToNot(HaveOccurred())
+
+			info, err := reader.Info()
+			Expect(err).ToNot(HaveOccurred())
+
+			data, err := json.Marshal(info)
+			Expect(err).ToNot(HaveOccurred())
+			var fields map[string]interface{}
+			Expect(json.Unmarshal(data, &fields)).To(Succeed())
+			Expect(fields).To(HaveKey("cipher_uuid"))
+			Expect(fields).To(HaveKey("database_name"))
+			Expect(fields).To(HaveKey("master_key_changed"))
+			Expect(fields).To(HaveKey("historical_entries"))
+			Expect(fields).To(HaveKey("attachment_bytes"))
+		})
+	})
+
 	Context("when trying to open database whose protected stream key has been modified in the header", func() {
 		It("returns an error", func() {
 			db, err := os.Open("test_data/BrokenHeaderHash.kdbx")
@@ -108,11 +161,11 @@ var _ = Describe("Databases", func() {
 			Expect(err).ToNot(HaveOccurred())
 
 			Expect(entry.Group).To(Equal("Format200"))
-			Expect(entry.Title.PlainText).To(Equal("Sample Entry"))
-			Expect(entry.Password.PlainText).To(Equal("Password"))
-			Expect(entry.Username.PlainText).To(Equal("User Name"))
-			Expect(entry.URL.PlainText).To(Equal("http://www.somesite.com/"))
-			Expect(entry.Notes.PlainText).To(Equal("Notes"))
+			Expect(entry.Title.String()).To(Equal("Sample Entry"))
+			Expect(entry.Password.String()).To(Equal("Password"))
+			Expect(entry.Username.String()).To(Equal("User Name"))
+			Expect(entry.URL.String()).To(Equal("http://www.somesite.com/"))
+			Expect(entry.Notes.String()).To(Equal("Notes"))
 
 		})
 	})
@@ -132,11 +185,11 @@ var _ = Describe("Databases", func() {
 			entry, err := entryService.SearchByTerm(searchTerm)
 			Expect(err).ToNot(HaveOccurred())
 
-			Expect(entry.Title.PlainText).To(Equal("Sample Entry"))
-			Expect(entry.Password.PlainText).To(Equal("Password"))
-			Expect(entry.Username.PlainText).To(Equal("User Name"))
-			Expect(entry.URL.PlainText).To(Equal("http://www.somesite.com/"))
-			Expect(entry.Notes.PlainText).To(Equal("Notes"))
+			Expect(entry.Title.String()).To(Equal("Sample Entry"))
+			Expect(entry.Password.String()).To(Equal("Password"))
+			Expect(entry.Username.String()).To(Equal("User Name"))
+			Expect(entry.URL.String()).To(Equal("http://www.somesite.com/"))
+			Expect(entry.Notes.String()).To(Equal("Notes"))
 		})
 	})
 
@@ -156,11 +209,148 @@ var _ = Describe("Databases", func() {
 			Expect(err).ToNot(HaveOccurred())
 
 			Expect(entry.UUID).To(Equal("640c38611c3ea4489ced361f54e43dbe"))
-			Expect(entry.Title.PlainText).To(Equal("Sample Entry"))
-			Expect(entry.Password.PlainText).To(Equal("Password"))
-			Expect(entry.Username.PlainText).To(Equal("User Name"))
-			Expect(entry.URL.PlainText).To(Equal("http://keepass.info/"))
-			Expect(entry.Notes.PlainText).To(Equal("Notes"))
+			Expect(entry.Title.String()).To(Equal("Sample Entry"))
+			Expect(entry.Password.String()).To(Equal("Password"))
+			Expect(entry.Username.String()).To(Equal("User Name"))
+			Expect(entry.URL.String()).To(Equal("http://keepass.info/"))
+			Expect(entry.Notes.String()).To(Equal("Notes"))
+		})
+	})
+
+	Context("when opening a database with an already transformed master key", func() {
+		It("succeeds without the composite key", func() {
+			db, err := os.Open("test_data/Example.kdbx")
+			Expect(err).ToNot(HaveOccurred())
+
+			reader := format.NewKeePass2Reader()
+			Expect(reader.ReadHeader(db)).To(Succeed())
+
+			transformed, err := keys.MasterKey("password", nil).Transform(reader.Db.TransformSeed, reader.Db.TransformRounds)
+			Expect(err).ToNot(HaveOccurred())
+
+			reader.Db.TransformedMasterKey = transformed
+			Expect(reader.ReadPayload(db, keys.NewCompositeKey())).To(Succeed())
+
+			entryService.XMLReader = reader.XMLReader
+			entry, err := entryService.SearchByTerm("Sample Entry")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entry.Password.String()).To(Equal("Password"))
+		})
+
+		It("returns an error when the key is wrong", func() {
+			db, err := os.Open("test_data/Example.kdbx")
+			Expect(err).ToNot(HaveOccurred())
+
+			reader := format.NewKeePass2Reader()
+			Expect(reader.ReadHeader(db)).To(Succeed())
+
+			transformed, err := keys.MasterKey("wrong", nil).Transform(reader.Db.TransformSeed, reader.Db.TransformRounds)
+			Expect(err).ToNot(HaveOccurred())
+
+			reader.Db.TransformedMasterKey = transformed
+			Expect(reader.ReadPayload(db, keys.NewCompositeKey())).ToNot(Succeed())
+		})
+	})
+
+	Context("when closing a database", func() {
+		It("wipes the keys and decrypted values", func() {
+			db, err := os.Open("test_data/ProtectedStrings.kdbx")
+			Expect(err).ToNot(HaveOccurred())
+
+			reader, err := format.OpenDatabase(keys.MasterKey("masterpw", nil), db)
+			Expect(err).ToNot(HaveOccurred())
+
+			entryService.XMLReader = reader.XMLReader
+			entry, err := entryService.SearchByTerm("Sample Entry")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entry.Password.String()).To(Equal("ProtectedPassword"))
+
+			reader.Close()
+			Expect(entry.Password.String()).To(Equal(""))
+			Expect(reader.Db.TransformedMasterKey).To(BeEmpty())
+		})
+
+		It("leaves copies of decrypted values readable", func() {
+			db, err := os.Open("test_data/ProtectedStrings.kdbx")
+			Expect(err).ToNot(HaveOccurred())
+
+			reader, err := format.OpenDatabase(keys.MasterKey("masterpw", nil), db)
+			Expect(err).ToNot(HaveOccurred())
+
+			entryService.XMLReader = reader.XMLReader
+			entry, err := entryService.SearchByTerm("Sample Entry")
+			Expect(err).ToNot(HaveOccurred())
+			password := entry.Password.String()
+			titles := map[string]string{entry.UUID: entry.Title.String()}
+
+			// the locked memory is released, the copies are not in it
+			reader.Close()
+			Expect(password).To(Equal("ProtectedPassword"))
+			Expect(titles[entry.UUID]).To(Equal("Sample Entry"))
+		})
+	})
+
+	Context("when opening a database with progress", func() {
+		It("reports each stage in order", func() {
+			db, err := os.Open("test_data/ProtectedStrings.kdbx")
+			Expect(err).ToNot(HaveOccurred())
+
+			var reports []format.Progress
+			reader, err := format.OpenDatabaseContext(context.Background(), keys.MasterKey("masterpw", nil), db, func(p format.Progress) {
+				reports = append(reports, p)
+			})
+			Expect(err).ToNot(HaveOccurred())
+			defer reader.Close()
+
+			Expect(reports).ToNot(BeEmpty())
+			Expect(reports[0]).To(Equal(format.Progress{Stage: format.StageKDF, KDFRounds: 6000}))
+
+			var stages []string
+			var kdf, decrypt format.Progress
+			for _, p := range reports {
+				if len(stages) == 0 || stages[len(stages)-1] != p.Stage {
+					stages = append(stages, p.Stage)
+				}
+				switch p.Stage {
+				case format.StageKDF:
+					kdf = p
+				case format.StageDecrypt:
+					decrypt = p
+				}
+			}
+			Expect(stages).To(Equal([]string{format.StageKDF, format.StageDecrypt, format.StageParse}))
+			Expect(kdf.KDFPercent()).To(Equal(100.0))
+			Expect(decrypt.BytesDecrypted).To(BeNumerically(">", 0))
+			Expect(reports[len(reports)-1]).To(Equal(format.Progress{Stage: format.StageParse, EntriesParsed: 2}))
+		})
+
+		It("stops when the context is cancelled", func() {
+			db, err := os.Open("test_data/ProtectedStrings.kdbx")
+			Expect(err).ToNot(HaveOccurred())
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			_, err = format.OpenDatabaseContext(ctx, keys.MasterKey("masterpw", nil), db, nil)
+			Expect(errors.Is(err, context.Canceled)).To(BeTrue())
+		})
+
+		It("stops decrypting when the context is cancelled", func() {
+			db, err := os.Open("test_data/ProtectedStrings.kdbx")
+			Expect(err).ToNot(HaveOccurred())
+
+			reader := format.NewKeePass2Reader()
+			Expect(reader.ReadHeader(db)).To(Succeed())
+			key := keys.MasterKey("masterpw", nil)
+			Expect(reader.TransformKey(context.Background(), key, nil)).To(Succeed())
+			defer reader.Close()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			err = reader.ReadPayloadContext(ctx, db, key, func(p format.Progress) {
+				if p.Stage == format.StageDecrypt {
+					cancel()
+				}
+			})
+			Expect(errors.Is(err, context.Canceled)).To(BeTrue())
 		})
 	})
 })
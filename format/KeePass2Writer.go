@@ -0,0 +1,236 @@
+package format
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/simonhayward/gkeepassxreader/core"
+	"github.com/simonhayward/gkeepassxreader/secure"
+)
+
+const (
+	// hashed block size used by KeePass
+	keepass2HashedBlockSize = 1024 * 1024
+)
+
+var (
+	keepass2EndOfHeaderData = []byte{0x0D, 0x0A, 0x0D, 0x0A}
+)
+
+//KeePass2Writer writes KeePass 2 (.kdbx 3.1) databases
+type KeePass2Writer struct {
+	Db *core.Database
+}
+
+//NewKeePass2Writer writes with the cipher, compression, transform seed and
+//transformed master key of the given database
+func NewKeePass2Writer(db *core.Database) *KeePass2Writer {
+	return &KeePass2Writer{
+		Db: db,
+	}
+}
+
+//WriteDatabase encrypts the xml file, protected values are given as plain text
+//and marked Protected or ProtectInMemory. A new master seed, encryption iv and
+//inner stream key are generated each time, as KeePass does.
+func (k *KeePass2Writer) WriteDatabase(w io.Writer, xmlFile *KeePass2XmlFile) error {
+	if k.Db.LegacyKey {
+		return errors.New("KeePass 1 databases are read only")
+	}
+
+	if !bytes.Equal(k.Db.Cipher.Data, core.Keepass2CipherAes) {
+		return errors.New("unsupported cipher")
+	}
+
+	if len(k.Db.TransformedMasterKey) == 0 || len(k.Db.TransformSeed) == 0 {
+		return errors.New("missing transformed master key")
+	}
+
+	masterSeed, err := randomBytes(32)
+	if err != nil {
+		return err
+	}
+	encryptionIV, err := randomBytes(aes.BlockSize)
+	if err != nil {
+		return err
+	}
+	protectedStreamKey, err := randomBytes(32)
+	if err != nil {
+		return err
+	}
+	defer secure.Wipe(protectedStreamKey)
+	streamStartBytes, err := randomBytes(32)
+	if err != nil {
+		return err
+	}
+
+	header, err := k.header(masterSeed, encryptionIV, protectedStreamKey, streamStartBytes)
+	if err != nil {
+		return errors.Wrap(err, "header write failed")
+	}
+	headerHash := sha256.Sum256(header)
+
+	f, err := xmlFile.clone()
+	if err != nil {
+		return err
+	}
+	f.Meta.HeaderHash = base64.StdEncoding.EncodeToString(headerHash[:])
+
+	randomKey := sha256.Sum256(protectedStreamKey)
+	stream := NewKeePass2RandomStream(innerStreamSalsa20Iv, &randomKey)
+	defer stream.Wipe()
+	if err := protectValues(f, stream); err != nil {
+		return err
+	}
+
+	payload := &bytes.Buffer{}
+	if k.Db.CompressionAlgo == core.CompressionGzip {
+		zw := gzip.NewWriter(payload)
+		if err := f.WriteXML(zw); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return errors.Wrap(err, "gzip write failed")
+		}
+	} else if err := f.WriteXML(payload); err != nil {
+		return err
+	}
+
+	plaintext := append(streamStartBytes, hashedBlocks(payload.Bytes())...)
+	secure.Wipe(payload.Bytes())
+
+	challengeResponse, err := k.Db.Key.Challenge(masterSeed)
+	if err != nil {
+		return errors.Wrap(err, "Challenge-response failed")
+	}
+	defer secure.Wipe(challengeResponse)
+
+	h := sha256.New()
+	h.Write(masterSeed)
+	h.Write(challengeResponse)
+	h.Write(k.Db.TransformedMasterKey)
+	finalKey := h.Sum(nil)
+
+	block, err := aes.NewCipher(finalKey)
+	secure.Wipe(finalKey)
+	if err != nil {
+		return errors.Wrap(err, "New AES Cipher error")
+	}
+
+	plaintext = pad(plaintext, block.BlockSize())
+	encrypted := make([]byte, len(plaintext))
+	cipher.NewCBCEncrypter(block, encryptionIV).CryptBlocks(encrypted, plaintext)
+	secure.Wipe(plaintext)
+
+	if _, err := w.Write(header); err != nil {
+		return errors.Wrap(err, "write failed")
+	}
+	if _, err := w.Write(encrypted); err != nil {
+		return errors.Wrap(err, "write failed")
+	}
+	return nil
+}
+
+func (k *KeePass2Writer) header(masterSeed, encryptionIV, protectedStreamKey, streamStartBytes []byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	for _, v := range []uint32{keepass2Signature1, keepass2Signature2, keepass2FileVersion} {
+		if err := binary.Write(buf, binary.LittleEndian, v); err != nil {
+			return nil, err
+		}
+	}
+
+	compression := make([]byte, 4)
+	binary.LittleEndian.PutUint32(compression, k.Db.CompressionAlgo)
+	rounds := make([]byte, 8)
+	binary.LittleEndian.PutUint64(rounds, k.Db.TransformRounds)
+	streamID := make([]byte, 4)
+	binary.LittleEndian.PutUint32(streamID, keepass2Salsa20)
+
+	fields := []struct {
+		id   byte
+		data []byte
+	}{
+		{keepass2CipherID, k.Db.Cipher.Data},
+		{keepass2CompressionFlags, compression},
+		{keepass2MasterSeed, masterSeed},
+		{keepass2TransformSeed, k.Db.TransformSeed},
+		{keepass2TransformRounds, rounds},
+		{keepass2EncryptionIV, encryptionIV},
+		{keepass2ProtectedStreamKey, protectedStreamKey},
+		{keepass2StreamStartBytes, streamStartBytes},
+		{keepass2InnerRandomStreamID, streamID},
+		{keepass2EndOfHeader, keepass2EndOfHeaderData},
+	}
+
+	for _, field := range fields {
+		buf.WriteByte(field.id)
+		if err := binary.Write(buf, binary.LittleEndian, uint16(len(field.data))); err != nil {
+			return nil, err
+		}
+		buf.Write(field.data)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// hashedBlocks splits data into blocks prefixed by their index, hash and size,
+// followed by an empty final block
+func hashedBlocks(data []byte) []byte {
+	buf := &bytes.Buffer{}
+	var index uint32
+	for len(data) > 0 {
+		n := len(data)
+		if n > keepass2HashedBlockSize {
+			n = keepass2HashedBlockSize
+		}
+		hash := sha256.Sum256(data[:n])
+		binary.Write(buf, binary.LittleEndian, index)
+		buf.Write(hash[:])
+		binary.Write(buf, binary.LittleEndian, uint32(n))
+		buf.Write(data[:n])
+		data = data[n:]
+		index++
+	}
+
+	binary.Write(buf, binary.LittleEndian, index)
+	buf.Write(make([]byte, sha256.Size))
+	binary.Write(buf, binary.LittleEndian, uint32(0))
+	return buf.Bytes()
+}
+
+// pad adds PKCS#7 padding
+func pad(b []byte, blockSize int) []byte {
+	padLen := blockSize - len(b)%blockSize
+	return append(b, bytes.Repeat([]byte{byte(padLen)}, padLen)...)
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, errors.Wrap(err, "unable to generate random bytes")
+	}
+	return b, nil
+}
+
+// clone deep copies the xml file
+func (f *KeePass2XmlFile) clone() (*KeePass2XmlFile, error) {
+	data, err := xml.Marshal(f)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal error")
+	}
+
+	c := &KeePass2XmlFile{}
+	if err := xml.Unmarshal(data, c); err != nil {
+		return nil, errors.Wrap(err, "unmarshal error")
+	}
+	return c, nil
+}
@@ -0,0 +1,138 @@
+package format_test
+
+import (
+	"io/ioutil"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/simonhayward/gkeepassxreader/format"
+	"github.com/simonhayward/gkeepassxreader/keys"
+)
+
+var _ = Describe("KeePass2Writer", func() {
+
+	var (
+		reader *format.KeePass2Reader
+		out    *os.File
+	)
+
+	BeforeEach(func() {
+		db, err := os.Open("test_data/ProtectedStrings.kdbx")
+		Expect(err).ToNot(HaveOccurred())
+		defer db.Close()
+
+		reader, err = format.OpenDatabase(keys.MasterKey("masterpw", nil), db)
+		Expect(err).ToNot(HaveOccurred())
+
+		out, err = ioutil.TempFile("", "writer-*.kdbx")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		reader.Close()
+		out.Close()
+		os.Remove(out.Name())
+	})
+
+	reopen := func(password string) (*format.KeePass2Reader, error) {
+		_, err := out.Seek(0, 0)
+		Expect(err).ToNot(HaveOccurred())
+		return format.OpenDatabase(keys.MasterKey(password, nil), out)
+	}
+
+	Context("when writing an unchanged database", func() {
+		It("can be read back with the same key", func() {
+			f, err := reader.XMLReader.Decrypted()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(format.NewKeePass2Writer(reader.Db).WriteDatabase(out, f)).To(Succeed())
+
+			written, err := reopen("masterpw")
+			Expect(err).ToNot(HaveOccurred())
+			defer written.Close()
+
+			entryService := &format.EntryServiceOp{XMLReader: written.XMLReader, HistoricalEntries: true}
+			entries, err := entryService.List()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entries).To(HaveLen(2))
+			Expect(entryService.Decode(entries)).To(Succeed())
+			Expect(entries[0].Password.String()).To(Equal("ProtectedPassword"))
+			Expect(entries[0].Field("TestProtected").String()).To(Equal("ABC"))
+			Expect(entries[1].Password.String()).To(Equal("ProtectedPassword"))
+		})
+
+		It("can not be read with another key", func() {
+			f, err := reader.XMLReader.Decrypted()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(format.NewKeePass2Writer(reader.Db).WriteDatabase(out, f)).To(Succeed())
+
+			_, err = reopen("wrong")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("when changing the master key", func() {
+		It("can only be read with the new key", func() {
+			seed := reader.Db.TransformSeed
+			f, err := reader.XMLReader.Decrypted()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(reader.Db.Rekey(keys.MasterKey("newpw", nil))).To(Succeed())
+			Expect(reader.Db.TransformSeed).ToNot(Equal(seed))
+			f.SetMasterKeyChanged(time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC))
+			Expect(format.NewKeePass2Writer(reader.Db).WriteDatabase(out, f)).To(Succeed())
+
+			_, err = reopen("masterpw")
+			Expect(err).To(HaveOccurred())
+
+			written, err := reopen("newpw")
+			Expect(err).ToNot(HaveOccurred())
+			defer written.Close()
+			info, err := written.Info()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(*info.MasterKeyChanged).To(Equal(time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)))
+		})
+	})
+
+	Context("when adding an entry", func() {
+		It("creates the groups and protects the password", func() {
+			f, err := reader.XMLReader.Decrypted()
+			Expect(err).ToNot(HaveOccurred())
+
+			uuid, err := f.AddEntry(&format.Entry{
+				Path:     []string{"Imported", "Email"},
+				Title:    &format.EntryValue{PlainText: "Mail"},
+				Username: &format.EntryValue{PlainText: "me@example.com"},
+				Password: &format.EntryValue{PlainText: "mailsecret"},
+				URL:      &format.EntryValue{PlainText: "https://mail.example.com"},
+				Fields: []format.Field{
+					{Key: "otp", Value: &format.EntryValue{PlainText: "otpauth://totp/Mail?secret=JBSWY3DP", Protected: true}},
+				},
+				Attachments: []format.Attachment{{Name: "a.txt", Data: []byte("attached")}},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(uuid).To(HaveLen(32))
+			Expect(format.NewKeePass2Writer(reader.Db).WriteDatabase(out, f)).To(Succeed())
+
+			written, err := reopen("masterpw")
+			Expect(err).ToNot(HaveOccurred())
+			defer written.Close()
+
+			entryService := &format.EntryServiceOp{XMLReader: written.XMLReader}
+			entry, err := entryService.SearchByTerm(uuid)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entry).ToNot(BeNil())
+			Expect(entry.Path).To(Equal([]string{"Protected", "Imported", "Email"}))
+			Expect(entry.Password.Protected).To(BeTrue())
+			Expect(entry.Password.String()).To(Equal("mailsecret"))
+			Expect(entry.Field("otp").Protected).To(BeTrue())
+			Expect(entry.Field("otp").String()).To(Equal("otpauth://totp/Mail?secret=JBSWY3DP"))
+			Expect(entry.Attachments).To(Equal([]format.Attachment{{Name: "a.txt", Data: []byte("attached")}}))
+
+			entry, err = entryService.SearchByTerm("Sample Entry")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entry.Password.String()).To(Equal("ProtectedPassword"))
+		})
+	})
+})
@@ -0,0 +1,133 @@
+package format
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultRootGroupName = "Root"
+)
+
+//WriteXML writes the xml file with an xml declaration
+func (f *KeePass2XmlFile) WriteXML(w io.Writer) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return errors.Wrap(err, "write error")
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "\t")
+	if err := enc.Encode(f); err != nil {
+		return errors.Wrap(err, "marshal error")
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+//AddEntry adds the plain text values of e to the group at e.Path, which is
+//relative to the root group, creating any missing groups. The password and
+//protected custom fields are marked ProtectInMemory. The new UUID is returned.
+func (f *KeePass2XmlFile) AddEntry(e *Entry) (string, error) {
+	uuid, err := randomBytes(16)
+	if err != nil {
+		return "", err
+	}
+
+	xe := entry{
+		UUID:  base64.StdEncoding.EncodeToString(uuid),
+		Tags:  formatTags(e.Tags),
+		Times: newTimes(time.Now()),
+		StringEntry: []stringEntry{
+			newStringEntry("Title", e.Title, false),
+			newStringEntry("UserName", e.Username, false),
+			newStringEntry("Password", e.Password, true),
+			newStringEntry("URL", e.URL, false),
+			newStringEntry("Notes", e.Notes, false),
+		},
+	}
+
+	for _, field := range e.Fields {
+		xe.StringEntry = append(xe.StringEntry, newStringEntry(field.Key, field.Value, field.Value != nil && field.Value.Protected))
+	}
+
+	for _, a := range e.Attachments {
+		ref := strconv.Itoa(len(f.Meta.Binaries))
+		f.Meta.Binaries = append(f.Meta.Binaries, metaBinary{
+			ID:   ref,
+			Data: base64.StdEncoding.EncodeToString(a.Data),
+		})
+		xe.Binaries = append(xe.Binaries, entryBinary{Key: a.Name, Value: binaryRef{Ref: ref}})
+	}
+
+	g, err := f.group(e.Path)
+	if err != nil {
+		return "", err
+	}
+	g.Entry = append(g.Entry, xe)
+
+	return hex.EncodeToString(uuid), nil
+}
+
+func newStringEntry(key string, ev *EntryValue, protected bool) stringEntry {
+	se := stringEntry{Key: key}
+	if ev != nil {
+		se.Value.Data = ev.String()
+	}
+	if protected {
+		se.Value.ProtectInMemory = "True"
+	}
+	return se
+}
+
+// group returns the group at path below the root group, missing groups are created
+func (f *KeePass2XmlFile) group(path []string) (*group, error) {
+	if len(f.Root.Groups) == 0 {
+		root, err := newGroup(defaultRootGroupName)
+		if err != nil {
+			return nil, err
+		}
+		f.Root.Groups = append(f.Root.Groups, *root)
+	}
+
+	g := &f.Root.Groups[0]
+	for _, name := range path {
+		idx := -1
+		for i := range g.Groups {
+			if g.Groups[i].Name == name {
+				idx = i
+				break
+			}
+		}
+
+		if idx < 0 {
+			child, err := newGroup(name)
+			if err != nil {
+				return nil, err
+			}
+			g.Groups = append(g.Groups, *child)
+			idx = len(g.Groups) - 1
+		}
+
+		g = &g.Groups[idx]
+	}
+	return g, nil
+}
+
+func newGroup(name string) (*group, error) {
+	uuid, err := randomBytes(16)
+	if err != nil {
+		return nil, err
+	}
+	return &group{
+		UUID:  base64.StdEncoding.EncodeToString(uuid),
+		Name:  name,
+		Times: newTimes(time.Now()),
+	}, nil
+}
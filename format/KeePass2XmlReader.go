@@ -1,13 +1,18 @@
 package format
 
 import (
+	"bytes"
+	"compress/gzip"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/xml"
 	"io"
 	"io/ioutil"
+	"strings"
 
 	"github.com/pkg/errors"
+	"github.com/simonhayward/gkeepassxreader/secure"
+	log "github.com/sirupsen/logrus"
 )
 
 var (
@@ -15,8 +20,16 @@ var (
 )
 
 type value struct {
-	Data      string `xml:",chardata"`
-	Protected string `xml:"Protected,attr"`
+	Data            string `xml:",chardata"`
+	Protected       string `xml:"Protected,attr,omitempty"`
+	ProtectInMemory string `xml:"ProtectInMemory,attr,omitempty"`
+}
+
+// element preserves xml the model does not describe so it can be written back
+type element struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Content string     `xml:",innerxml"`
 }
 
 type stringEntry struct {
@@ -25,42 +38,81 @@ type stringEntry struct {
 	Value   value    `xml:"Value"`
 }
 
+type binaryRef struct {
+	Ref        string `xml:"Ref,attr,omitempty"`
+	Compressed string `xml:"Compressed,attr,omitempty"`
+	value
+}
+
+type entryBinary struct {
+	XMLName xml.Name  `xml:"Binary"`
+	Key     string    `xml:"Key"`
+	Value   binaryRef `xml:"Value"`
+}
+
 type entry struct {
 	XMLName        xml.Name      `xml:"Entry"`
 	UUID           string        `xml:"UUID"`
+	Tags           string        `xml:"Tags,omitempty"`
+	Times          *times        `xml:"Times"`
 	StringEntry    []stringEntry `xml:"String"`
+	Binaries       []entryBinary `xml:"Binary"`
 	HistoryEntries []entry       `xml:"History>Entry"`
+	Other          []element     `xml:",any"`
 }
 
 type group struct {
-	XMLName xml.Name `xml:"Group"`
-	UUID    string   `xml:"UUID"`
-	Name    string   `xml:"Name"`
-	Entry   []entry  `xml:"Entry"`
-	Groups  []group  `xml:"Group"`
+	XMLName xml.Name  `xml:"Group"`
+	UUID    string    `xml:"UUID"`
+	Name    string    `xml:"Name"`
+	Times   *times    `xml:"Times"`
+	Entry   []entry   `xml:"Entry"`
+	Groups  []group   `xml:"Group"`
+	Other   []element `xml:",any"`
 }
 
 type root struct {
-	XMLName xml.Name `xml:"Root"`
-	Groups  []group  `xml:"Group"`
+	XMLName        xml.Name        `xml:"Root"`
+	Groups         []group         `xml:"Group"`
+	DeletedObjects *deletedObjects `xml:"DeletedObjects"`
+	Other          []element       `xml:",any"`
+}
+
+type metaBinary struct {
+	ID         string `xml:"ID,attr"`
+	Compressed string `xml:"Compressed,attr,omitempty"`
+	Data       string `xml:",chardata"`
 }
 
 type meta struct {
-	XMLName    xml.Name `xml:"Meta"`
-	HeaderHash string   `xml:"HeaderHash"`
+	XMLName              xml.Name     `xml:"Meta"`
+	HeaderHash           string       `xml:"HeaderHash,omitempty"`
+	RecycleBinEnabled    string       `xml:"RecycleBinEnabled,omitempty"`
+	RecycleBinUUID       string       `xml:"RecycleBinUUID,omitempty"`
+	RecycleBinChanged    string       `xml:"RecycleBinChanged,omitempty"`
+	Binaries             []metaBinary `xml:"Binaries>Binary"`
+	Generator            string       `xml:"Generator,omitempty"`
+	DatabaseName         string       `xml:"DatabaseName,omitempty"`
+	Description          string       `xml:"DatabaseDescription,omitempty"`
+	DefaultUserName      string       `xml:"DefaultUserName,omitempty"`
+	MasterKeyChanged     string       `xml:"MasterKeyChanged,omitempty"`
+	MasterKeyChangeRec   string       `xml:"MasterKeyChangeRec,omitempty"`
+	MasterKeyChangeForce string       `xml:"MasterKeyChangeForce,omitempty"`
+	Other                []element    `xml:",any"`
 }
 
 //KeePass2XmlFile represents the xml file
 type KeePass2XmlFile struct {
 	XMLName xml.Name `xml:"KeePassFile"`
-	Root    root     `xml:"Root"`
 	Meta    meta     `xml:"Meta"`
+	Root    root     `xml:"Root"`
 }
 
 //KeePass2XmlReader represents an XML file and an associated random stream
 type KeePass2XmlReader struct {
 	KeePass2XmlFile      KeePass2XmlFile
 	KeePass2RandomStream *KeePass2RandomStream
+	decoded              []*EntryValue
 }
 
 //NewKeePass2XmlReader creates a new reader
@@ -122,10 +174,16 @@ func (k *KeePass2XmlReader) newEntryValue(sEntry stringEntry, randomBytesOffset
 
 }
 
-func (k *KeePass2XmlReader) readEntries(entries *[]Entry, rEntries []entry, entryGroup group, historical bool, randomBytesOffset *int) error {
+func (k *KeePass2XmlReader) readEntries(entries *[]Entry, rEntries []entry, entryGroup group, path []string, historical, recycled bool, randomBytesOffset *int) error {
+
+	groupUUID, err := base64.StdEncoding.DecodeString(entryGroup.UUID)
+	if err != nil {
+		return errors.Wrap(err, "base64 decode for group uuid failed")
+	}
 
 	for _, entry := range rEntries {
 		var title, password, username, url, notes *EntryValue
+		var fields []Field
 		var err error
 
 		for _, sEntry := range entry.StringEntry {
@@ -155,23 +213,46 @@ func (k *KeePass2XmlReader) readEntries(entries *[]Entry, rEntries []entry, entr
 				if err != nil {
 					return errors.Wrap(err, "UserName entry value failed")
 				}
+			default:
+				v, err := k.newEntryValue(sEntry, randomBytesOffset)
+				if err != nil {
+					return errors.Wrapf(err, "%s entry value failed", sEntry.Key)
+				}
+				fields = append(fields, Field{Key: sEntry.Key, Value: v})
 			}
 		}
 
+		attachments, err := k.attachments(entry.Binaries, randomBytesOffset)
+		if err != nil {
+			return errors.Wrap(err, "attachments failed")
+		}
+
 		uuid, err := base64.StdEncoding.DecodeString(entry.UUID)
 		if err != nil {
 			return errors.Wrap(err, "base64 decode for uuid failed")
 		}
 
+		times := entry.Times.parse()
+		if len(times.Invalid) > 0 {
+			log.Debugf("entry %x has invalid times, kept as zero: %s", uuid, strings.Join(times.Invalid, ", "))
+		}
+
 		e := Entry{
-			UUID:       hex.EncodeToString(uuid),
-			Title:      title,
-			Group:      entryGroup.Name,
-			Password:   password,
-			Username:   username,
-			URL:        url,
-			Notes:      notes,
-			Historical: historical,
+			UUID:        hex.EncodeToString(uuid),
+			Title:       title,
+			Group:       entryGroup.Name,
+			GroupUUID:   hex.EncodeToString(groupUUID),
+			Path:        path,
+			Password:    password,
+			Username:    username,
+			URL:         url,
+			Notes:       notes,
+			Fields:      fields,
+			Attachments: attachments,
+			Times:       times,
+			Tags:        ParseTags(entry.Tags),
+			Historical:  historical,
+			Recycled:    recycled,
 		}
 
 		*entries = append(*entries, e)
@@ -179,7 +260,7 @@ func (k *KeePass2XmlReader) readEntries(entries *[]Entry, rEntries []entry, entr
 		// Historical entries are required as they are included in the randomBytes offset values,
 		// but the historical flag is set so they can be excluded from the output results.
 		if len(entry.HistoryEntries) > 0 {
-			if err := k.readEntries(entries, entry.HistoryEntries, entryGroup, true, randomBytesOffset); err != nil {
+			if err := k.readEntries(entries, entry.HistoryEntries, entryGroup, path, true, recycled, randomBytesOffset); err != nil {
 				return err
 			}
 		}
@@ -187,20 +268,230 @@ func (k *KeePass2XmlReader) readEntries(entries *[]Entry, rEntries []entry, entr
 	return nil
 }
 
-//ReadGroups iterates over database groups
+// attachments resolves the binary references from the meta binaries pool,
+// format 2.00 databases store the data inline
+func (k *KeePass2XmlReader) attachments(binaries []entryBinary, randomBytesOffset *int) ([]Attachment, error) {
+	var attachments []Attachment
+	for _, b := range binaries {
+		var data []byte
+		var err error
+		if len(b.Value.Ref) > 0 {
+			data, err = k.binary(b.Value.Ref)
+		} else {
+			data, err = k.inlineBinary(b.Value, randomBytesOffset)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "attachment %s", b.Key)
+		}
+		attachments = append(attachments, Attachment{Name: b.Key, Data: data})
+	}
+	return attachments, nil
+}
+
+func (k *KeePass2XmlReader) binary(ref string) ([]byte, error) {
+	for _, b := range k.KeePass2XmlFile.Meta.Binaries {
+		if b.ID != ref {
+			continue
+		}
+
+		data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(b.Data))
+		if err != nil {
+			return nil, errors.Wrap(err, "base64 decode failed")
+		}
+
+		return decompressBinary(data, b.Compressed == "True")
+	}
+	return nil, errors.Errorf("binary not found: %s", ref)
+}
+
+func (k *KeePass2XmlReader) inlineBinary(v binaryRef, randomBytesOffset *int) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(v.Data))
+	if err != nil {
+		return nil, errors.Wrap(err, "base64 decode failed")
+	}
+
+	if v.Protected == "True" && len(data) > 0 {
+		offset := *randomBytesOffset
+		*randomBytesOffset += len(data)
+		if data, err = k.KeePass2RandomStream.Process(offset, data); err != nil {
+			return nil, errors.Wrap(err, "decrypt failed")
+		}
+	}
+
+	return decompressBinary(data, v.Compressed == "True")
+}
+
+func decompressBinary(data []byte, compressed bool) ([]byte, error) {
+	if !compressed {
+		return data, nil
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Wrap(err, "gzip new reader failed")
+	}
+	defer zr.Close()
+
+	return ioutil.ReadAll(zr)
+}
+
+//ReadGroups iterates over database groups, entries in the recycle bin are
+//marked Recycled
 func (k *KeePass2XmlReader) ReadGroups(entries *[]Entry, groups []group, randomBytesOffset *int) error {
+	return k.readGroups(entries, groups, nil, false, randomBytesOffset)
+}
+
+func (k *KeePass2XmlReader) readGroups(entries *[]Entry, groups []group, parentPath []string, parentRecycled bool, randomBytesOffset *int) error {
+	recycleBin := k.KeePass2XmlFile.recycleBin()
 	for _, group := range groups {
+		path := append(append([]string(nil), parentPath...), group.Name)
+		recycled := parentRecycled || (len(recycleBin) > 0 && group.UUID == recycleBin)
+
+		// recycled entries are read too as they are included in the randomBytes offset values
 		if len(group.Entry) > 0 {
-			if err := k.readEntries(entries, group.Entry, group, false, randomBytesOffset); err != nil {
+			if err := k.readEntries(entries, group.Entry, group, path, false, recycled, randomBytesOffset); err != nil {
 				return err
 			}
 		}
 
 		if len(group.Groups) > 0 {
-			if err := k.ReadGroups(entries, group.Groups, randomBytesOffset); err != nil {
+			if err := k.readGroups(entries, group.Groups, path, recycled, randomBytesOffset); err != nil {
 				return err
 			}
 		}
 	}
 	return nil
 }
+
+// track decoded values so they can be wiped
+func (k *KeePass2XmlReader) track(ev *EntryValue) {
+	k.decoded = append(k.decoded, ev)
+}
+
+//Wipe destroys all decrypted values and the random stream key
+func (k *KeePass2XmlReader) Wipe() {
+	for _, ev := range k.decoded {
+		ev.Wipe()
+	}
+	k.decoded = nil
+
+	if k.KeePass2RandomStream != nil {
+		k.KeePass2RandomStream.Wipe()
+	}
+}
+
+// forEachValue calls fn for every string and inline binary value in the order
+// readEntries assigns their random stream offsets
+func forEachValue(groups []group, fn func(v *value, binary bool) error) error {
+	var entries func(entries []entry) error
+	entries = func(rEntries []entry) error {
+		for i := range rEntries {
+			for j := range rEntries[i].StringEntry {
+				if err := fn(&rEntries[i].StringEntry[j].Value, false); err != nil {
+					return err
+				}
+			}
+			for j := range rEntries[i].Binaries {
+				if len(rEntries[i].Binaries[j].Value.Ref) > 0 {
+					continue
+				}
+				if err := fn(&rEntries[i].Binaries[j].Value.value, true); err != nil {
+					return err
+				}
+			}
+			if err := entries(rEntries[i].HistoryEntries); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for i := range groups {
+		if err := entries(groups[i].Entry); err != nil {
+			return err
+		}
+		if err := forEachValue(groups[i].Groups, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// protectValues encrypts the plain text of protected values with the random
+// stream, in the same order readEntries assigns their offsets. Values marked
+// ProtectInMemory, as in unencrypted xml, become protected.
+func protectValues(f *KeePass2XmlFile, stream *KeePass2RandomStream) error {
+	offset := 0
+	return forEachValue(f.Root.Groups, func(v *value, binary bool) error {
+		if v.ProtectInMemory == "True" {
+			v.Protected = "True"
+			v.ProtectInMemory = ""
+		}
+		if v.Protected != "True" || len(v.Data) == 0 {
+			return nil
+		}
+
+		plaintext := []byte(v.Data)
+		if binary {
+			var err error
+			if plaintext, err = base64.StdEncoding.DecodeString(v.Data); err != nil {
+				return errors.Wrap(err, "base64 decode failed")
+			}
+		}
+
+		ciphertext, err := stream.Process(offset, plaintext)
+		secure.Wipe(plaintext)
+		if err != nil {
+			return errors.Wrap(err, "protect value failed")
+		}
+
+		v.Data = base64.StdEncoding.EncodeToString(ciphertext)
+		offset += len(ciphertext)
+		return nil
+	})
+}
+
+//Decrypted returns a copy of the xml file with protected values decrypted,
+//they are marked ProtectInMemory as KeePass does for unencrypted xml
+func (k *KeePass2XmlReader) Decrypted() (*KeePass2XmlFile, error) {
+	f, err := k.KeePass2XmlFile.clone()
+	if err != nil {
+		return nil, err
+	}
+
+	offset := 0
+	err = forEachValue(f.Root.Groups, func(v *value, binary bool) error {
+		if v.Protected != "True" {
+			return nil
+		}
+
+		v.Protected = ""
+		v.ProtectInMemory = "True"
+		if len(v.Data) == 0 {
+			return nil
+		}
+
+		ciphertext, err := base64.StdEncoding.DecodeString(v.Data)
+		if err != nil {
+			return errors.Wrap(err, "ciphertext decode failed")
+		}
+
+		plaintext, err := k.KeePass2RandomStream.Process(offset, ciphertext)
+		if err != nil {
+			return errors.Wrap(err, "decrypt failed")
+		}
+		offset += len(ciphertext)
+
+		if binary {
+			v.Data = base64.StdEncoding.EncodeToString(plaintext)
+		} else {
+			v.Data = string(plaintext)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
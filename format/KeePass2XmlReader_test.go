@@ -1,10 +1,13 @@
 package format_test
 
 import (
+	"encoding/base64"
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/xml"
 	"io/ioutil"
 	"os"
+	"time"
 
 	"github.com/simonhayward/gkeepassxreader/format"
 
@@ -212,6 +215,103 @@ var _ = Describe("Xml", func() {
 				}
 			})
 
+			It("lists every group with its path", func() {
+				xmlReader := &format.KeePass2XmlReader{KeePass2XmlFile: v}
+				groups, err := xmlReader.Groups()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(groups).To(HaveLen(6))
+
+				Expect(groups[0].UUID).To(Equal("96653ef67d1a78448a66f704cdef9b46"))
+				Expect(groups[0].ParentUUID).To(Equal(""))
+				Expect(groups[0].Path).To(Equal([]string{"NewDatabase"}))
+
+				Expect(groups[3].Name).To(Equal("Subsub"))
+				Expect(groups[3].ParentUUID).To(Equal(groups[2].UUID))
+				Expect(groups[3].Path).To(Equal([]string{"NewDatabase", "Windows", "Subsub"}))
+			})
+
+			It("marks entries in the recycle bin and leaves them out of lists", func() {
+				xmlReader := &format.KeePass2XmlReader{KeePass2XmlFile: v}
+				entries := []format.Entry{}
+				randomBytesOffset := 0
+				Expect(xmlReader.ReadGroups(&entries, v.Root.Groups, &randomBytesOffset)).To(Succeed())
+				for _, e := range entries {
+					Expect(e.Recycled).To(Equal(e.Path[len(e.Path)-1] == "Recycle Bin"), e.UUID)
+				}
+
+				titles := func(service *format.EntryServiceOp) []string {
+					list, err := service.List()
+					Expect(err).ToNot(HaveOccurred())
+					var t []string
+					for _, e := range list {
+						t = append(t, e.Title.String())
+					}
+					return t
+				}
+				Expect(titles(&format.EntryServiceOp{XMLReader: xmlReader})).ToNot(ContainElement("delentry"))
+				Expect(titles(&format.EntryServiceOp{XMLReader: xmlReader, RecycledEntries: true})).To(ContainElement("delentry"))
+			})
+
+			It("parses group and entry times", func() {
+				xmlReader := &format.KeePass2XmlReader{KeePass2XmlFile: v}
+				groups, err := xmlReader.Groups()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(groups[0].Times).To(Equal(format.Times{
+					Created:         time.Date(2010, 8, 7, 17, 24, 27, 0, time.UTC),
+					Modified:        time.Date(2010, 8, 8, 17, 24, 27, 0, time.UTC),
+					Accessed:        time.Date(2010, 8, 9, 9, 9, 44, 0, time.UTC),
+					Expiry:          time.Date(2010, 8, 8, 17, 24, 17, 0, time.UTC),
+					UsageCount:      52,
+					LocationChanged: time.Date(2010, 8, 8, 17, 24, 27, 0, time.UTC),
+				}))
+
+				entries := []format.Entry{}
+				randomBytesOffset := 0
+				Expect(xmlReader.ReadGroups(&entries, v.Root.Groups, &randomBytesOffset)).To(Succeed())
+				Expect(entries[0].Times.Modified).To(Equal(time.Date(2010, 8, 25, 16, 19, 25, 0, time.UTC)))
+				Expect(entries[0].Times.Expires).To(BeFalse())
+			})
+
+			It("parses KDBX 4 base64 times", func() {
+				seconds := make([]byte, 8)
+				binary.LittleEndian.PutUint64(seconds, uint64(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC).Unix()+62135596800))
+				body := "<KeePassFile><Root><Group><UUID>lmU+9n0aeESKZvcEze+bRg==</UUID><Name>Root</Name><Times><LastModificationTime>" +
+					base64.StdEncoding.EncodeToString(seconds) + "</LastModificationTime><Expires>True</Expires></Times></Group></Root></KeePassFile>"
+
+				f := format.KeePass2XmlFile{}
+				Expect(xml.Unmarshal([]byte(body), &f)).To(Succeed())
+				groups, err := (&format.KeePass2XmlReader{KeePass2XmlFile: f}).Groups()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(groups[0].Times.Modified).To(Equal(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)))
+				Expect(groups[0].Times.Expires).To(BeTrue())
+				Expect(groups[0].Times.Created.IsZero()).To(BeTrue())
+			})
+
+			It("keeps times which can't be parsed as zero", func() {
+				body := "<KeePassFile><Root><Group><UUID>lmU+9n0aeESKZvcEze+bRg==</UUID><Name>Root</Name>" +
+					"<Times><CreationTime>yesterday</CreationTime><LastModificationTime>2020-01-02T03:04:05Z</LastModificationTime></Times>" +
+					"<Entry><UUID>lmU+9n0aeESKZvcEze+bRw==</UUID><Times><ExpiryTime>soon</ExpiryTime><UsageCount>many</UsageCount></Times>" +
+					"<String><Key>Title</Key><Value>Broken</Value></String></Entry></Group></Root></KeePassFile>"
+
+				f := format.KeePass2XmlFile{}
+				Expect(xml.Unmarshal([]byte(body), &f)).To(Succeed())
+				xmlReader := &format.KeePass2XmlReader{KeePass2XmlFile: f}
+				groups, err := xmlReader.Groups()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(groups[0].Times.Created.IsZero()).To(BeTrue())
+				Expect(groups[0].Times.Modified).To(Equal(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)))
+				Expect(groups[0].Times.Invalid).To(Equal([]string{format.TimeCreated}))
+
+				entries, err := (&format.EntryServiceOp{XMLReader: xmlReader}).List()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(entries).To(HaveLen(1))
+				Expect(entries[0].Title.String()).To(Equal("Broken"))
+				Expect(entries[0].Times.Expiry.IsZero()).To(BeTrue())
+				Expect(entries[0].Times.Invalid).To(Equal([]string{format.TimeExpiry, format.TimeUsageCount}))
+				Expect(entries[0].Times.Check(format.TimeModified)).To(Succeed())
+				Expect(entries[0].Times.Check(format.TimeModified, format.TimeExpiry)).To(MatchError("invalid ExpiryTime"))
+			})
+
 		})
 	})
 
@@ -0,0 +1,23 @@
+package format
+
+import "github.com/simonhayward/gkeepassxreader/streams"
+
+//Limits bound what is read from a database before it can be authenticated, a
+//damaged or hostile file exceeding them is an error rather than exhausting
+//memory
+type Limits struct {
+	//MaxHeaderFieldSize is the largest header field
+	MaxHeaderFieldSize int
+	//MaxHeaderSize is the largest header, its fields together
+	MaxHeaderSize int
+	//MaxBlockSize is the largest block of the payload
+	MaxBlockSize uint32
+}
+
+//DefaultLimits are the limits of a new reader, far beyond the 32 byte header
+//fields and 1 MiB blocks KeePass writes
+var DefaultLimits = Limits{
+	MaxHeaderFieldSize: 4 * 1024,
+	MaxHeaderSize:      64 * 1024,
+	MaxBlockSize:       streams.DefaultMaxBlockSize,
+}
@@ -0,0 +1,92 @@
+package format_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/simonhayward/gkeepassxreader/format"
+	"github.com/simonhayward/gkeepassxreader/keys"
+)
+
+var _ = Describe("Limits", func() {
+
+	const (
+		// signatures and version preceding the header fields
+		headerStart = 12
+	)
+
+	var (
+		database []byte
+		reader   *format.KeePass2Reader
+	)
+
+	// withField inserts a header field before the first
+	withField := func(id byte, data []byte) []byte {
+		field := append([]byte{id, byte(len(data)), byte(len(data) >> 8)}, data...)
+		b := append([]byte(nil), database[:headerStart]...)
+		b = append(b, field...)
+		return append(b, database[headerStart:]...)
+	}
+
+	BeforeEach(func() {
+		var err error
+		database, err = ioutil.ReadFile("test_data/ProtectedStrings.kdbx")
+		Expect(err).ToNot(HaveOccurred())
+		reader = format.NewKeePass2Reader()
+	})
+
+	AfterEach(func() {
+		reader.Close()
+	})
+
+	Context("when reading the header", func() {
+		It("uses the default limits", func() {
+			Expect(reader.Limits).To(Equal(format.DefaultLimits))
+			Expect(reader.ReadHeader(bytes.NewReader(database))).To(Succeed())
+		})
+
+		It("ignores a comment", func() {
+			Expect(reader.ReadHeader(bytes.NewReader(withField(1, []byte("comment"))))).To(Succeed())
+		})
+
+		It("returns an error for an unknown field", func() {
+			err := reader.ReadHeader(bytes.NewReader(withField(42, nil)))
+			Expect(err).To(MatchError(ContainSubstring("unknown header field: 42")))
+		})
+
+		It("returns an error when it is cut short", func() {
+			err := reader.ReadHeader(bytes.NewReader(database[:headerStart+10]))
+			Expect(err).To(MatchError(ContainSubstring("invalid header data length")))
+		})
+
+		It("returns an error for a field over the limit", func() {
+			reader.Limits.MaxHeaderFieldSize = 16
+
+			err := reader.ReadHeader(bytes.NewReader(database))
+			Expect(err).To(MatchError(ContainSubstring("header field length 32 exceeds the limit of 16")))
+		})
+
+		It("returns an error for a header over the limit", func() {
+			reader.Limits.MaxHeaderSize = 64
+
+			err := reader.ReadHeader(bytes.NewReader(database))
+			Expect(err).To(MatchError(ContainSubstring("header exceeds the limit of 64 bytes")))
+		})
+	})
+
+	Context("when reading the payload", func() {
+		It("returns an error for a block over the limit", func() {
+			db, err := os.Open("test_data/ProtectedStrings.kdbx")
+			Expect(err).ToNot(HaveOccurred())
+			defer db.Close()
+
+			reader.Limits.MaxBlockSize = 16
+			err = reader.ReadDatabase(db, keys.MasterKey("masterpw", nil))
+			Expect(err).To(MatchError(MatchRegexp(`block size \d+ exceeds the limit of 16`)))
+		})
+	})
+})
@@ -0,0 +1,75 @@
+package format
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const day = 24 * time.Hour
+
+//MasterKeyStatus is the age of the master key and whether a change is due
+type MasterKeyStatus struct {
+	Changed     time.Time
+	Days        int
+	Recommended bool
+	Forced      bool
+}
+
+//MasterKeyStatus compares the age of the master key with the recommended and
+//forced change intervals, nothing is due when the change time is not stored
+func (k *KeePass2XmlReader) MasterKeyStatus(now time.Time) (*MasterKeyStatus, error) {
+	m := k.KeePass2XmlFile.Meta
+	changed, err := parseTime(m.MasterKeyChanged)
+	if err != nil {
+		return nil, errors.Wrap(err, "master key changed")
+	}
+	rec, err := changeInterval(m.MasterKeyChangeRec)
+	if err != nil {
+		return nil, errors.Wrap(err, "master key change recommended")
+	}
+	force, err := changeInterval(m.MasterKeyChangeForce)
+	if err != nil {
+		return nil, errors.Wrap(err, "master key change forced")
+	}
+
+	status := &MasterKeyStatus{Changed: changed, Forced: forceOnce(m.Other)}
+	if changed.IsZero() {
+		return status, nil
+	}
+
+	age := now.Sub(changed)
+	status.Days = int(age / day)
+	if rec >= 0 && age > time.Duration(rec)*day {
+		status.Recommended = true
+	}
+	if force >= 0 && age > time.Duration(force)*day {
+		status.Forced = true
+	}
+	return status, nil
+}
+
+//SetMasterKeyChanged records a change of the master key, a pending forced
+//change is cleared
+func (f *KeePass2XmlFile) SetMasterKeyChanged(now time.Time) {
+	f.Meta.MasterKeyChanged = formatTime(now)
+
+	var other []element
+	for _, e := range f.Meta.Other {
+		if e.XMLName.Local != "MasterKeyChangeForceOnce" {
+			other = append(other, e)
+		}
+	}
+	f.Meta.Other = other
+}
+
+// forceOnce is set by KeePass to force a change on the next open
+func forceOnce(other []element) bool {
+	for _, e := range other {
+		if e.XMLName.Local == "MasterKeyChangeForceOnce" {
+			return strings.EqualFold(strings.TrimSpace(e.Content), "True")
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package format_test
+
+import (
+	"encoding/xml"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/simonhayward/gkeepassxreader/format"
+)
+
+var _ = Describe("MasterKey", func() {
+
+	now := time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)
+
+	status := func(meta string) *format.MasterKeyStatus {
+		f := format.KeePass2XmlFile{}
+		Expect(xml.Unmarshal([]byte("<KeePassFile><Meta>"+meta+"</Meta><Root></Root></KeePassFile>"), &f)).To(Succeed())
+		s, err := (&format.KeePass2XmlReader{KeePass2XmlFile: f}).MasterKeyStatus(now)
+		Expect(err).ToNot(HaveOccurred())
+		return s
+	}
+
+	It("is not due when the intervals are disabled", func() {
+		s := status("<MasterKeyChanged>2020-01-01T00:00:00Z</MasterKeyChanged><MasterKeyChangeRec>-1</MasterKeyChangeRec><MasterKeyChangeForce>-1</MasterKeyChangeForce>")
+		Expect(s.Recommended).To(BeFalse())
+		Expect(s.Forced).To(BeFalse())
+	})
+
+	It("is recommended once the recommended interval has passed", func() {
+		s := status("<MasterKeyChanged>2024-01-01T00:00:00Z</MasterKeyChanged><MasterKeyChangeRec>20</MasterKeyChangeRec><MasterKeyChangeForce>60</MasterKeyChangeForce>")
+		Expect(s.Days).To(Equal(30))
+		Expect(s.Recommended).To(BeTrue())
+		Expect(s.Forced).To(BeFalse())
+	})
+
+	It("is forced once the forced interval has passed", func() {
+		s := status("<MasterKeyChanged>2024-01-01T00:00:00Z</MasterKeyChanged><MasterKeyChangeRec>-1</MasterKeyChangeRec><MasterKeyChangeForce>29</MasterKeyChangeForce>")
+		Expect(s.Forced).To(BeTrue())
+	})
+
+	It("is forced when a change on the next open is requested", func() {
+		Expect(status("<MasterKeyChangeForceOnce>True</MasterKeyChangeForceOnce>").Forced).To(BeTrue())
+	})
+
+	It("is not due when the change time is not stored", func() {
+		s := status("<MasterKeyChangeRec>1</MasterKeyChangeRec><MasterKeyChangeForce>1</MasterKeyChangeForce>")
+		Expect(s.Recommended).To(BeFalse())
+		Expect(s.Forced).To(BeFalse())
+	})
+
+	It("records the change and clears a forced change", func() {
+		f := format.KeePass2XmlFile{}
+		Expect(xml.Unmarshal([]byte("<KeePassFile><Meta><MasterKeyChangeForceOnce>True</MasterKeyChangeForceOnce></Meta><Root></Root></KeePassFile>"), &f)).To(Succeed())
+		f.SetMasterKeyChanged(now)
+
+		s, err := (&format.KeePass2XmlReader{KeePass2XmlFile: f}).MasterKeyStatus(now)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(s.Changed).To(Equal(now))
+		Expect(s.Forced).To(BeFalse())
+	})
+})
@@ -0,0 +1,551 @@
+package format
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	//MergeAdded the object only existed in the source
+	MergeAdded = "added"
+	//MergeUpdated the source version was newer and replaced the target's
+	MergeUpdated = "updated"
+	//MergeKept the target version was newer, the source version went to history
+	MergeKept = "kept"
+	//MergeMoved the source moved the object more recently
+	MergeMoved = "moved"
+	//MergeDeleted the source deleted the object after it was last modified
+	MergeDeleted = "deleted"
+	//MergeSkipped the target deleted the object after it was last modified
+	MergeSkipped = "skipped"
+
+	//MergeKindEntry an entry changed
+	MergeKindEntry = "entry"
+	//MergeKindGroup a group changed
+	MergeKindGroup = "group"
+)
+
+//MergeChange describes a change made to the target by Merge. Conflict is set
+//when both databases changed an entry independently, the older version is
+//kept in the entry's history.
+type MergeChange struct {
+	Kind     string
+	Action   string
+	UUID     string
+	Path     []string
+	Title    string
+	Conflict bool
+}
+
+//Merge synchronises the source into f as KeePass does. Groups and entries are
+//matched by UUID and the newer LastModificationTime wins, the older entry is
+//kept in history. Moves are decided by LocationChanged and objects deleted on
+//either side are removed unless modified after the deletion. Both files must
+//be decrypted, see Decrypted. Any of those times which could not be parsed, in
+//either file, is an error and nothing is merged.
+func (f *KeePass2XmlFile) Merge(source *KeePass2XmlFile) ([]MergeChange, error) {
+	for _, file := range []*KeePass2XmlFile{f, source} {
+		if err := file.checkMergeTimes(); err != nil {
+			return nil, err
+		}
+	}
+
+	m := &merger{target: f, source: source}
+	if len(f.Root.Groups) == 0 {
+		if _, err := f.group(nil); err != nil {
+			return nil, err
+		}
+	}
+	if len(source.Root.Groups) == 0 {
+		return nil, nil
+	}
+
+	sourceRoot := &source.Root.Groups[0]
+	m.mergeGroups(sourceRoot.Groups, f.Root.Groups[0].UUID)
+	m.mergeEntries(sourceRoot, f.Root.Groups[0].UUID)
+	for i := range sourceRoot.Groups {
+		m.mergeGroupEntries(&sourceRoot.Groups[i])
+	}
+	m.applyDeletions()
+
+	return m.changes, nil
+}
+
+// checkMergeTimes of every group, entry and deletion, the merge decisions
+// depend on them
+func (f *KeePass2XmlFile) checkMergeTimes() error {
+	var entries func(rEntries []entry) error
+	entries = func(rEntries []entry) error {
+		for i := range rEntries {
+			times := rEntries[i].Times.parse()
+			if err := times.Check(TimeModified, TimeLocationChanged); err != nil {
+				return errors.Wrapf(err, "cannot merge entry %s", hexUUID(rEntries[i].UUID))
+			}
+			if err := entries(rEntries[i].HistoryEntries); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	var groups func(rGroups []group) error
+	groups = func(rGroups []group) error {
+		for i := range rGroups {
+			times := rGroups[i].Times.parse()
+			if err := times.Check(TimeModified, TimeLocationChanged); err != nil {
+				return errors.Wrapf(err, "cannot merge group %s", hexUUID(rGroups[i].UUID))
+			}
+			if err := entries(rGroups[i].Entry); err != nil {
+				return err
+			}
+			if err := groups(rGroups[i].Groups); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := groups(f.Root.Groups); err != nil {
+		return err
+	}
+
+	if f.Root.DeletedObjects != nil {
+		for _, d := range f.Root.DeletedObjects.Objects {
+			if _, err := parseTime(d.DeletionTime); err != nil {
+				return errors.Wrapf(err, "cannot merge deletion of %s", hexUUID(d.UUID))
+			}
+		}
+	}
+	return nil
+}
+
+type merger struct {
+	target  *KeePass2XmlFile
+	source  *KeePass2XmlFile
+	changes []MergeChange
+}
+
+// mergeGroups adds, updates and moves groups, parents before children
+func (m *merger) mergeGroups(groups []group, parentUUID string) {
+	for i := range groups {
+		sg := &groups[i]
+
+		tg, _ := m.target.findGroup(sg.UUID)
+		if tg == nil {
+			if m.deletedInTarget(sg.UUID, sg.Times.lastModified()) {
+				m.report(MergeKindGroup, MergeSkipped, sg.UUID, m.sourcePath(sg.UUID), sg.Name, false)
+				continue
+			}
+
+			parent, _ := m.target.findGroup(parentUUID)
+			if parent == nil {
+				parent = &m.target.Root.Groups[0]
+			}
+			parent.Groups = append(parent.Groups, group{
+				UUID:  sg.UUID,
+				Name:  sg.Name,
+				Times: cloneTimes(sg.Times),
+				Other: append([]element(nil), sg.Other...),
+			})
+			m.report(MergeKindGroup, MergeAdded, sg.UUID, m.targetPath(sg.UUID), sg.Name, false)
+		} else {
+			if sg.Times.lastModified().After(tg.Times.lastModified()) {
+				tg.Name = sg.Name
+				tg.Other = append([]element(nil), sg.Other...)
+				location := tg.Times
+				tg.Times = cloneTimes(sg.Times)
+				if location != nil && tg.Times != nil {
+					tg.Times.LocationChanged = location.LocationChanged
+				}
+				m.report(MergeKindGroup, MergeUpdated, sg.UUID, m.targetPath(sg.UUID), sg.Name, false)
+			}
+
+			_, currentParent := m.target.findGroup(sg.UUID)
+			newParent, _ := m.target.findGroup(parentUUID)
+			if currentParent != nil && newParent != nil && currentParent.UUID != parentUUID &&
+				sg.Times.locationChanged().After(tg.Times.locationChanged()) && !m.target.isDescendant(parentUUID, sg.UUID) {
+				moved := m.target.removeGroup(sg.UUID)
+				if moved.Times != nil && sg.Times != nil {
+					moved.Times.LocationChanged = sg.Times.LocationChanged
+				}
+				// removing the group may have moved the new parent in memory
+				parent, _ := m.target.findGroup(parentUUID)
+				parent.Groups = append(parent.Groups, moved)
+				m.report(MergeKindGroup, MergeMoved, sg.UUID, m.targetPath(sg.UUID), sg.Name, false)
+			}
+		}
+
+		m.mergeGroups(sg.Groups, sg.UUID)
+	}
+}
+
+// mergeGroupEntries merges the entries of g and its subgroups
+func (m *merger) mergeGroupEntries(g *group) {
+	m.mergeEntries(g, g.UUID)
+	for i := range g.Groups {
+		m.mergeGroupEntries(&g.Groups[i])
+	}
+}
+
+// mergeEntries merges the entries of the source group into the target group
+// with the given UUID, which may have been skipped if deleted
+func (m *merger) mergeEntries(sg *group, groupUUID string) {
+	for i := range sg.Entry {
+		se := &sg.Entry[i]
+
+		tg, idx := m.target.findEntry(se.UUID)
+		if tg == nil {
+			if m.deletedInTarget(se.UUID, se.Times.lastModified()) {
+				m.report(MergeKindEntry, MergeSkipped, se.UUID, m.sourcePath(sg.UUID), entryTitle(se), false)
+				continue
+			}
+
+			parent, _ := m.target.findGroup(groupUUID)
+			if parent == nil {
+				parent = &m.target.Root.Groups[0]
+			}
+			parent.Entry = append(parent.Entry, m.importEntry(se))
+			m.report(MergeKindEntry, MergeAdded, se.UUID, m.targetPath(parent.UUID), entryTitle(se), false)
+			continue
+		}
+
+		te := &tg.Entry[idx]
+		sourceModified, targetModified := se.Times.lastModified(), te.Times.lastModified()
+		switch {
+		case sourceModified.After(targetModified):
+			// the target is only in conflict if it changed since the source saw it
+			conflict := !hasHistory(se, targetModified)
+			merged := m.importEntry(se)
+			merged.HistoryEntries = mergeHistory(te.HistoryEntries, merged.HistoryEntries, withoutHistory(te))
+			if merged.Times != nil && te.Times != nil {
+				merged.Times.LocationChanged = te.Times.LocationChanged
+			}
+			tg.Entry[idx] = merged
+			m.report(MergeKindEntry, MergeUpdated, se.UUID, m.targetPath(tg.UUID), entryTitle(se), conflict)
+		case targetModified.After(sourceModified):
+			conflict := !hasHistory(te, sourceModified)
+			imported := m.importEntry(se)
+			te.HistoryEntries = mergeHistory(te.HistoryEntries, imported.HistoryEntries, withoutHistory(&imported))
+			if conflict {
+				m.report(MergeKindEntry, MergeKept, se.UUID, m.targetPath(tg.UUID), entryTitle(te), true)
+			}
+		default:
+			imported := m.importEntry(se)
+			te.HistoryEntries = mergeHistory(te.HistoryEntries, imported.HistoryEntries)
+		}
+
+		if tg.UUID != groupUUID && se.Times.locationChanged().After(tg.Entry[idx].Times.locationChanged()) {
+			parent, _ := m.target.findGroup(groupUUID)
+			if parent == nil {
+				continue
+			}
+			moved := tg.Entry[idx]
+			tg.Entry = append(tg.Entry[:idx], tg.Entry[idx+1:]...)
+			if moved.Times != nil && se.Times != nil {
+				moved.Times.LocationChanged = se.Times.LocationChanged
+			}
+			parent.Entry = append(parent.Entry, moved)
+			m.report(MergeKindEntry, MergeMoved, se.UUID, m.targetPath(groupUUID), entryTitle(&moved), false)
+		}
+	}
+}
+
+// applyDeletions removes objects the source deleted after their last
+// modification, then records the deletions of both sides in the target
+func (m *merger) applyDeletions() {
+	var deleted []deletedObject
+	if m.source.Root.DeletedObjects != nil {
+		deleted = m.source.Root.DeletedObjects.Objects
+	}
+
+	for _, d := range deleted {
+		deletionTime, err := parseTime(d.DeletionTime)
+		if err != nil {
+			continue
+		}
+
+		if g, idx := m.target.findEntry(d.UUID); g != nil {
+			if g.Entry[idx].Times.lastModified().Before(deletionTime) {
+				path, title := m.targetPath(g.UUID), entryTitle(&g.Entry[idx])
+				g.Entry = append(g.Entry[:idx], g.Entry[idx+1:]...)
+				m.report(MergeKindEntry, MergeDeleted, d.UUID, path, title, false)
+			}
+		}
+	}
+
+	// a group is only removed once empty, repeated as removing a group can
+	// empty its parent
+	for removed := true; removed; {
+		removed = false
+		for _, d := range deleted {
+			deletionTime, err := parseTime(d.DeletionTime)
+			if err != nil {
+				continue
+			}
+			g, parent := m.target.findGroup(d.UUID)
+			if g == nil || parent == nil || len(g.Entry) > 0 || len(g.Groups) > 0 || !g.Times.lastModified().Before(deletionTime) {
+				continue
+			}
+			path, name := m.targetPath(g.UUID), g.Name
+			m.target.removeGroup(d.UUID)
+			removed = true
+			m.report(MergeKindGroup, MergeDeleted, d.UUID, path, name, false)
+		}
+	}
+
+	if len(deleted) == 0 {
+		return
+	}
+	if m.target.Root.DeletedObjects == nil {
+		m.target.Root.DeletedObjects = &deletedObjects{}
+	}
+	for _, d := range deleted {
+		m.target.Root.DeletedObjects.add(d)
+	}
+}
+
+// add keeps the latest deletion time of each object
+func (d *deletedObjects) add(o deletedObject) {
+	for i := range d.Objects {
+		if d.Objects[i].UUID != o.UUID {
+			continue
+		}
+		existing, _ := parseTime(d.Objects[i].DeletionTime)
+		if deletionTime, err := parseTime(o.DeletionTime); err == nil && deletionTime.After(existing) {
+			d.Objects[i].DeletionTime = o.DeletionTime
+		}
+		return
+	}
+	d.Objects = append(d.Objects, o)
+}
+
+func (m *merger) deletedInTarget(uuid string, modified time.Time) bool {
+	if m.target.Root.DeletedObjects == nil {
+		return false
+	}
+	for _, d := range m.target.Root.DeletedObjects.Objects {
+		if d.UUID != uuid {
+			continue
+		}
+		deletionTime, err := parseTime(d.DeletionTime)
+		return err == nil && !modified.After(deletionTime)
+	}
+	return false
+}
+
+// importEntry copies a source entry, binaries referenced from the source pool
+// are added to the target pool
+func (m *merger) importEntry(se *entry) entry {
+	e := cloneEntry(se)
+	m.importBinaries(&e)
+	return e
+}
+
+func (m *merger) importBinaries(e *entry) {
+	for i := range e.Binaries {
+		ref := e.Binaries[i].Value.Ref
+		if len(ref) == 0 {
+			continue
+		}
+		for _, b := range m.source.Meta.Binaries {
+			if b.ID == ref {
+				e.Binaries[i].Value.Ref = m.target.addBinary(b)
+				break
+			}
+		}
+	}
+	for i := range e.HistoryEntries {
+		m.importBinaries(&e.HistoryEntries[i])
+	}
+}
+
+// addBinary returns the id of an identical binary in the pool, or adds it
+func (f *KeePass2XmlFile) addBinary(b metaBinary) string {
+	next := 0
+	for _, existing := range f.Meta.Binaries {
+		if existing.Data == b.Data && existing.Compressed == b.Compressed {
+			return existing.ID
+		}
+		if id, err := strconv.Atoi(existing.ID); err == nil && id >= next {
+			next = id + 1
+		}
+	}
+	b.ID = strconv.Itoa(next)
+	f.Meta.Binaries = append(f.Meta.Binaries, b)
+	return b.ID
+}
+
+func (m *merger) report(kind, action, uuid string, path []string, title string, conflict bool) {
+	m.changes = append(m.changes, MergeChange{
+		Kind:     kind,
+		Action:   action,
+		UUID:     hexUUID(uuid),
+		Path:     path,
+		Title:    title,
+		Conflict: conflict,
+	})
+}
+
+func (m *merger) targetPath(groupUUID string) []string {
+	return m.target.groupPath(groupUUID)
+}
+
+func (m *merger) sourcePath(groupUUID string) []string {
+	return m.source.groupPath(groupUUID)
+}
+
+// findGroup returns the group with the given base64 UUID and its parent
+func (f *KeePass2XmlFile) findGroup(uuid string) (*group, *group) {
+	var find func(groups []group, parent *group) (*group, *group)
+	find = func(groups []group, parent *group) (*group, *group) {
+		for i := range groups {
+			if groups[i].UUID == uuid {
+				return &groups[i], parent
+			}
+			if g, p := find(groups[i].Groups, &groups[i]); g != nil {
+				return g, p
+			}
+		}
+		return nil, nil
+	}
+	return find(f.Root.Groups, nil)
+}
+
+// findEntry returns the group holding the entry with the given base64 UUID
+// and the entry's index
+func (f *KeePass2XmlFile) findEntry(uuid string) (*group, int) {
+	var find func(groups []group) (*group, int)
+	find = func(groups []group) (*group, int) {
+		for i := range groups {
+			for j := range groups[i].Entry {
+				if groups[i].Entry[j].UUID == uuid {
+					return &groups[i], j
+				}
+			}
+			if g, idx := find(groups[i].Groups); g != nil {
+				return g, idx
+			}
+		}
+		return nil, -1
+	}
+	return find(f.Root.Groups)
+}
+
+// groupPath returns the names from the root group to the given group
+func (f *KeePass2XmlFile) groupPath(uuid string) []string {
+	var find func(groups []group, path []string) []string
+	find = func(groups []group, path []string) []string {
+		for i := range groups {
+			p := append(append([]string(nil), path...), groups[i].Name)
+			if groups[i].UUID == uuid {
+				return p
+			}
+			if found := find(groups[i].Groups, p); found != nil {
+				return found
+			}
+		}
+		return nil
+	}
+	return find(f.Root.Groups, nil)
+}
+
+// isDescendant reports whether the group uuid is ancestor or below it
+func (f *KeePass2XmlFile) isDescendant(uuid, ancestor string) bool {
+	g, _ := f.findGroup(ancestor)
+	if g == nil {
+		return false
+	}
+	found, _ := (&KeePass2XmlFile{Root: root{Groups: []group{*g}}}).findGroup(uuid)
+	return found != nil
+}
+
+// removeGroup detaches the group from its parent and returns it
+func (f *KeePass2XmlFile) removeGroup(uuid string) group {
+	g, parent := f.findGroup(uuid)
+	removed := *g
+	for i := range parent.Groups {
+		if parent.Groups[i].UUID == uuid {
+			parent.Groups = append(parent.Groups[:i], parent.Groups[i+1:]...)
+			break
+		}
+	}
+	return removed
+}
+
+// mergeHistory combines histories, versions are matched by modification time
+// and sorted oldest first
+func mergeHistory(histories ...[]entry) []entry {
+	seen := make(map[int64]bool)
+	var merged []entry
+	for _, history := range histories {
+		for _, h := range history {
+			modified := h.Times.lastModified().Unix()
+			if seen[modified] {
+				continue
+			}
+			seen[modified] = true
+			merged = append(merged, h)
+		}
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Times.lastModified().Before(merged[j].Times.lastModified())
+	})
+	return merged
+}
+
+// hasHistory reports whether a version of e modified at the given time exists
+func hasHistory(e *entry, modified time.Time) bool {
+	for _, h := range e.HistoryEntries {
+		if h.Times.lastModified().Equal(modified) {
+			return true
+		}
+	}
+	return false
+}
+
+func withoutHistory(e *entry) []entry {
+	c := cloneEntry(e)
+	c.HistoryEntries = nil
+	return []entry{c}
+}
+
+func cloneEntry(e *entry) entry {
+	c := *e
+	c.Times = cloneTimes(e.Times)
+	c.StringEntry = append([]stringEntry(nil), e.StringEntry...)
+	c.Binaries = append([]entryBinary(nil), e.Binaries...)
+	c.Other = append([]element(nil), e.Other...)
+	c.HistoryEntries = nil
+	for i := range e.HistoryEntries {
+		c.HistoryEntries = append(c.HistoryEntries, cloneEntry(&e.HistoryEntries[i]))
+	}
+	return c
+}
+
+func cloneTimes(t *times) *times {
+	if t == nil {
+		return nil
+	}
+	c := *t
+	return &c
+}
+
+func entryTitle(e *entry) string {
+	for _, s := range e.StringEntry {
+		if s.Key == "Title" {
+			return s.Value.Data
+		}
+	}
+	return ""
+}
+
+func hexUUID(uuid string) string {
+	b, err := base64.StdEncoding.DecodeString(uuid)
+	if err != nil {
+		return uuid
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,201 @@
+package format_test
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/simonhayward/gkeepassxreader/format"
+)
+
+func mergeUUID(n byte) string {
+	uuid := make([]byte, 16)
+	uuid[15] = n
+	return base64.StdEncoding.EncodeToString(uuid)
+}
+
+func mergeHexUUID(n byte) string {
+	return fmt.Sprintf("%030x%02x", 0, n)
+}
+
+func mergeTimes(modified, location string) string {
+	return fmt.Sprintf("<Times><LastModificationTime>%s</LastModificationTime><LocationChanged>%s</LocationChanged></Times>", modified, location)
+}
+
+func mergeEntry(n byte, title, modified, location string, history ...string) string {
+	return fmt.Sprintf("<Entry><UUID>%s</UUID>%s<String><Key>Title</Key><Value>%s</Value></String><History>%s</History></Entry>",
+		mergeUUID(n), mergeTimes(modified, location), title, strings.Join(history, ""))
+}
+
+func mergeGroup(n byte, name, modified string, children ...string) string {
+	return fmt.Sprintf("<Group><UUID>%s</UUID><Name>%s</Name>%s%s</Group>",
+		mergeUUID(n), name, mergeTimes(modified, modified), strings.Join(children, ""))
+}
+
+func mergeFile(root, deleted string) *format.KeePass2XmlFile {
+	f := &format.KeePass2XmlFile{}
+	body := fmt.Sprintf("<KeePassFile><Meta></Meta><Root>%s<DeletedObjects>%s</DeletedObjects></Root></KeePassFile>", root, deleted)
+	Expect(xml.Unmarshal([]byte(body), f)).To(Succeed())
+	return f
+}
+
+func mergedEntries(f *format.KeePass2XmlFile) map[string]format.Entry {
+	entries, err := (&format.EntryServiceOp{XMLReader: &format.KeePass2XmlReader{KeePass2XmlFile: *f}}).List()
+	Expect(err).ToNot(HaveOccurred())
+
+	m := make(map[string]format.Entry)
+	for _, e := range entries {
+		m[e.Title.String()] = e
+	}
+	return m
+}
+
+func historyTitles(f *format.KeePass2XmlFile, uuid string) []string {
+	entries, err := (&format.EntryServiceOp{XMLReader: &format.KeePass2XmlReader{KeePass2XmlFile: *f}, HistoricalEntries: true}).List()
+	Expect(err).ToNot(HaveOccurred())
+
+	var titles []string
+	for _, e := range entries {
+		if e.UUID == uuid && e.Historical {
+			titles = append(titles, e.Title.String())
+		}
+	}
+	return titles
+}
+
+const (
+	t1 = "2020-01-01T00:00:00Z"
+	t2 = "2020-02-01T00:00:00Z"
+	t3 = "2020-03-01T00:00:00Z"
+)
+
+var _ = Describe("Merge", func() {
+
+	Context("when the source changed an entry the target did not", func() {
+		It("updates the target and keeps the old version in history", func() {
+			target := mergeFile(mergeGroup(1, "Root", t1, mergeEntry(10, "Old", t1, t1)), "")
+			source := mergeFile(mergeGroup(1, "Root", t1, mergeEntry(10, "New", t2, t1, mergeEntry(10, "Old", t1, t1))), "")
+
+			changes, err := target.Merge(source)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(changes).To(Equal([]format.MergeChange{
+				{Kind: format.MergeKindEntry, Action: format.MergeUpdated, UUID: mergeHexUUID(10), Path: []string{"Root"}, Title: "New"},
+			}))
+
+			Expect(mergedEntries(target)).To(HaveKey("New"))
+			Expect(historyTitles(target, mergeHexUUID(10))).To(Equal([]string{"Old"}))
+		})
+	})
+
+	Context("when both databases changed an entry", func() {
+		It("keeps the newer version and reports a conflict", func() {
+			target := mergeFile(mergeGroup(1, "Root", t1, mergeEntry(10, "Target", t3, t1)), "")
+			source := mergeFile(mergeGroup(1, "Root", t1, mergeEntry(10, "Source", t2, t1)), "")
+
+			changes, err := target.Merge(source)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(changes).To(HaveLen(1))
+			Expect(changes[0].Action).To(Equal(format.MergeKept))
+			Expect(changes[0].Conflict).To(BeTrue())
+
+			Expect(mergedEntries(target)).To(HaveKey("Target"))
+			Expect(historyTitles(target, mergeHexUUID(10))).To(Equal([]string{"Source"}))
+		})
+	})
+
+	Context("when the source added groups and entries", func() {
+		It("adds them below the matching group", func() {
+			target := mergeFile(mergeGroup(1, "Root", t1), "")
+			source := mergeFile(mergeGroup(1, "Root", t1, mergeGroup(2, "Team", t2, mergeEntry(10, "Shared", t2, t2))), "")
+
+			changes, err := target.Merge(source)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(changes).To(Equal([]format.MergeChange{
+				{Kind: format.MergeKindGroup, Action: format.MergeAdded, UUID: mergeHexUUID(2), Path: []string{"Root", "Team"}, Title: "Team"},
+				{Kind: format.MergeKindEntry, Action: format.MergeAdded, UUID: mergeHexUUID(10), Path: []string{"Root", "Team"}, Title: "Shared"},
+			}))
+			Expect(mergedEntries(target)["Shared"].Path).To(Equal([]string{"Root", "Team"}))
+		})
+	})
+
+	Context("when the source moved an entry", func() {
+		It("moves it when the location changed more recently", func() {
+			target := mergeFile(mergeGroup(1, "Root", t1, mergeGroup(2, "A", t1, mergeEntry(10, "Moving", t1, t1)), mergeGroup(3, "B", t1)), "")
+			source := mergeFile(mergeGroup(1, "Root", t1, mergeGroup(2, "A", t1), mergeGroup(3, "B", t1, mergeEntry(10, "Moving", t1, t2))), "")
+
+			changes, err := target.Merge(source)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(changes).To(HaveLen(1))
+			Expect(changes[0].Action).To(Equal(format.MergeMoved))
+			Expect(mergedEntries(target)["Moving"].Path).To(Equal([]string{"Root", "B"}))
+		})
+	})
+
+	Context("when objects were deleted", func() {
+		It("removes entries the source deleted and records the deletion", func() {
+			target := mergeFile(mergeGroup(1, "Root", t1, mergeGroup(2, "Old", t1, mergeEntry(10, "Gone", t1, t1))), "")
+			source := mergeFile(mergeGroup(1, "Root", t1),
+				fmt.Sprintf("<DeletedObject><UUID>%s</UUID><DeletionTime>%s</DeletionTime></DeletedObject>", mergeUUID(10), t2)+
+					fmt.Sprintf("<DeletedObject><UUID>%s</UUID><DeletionTime>%s</DeletionTime></DeletedObject>", mergeUUID(2), t2))
+
+			changes, err := target.Merge(source)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(changes).To(HaveLen(2))
+			Expect(changes[0].Action).To(Equal(format.MergeDeleted))
+			Expect(changes[0].Kind).To(Equal(format.MergeKindEntry))
+			Expect(changes[1].Action).To(Equal(format.MergeDeleted))
+			Expect(changes[1].Kind).To(Equal(format.MergeKindGroup))
+			Expect(mergedEntries(target)).To(BeEmpty())
+
+			buf := &strings.Builder{}
+			Expect(target.WriteXML(buf)).To(Succeed())
+			Expect(buf.String()).To(ContainSubstring(mergeUUID(10)))
+		})
+
+		It("keeps an entry modified after the deletion", func() {
+			target := mergeFile(mergeGroup(1, "Root", t1, mergeEntry(10, "Edited", t3, t1)), "")
+			source := mergeFile(mergeGroup(1, "Root", t1),
+				fmt.Sprintf("<DeletedObject><UUID>%s</UUID><DeletionTime>%s</DeletionTime></DeletedObject>", mergeUUID(10), t2))
+
+			_, err := target.Merge(source)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(mergedEntries(target)).To(HaveKey("Edited"))
+		})
+
+		It("skips entries the target deleted", func() {
+			target := mergeFile(mergeGroup(1, "Root", t1),
+				fmt.Sprintf("<DeletedObject><UUID>%s</UUID><DeletionTime>%s</DeletionTime></DeletedObject>", mergeUUID(10), t2))
+			source := mergeFile(mergeGroup(1, "Root", t1, mergeEntry(10, "Gone", t1, t1)), "")
+
+			changes, err := target.Merge(source)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(changes).To(HaveLen(1))
+			Expect(changes[0].Action).To(Equal(format.MergeSkipped))
+			Expect(mergedEntries(target)).To(BeEmpty())
+		})
+	})
+
+	Context("when a time the merge depends on can't be parsed", func() {
+		It("fails without changing the target", func() {
+			target := mergeFile(mergeGroup(1, "Root", t1, mergeEntry(10, "Old", t1, t1)), "")
+			source := mergeFile(mergeGroup(1, "Root", t1, mergeEntry(10, "New", t2, t1, mergeEntry(10, "Older", "yesterday", t1))), "")
+
+			_, err := target.Merge(source)
+			Expect(err).To(MatchError("cannot merge entry " + mergeHexUUID(10) + ": invalid LastModificationTime"))
+			Expect(mergedEntries(target)).To(HaveKey("Old"))
+		})
+
+		It("fails on an invalid deletion time", func() {
+			target := mergeFile(mergeGroup(1, "Root", t1, mergeEntry(10, "Old", t1, t1)), "")
+			source := mergeFile(mergeGroup(1, "Root", t1),
+				fmt.Sprintf("<DeletedObject><UUID>%s</UUID><DeletionTime>soon</DeletionTime></DeletedObject>", mergeUUID(10)))
+
+			_, err := target.Merge(source)
+			Expect(err).To(MatchError(ContainSubstring("cannot merge deletion of " + mergeHexUUID(10))))
+		})
+	})
+})
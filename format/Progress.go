@@ -0,0 +1,50 @@
+package format
+
+const (
+	//StageKDF the composite key is being transformed
+	StageKDF = "kdf"
+	//StageDecrypt the payload is being decrypted
+	StageDecrypt = "decrypt"
+	//StageParse the decrypted xml is being parsed
+	StageParse = "parse"
+)
+
+//Progress is how far opening a database has got
+type Progress struct {
+	Stage          string
+	KDFRounds      uint64
+	KDFDone        uint64
+	BytesDecrypted int64
+	EntriesParsed  int
+}
+
+//KDFPercent is the percentage of the transform rounds done
+func (p Progress) KDFPercent() float64 {
+	if p.KDFRounds == 0 {
+		return 0
+	}
+	return float64(p.KDFDone) * 100 / float64(p.KDFRounds)
+}
+
+//ProgressFunc is called as a database is opened, on the reading goroutine so
+//it should return quickly
+type ProgressFunc func(Progress)
+
+// report calls fn when one is given
+func (fn ProgressFunc) report(p Progress) {
+	if fn != nil {
+		fn(p)
+	}
+}
+
+// countEntries counts the entries of groups, history included
+func countEntries(groups []group) int {
+	n := 0
+	for _, g := range groups {
+		for _, e := range g.Entry {
+			n += 1 + len(e.HistoryEntries)
+		}
+		n += countEntries(g.Groups)
+	}
+	return n
+}
@@ -0,0 +1,308 @@
+package format
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"os"
+	"regexp"
+
+	"github.com/pkg/errors"
+	"github.com/simonhayward/gkeepassxreader/keys"
+	"github.com/simonhayward/gkeepassxreader/secure"
+)
+
+const (
+	recoveredGroupName = "Recovered"
+)
+
+var (
+	// protected values as KeePass and the writer store them, the random stream
+	// offsets of those after a missing block are unknown
+	protectedValuePattern = regexp.MustCompile(`<Value\s[^>]*Protected="True"[^>]*?(?:/>|>([^<]*)</Value>)`)
+
+	entryStart      = []byte("<Entry>")
+	metaBinaryStart = []byte("<Binary ID=")
+)
+
+//RecoverReport describes what was salvaged from a damaged database. Lost
+//values are protected values whose random stream offset is unknown, lost
+//attachments refer to binaries which weren't recovered.
+type RecoverReport struct {
+	Blocks            int            `json:"blocks"`
+	CorruptBlocks     []CorruptBlock `json:"corrupt_blocks"`
+	StreamError       string         `json:"stream_error,omitempty"`
+	XMLError          string         `json:"xml_error,omitempty"`
+	Entries           int            `json:"entries"`
+	LostValues        int            `json:"lost_values"`
+	LostAttachments   int            `json:"lost_attachments"`
+	RecoveredBinaries int            `json:"recovered_binaries"`
+	UnparsedFragments int            `json:"unparsed_fragments"`
+}
+
+// protectedValue is where a protected value is in the xml and, when it is
+// known, its random stream offset
+type protectedValue struct {
+	pos    int
+	offset int
+	known  bool
+}
+
+//Recover salvages the entries of a damaged database. Corrupt blocks are
+//skipped and every entry whose xml still parses is added, decrypted, to the
+//root group of a new xml file. The key must have been transformed.
+func (k *KeePass2Reader) Recover(ctx context.Context, db *os.File, compositeKey *keys.CompositeKey) (*KeePass2XmlFile, *RecoverReport, error) {
+	p, err := k.readBlocks(ctx, db, compositeKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer secure.Wipe(p.data)
+
+	report := &RecoverReport{Blocks: p.blocks, CorruptBlocks: p.corrupt}
+	if p.streamErr != nil {
+		report.StreamError = p.streamErr.Error()
+	}
+
+	// the random stream offsets of protected values after the gap are unknown
+	xmlData, gap, err := k.payloadXML(p)
+	if err != nil {
+		report.XMLError = err.Error()
+	}
+	defer secure.Wipe(xmlData)
+
+	randomKey := sha256.Sum256(k.protectedStreamKey)
+	stream := NewKeePass2RandomStream(innerStreamSalsa20Iv, &randomKey)
+	defer stream.Wipe()
+
+	f := &KeePass2XmlFile{}
+	root, err := newGroup(recoveredGroupName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f.Meta.Binaries = salvageBinaries(xmlData)
+	report.RecoveredBinaries = len(f.Meta.Binaries)
+
+	values := protectedValues(xmlData, gap)
+	entries, unparsed := salvageEntries(xmlData)
+	report.UnparsedFragments = unparsed
+
+	for _, s := range entries {
+		e := s.entry
+		lost, err := decryptSalvaged(&e, values, s.start, s.end, stream)
+		if err != nil {
+			return nil, nil, err
+		}
+		report.LostValues += lost
+		report.LostAttachments += dropMissingBinaries(&e, f.Meta.Binaries)
+		root.Entry = append(root.Entry, e)
+	}
+	report.Entries = len(root.Entry)
+
+	f.Root.Groups = []group{*root}
+	return f, report, nil
+}
+
+// salvagedEntry is an entry which parsed and where its xml is
+type salvagedEntry struct {
+	entry      entry
+	start, end int
+}
+
+// salvageEntries parses every entry of data which is still well formed. An
+// entry which doesn't parse may still contain history entries which do, as
+// they share its UUID only the last found is kept.
+func salvageEntries(data []byte) ([]salvagedEntry, int) {
+	var salvaged []salvagedEntry
+	index := make(map[string]int)
+	unparsed := 0
+
+	for pos := 0; ; {
+		i := bytes.Index(data[pos:], entryStart)
+		if i < 0 {
+			break
+		}
+		start := pos + i
+
+		d := xml.NewDecoder(bytes.NewReader(data[start:]))
+		var e entry
+		if err := d.Decode(&e); err != nil || !validUUID(e.UUID) {
+			unparsed++
+			pos = start + len(entryStart)
+			continue
+		}
+		end := start + int(d.InputOffset())
+		pos = end
+
+		var history []entry
+		for _, h := range e.HistoryEntries {
+			if validUUID(h.UUID) {
+				history = append(history, h)
+			}
+		}
+		e.HistoryEntries = history
+
+		s := salvagedEntry{entry: e, start: start, end: end}
+		if j, ok := index[e.UUID]; ok {
+			salvaged[j] = s
+			continue
+		}
+		index[e.UUID] = len(salvaged)
+		salvaged = append(salvaged, s)
+	}
+	return salvaged, unparsed
+}
+
+// validUUID is whether a salvaged UUID decodes, damaged xml can still parse
+// and an entry without one can't be read back
+func validUUID(uuid string) bool {
+	b, err := base64.StdEncoding.DecodeString(uuid)
+	return err == nil && len(b) == 16
+}
+
+// salvageBinaries parses every binary of the meta binaries pool which is
+// still well formed
+func salvageBinaries(data []byte) []metaBinary {
+	var binaries []metaBinary
+	seen := make(map[string]bool)
+	for pos := 0; ; {
+		i := bytes.Index(data[pos:], metaBinaryStart)
+		if i < 0 {
+			break
+		}
+		start := pos + i
+
+		d := xml.NewDecoder(bytes.NewReader(data[start:]))
+		var b metaBinary
+		if err := d.Decode(&b); err != nil || seen[b.ID] {
+			pos = start + len(metaBinaryStart)
+			continue
+		}
+		pos = start + int(d.InputOffset())
+		seen[b.ID] = true
+		binaries = append(binaries, b)
+	}
+	return binaries
+}
+
+// protectedValues finds every protected value of data in document order, the
+// order of their random stream offsets, which are only known before gap
+func protectedValues(data []byte, gap int) []protectedValue {
+	var values []protectedValue
+	offset := 0
+	for _, m := range protectedValuePattern.FindAllSubmatchIndex(data, -1) {
+		v := protectedValue{pos: m[0], offset: offset, known: m[1] <= gap}
+		values = append(values, v)
+		if m[2] >= 0 {
+			n, err := base64.StdEncoding.DecodeString(string(data[m[2]:m[3]]))
+			if err != nil {
+				// the offsets of the values which follow can't be known
+				gap = m[0]
+			}
+			offset += len(n)
+		}
+	}
+	return values
+}
+
+// decryptSalvaged decrypts the protected values of an entry found between
+// start and end, values whose random stream offset isn't known are cleared
+// and counted
+func decryptSalvaged(e *entry, values []protectedValue, start, end int, stream *KeePass2RandomStream) (int, error) {
+	var inEntry []protectedValue
+	for _, v := range values {
+		if v.pos >= start && v.pos < end {
+			inEntry = append(inEntry, v)
+		}
+	}
+
+	g := group{Entry: []entry{*e}}
+	defer func() { *e = g.Entry[0] }()
+
+	// the pattern and the decoder must agree on which values are protected
+	matched := len(inEntry) == countProtected(g)
+
+	lost, i := 0, 0
+	err := forEachValue([]group{g}, func(v *value, binary bool) error {
+		if v.Protected != "True" {
+			return nil
+		}
+		v.Protected = ""
+		v.ProtectInMemory = "True"
+
+		known := matched && inEntry[i].known
+		var offset int
+		if matched {
+			offset = inEntry[i].offset
+		}
+		i++
+
+		if len(v.Data) == 0 {
+			return nil
+		}
+		if !known {
+			v.Data = ""
+			lost++
+			return nil
+		}
+
+		ciphertext, err := base64.StdEncoding.DecodeString(v.Data)
+		if err != nil {
+			return errors.Wrap(err, "ciphertext decode failed")
+		}
+		plaintext, err := stream.Process(offset, ciphertext)
+		if err != nil {
+			return errors.Wrap(err, "decrypt failed")
+		}
+		if binary {
+			v.Data = base64.StdEncoding.EncodeToString(plaintext)
+		} else {
+			v.Data = string(plaintext)
+		}
+		secure.Wipe(plaintext)
+		return nil
+	})
+	return lost, err
+}
+
+func countProtected(g group) int {
+	n := 0
+	forEachValue([]group{g}, func(v *value, binary bool) error {
+		if v.Protected == "True" {
+			n++
+		}
+		return nil
+	})
+	return n
+}
+
+// dropMissingBinaries removes references to binaries which weren't recovered,
+// returning how many were removed
+func dropMissingBinaries(e *entry, binaries []metaBinary) int {
+	dropped := 0
+	var kept []entryBinary
+	for _, b := range e.Binaries {
+		if len(b.Value.Ref) > 0 && !hasBinary(binaries, b.Value.Ref) {
+			dropped++
+			continue
+		}
+		kept = append(kept, b)
+	}
+	e.Binaries = kept
+
+	for i := range e.HistoryEntries {
+		dropped += dropMissingBinaries(&e.HistoryEntries[i], binaries)
+	}
+	return dropped
+}
+
+func hasBinary(binaries []metaBinary, id string) bool {
+	for _, b := range binaries {
+		if b.ID == id {
+			return true
+		}
+	}
+	return false
+}
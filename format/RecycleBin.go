@@ -0,0 +1,134 @@
+package format
+
+import (
+	"encoding/xml"
+	"strings"
+	"time"
+)
+
+const (
+	recycleBinName = "Recycle Bin"
+	// the trash can icon KeePass gives the recycle bin
+	recycleBinIconID = "43"
+	// an unset recycle bin is stored as a zero UUID
+	zeroUUID = "AAAAAAAAAAAAAAAAAAAAAA=="
+)
+
+// recycleBin returns the base64 UUID of the recycle bin group, empty when the
+// recycle bin is disabled or not yet created
+func (f *KeePass2XmlFile) recycleBin() string {
+	if !strings.EqualFold(strings.TrimSpace(f.Meta.RecycleBinEnabled), "True") {
+		return ""
+	}
+	uuid := strings.TrimSpace(f.Meta.RecycleBinUUID)
+	if uuid == zeroUUID {
+		return ""
+	}
+	return uuid
+}
+
+//RemoveEntry moves the entry with the given hex UUID into the recycle bin,
+//which is created when missing. An entry already in the recycle bin, or any
+//entry when the recycle bin is disabled, is deleted and recorded in the
+//deleted objects. recycled reports whether the entry was moved.
+func (f *KeePass2XmlFile) RemoveEntry(uuid string) (recycled bool, err error) {
+	e, err := f.entry(uuid)
+	if err != nil {
+		return false, err
+	}
+	b64 := e.UUID
+	g, idx := f.findEntry(b64)
+	now := time.Now()
+
+	if !strings.EqualFold(strings.TrimSpace(f.Meta.RecycleBinEnabled), "True") || f.inRecycleBin(g.UUID) {
+		g.Entry = append(g.Entry[:idx], g.Entry[idx+1:]...)
+		f.deleted(b64, now)
+		return false, nil
+	}
+
+	bin, err := f.recycleBinGroup(now)
+	if err != nil {
+		return false, err
+	}
+	// bin may have been appended to the root group, find the entry again
+	g, idx = f.findEntry(b64)
+	moved := g.Entry[idx]
+	g.Entry = append(g.Entry[:idx], g.Entry[idx+1:]...)
+	if moved.Times == nil {
+		moved.Times = newTimes(now)
+	}
+	moved.Times.LocationChanged = formatTime(now)
+	bin, _ = f.findGroup(bin.UUID)
+	bin.Entry = append(bin.Entry, moved)
+	return true, nil
+}
+
+//EmptyRecycleBin deletes the entries and groups in the recycle bin, recording
+//them in the deleted objects, and returns the number of entries and groups
+//deleted
+func (f *KeePass2XmlFile) EmptyRecycleBin() (entries, groups int) {
+	bin, _ := f.findGroup(f.recycleBin())
+	if bin == nil {
+		return 0, 0
+	}
+
+	now := time.Now()
+	var empty func(g *group)
+	empty = func(g *group) {
+		for i := range g.Entry {
+			f.deleted(g.Entry[i].UUID, now)
+			entries++
+		}
+		for i := range g.Groups {
+			empty(&g.Groups[i])
+			f.deleted(g.Groups[i].UUID, now)
+			groups++
+		}
+	}
+	empty(bin)
+
+	bin.Entry = nil
+	bin.Groups = nil
+	return entries, groups
+}
+
+// inRecycleBin reports whether the group is the recycle bin or below it
+func (f *KeePass2XmlFile) inRecycleBin(uuid string) bool {
+	bin := f.recycleBin()
+	return len(bin) > 0 && f.isDescendant(uuid, bin)
+}
+
+// recycleBinGroup returns the recycle bin, creating it below the root group
+// when it does not exist
+func (f *KeePass2XmlFile) recycleBinGroup(now time.Time) (*group, error) {
+	if bin, _ := f.findGroup(f.recycleBin()); bin != nil {
+		return bin, nil
+	}
+
+	root, err := f.group(nil)
+	if err != nil {
+		return nil, err
+	}
+	bin, err := newGroup(recycleBinName)
+	if err != nil {
+		return nil, err
+	}
+	bin.Other = append(bin.Other,
+		element{XMLName: xml.Name{Local: "IconID"}, Content: recycleBinIconID},
+		element{XMLName: xml.Name{Local: "EnableAutoType"}, Content: "false"},
+		element{XMLName: xml.Name{Local: "EnableSearching"}, Content: "false"},
+	)
+	root.Groups = append(root.Groups, *bin)
+
+	f.Meta.RecycleBinUUID = bin.UUID
+	f.Meta.RecycleBinChanged = formatTime(now)
+	return &root.Groups[len(root.Groups)-1], nil
+}
+
+// deleted records the deletion of an entry or group
+func (f *KeePass2XmlFile) deleted(uuid string, now time.Time) {
+	if f.Root.DeletedObjects == nil {
+		f.Root.DeletedObjects = &deletedObjects{}
+	}
+	f.Root.DeletedObjects.add(deletedObject{UUID: uuid, DeletionTime: formatTime(now)})
+}
@@ -0,0 +1,101 @@
+package format_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/simonhayward/gkeepassxreader/format"
+)
+
+var _ = Describe("RecycleBin", func() {
+
+	recycledTitles := func(f *format.KeePass2XmlFile) []string {
+		entries, err := (&format.EntryServiceOp{XMLReader: &format.KeePass2XmlReader{KeePass2XmlFile: *f}, RecycledEntries: true}).List()
+		Expect(err).ToNot(HaveOccurred())
+		var titles []string
+		for _, e := range entries {
+			if e.Recycled {
+				titles = append(titles, e.Title.String())
+			}
+		}
+		return titles
+	}
+
+	deletedUUIDs := func(f *format.KeePass2XmlFile) []string {
+		var uuids []string
+		if f.Root.DeletedObjects != nil {
+			for _, d := range f.Root.DeletedObjects.Objects {
+				uuids = append(uuids, d.UUID)
+			}
+		}
+		return uuids
+	}
+
+	Context("when the recycle bin is enabled", func() {
+		var f *format.KeePass2XmlFile
+
+		BeforeEach(func() {
+			f = mergeFile(mergeGroup(1, "Root", t1,
+				mergeEntry(2, "Mail", t1, t1),
+				mergeEntry(3, "Bank", t1, t1)), "")
+			f.Meta.RecycleBinEnabled = "True"
+			f.Meta.RecycleBinUUID = "AAAAAAAAAAAAAAAAAAAAAA=="
+		})
+
+		It("creates the recycle bin and moves the entry into it", func() {
+			recycled, err := f.RemoveEntry(mergeHexUUID(2))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(recycled).To(BeTrue())
+
+			Expect(f.Root.Groups[0].Groups).To(HaveLen(1))
+			bin := f.Root.Groups[0].Groups[0]
+			Expect(bin.Name).To(Equal("Recycle Bin"))
+			Expect(f.Meta.RecycleBinUUID).To(Equal(bin.UUID))
+			Expect(bin.Entry[0].Times.LocationChanged).ToNot(Equal(t1))
+
+			Expect(mergedEntries(f)).To(HaveLen(1))
+			Expect(recycledTitles(f)).To(Equal([]string{"Mail"}))
+			Expect(deletedUUIDs(f)).To(BeEmpty())
+		})
+
+		It("deletes an entry already in the recycle bin", func() {
+			Expect(f.RemoveEntry(mergeHexUUID(2))).To(BeTrue())
+			recycled, err := f.RemoveEntry(mergeHexUUID(2))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(recycled).To(BeFalse())
+
+			Expect(recycledTitles(f)).To(BeEmpty())
+			Expect(deletedUUIDs(f)).To(Equal([]string{mergeUUID(2)}))
+		})
+
+		It("empties the recycle bin recording deleted objects", func() {
+			Expect(f.RemoveEntry(mergeHexUUID(2))).To(BeTrue())
+			Expect(f.RemoveEntry(mergeHexUUID(3))).To(BeTrue())
+
+			entries, groups := f.EmptyRecycleBin()
+			Expect(entries).To(Equal(2))
+			Expect(groups).To(Equal(0))
+			Expect(recycledTitles(f)).To(BeEmpty())
+			Expect(deletedUUIDs(f)).To(ConsistOf(mergeUUID(2), mergeUUID(3)))
+		})
+	})
+
+	Context("when the recycle bin is disabled", func() {
+		It("deletes the entry", func() {
+			f := mergeFile(mergeGroup(1, "Root", t1, mergeEntry(2, "Mail", t1, t1)), "")
+
+			recycled, err := f.RemoveEntry(mergeHexUUID(2))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(recycled).To(BeFalse())
+			Expect(f.Root.Groups[0].Groups).To(BeEmpty())
+			Expect(mergedEntries(f)).To(BeEmpty())
+			Expect(deletedUUIDs(f)).To(Equal([]string{mergeUUID(2)}))
+		})
+	})
+
+	It("fails when the entry does not exist", func() {
+		f := mergeFile(mergeGroup(1, "Root", t1), "")
+		_, err := f.RemoveEntry(mergeHexUUID(9))
+		Expect(err).To(MatchError(ContainSubstring("not found")))
+	})
+})
@@ -0,0 +1,102 @@
+package format
+
+import (
+	"sort"
+	"strings"
+)
+
+// KeePass 2.x and KeePassXC write ';', older versions ','
+const tagSeparators = ";,"
+
+//TagCount is a tag and the number of entries with it
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+//ParseTags splits stored tags, blanks and duplicates are dropped
+func ParseTags(s string) []string {
+	var tags []string
+	for _, t := range strings.FieldsFunc(s, func(r rune) bool { return strings.ContainsRune(tagSeparators, r) }) {
+		if t = strings.TrimSpace(t); len(t) > 0 && !HasTag(tags, t) {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+func formatTags(tags []string) string {
+	return strings.Join(tags, ";")
+}
+
+//HasTag reports whether tags contains tag, ignoring case
+func HasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+//FilterByTags returns the entries with every tag given, a tag starting with !
+//excludes entries which have it
+func FilterByTags(entries []Entry, tags []string) []Entry {
+	var filtered []Entry
+	for _, e := range entries {
+		if matchTags(e.Tags, tags) {
+			filtered = append(filtered, e)
+		}
+	}
+	return filtered
+}
+
+func matchTags(entryTags, tags []string) bool {
+	for _, tag := range tags {
+		if strings.HasPrefix(tag, "!") {
+			if HasTag(entryTags, tag[1:]) {
+				return false
+			}
+		} else if !HasTag(entryTags, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+//CountTags returns every tag used by entries, most used first. Tags differing
+//only in case are counted together under the first spelling seen.
+func CountTags(entries []Entry) []TagCount {
+	var counts []TagCount
+	index := make(map[string]int)
+	for _, e := range entries {
+		for _, t := range e.Tags {
+			key := strings.ToLower(t)
+			if i, ok := index[key]; ok {
+				counts[i].Count++
+				continue
+			}
+			index[key] = len(counts)
+			counts = append(counts, TagCount{Tag: t, Count: 1})
+		}
+	}
+
+	sort.SliceStable(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return strings.ToLower(counts[i].Tag) < strings.ToLower(counts[j].Tag)
+	})
+	return counts
+}
+
+//EditTags returns tags with add appended and remove taken out, ignoring case
+func EditTags(tags, add, remove []string) []string {
+	edited := []string{}
+	for _, t := range append(append([]string(nil), tags...), add...) {
+		if !HasTag(remove, t) && !HasTag(edited, t) {
+			edited = append(edited, t)
+		}
+	}
+	return edited
+}
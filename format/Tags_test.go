@@ -0,0 +1,77 @@
+package format_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/simonhayward/gkeepassxreader/format"
+)
+
+var _ = Describe("Tags", func() {
+
+	Context("when parsing tags", func() {
+		It("splits on semicolons and commas", func() {
+			Expect(format.ParseTags("prod; shared,rotate-quarterly")).To(Equal([]string{"prod", "shared", "rotate-quarterly"}))
+		})
+
+		It("drops blanks and duplicates", func() {
+			Expect(format.ParseTags(" ;prod;;PROD; ")).To(Equal([]string{"prod"}))
+			Expect(format.ParseTags("")).To(BeNil())
+		})
+	})
+
+	Context("when filtering by tags", func() {
+		entries := []format.Entry{
+			{UUID: "1", Tags: []string{"prod", "shared"}},
+			{UUID: "2", Tags: []string{"Prod", "legacy"}},
+			{UUID: "3"},
+		}
+
+		uuids := func(entries []format.Entry) []string {
+			var u []string
+			for _, e := range entries {
+				u = append(u, e.UUID)
+			}
+			return u
+		}
+
+		It("keeps entries with every tag, ignoring case", func() {
+			Expect(uuids(format.FilterByTags(entries, []string{"PROD"}))).To(Equal([]string{"1", "2"}))
+			Expect(uuids(format.FilterByTags(entries, []string{"prod", "shared"}))).To(Equal([]string{"1"}))
+		})
+
+		It("leaves out entries with an excluded tag", func() {
+			Expect(uuids(format.FilterByTags(entries, []string{"prod", "!legacy"}))).To(Equal([]string{"1"}))
+			Expect(uuids(format.FilterByTags(entries, []string{"!prod"}))).To(Equal([]string{"3"}))
+		})
+
+		It("counts tags, most used first", func() {
+			Expect(format.CountTags(entries)).To(Equal([]format.TagCount{
+				{Tag: "prod", Count: 2},
+				{Tag: "legacy", Count: 1},
+				{Tag: "shared", Count: 1},
+			}))
+		})
+	})
+
+	Context("when editing tags", func() {
+		It("adds and removes tags, ignoring case", func() {
+			Expect(format.EditTags([]string{"prod", "legacy"}, []string{"shared", "Prod"}, []string{"LEGACY"})).To(Equal([]string{"prod", "shared"}))
+			Expect(format.EditTags([]string{"prod"}, nil, []string{"prod"})).To(BeEmpty())
+		})
+
+		It("stores tags on the entry", func() {
+			f := mergeFile(mergeGroup(1, "Root", t1, mergeEntry(2, "Mail", t1, t1)), "")
+			Expect(f.EditEntry(mergeHexUUID(2), &format.Entry{Tags: []string{"prod", "shared"}})).To(Succeed())
+
+			Expect(f.Root.Groups[0].Entry[0].Tags).To(Equal("prod;shared"))
+			Expect(mergedEntries(f)["Mail"].Tags).To(Equal([]string{"prod", "shared"}))
+		})
+	})
+
+	It("reads tags from a database", func() {
+		f := mergeFile(mergeGroup(1, "Root", t1, mergeEntry(2, "Mail", t1, t1)), "")
+		f.Root.Groups[0].Entry[0].Tags = "prod,rotate-quarterly"
+		Expect(mergedEntries(f)["Mail"].Tags).To(Equal([]string{"prod", "rotate-quarterly"}))
+	})
+})
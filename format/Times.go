@@ -0,0 +1,174 @@
+package format
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// KDBX 3 stores times as ISO-8601 in UTC
+	keepass2TimeFormat = "2006-01-02T15:04:05Z"
+	// KDBX 4 stores base64 little endian seconds since 0001-01-01
+	keepass2TimeSecondsToUnix = 62135596800
+)
+
+const (
+	//TimeCreated names the creation time in Times.Invalid
+	TimeCreated = "CreationTime"
+	//TimeModified names the last modification time in Times.Invalid
+	TimeModified = "LastModificationTime"
+	//TimeAccessed names the last access time in Times.Invalid
+	TimeAccessed = "LastAccessTime"
+	//TimeExpiry names the expiry time in Times.Invalid
+	TimeExpiry = "ExpiryTime"
+	//TimeLocationChanged names the location changed time in Times.Invalid
+	TimeLocationChanged = "LocationChanged"
+	//TimeUsageCount names the usage count in Times.Invalid
+	TimeUsageCount = "UsageCount"
+)
+
+//Times of an entry or group, times which are not stored are zero. Values
+//which could not be parsed are zero too and named in Invalid.
+type Times struct {
+	Created         time.Time
+	Modified        time.Time
+	Accessed        time.Time
+	Expiry          time.Time
+	Expires         bool
+	UsageCount      int
+	LocationChanged time.Time
+	Invalid         []string
+}
+
+//Check returns an error when any of the named values could not be parsed
+func (t *Times) Check(names ...string) error {
+	var invalid []string
+	for _, name := range names {
+		for _, i := range t.Invalid {
+			if i == name {
+				invalid = append(invalid, name)
+			}
+		}
+	}
+	if len(invalid) > 0 {
+		return errors.Errorf("invalid %s", strings.Join(invalid, ", "))
+	}
+	return nil
+}
+
+type times struct {
+	LastModificationTime string `xml:"LastModificationTime,omitempty"`
+	CreationTime         string `xml:"CreationTime,omitempty"`
+	LastAccessTime       string `xml:"LastAccessTime,omitempty"`
+	ExpiryTime           string `xml:"ExpiryTime,omitempty"`
+	Expires              string `xml:"Expires,omitempty"`
+	UsageCount           string `xml:"UsageCount,omitempty"`
+	LocationChanged      string `xml:"LocationChanged,omitempty"`
+}
+
+type deletedObject struct {
+	UUID         string `xml:"UUID"`
+	DeletionTime string `xml:"DeletionTime"`
+}
+
+type deletedObjects struct {
+	Objects []deletedObject `xml:"DeletedObject"`
+}
+
+// parse the stored times, all zero when there are none. A value which can't
+// be parsed is left zero and named in Invalid, only the commands which need
+// it fail.
+func (t *times) parse() Times {
+	var parsed Times
+	if t == nil {
+		return parsed
+	}
+
+	var err error
+	for _, field := range []struct {
+		name  string
+		value string
+		t     *time.Time
+	}{
+		{TimeCreated, t.CreationTime, &parsed.Created},
+		{TimeModified, t.LastModificationTime, &parsed.Modified},
+		{TimeAccessed, t.LastAccessTime, &parsed.Accessed},
+		{TimeExpiry, t.ExpiryTime, &parsed.Expiry},
+		{TimeLocationChanged, t.LocationChanged, &parsed.LocationChanged},
+	} {
+		if *field.t, err = parseTime(field.value); err != nil {
+			parsed.Invalid = append(parsed.Invalid, field.name)
+		}
+	}
+
+	parsed.Expires = strings.EqualFold(strings.TrimSpace(t.Expires), "True")
+	if usage := strings.TrimSpace(t.UsageCount); len(usage) > 0 {
+		if parsed.UsageCount, err = strconv.Atoi(usage); err != nil {
+			parsed.UsageCount = 0
+			parsed.Invalid = append(parsed.Invalid, TimeUsageCount)
+		}
+	}
+
+	return parsed
+}
+
+func newTimes(now time.Time) *times {
+	t := formatTime(now)
+	return &times{
+		LastModificationTime: t,
+		CreationTime:         t,
+		LastAccessTime:       t,
+		ExpiryTime:           t,
+		Expires:              "False",
+		UsageCount:           "0",
+		LocationChanged:      t,
+	}
+}
+
+// parseTime accepts both the KDBX 3 and KDBX 4 formats, an empty value is
+// the zero time
+func parseTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if len(s) == 0 {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UTC(), nil
+	}
+
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(b) != 8 {
+		return time.Time{}, errors.Errorf("invalid time: %s", s)
+	}
+	seconds := int64(binary.LittleEndian.Uint64(b))
+	return time.Unix(seconds-keepass2TimeSecondsToUnix, 0).UTC(), nil
+}
+
+// formatTime uses the KDBX 3 format the writer produces
+func formatTime(t time.Time) string {
+	return t.UTC().Format(keepass2TimeFormat)
+}
+
+// lastModified of the given times, the zero time when unknown
+func (t *times) lastModified() time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	modified, _ := parseTime(t.LastModificationTime)
+	return modified
+}
+
+// locationChanged of the given times, the zero time when unknown
+func (t *times) locationChanged() time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	changed, _ := parseTime(t.LocationChanged)
+	return changed
+}
@@ -0,0 +1,228 @@
+package format
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/simonhayward/gkeepassxreader/core"
+	"github.com/simonhayward/gkeepassxreader/keys"
+)
+
+const (
+	//HeaderHashValid the xml records the hash of the header
+	HeaderHashValid = "valid"
+	//HeaderHashMismatch the header has been changed or the xml is corrupt
+	HeaderHashMismatch = "mismatch"
+	//HeaderHashMissing the xml has no header hash, which only format 3.0 and
+	//earlier databases may omit
+	HeaderHashMissing = "missing"
+	//HeaderHashUnknown the xml is too damaged to find the header hash
+	HeaderHashUnknown = "unknown"
+)
+
+//CorruptBlock is a block of the payload whose data doesn't match its hash,
+//the offset is of the block in the file
+type CorruptBlock struct {
+	Index  uint32 `json:"index"`
+	Offset int64  `json:"offset"`
+	Size   uint32 `json:"size"`
+}
+
+//VerifyReport is the integrity of a database file. StreamError is why the
+//blocks after the last one read couldn't be found.
+type VerifyReport struct {
+	Blocks        int            `json:"blocks"`
+	CorruptBlocks []CorruptBlock `json:"corrupt_blocks"`
+	StreamError   string         `json:"stream_error,omitempty"`
+	HeaderHash    string         `json:"header_hash"`
+	XMLWellFormed bool           `json:"xml_well_formed"`
+	XMLError      string         `json:"xml_error,omitempty"`
+}
+
+//OK reports whether no problems were found
+func (r *VerifyReport) OK() bool {
+	return len(r.CorruptBlocks) == 0 && len(r.StreamError) == 0 && r.XMLWellFormed &&
+		(r.HeaderHash == HeaderHashValid || r.HeaderHash == HeaderHashMissing)
+}
+
+// payload is the block stream of a database with the data of corrupt blocks
+// left out
+type payload struct {
+	blocks    int
+	corrupt   []CorruptBlock
+	streamErr error
+	data      []byte
+	// offsets in data where corrupt blocks were left out or, in a compressed
+	// payload, start
+	gaps []int
+}
+
+//Verify reads every block of the payload, checks the header hash and that the
+//xml is well formed, reporting every problem found rather than stopping at
+//the first. The key must have been transformed, a wrong key is an error.
+func (k *KeePass2Reader) Verify(ctx context.Context, db *os.File, compositeKey *keys.CompositeKey) (*VerifyReport, error) {
+	p, err := k.readBlocks(ctx, db, compositeKey)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &VerifyReport{
+		Blocks:        p.blocks,
+		CorruptBlocks: p.corrupt,
+		HeaderHash:    HeaderHashUnknown,
+	}
+	if p.streamErr != nil {
+		report.StreamError = p.streamErr.Error()
+	}
+
+	xmlData, _, err := k.payloadXML(p)
+	if err != nil {
+		report.XMLError = err.Error()
+	}
+
+	headerHash, found, err := checkXML(xmlData)
+	if err != nil {
+		if len(report.XMLError) == 0 {
+			report.XMLError = err.Error()
+		}
+	} else if len(report.XMLError) == 0 {
+		report.XMLWellFormed = true
+	}
+
+	switch {
+	case found:
+		report.HeaderHash = HeaderHashMismatch
+		hash := sha256.Sum256(k.headerStoredData)
+		if stored, err := base64.StdEncoding.DecodeString(headerHash); err == nil && bytes.Equal(stored, hash[:]) {
+			report.HeaderHash = HeaderHashValid
+		}
+	case report.XMLWellFormed:
+		report.HeaderHash = HeaderHashMissing
+		if k.version >= keepass2FileVersion {
+			report.HeaderHash = HeaderHashMismatch
+		}
+	}
+
+	return report, nil
+}
+
+// readBlocks decrypts every block of the payload, keeping the data of those
+// whose hash matches
+func (k *KeePass2Reader) readBlocks(ctx context.Context, db *os.File, compositeKey *keys.CompositeKey) (*payload, error) {
+	if k.keepass1 != nil {
+		return nil, errors.New("KeePass 1 databases have no hashed blocks")
+	}
+
+	start, err := db.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, errors.Wrap(err, "seek failed")
+	}
+
+	cipherStream, err := k.decryptStream(db, compositeKey)
+	if err != nil {
+		return nil, err
+	}
+	// blocks follow the stream start bytes
+	start += int64(len(k.streamStartBytes))
+
+	p := &payload{}
+	hashBlock := k.hashedBlock(ctx, cipherStream)
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		block, data, err := hashBlock.ReadBlock()
+		if err != nil {
+			p.streamErr = err
+			break
+		}
+		if block == nil {
+			break
+		}
+
+		p.blocks++
+		if !block.Valid {
+			p.corrupt = append(p.corrupt, CorruptBlock{Index: block.Index, Offset: start + block.Offset, Size: block.Size})
+			p.gaps = append(p.gaps, len(p.data))
+			// a compressed stream can't skip a block, most of a corrupt block
+			// is usually intact so the inflater is given it
+			if k.Db.CompressionAlgo == core.CompressionNone {
+				continue
+			}
+		}
+		p.data = append(p.data, data...)
+	}
+
+	// a stream cut short is missing its end
+	if p.streamErr != nil {
+		p.gaps = append(p.gaps, len(p.data))
+	}
+	return p, nil
+}
+
+// payloadXML decompresses the payload when needed, returning the xml and where
+// in it the first missing or corrupt block is. A gzip stream can't skip a
+// block so it is inflated through the corrupt blocks, as much xml as could be
+// is returned with any error.
+func (k *KeePass2Reader) payloadXML(p *payload) ([]byte, int, error) {
+	if k.Db.CompressionAlgo == core.CompressionNone {
+		if len(p.gaps) > 0 {
+			return p.data, p.gaps[0], nil
+		}
+		return p.data, len(p.data), nil
+	}
+
+	damaged := len(p.data)
+	if len(p.gaps) > 0 {
+		damaged = p.gaps[0]
+	}
+	return salvageInflate(p.data, damaged)
+}
+
+// checkXML reads every token of the xml, returning the header hash if it was
+// reached and where the xml first isn't well formed
+func checkXML(data []byte) (headerHash string, found bool, err error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	var path []string
+	var text strings.Builder
+	roots := 0
+
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return headerHash, found, errors.Wrapf(err, "xml error at offset %d", d.InputOffset())
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if len(path) == 0 {
+				roots++
+			}
+			path = append(path, t.Name.Local)
+			text.Reset()
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			if strings.Join(path, "/") == "KeePassFile/Meta/HeaderHash" {
+				headerHash, found = strings.TrimSpace(text.String()), true
+			}
+			path = path[:len(path)-1]
+		}
+	}
+
+	if roots != 1 {
+		return headerHash, found, errors.Errorf("xml error: expected one root element, found %d", roots)
+	}
+	return headerHash, found, nil
+}
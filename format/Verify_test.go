@@ -0,0 +1,357 @@
+package format_test
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	mathrand "math/rand"
+	"os"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/simonhayward/gkeepassxreader/core"
+	"github.com/simonhayward/gkeepassxreader/format"
+	"github.com/simonhayward/gkeepassxreader/keys"
+)
+
+var _ = Describe("Verify", func() {
+
+	const (
+		// hashed block size used by KeePass and the writer
+		blockSize = 1024 * 1024
+		// index, hash and size preceding the data of a block
+		blockHeaderSize = 4 + 32 + 4
+		// stream start bytes preceding the blocks
+		startBytesSize = 32
+	)
+
+	var (
+		out        *os.File
+		headerSize int64
+	)
+
+	// open reads the header and transforms the key, leaving the payload
+	open := func() *format.KeePass2Reader {
+		_, err := out.Seek(0, io.SeekStart)
+		Expect(err).ToNot(HaveOccurred())
+
+		reader := format.NewKeePass2Reader()
+		Expect(reader.ReadHeader(out)).To(Succeed())
+		Expect(reader.TransformKey(context.Background(), keys.MasterKey("masterpw", nil), nil)).To(Succeed())
+		return reader
+	}
+
+	// corrupt flips a byte of the data of a block
+	corrupt := func(index int) {
+		offset := headerSize + startBytesSize + int64(index)*(blockHeaderSize+blockSize) + blockHeaderSize + 1000
+		b := make([]byte, 1)
+		_, err := out.ReadAt(b, offset)
+		Expect(err).ToNot(HaveOccurred())
+		b[0] ^= 0xFF
+		_, err = out.WriteAt(b, offset)
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	// scramble overwrites size bytes of the data of a block with random bytes
+	scramble := func(index, size int) {
+		offset := headerSize + startBytesSize + int64(index)*(blockHeaderSize+blockSize) + blockHeaderSize + 1000
+		b := make([]byte, size)
+		_, err := rand.Read(b)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = out.WriteAt(b, offset)
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	// titles of the entries of a recovered xml file
+	recoveredTitles := func(xmlFile *format.KeePass2XmlFile) []string {
+		entries, err := (&format.EntryServiceOp{XMLReader: &format.KeePass2XmlReader{KeePass2XmlFile: *xmlFile}}).List()
+		Expect(err).ToNot(HaveOccurred())
+		var titles []string
+		for _, e := range entries {
+			titles = append(titles, e.Title.String())
+		}
+		return titles
+	}
+
+	BeforeEach(func() {
+		db, err := os.Open("test_data/ProtectedStrings.kdbx")
+		Expect(err).ToNot(HaveOccurred())
+		defer db.Close()
+
+		reader, err := format.OpenDatabase(keys.MasterKey("masterpw", nil), db)
+		Expect(err).ToNot(HaveOccurred())
+		defer reader.Close()
+
+		xmlFile, err := reader.XMLReader.Decrypted()
+		Expect(err).ToNot(HaveOccurred())
+
+		// uncompressed entries filling three blocks
+		for i := 0; i < 60; i++ {
+			_, err := xmlFile.AddEntry(&format.Entry{
+				Title:    &format.EntryValue{PlainText: fmt.Sprintf("Entry %d", i)},
+				Password: &format.EntryValue{PlainText: fmt.Sprintf("password %d", i)},
+				Notes:    &format.EntryValue{PlainText: strings.Repeat("n", 40000)},
+			})
+			Expect(err).ToNot(HaveOccurred())
+		}
+		reader.Db.CompressionAlgo = core.CompressionNone
+
+		out, err = ioutil.TempFile("", "verify-*.kdbx")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(format.NewKeePass2Writer(reader.Db).WriteDatabase(out, xmlFile)).To(Succeed())
+
+		header := open()
+		headerSize, err = out.Seek(0, io.SeekCurrent)
+		Expect(err).ToNot(HaveOccurred())
+		header.Close()
+	})
+
+	AfterEach(func() {
+		out.Close()
+		os.Remove(out.Name())
+	})
+
+	Context("when the database is intact", func() {
+		It("reads a payload of several blocks", func() {
+			_, err := out.Seek(0, io.SeekStart)
+			Expect(err).ToNot(HaveOccurred())
+
+			reader, err := format.OpenDatabase(keys.MasterKey("masterpw", nil), out)
+			Expect(err).ToNot(HaveOccurred())
+			defer reader.Close()
+
+			entries, err := (&format.EntryServiceOp{XMLReader: reader.XMLReader}).List()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entries).To(HaveLen(61))
+		})
+
+		It("reports no problems", func() {
+			reader := open()
+			defer reader.Close()
+
+			report, err := reader.Verify(context.Background(), out, reader.Db.Key)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.OK()).To(BeTrue())
+			Expect(report.Blocks).To(Equal(3))
+			Expect(report.CorruptBlocks).To(BeEmpty())
+			Expect(report.HeaderHash).To(Equal(format.HeaderHashValid))
+			Expect(report.XMLWellFormed).To(BeTrue())
+		})
+
+		It("reports no problems for a compressed database", func() {
+			db, err := os.Open("test_data/ProtectedStrings.kdbx")
+			Expect(err).ToNot(HaveOccurred())
+			defer db.Close()
+
+			reader := format.NewKeePass2Reader()
+			Expect(reader.ReadHeader(db)).To(Succeed())
+			Expect(reader.TransformKey(context.Background(), keys.MasterKey("masterpw", nil), nil)).To(Succeed())
+			defer reader.Close()
+
+			report, err := reader.Verify(context.Background(), db, reader.Db.Key)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.OK()).To(BeTrue())
+			Expect(report.HeaderHash).To(Equal(format.HeaderHashValid))
+		})
+	})
+
+	Context("when a block is corrupt", func() {
+		BeforeEach(func() {
+			corrupt(1)
+		})
+
+		It("can't be opened", func() {
+			_, err := out.Seek(0, io.SeekStart)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = format.OpenDatabase(keys.MasterKey("masterpw", nil), out)
+			Expect(err).To(MatchError(ContainSubstring("mismatch between hash and data of block 1")))
+		})
+
+		It("reports the block and reads the rest", func() {
+			reader := open()
+			defer reader.Close()
+
+			report, err := reader.Verify(context.Background(), out, reader.Db.Key)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.OK()).To(BeFalse())
+			Expect(report.Blocks).To(Equal(3))
+			Expect(report.CorruptBlocks).To(Equal([]format.CorruptBlock{{
+				Index:  1,
+				Offset: headerSize + startBytesSize + blockHeaderSize + blockSize,
+				Size:   blockSize,
+			}}))
+			Expect(report.StreamError).To(BeEmpty())
+			Expect(report.HeaderHash).To(Equal(format.HeaderHashValid))
+			// the block is within the notes of an entry, without it the xml is
+			// still well formed
+			Expect(report.XMLWellFormed).To(BeTrue())
+		})
+
+		It("reports xml which isn't well formed", func() {
+			corrupt(2)
+			reader := open()
+			defer reader.Close()
+
+			report, err := reader.Verify(context.Background(), out, reader.Db.Key)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.CorruptBlocks).To(HaveLen(2))
+			Expect(report.XMLWellFormed).To(BeFalse())
+			Expect(report.XMLError).To(ContainSubstring("xml error at offset"))
+
+			data, err := json.Marshal(report)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(data)).To(ContainSubstring(`"corrupt_blocks":[{"index":1,`))
+			Expect(string(data)).To(ContainSubstring(`"header_hash":`))
+			Expect(string(data)).To(ContainSubstring(`"xml_well_formed":false,"xml_error":`))
+		})
+
+		It("recovers the entries of the other blocks", func() {
+			reader := open()
+			defer reader.Close()
+
+			xmlFile, report, err := reader.Recover(context.Background(), out, reader.Db.Key)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.CorruptBlocks).To(HaveLen(1))
+			Expect(report.Entries).To(BeNumerically(">", 30))
+			Expect(report.Entries).To(BeNumerically("<", 61))
+			Expect(report.LostValues).To(BeNumerically(">", 0))
+
+			data, err := json.Marshal(report)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(data)).To(ContainSubstring(`"corrupt_blocks":`))
+			Expect(string(data)).To(ContainSubstring(`"lost_values":`))
+			Expect(string(data)).To(ContainSubstring(`"unparsed_fragments":`))
+
+			recovered, err := ioutil.TempFile("", "recovered-*.kdbx")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(recovered.Name())
+			defer recovered.Close()
+			Expect(format.NewKeePass2Writer(reader.Db).WriteDatabase(recovered, xmlFile)).To(Succeed())
+
+			_, err = recovered.Seek(0, io.SeekStart)
+			Expect(err).ToNot(HaveOccurred())
+			written, err := format.OpenDatabase(keys.MasterKey("masterpw", nil), recovered)
+			Expect(err).ToNot(HaveOccurred())
+			defer written.Close()
+
+			entryService := &format.EntryServiceOp{XMLReader: written.XMLReader}
+			entries, err := entryService.List()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entries).To(HaveLen(report.Entries))
+			Expect(entryService.Decode(entries)).To(Succeed())
+
+			// entries before the corrupt block keep their passwords
+			Expect(entries[0].Title.String()).To(Equal("Sample Entry"))
+			Expect(entries[0].Password.String()).To(Equal("ProtectedPassword"))
+			Expect(entries[1].Title.String()).To(Equal("Entry 0"))
+			Expect(entries[1].Password.String()).To(Equal("password 0"))
+
+			// the random stream offsets of those after it are unknown
+			last := entries[len(entries)-1]
+			Expect(last.Title.String()).To(Equal("Entry 59"))
+			Expect(last.Password.String()).To(BeEmpty())
+			Expect(last.Notes.String()).To(HaveLen(40000))
+		})
+	})
+
+	Context("when a block of a compressed database is corrupt", func() {
+		BeforeEach(func() {
+			db, err := os.Open("test_data/ProtectedStrings.kdbx")
+			Expect(err).ToNot(HaveOccurred())
+			defer db.Close()
+
+			reader, err := format.OpenDatabase(keys.MasterKey("masterpw", nil), db)
+			Expect(err).ToNot(HaveOccurred())
+			defer reader.Close()
+
+			xmlFile, err := reader.XMLReader.Decrypted()
+			Expect(err).ToNot(HaveOccurred())
+
+			// notes which barely compress so the entries fill three blocks
+			notes := mathrand.New(mathrand.NewSource(1))
+			for i := 0; i < 100; i++ {
+				b := make([]byte, 20000)
+				notes.Read(b)
+				_, err := xmlFile.AddEntry(&format.Entry{
+					Title:    &format.EntryValue{PlainText: fmt.Sprintf("Entry %d", i)},
+					Password: &format.EntryValue{PlainText: fmt.Sprintf("password %d", i)},
+					Notes:    &format.EntryValue{PlainText: hex.EncodeToString(b)},
+				})
+				Expect(err).ToNot(HaveOccurred())
+			}
+			reader.Db.CompressionAlgo = core.CompressionGzip
+
+			Expect(out.Truncate(0)).To(Succeed())
+			_, err = out.Seek(0, io.SeekStart)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(format.NewKeePass2Writer(reader.Db).WriteDatabase(out, xmlFile)).To(Succeed())
+
+			header := open()
+			headerSize, err = out.Seek(0, io.SeekCurrent)
+			Expect(err).ToNot(HaveOccurred())
+			header.Close()
+		})
+
+		It("inflates through the corrupt block", func() {
+			corrupt(1)
+			reader := open()
+			defer reader.Close()
+
+			report, err := reader.Verify(context.Background(), out, reader.Db.Key)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.Blocks).To(Equal(3))
+			Expect(report.CorruptBlocks).To(HaveLen(1))
+			Expect(report.CorruptBlocks[0].Index).To(Equal(uint32(1)))
+			Expect(report.XMLError).To(ContainSubstring("gzip read failed"))
+
+			reader = open()
+			defer reader.Close()
+
+			xmlFile, recovered, err := reader.Recover(context.Background(), out, reader.Db.Key)
+			Expect(err).ToNot(HaveOccurred())
+			// only the entry with the damaged bytes may be lost
+			Expect(recovered.Entries).To(BeNumerically(">=", 100))
+			Expect(recoveredTitles(xmlFile)).To(ContainElements("Sample Entry", "Entry 0", "Entry 50", "Entry 99"))
+		})
+
+		It("restarts the inflater after damage it can't get through", func() {
+			scramble(1, 100000)
+			reader := open()
+			defer reader.Close()
+
+			xmlFile, report, err := reader.Recover(context.Background(), out, reader.Db.Key)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.CorruptBlocks).To(HaveLen(1))
+			Expect(report.Entries).To(BeNumerically(">", 80))
+			Expect(report.Entries).To(BeNumerically("<", 101))
+
+			// entries in the blocks either side of it are recovered
+			titles := recoveredTitles(xmlFile)
+			Expect(titles).To(ContainElements("Sample Entry", "Entry 0", "Entry 99"))
+			Expect(report.LostValues).To(BeNumerically(">", 0))
+
+			recovered, err := ioutil.TempFile("", "recovered-*.kdbx")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(recovered.Name())
+			defer recovered.Close()
+			Expect(format.NewKeePass2Writer(reader.Db).WriteDatabase(recovered, xmlFile)).To(Succeed())
+
+			_, err = recovered.Seek(0, io.SeekStart)
+			Expect(err).ToNot(HaveOccurred())
+			written, err := format.OpenDatabase(keys.MasterKey("masterpw", nil), recovered)
+			Expect(err).ToNot(HaveOccurred())
+			defer written.Close()
+
+			entries, err := (&format.EntryServiceOp{XMLReader: written.XMLReader}).List()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entries).To(HaveLen(report.Entries))
+		})
+	})
+})
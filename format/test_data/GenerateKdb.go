@@ -0,0 +1,194 @@
+//go:build ignore
+// +build ignore
+
+// GenerateKdb writes Basic.kdb and Twofish.kdb, KeePass 1.x databases laid out
+// as KeePass 1.x and KeePassX 0.4 save them: every group and entry field, the
+// "Simple UI State" and "KPX_GROUP_TREE_STATE" meta streams and an attachment.
+// The seeds are fixed so the files are reproducible, the password is masterpw.
+//
+//	go run test_data/GenerateKdb.go test_data
+//
+// It is independent of the reader and doesn't take the place of databases
+// saved by KeePass itself.
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/crypto/twofish"
+)
+
+const (
+	flagSHA2     = 1
+	flagRijndael = 2
+	flagTwofish  = 8
+
+	signature1 = 0x9AA2D903
+	signature2 = 0xB54BFB65
+	version    = 0x00030004
+
+	password = "masterpw"
+	rounds   = 6000
+)
+
+var (
+	// KeePass 1.x writes 2999-12-28 23:59:59 for a time which never expires
+	never    = time.Date(2999, 12, 28, 23, 59, 59, 0, time.UTC)
+	created  = time.Date(2009, 6, 14, 10, 20, 30, 0, time.UTC)
+	modified = time.Date(2010, 2, 3, 4, 5, 6, 0, time.UTC)
+
+	masterSeed    = []byte("kdb fixture seed")
+	iv            = []byte("kdb fixture iv!!")
+	transformSeed = []byte("kdb fixture transform seed 32 b!")
+)
+
+type fields struct {
+	bytes.Buffer
+}
+
+func (f *fields) field(fieldType uint16, data []byte) {
+	binary.Write(f, binary.LittleEndian, fieldType)
+	binary.Write(f, binary.LittleEndian, uint32(len(data)))
+	f.Write(data)
+}
+
+func (f *fields) uint32Field(fieldType uint16, v uint32) {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, v)
+	f.field(fieldType, b)
+}
+
+func (f *fields) stringField(fieldType uint16, s string) {
+	f.field(fieldType, append([]byte(s), 0))
+}
+
+// timeField packs t into the 5 bytes KeePass 1.x stores times in
+func (f *fields) timeField(fieldType uint16, t time.Time) {
+	year, month, day := t.Date()
+	hour, minute, second := t.Clock()
+	m := int(month)
+	f.field(fieldType, []byte{
+		byte(year >> 6 & 0x3F),
+		byte((year&0x3F)<<2 | (m>>2)&0x03),
+		byte((m&0x03)<<6 | (day&0x1F)<<1 | (hour>>4)&0x01),
+		byte((hour&0x0F)<<4 | (minute>>2)&0x0F),
+		byte((minute&0x03)<<6 | second&0x3F),
+	})
+}
+
+func (f *fields) group(id uint32, name string, image uint32, level uint16) {
+	f.uint32Field(0x0001, id)
+	f.stringField(0x0002, name)
+	f.timeField(0x0003, created)
+	f.timeField(0x0004, modified)
+	f.timeField(0x0005, modified)
+	f.timeField(0x0006, never)
+	f.uint32Field(0x0007, image)
+	b := make([]byte, 2)
+	binary.LittleEndian.PutUint16(b, level)
+	f.field(0x0008, b)
+	f.uint32Field(0x0009, 0)
+	f.field(0xFFFF, nil)
+}
+
+func (f *fields) entry(uuid byte, groupID, image uint32, title, url, username, password, notes string, expiry time.Time, binaryDesc string, binaryData []byte) {
+	f.field(0x0001, bytes.Repeat([]byte{uuid}, 16))
+	f.uint32Field(0x0002, groupID)
+	f.uint32Field(0x0003, image)
+	f.stringField(0x0004, title)
+	f.stringField(0x0005, url)
+	f.stringField(0x0006, username)
+	f.stringField(0x0007, password)
+	f.stringField(0x0008, notes)
+	f.timeField(0x0009, created)
+	f.timeField(0x000A, modified)
+	f.timeField(0x000B, modified)
+	f.timeField(0x000C, expiry)
+	f.stringField(0x000D, binaryDesc)
+	f.field(0x000E, binaryData)
+	f.field(0xFFFF, nil)
+}
+
+// metaStream is an entry KeePass 1.x keeps its own state in
+func (f *fields) metaStream(uuid byte, name string, data []byte) {
+	f.entry(uuid, 0x1A2B3C01, 0, "Meta-Info", "$", "SYSTEM", "", name, never, "bin-stream", data)
+}
+
+func contents() []byte {
+	f := &fields{}
+	f.group(0x1A2B3C01, "Internet", 1, 0)
+	f.group(0x1A2B3C02, "Forums", 1, 1)
+	f.group(0x1A2B3C03, "eMail", 19, 0)
+	f.entry(0x11, 0x1A2B3C01, 0, "Sample Entry", "http://www.example.com/", "User Name", "Password", "Notes\r\nover two lines", never, "", nil)
+	f.entry(0x22, 0x1A2B3C02, 1, "Café Forum", "https://forum.example.org/", "jürgen", "pässwörd", "", never, "readme.txt", []byte("attached file contents\n"))
+	f.entry(0x33, 0x1A2B3C03, 19, "Mail Account", "", "mail@example.com", "mailpass", "", time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC), "", nil)
+	f.metaStream(0x44, "Simple UI State", append(make([]byte, 36), 1))
+	f.metaStream(0x55, "KPX_GROUP_TREE_STATE", []byte{3, 0, 0, 0, 0x01, 0x3C, 0x2B, 0x1A, 1, 0x02, 0x3C, 0x2B, 0x1A, 0, 0x03, 0x3C, 0x2B, 0x1A, 0})
+	return f.Bytes()
+}
+
+// finalKey transforms the password as KeePass 1.x does, a single key is not
+// hashed again before the transform
+func finalKey() []byte {
+	transformed := sha256.Sum256([]byte(password))
+	block, err := aes.NewCipher(transformSeed)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for i := 0; i < rounds; i++ {
+		block.Encrypt(transformed[:16], transformed[:16])
+		block.Encrypt(transformed[16:], transformed[16:])
+	}
+	transformedKey := sha256.Sum256(transformed[:])
+
+	key := sha256.Sum256(append(append([]byte(nil), masterSeed...), transformedKey[:]...))
+	return key[:]
+}
+
+func write(name string, flags uint32) {
+	var block cipher.Block
+	var err error
+	if flags&flagTwofish != 0 {
+		block, err = twofish.NewCipher(finalKey())
+	} else {
+		block, err = aes.NewCipher(finalKey())
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	plaintext := contents()
+	contentsHash := sha256.Sum256(plaintext)
+	padLen := block.BlockSize() - len(plaintext)%block.BlockSize()
+	plaintext = append(plaintext, bytes.Repeat([]byte{byte(padLen)}, padLen)...)
+	encrypted := make([]byte, len(plaintext))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, plaintext)
+
+	header := &bytes.Buffer{}
+	for _, v := range []interface{}{uint32(signature1), uint32(signature2), flags, uint32(version),
+		masterSeed, iv, uint32(3), uint32(5), contentsHash[:], transformSeed, uint32(rounds)} {
+		binary.Write(header, binary.LittleEndian, v)
+	}
+
+	if err := ioutil.WriteFile(name, append(header.Bytes(), encrypted...), 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func main() {
+	if len(os.Args) != 2 {
+		log.Fatal("usage: go run GenerateKdb.go <directory>")
+	}
+
+	write(filepath.Join(os.Args[1], "Basic.kdb"), flagSHA2|flagRijndael)
+	write(filepath.Join(os.Args[1], "Twofish.kdb"), flagSHA2|flagTwofish)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/simonhayward/gkeepassxreader/generate"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+// generator options of a command, prefixed on commands which generate a
+// password as an option
+type generatorFlags struct {
+	length            *int
+	classes           *string
+	excludeLookAlikes *bool
+	exclude           *string
+	requireEach       *bool
+	entropy           *float64
+	pattern           *string
+	passphrase        *bool
+	words             *int
+	separator         *string
+	wordCase          *string
+}
+
+func newGeneratorFlags(cmd *kingpin.CmdClause, prefix string) *generatorFlags {
+	flag := func(name, help string) *kingpin.FlagClause {
+		return cmd.Flag(prefix+name, help)
+	}
+	return &generatorFlags{
+		length:            flag("length", "Password length").Default("20").Int(),
+		classes:           flag("classes", "Comma separated character classes, from "+strings.Join(generate.Classes, ", ")).Default(strings.Join(generate.Classes, ",")).String(),
+		excludeLookAlikes: flag("exclude-look-alikes", "Exclude characters which look alike, such as l, I and 1").Bool(),
+		exclude:           flag("exclude", "Characters never used").PlaceHolder("CHARS").String(),
+		requireEach:       flag("require-each", "Use every character class at least once").Default("true").Bool(),
+		entropy:           flag("entropy", "Lengthen the password or passphrase to at least this many bits").PlaceHolder("BITS").Float64(),
+		pattern:           flag("pattern", "KeePass password pattern, such as u{4}d{4}").PlaceHolder("PATTERN").String(),
+		passphrase:        flag("passphrase", "Generate a passphrase from the EFF wordlist").Bool(),
+		words:             flag("words", "Words in a passphrase").Default("6").Int(),
+		separator:         flag("separator", "Separator between passphrase words").Default("-").String(),
+		wordCase:          flag("case", "Case of passphrase words, from "+strings.Join(generate.Cases, ", ")).Default(generate.CaseLower).Enum(generate.Cases...),
+	}
+}
+
+func (g *generatorFlags) generate() *generate.Generated {
+	var generated *generate.Generated
+	var err error
+	switch {
+	case len(*g.pattern) > 0:
+		generated, err = generate.Pattern(*g.pattern, *g.excludeLookAlikes, *g.exclude)
+	case *g.passphrase:
+		generated, err = generate.Passphrase(generate.PassphraseOptions{
+			Words:      *g.words,
+			Separator:  *g.separator,
+			Case:       *g.wordCase,
+			MinEntropy: *g.entropy,
+		})
+	default:
+		generated, err = generate.Password(generate.PasswordOptions{
+			Length:            *g.length,
+			Classes:           splitList(*g.classes),
+			ExcludeLookAlikes: *g.excludeLookAlikes,
+			Exclude:           *g.exclude,
+			RequireEach:       *g.requireEach,
+			MinEntropy:        *g.entropy,
+		})
+	}
+	if err != nil {
+		kingpin.Fatalf("generate error: %s", err)
+	}
+	return generated
+}
+
+func generatePassword(g *generatorFlags, clipboard bool) {
+	generated := g.generate()
+	if clipboard {
+		copyToClipboard(generated.Value)
+		fmt.Printf("password copied to clipboard, %.1f bits of entropy\n", generated.Entropy)
+		return
+	}
+
+	fmt.Println(generated.Value)
+	// stdout holds only the password so it can be piped
+	fmt.Fprintf(os.Stderr, "%.1f bits of entropy\n", generated.Entropy)
+}
+
+// splitList splits a comma separated flag value
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,109 @@
+package generate
+
+import (
+	_ "embed"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	//CaseLower words are lower case
+	CaseLower = "lower"
+	//CaseUpper words are upper case
+	CaseUpper = "upper"
+	//CaseTitle words start with a capital
+	CaseTitle = "title"
+	//CaseMixed each word is lower or title case at random
+	CaseMixed = "mixed"
+)
+
+//Cases words can be written in
+var Cases = []string{CaseLower, CaseUpper, CaseTitle, CaseMixed}
+
+// the EFF large wordlist, https://www.eff.org/dice, each line is five dice
+// rolls and a word
+//
+//go:embed eff_large_wordlist.txt
+var effLargeWordlist string
+
+var (
+	wordsOnce sync.Once
+	words     []string
+)
+
+func wordlist() []string {
+	wordsOnce.Do(func() {
+		for _, line := range strings.Split(effLargeWordlist, "\n") {
+			if fields := strings.Fields(line); len(fields) == 2 {
+				words = append(words, fields[1])
+			}
+		}
+	})
+	return words
+}
+
+//PassphraseOptions describe a passphrase of random words
+type PassphraseOptions struct {
+	Words     int
+	Separator string
+	Case      string
+	// words are added until the entropy is at least this many bits
+	MinEntropy float64
+}
+
+//Passphrase generates a passphrase of words chosen uniformly at random from
+//the EFF large wordlist, 12.9 bits each
+func Passphrase(options PassphraseOptions) (*Generated, error) {
+	list := wordlist()
+
+	bitsPerWord := math.Log2(float64(len(list)))
+	switch options.Case {
+	case CaseLower, CaseUpper, CaseTitle, "":
+	case CaseMixed:
+		bitsPerWord++
+	default:
+		return nil, errors.Errorf("unknown case %s, cases are: %s", options.Case, strings.Join(Cases, ", "))
+	}
+
+	if err := checkLimits(options.Words, options.MinEntropy); err != nil {
+		return nil, err
+	}
+
+	n := options.Words
+	for float64(n)*bitsPerWord < options.MinEntropy {
+		n++
+	}
+	if n <= 0 {
+		return nil, errors.New("a number of words or entropy is required")
+	}
+
+	chosen := make([]string, n)
+	for i := range chosen {
+		idx, err := randomInt(len(list))
+		if err != nil {
+			return nil, err
+		}
+		word := list[idx]
+
+		switch options.Case {
+		case CaseUpper:
+			word = strings.ToUpper(word)
+		case CaseTitle:
+			word = strings.ToUpper(word[:1]) + word[1:]
+		case CaseMixed:
+			title, err := randomInt(2)
+			if err != nil {
+				return nil, err
+			}
+			if title == 1 {
+				word = strings.ToUpper(word[:1]) + word[1:]
+			}
+		}
+		chosen[i] = word
+	}
+
+	return &Generated{Value: strings.Join(chosen, options.Separator), Entropy: round(float64(n) * bitsPerWord)}, nil
+}
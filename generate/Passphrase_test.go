@@ -0,0 +1,56 @@
+package generate_test
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/simonhayward/gkeepassxreader/generate"
+)
+
+var _ = Describe("Passphrase", func() {
+
+	It("joins words from the wordlist", func() {
+		p, err := generate.Passphrase(generate.PassphraseOptions{Words: 6, Separator: "-", Case: generate.CaseLower})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(strings.Split(p.Value, "-")).To(HaveLen(6))
+		Expect(p.Value).To(MatchRegexp(`^[a-z-]+$`))
+		// 6 * log2(7776)
+		Expect(p.Entropy).To(Equal(77.5))
+	})
+
+	It("capitalises words", func() {
+		p, err := generate.Passphrase(generate.PassphraseOptions{Words: 4, Separator: " ", Case: generate.CaseTitle})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p.Value).To(MatchRegexp(`^[A-Z][a-z-]+( [A-Z][a-z-]+){3}$`))
+
+		p, err = generate.Passphrase(generate.PassphraseOptions{Words: 4, Separator: ".", Case: generate.CaseUpper})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p.Value).To(Equal(strings.ToUpper(p.Value)))
+	})
+
+	It("counts a bit a word for mixed case", func() {
+		p, err := generate.Passphrase(generate.PassphraseOptions{Words: 4, Case: generate.CaseMixed})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p.Entropy).To(Equal(55.7))
+	})
+
+	It("adds words to reach the entropy", func() {
+		p, err := generate.Passphrase(generate.PassphraseOptions{Separator: " ", MinEntropy: 100})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(strings.Split(p.Value, " ")).To(HaveLen(8))
+	})
+
+	It("rejects an unknown case", func() {
+		_, err := generate.Passphrase(generate.PassphraseOptions{Words: 4, Case: "camel"})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("rejects words or entropy above the maximum", func() {
+		_, err := generate.Passphrase(generate.PassphraseOptions{MinEntropy: 1e7})
+		Expect(err).To(MatchError("an entropy of 1e+07 bits is more than the maximum of 1024"))
+		_, err = generate.Passphrase(generate.PassphraseOptions{Words: generate.MaxLength + 1})
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,258 @@
+package generate
+
+import (
+	"crypto/rand"
+	"math"
+	"math/big"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	//ClassLower lower case letters
+	ClassLower = "lower"
+	//ClassUpper upper case letters
+	ClassUpper = "upper"
+	//ClassDigits digits
+	ClassDigits = "digits"
+	//ClassSymbols printable ASCII symbols
+	ClassSymbols = "symbols"
+
+	// characters excluded with ExcludeLookAlikes, as KeePassXC does
+	lookAlikes = "lI1|O0B8G6"
+
+	// a password missing a required class is generated again, this many times
+	maxAttempts = 10000
+
+	//MaxLength is the most characters in a password or words in a passphrase
+	MaxLength = 1024
+	//MaxEntropy is the most bits a password or passphrase is lengthened to
+	MaxEntropy = 1024
+)
+
+//Classes of characters a password can be made of
+var Classes = []string{ClassLower, ClassUpper, ClassDigits, ClassSymbols}
+
+var classCharacters = map[string]string{
+	ClassLower:   "abcdefghijklmnopqrstuvwxyz",
+	ClassUpper:   "ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	ClassDigits:  "0123456789",
+	ClassSymbols: "!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~",
+}
+
+//Generated is a password and its entropy in bits
+type Generated struct {
+	Value   string
+	Entropy float64
+}
+
+//PasswordOptions describe a password of random characters
+type PasswordOptions struct {
+	Length  int
+	Classes []string
+	// excludes characters which are easily confused, such as l, 1 and I
+	ExcludeLookAlikes bool
+	// characters never used
+	Exclude string
+	// every class is used at least once
+	RequireEach bool
+	// the length is increased until the entropy is at least this many bits
+	MinEntropy float64
+}
+
+//Password generates a password of characters chosen uniformly at random from
+//the classes. Passwords missing a required class are discarded, so every
+//password meeting the options is equally likely and the entropy is exact.
+func Password(options PasswordOptions) (*Generated, error) {
+	var sets [][]rune
+	seen := make(map[string]bool)
+	for _, class := range options.Classes {
+		if seen[class] {
+			continue
+		}
+		seen[class] = true
+		chars, ok := classCharacters[class]
+		if !ok {
+			return nil, errors.Errorf("unknown class %s, classes are: %s", class, strings.Join(Classes, ", "))
+		}
+		set := filter([]rune(chars), options.ExcludeLookAlikes, options.Exclude)
+		if len(set) == 0 {
+			return nil, errors.Errorf("every character of class %s is excluded", class)
+		}
+		sets = append(sets, set)
+	}
+	if len(sets) == 0 {
+		return nil, errors.New("at least one character class is required")
+	}
+
+	var alphabet []rune
+	for _, set := range sets {
+		alphabet = append(alphabet, set...)
+	}
+	alphabet = unique(alphabet)
+
+	if err := checkLimits(options.Length, options.MinEntropy); err != nil {
+		return nil, err
+	}
+
+	length := options.Length
+	if options.RequireEach && length < len(sets) {
+		if options.MinEntropy <= 0 {
+			return nil, errors.Errorf("a length of %d can't use all %d classes", length, len(sets))
+		}
+		length = len(sets)
+	}
+	if length <= 0 && options.MinEntropy <= 0 {
+		return nil, errors.New("a length or entropy is required")
+	}
+
+	entropy := func(length int) float64 {
+		if options.RequireEach {
+			return requiredEntropy(len(alphabet), sets, length)
+		}
+		return float64(length) * math.Log2(float64(len(alphabet)))
+	}
+	for entropy(length) < options.MinEntropy {
+		if length >= MaxLength {
+			return nil, errors.Errorf("%g bits can't be reached within %d characters", options.MinEntropy, MaxLength)
+		}
+		length++
+	}
+
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		password := make([]rune, length)
+		for i := range password {
+			c, err := choose(alphabet)
+			if err != nil {
+				return nil, err
+			}
+			password[i] = c
+		}
+
+		if !options.RequireEach || usesEach(password, sets) {
+			return &Generated{Value: string(password), Entropy: round(entropy(length))}, nil
+		}
+	}
+	return nil, errors.New("unable to generate a password using every class, try a longer length")
+}
+
+// checkLimits rejects targets which would take too long to generate
+func checkLimits(length int, entropy float64) error {
+	if length > MaxLength {
+		return errors.Errorf("a length of %d is more than the maximum of %d", length, MaxLength)
+	}
+	if entropy > MaxEntropy {
+		return errors.Errorf("an entropy of %g bits is more than the maximum of %d", entropy, MaxEntropy)
+	}
+	return nil
+}
+
+// requiredEntropy is log2 of the number of passwords using every set, counted
+// by inclusion and exclusion of the sets which are missing
+func requiredEntropy(alphabet int, sets [][]rune, length int) float64 {
+	total := new(big.Int)
+	for mask := 0; mask < 1<<len(sets); mask++ {
+		excluded, n := 0, 0
+		for i, set := range sets {
+			if mask&(1<<i) != 0 {
+				excluded += len(set)
+				n++
+			}
+		}
+		term := new(big.Int).Exp(big.NewInt(int64(alphabet-excluded)), big.NewInt(int64(length)), nil)
+		if n%2 == 0 {
+			total.Add(total, term)
+		} else {
+			total.Sub(total, term)
+		}
+	}
+	return log2(total)
+}
+
+func usesEach(password []rune, sets [][]rune) bool {
+	for _, set := range sets {
+		found := false
+		for _, c := range password {
+			if containsRune(set, c) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func filter(chars []rune, excludeLookAlikes bool, exclude string) []rune {
+	var kept []rune
+	for _, c := range chars {
+		if excludeLookAlikes && strings.ContainsRune(lookAlikes, c) {
+			continue
+		}
+		if strings.ContainsRune(exclude, c) {
+			continue
+		}
+		kept = append(kept, c)
+	}
+	return kept
+}
+
+func unique(chars []rune) []rune {
+	seen := make(map[rune]bool)
+	var u []rune
+	for _, c := range chars {
+		if !seen[c] {
+			seen[c] = true
+			u = append(u, c)
+		}
+	}
+	return u
+}
+
+func containsRune(chars []rune, c rune) bool {
+	for _, r := range chars {
+		if r == c {
+			return true
+		}
+	}
+	return false
+}
+
+// choose returns a character chosen uniformly with crypto/rand
+func choose(chars []rune) (rune, error) {
+	i, err := randomInt(len(chars))
+	if err != nil {
+		return 0, err
+	}
+	return chars[i], nil
+}
+
+func randomInt(n int) (int, error) {
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, errors.Wrap(err, "random error")
+	}
+	return int(i.Int64()), nil
+}
+
+func log2(n *big.Int) float64 {
+	if n.Sign() <= 0 {
+		return 0
+	}
+	f, _ := new(big.Float).SetInt(n).Float64()
+	if !math.IsInf(f, 0) {
+		return math.Log2(f)
+	}
+	// too large for a float64, shift off the low bits
+	shift := n.BitLen() - 64
+	f, _ = new(big.Float).SetInt(new(big.Int).Rsh(n, uint(shift))).Float64()
+	return math.Log2(f) + float64(shift)
+}
+
+// round to a tenth of a bit
+func round(bits float64) float64 {
+	return math.Round(bits*10) / 10
+}
@@ -0,0 +1,81 @@
+package generate_test
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/simonhayward/gkeepassxreader/generate"
+)
+
+var _ = Describe("Password", func() {
+
+	It("uses only the given classes at the given length", func() {
+		for i := 0; i < 50; i++ {
+			p, err := generate.Password(generate.PasswordOptions{Length: 16, Classes: []string{generate.ClassLower, generate.ClassDigits}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.Value).To(MatchRegexp(`^[a-z0-9]{16}$`))
+			// 16 * log2(36)
+			Expect(p.Entropy).To(Equal(82.7))
+		}
+	})
+
+	It("uses every class when required", func() {
+		for i := 0; i < 100; i++ {
+			p, err := generate.Password(generate.PasswordOptions{Length: 4, Classes: generate.Classes, RequireEach: true})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.Value).To(MatchRegexp(`[a-z]`))
+			Expect(p.Value).To(MatchRegexp(`[A-Z]`))
+			Expect(p.Value).To(MatchRegexp(`[0-9]`))
+			Expect(p.Value).To(MatchRegexp(`[^a-zA-Z0-9]`))
+		}
+	})
+
+	It("counts only passwords using every class in the entropy", func() {
+		p, err := generate.Password(generate.PasswordOptions{Length: 2, Classes: []string{generate.ClassLower, generate.ClassDigits}, RequireEach: true})
+		Expect(err).ToNot(HaveOccurred())
+		// 2 * 26 * 10 passwords
+		Expect(p.Entropy).To(Equal(9.0))
+	})
+
+	It("excludes look-alikes and given characters", func() {
+		for i := 0; i < 50; i++ {
+			p, err := generate.Password(generate.PasswordOptions{Length: 64, Classes: generate.Classes, ExcludeLookAlikes: true, Exclude: "xyz"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(strings.ContainsAny(p.Value, "lI1|O0B8G6xyz")).To(BeFalse(), p.Value)
+		}
+	})
+
+	It("lengthens the password to reach the entropy", func() {
+		p, err := generate.Password(generate.PasswordOptions{Length: 8, Classes: []string{generate.ClassDigits}, MinEntropy: 64})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p.Value).To(HaveLen(20))
+		Expect(p.Entropy).To(BeNumerically(">=", 64))
+	})
+
+	It("rejects impossible options", func() {
+		_, err := generate.Password(generate.PasswordOptions{Length: 3, Classes: generate.Classes, RequireEach: true})
+		Expect(err).To(HaveOccurred())
+		_, err = generate.Password(generate.PasswordOptions{Length: 8, Classes: []string{"emoji"}})
+		Expect(err).To(MatchError(ContainSubstring("unknown class")))
+		_, err = generate.Password(generate.PasswordOptions{Length: 8, Classes: []string{generate.ClassDigits}, Exclude: "0123456789"})
+		Expect(err).To(HaveOccurred())
+		_, err = generate.Password(generate.PasswordOptions{Length: 8})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("rejects a length or entropy above the maximum", func() {
+		_, err := generate.Password(generate.PasswordOptions{Length: 8, Classes: generate.Classes, RequireEach: true, MinEntropy: 1e7})
+		Expect(err).To(MatchError("an entropy of 1e+07 bits is more than the maximum of 1024"))
+		_, err = generate.Password(generate.PasswordOptions{Length: generate.MaxLength + 1, Classes: generate.Classes})
+		Expect(err).To(MatchError("a length of 1025 is more than the maximum of 1024"))
+		// a single character adds no entropy
+		_, err = generate.Password(generate.PasswordOptions{Length: 8, Classes: []string{generate.ClassDigits}, Exclude: "012345678", MinEntropy: 1})
+		Expect(err).To(MatchError("1 bits can't be reached within 1024 characters"))
+
+		p, err := generate.Password(generate.PasswordOptions{Classes: generate.Classes, RequireEach: true, MinEntropy: generate.MaxEntropy})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p.Entropy).To(BeNumerically(">=", generate.MaxEntropy))
+	})
+})
@@ -0,0 +1,193 @@
+package generate
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	vowels     = "aeiou"
+	consonants = "bcdfghjklmnpqrstvwxyz"
+)
+
+// placeholders of the KeePass password pattern syntax
+var placeholders = map[rune]string{
+	'a': classCharacters[ClassLower] + classCharacters[ClassDigits],
+	'A': classCharacters[ClassLower] + classCharacters[ClassUpper] + classCharacters[ClassDigits],
+	'U': classCharacters[ClassUpper] + classCharacters[ClassDigits],
+	'd': classCharacters[ClassDigits],
+	'h': "0123456789abcdef",
+	'H': "0123456789ABCDEF",
+	'l': classCharacters[ClassLower],
+	'L': classCharacters[ClassLower] + classCharacters[ClassUpper],
+	'u': classCharacters[ClassUpper],
+	'v': vowels,
+	'V': vowels + strings.ToUpper(vowels),
+	'Z': strings.ToUpper(vowels),
+	'c': consonants,
+	'C': consonants + strings.ToUpper(consonants),
+	'z': strings.ToUpper(consonants),
+	'p': ",.;:",
+	'b': "()[]{}<>",
+	's': classCharacters[ClassSymbols],
+	'S': classCharacters[ClassLower] + classCharacters[ClassUpper] + classCharacters[ClassDigits] + classCharacters[ClassSymbols],
+	'x': highANSI(),
+}
+
+// highANSI is the printable Latin-1 supplement, without the soft hyphen
+func highANSI() string {
+	var chars []rune
+	for c := rune(0xA1); c <= 0xFF; c++ {
+		if c != 0xAD {
+			chars = append(chars, c)
+		}
+	}
+	return string(chars)
+}
+
+//Pattern generates a password from a KeePass pattern. Placeholders such as
+//u (upper case), d (digit) or s (symbol) are replaced by a random character,
+//{n} repeats the previous item, [...] defines a set of placeholders and
+//literals with ^ excluding the characters which follow, \ escapes a literal.
+//For example u{4}d{4} or [ud^O0]{8}.
+func Pattern(pattern string, excludeLookAlikes bool, exclude string) (*Generated, error) {
+	sets, err := parsePattern([]rune(pattern))
+	if err != nil {
+		return nil, err
+	}
+
+	var password []rune
+	entropy := 0.0
+	for _, set := range sets {
+		set = filter(set, excludeLookAlikes, exclude)
+		if len(set) == 0 {
+			return nil, errors.Errorf("pattern %s has an item with every character excluded", pattern)
+		}
+		c, err := choose(set)
+		if err != nil {
+			return nil, err
+		}
+		password = append(password, c)
+		entropy += math.Log2(float64(len(set)))
+	}
+	if len(password) == 0 {
+		return nil, errors.New("the pattern is empty")
+	}
+
+	return &Generated{Value: string(password), Entropy: round(entropy)}, nil
+}
+
+// parsePattern returns the set of characters of each position
+func parsePattern(p []rune) ([][]rune, error) {
+	var sets [][]rune
+	for i := 0; i < len(p); i++ {
+		switch c := p[i]; c {
+		case '\\':
+			if i+1 >= len(p) {
+				return nil, errors.New("pattern ends with an escape")
+			}
+			i++
+			sets = append(sets, []rune{p[i]})
+		case '{':
+			end := indexRune(p, i, '}')
+			if end < 0 {
+				return nil, errors.Errorf("unclosed { at %d", i)
+			}
+			n, err := strconv.Atoi(string(p[i+1 : end]))
+			if err != nil || n < 0 {
+				return nil, errors.Errorf("invalid repeat count %q at %d", string(p[i+1:end]), i)
+			}
+			if len(sets) == 0 {
+				return nil, errors.Errorf("repeat at %d has nothing to repeat", i)
+			}
+			if len(sets)-1+n > MaxLength {
+				return nil, errors.Errorf("a length of %d is more than the maximum of %d", len(sets)-1+n, MaxLength)
+			}
+			last := sets[len(sets)-1]
+			sets = sets[:len(sets)-1]
+			for j := 0; j < n; j++ {
+				sets = append(sets, last)
+			}
+			i = end
+		case '[':
+			end := indexRune(p, i, ']')
+			if end < 0 {
+				return nil, errors.Errorf("unclosed [ at %d", i)
+			}
+			set, err := parseSet(p[i+1 : end])
+			if err != nil {
+				return nil, err
+			}
+			sets = append(sets, set)
+			i = end
+		default:
+			chars, ok := placeholders[c]
+			if !ok {
+				return nil, errors.Errorf("unknown placeholder %c at %d, escape literals with \\", c, i)
+			}
+			sets = append(sets, []rune(chars))
+		}
+	}
+	return sets, nil
+}
+
+// parseSet parses the inside of [...], placeholders and escaped literals are
+// included until ^, the literal characters after it are excluded
+func parseSet(p []rune) ([]rune, error) {
+	var included, excluded []rune
+	exclude := false
+	for i := 0; i < len(p); i++ {
+		var chars []rune
+		switch c := p[i]; c {
+		case '^':
+			exclude = true
+			continue
+		case '\\':
+			if i+1 >= len(p) {
+				return nil, errors.New("set ends with an escape")
+			}
+			i++
+			chars = []rune{p[i]}
+		default:
+			if exclude {
+				chars = []rune{c}
+				break
+			}
+			s, ok := placeholders[c]
+			if !ok {
+				return nil, errors.Errorf("unknown placeholder %c in set, escape literals with \\", c)
+			}
+			chars = []rune(s)
+		}
+		if exclude {
+			excluded = append(excluded, chars...)
+		} else {
+			included = append(included, chars...)
+		}
+	}
+
+	var set []rune
+	for _, c := range unique(included) {
+		if !containsRune(excluded, c) {
+			set = append(set, c)
+		}
+	}
+	return set, nil
+}
+
+// indexRune finds r after position from, skipping escaped characters
+func indexRune(p []rune, from int, r rune) int {
+	for i := from + 1; i < len(p); i++ {
+		if p[i] == '\\' {
+			i++
+			continue
+		}
+		if p[i] == r {
+			return i
+		}
+	}
+	return -1
+}
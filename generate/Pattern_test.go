@@ -0,0 +1,48 @@
+package generate_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/simonhayward/gkeepassxreader/generate"
+)
+
+var _ = Describe("Pattern", func() {
+
+	It("replaces placeholders and repeats", func() {
+		p, err := generate.Pattern("u{4}d{4}", false, "")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p.Value).To(MatchRegexp(`^[A-Z]{4}[0-9]{4}$`))
+		// 4 * log2(26) + 4 * log2(10)
+		Expect(p.Entropy).To(Equal(32.1))
+	})
+
+	It("keeps escaped literals", func() {
+		p, err := generate.Pattern(`\u\{d\}hH`, false, "")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p.Value).To(MatchRegexp(`^u\{[0-9]\}[0-9a-f][0-9A-F]$`))
+	})
+
+	It("uses custom sets with exclusions", func() {
+		for i := 0; i < 50; i++ {
+			p, err := generate.Pattern("[ud^O0]{32}", false, "")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.Value).To(MatchRegexp(`^[A-NP-Z1-9]{32}$`))
+		}
+	})
+
+	It("excludes look-alikes", func() {
+		for i := 0; i < 50; i++ {
+			p, err := generate.Pattern("d{32}", true, "")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.Value).To(MatchRegexp(`^[2-579]{32}$`))
+		}
+	})
+
+	It("rejects invalid patterns", func() {
+		for _, pattern := range []string{"", "q", "{4}", "d{x}", "d{4", "[d", `d\`, "[q]", "d{1025}", "d{1000}u{25}"} {
+			_, err := generate.Pattern(pattern, false, "")
+			Expect(err).To(HaveOccurred(), pattern)
+		}
+	})
+})
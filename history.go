@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/simonhayward/gkeepassxreader/diff"
+	"github.com/simonhayward/gkeepassxreader/format"
+	"github.com/simonhayward/gkeepassxreader/output"
+	log "github.com/sirupsen/logrus"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+func revisions(reader *format.KeePass2Reader, term string) []format.Entry {
+	revisions, err := entryService(reader).Revisions(term)
+	if err != nil {
+		log.Fatalf("search database error: %s", err)
+	}
+	if revisions == nil {
+		log.Fatalf("Search term: '%s' not found\n", term)
+	}
+	return revisions
+}
+
+func entryHistory(reader *format.KeePass2Reader, term, secrets string, asJSON bool) {
+	revisions := revisions(reader, term)
+	hashed := diff.NewSecrets(secrets, reader.Db.TransformedMasterKey)
+	defer hashed.Wipe()
+
+	history := diff.History(revisions, hashed)
+	if asJSON {
+		writeJSON(history)
+		return
+	}
+
+	current := revisions[len(revisions)-1]
+	fmt.Printf("%s [%s], %d revisions\n", current.Title.String(), current.UUID, len(revisions))
+
+	fields := &output.Data{Header: []string{"Revision", "Modified", "Field", "Old", "New"}}
+	for _, r := range history {
+		revision, modified := strconv.Itoa(r.Revision), r.Modified.Local().Format("2006-01-02 15:04")
+		if len(r.Fields) == 0 {
+			fields.Data = append(fields.Data, []string{revision, modified, "", "", ""})
+		}
+		for _, f := range r.Fields {
+			fields.Data = append(fields.Data, []string{revision, modified, f.Field, f.Old, f.New})
+		}
+	}
+	output.Table(fields.Header, fields.Data)
+}
+
+func showRevisionOf(reader *format.KeePass2Reader, term string, revision int, chrs string, clipboard bool) {
+	revisions := revisions(reader, term)
+	if revision < 0 || revision >= len(revisions) {
+		kingpin.Fatalf("revision %d not found, the entry has revisions 0 to %d", revision, len(revisions)-1)
+	}
+
+	entry := revisions[len(revisions)-1-revision]
+	if revision > 0 {
+		fmt.Printf("revision %d, modified %s\n", revision, entry.Times.Modified.Local().Format("2006-01-02 15:04"))
+	}
+	showEntry(&entry, chrs, clipboard)
+}
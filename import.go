@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/simonhayward/gkeepassxreader/format"
+	"github.com/simonhayward/gkeepassxreader/input"
+	"github.com/simonhayward/gkeepassxreader/output"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	importActionAdd       = "add"
+	importActionDuplicate = "duplicate"
+)
+
+func importEntries(reader *format.KeePass2Reader, name, importFormat string, mapping map[string]string, group string, dryRun bool) {
+	f, err := os.Open(name)
+	if err != nil {
+		log.Fatalf("unable to open import file: %s", err)
+	}
+	records, err := input.Parse(f, importFormat, mapping)
+	f.Close()
+	if err != nil {
+		log.Fatalf("import error: %s", err)
+	}
+
+	existing, err := entryService(reader).List()
+	if err != nil {
+		log.Fatalf("list database error: %s", err)
+	}
+
+	xmlFile, err := reader.XMLReader.Decrypted()
+	if err != nil {
+		log.Fatalf("decrypt database error: %s", err)
+	}
+
+	var rootName string
+	if len(xmlFile.Root.Groups) > 0 {
+		rootName = xmlFile.Root.Groups[0].Name
+	}
+	prefix := splitGroup(group)
+
+	duplicates := input.NewDuplicates(existing)
+	fields := &output.Data{Header: []string{"Action", "Group", "Title", "Username", "URL"}}
+	added := 0
+
+	for i := range records {
+		record := &records[i]
+
+		// exports of KeePass databases include the root group
+		path := record.Path
+		if len(path) > 0 && len(rootName) > 0 && path[0] == rootName {
+			path = path[1:]
+		}
+		record.Path = append(append([]string(nil), prefix...), path...)
+
+		action := importActionAdd
+		if duplicates.Check(record) {
+			action = importActionDuplicate
+		} else {
+			added++
+			if !dryRun {
+				if _, err := xmlFile.AddEntry(record); err != nil {
+					log.Fatalf("import error: %s", err)
+				}
+			}
+		}
+
+		fields.Data = append(fields.Data, []string{
+			action,
+			strings.Join(append([]string{rootName}, record.Path...), "/"),
+			record.Title.String(),
+			record.Username.String(),
+			record.URL.String(),
+		})
+	}
+
+	output.Table(fields.Header, fields.Data)
+
+	skipped := len(records) - added
+	if dryRun {
+		fmt.Printf("dry run: %d entries would be imported, %d duplicates skipped\n", added, skipped)
+		return
+	}
+
+	if added > 0 {
+		saveDatabase((*db).Name(), reader, xmlFile)
+	}
+	fmt.Printf("%d entries imported, %d duplicates skipped\n", added, skipped)
+}
+
+// splitGroup splits a group path given on the command line
+func splitGroup(group string) []string {
+	var path []string
+	for _, name := range strings.Split(group, "/") {
+		if len(name) > 0 {
+			path = append(path, name)
+		}
+	}
+	return path
+}
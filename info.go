@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/simonhayward/gkeepassxreader/format"
+	log "github.com/sirupsen/logrus"
+)
+
+func info(reader *format.KeePass2Reader, asJSON bool) {
+	i, err := reader.Info()
+	if err != nil {
+		log.Fatalf("database info error: %s", err)
+	}
+	if asJSON {
+		writeJSON(i)
+		return
+	}
+
+	masterKeyChanged := ""
+	if i.MasterKeyChanged != nil {
+		masterKeyChanged = i.MasterKeyChanged.Local().Format("2006-01-02 15:04")
+	}
+
+	for _, field := range []struct {
+		name, value string
+	}{
+		{"Format", i.Format + " " + i.Version},
+		{"Cipher", i.Cipher + " " + i.CipherUUID},
+		{"Compression", i.Compression},
+		{"KDF", fmt.Sprintf("%s %s, %d rounds", i.KDF.Name, i.KDF.UUID, i.KDF.Rounds)},
+		{"Inner stream", i.InnerStream},
+		{"Generator", i.Generator},
+		{"Name", i.DatabaseName},
+		{"Description", i.Description},
+		{"Default user name", i.DefaultUserName},
+		{"Master key changed", masterKeyChanged},
+		{"Change recommended", changeInterval(i.MasterKeyChangeRec)},
+		{"Change forced", changeInterval(i.MasterKeyChangeForce)},
+		{"Groups", strconv.Itoa(i.Groups)},
+		{"Entries", fmt.Sprintf("%d, %d historical, %d recycled", i.Entries, i.HistoricalEntries, i.RecycledEntries)},
+		{"Attachments", fmt.Sprintf("%d, %d bytes", i.Attachments, i.AttachmentBytes)},
+	} {
+		if len(field.value) > 0 {
+			fmt.Printf("%-20s%s\n", field.name+":", field.value)
+		}
+	}
+}
+
+func changeInterval(days int) string {
+	if days < 0 {
+		return "never"
+	}
+	return fmt.Sprintf("every %d days", days)
+}
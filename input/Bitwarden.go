@@ -0,0 +1,156 @@
+package input
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/simonhayward/gkeepassxreader/format"
+)
+
+const (
+	bitwardenItemLogin      = 1
+	bitwardenItemSecureNote = 2
+	bitwardenItemCard       = 3
+	bitwardenItemIdentity   = 4
+
+	bitwardenFieldHidden = 1
+
+	// additional URLs are kept as KeePassXC does
+	additionalURLField = "KP2A_URL"
+)
+
+type bitwardenFolder struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type bitwardenField struct {
+	Name  string  `json:"name"`
+	Value *string `json:"value"`
+	Type  int     `json:"type"`
+}
+
+type bitwardenURI struct {
+	URI string `json:"uri"`
+}
+
+type bitwardenLogin struct {
+	URIs     []bitwardenURI `json:"uris"`
+	Username *string        `json:"username"`
+	Password *string        `json:"password"`
+	TOTP     *string        `json:"totp"`
+}
+
+type bitwardenItem struct {
+	FolderID *string                `json:"folderId"`
+	Type     int                    `json:"type"`
+	Name     string                 `json:"name"`
+	Notes    *string                `json:"notes"`
+	Fields   []bitwardenField       `json:"fields"`
+	Login    *bitwardenLogin        `json:"login"`
+	Card     map[string]interface{} `json:"card"`
+	Identity map[string]interface{} `json:"identity"`
+}
+
+type bitwardenExport struct {
+	Encrypted bool              `json:"encrypted"`
+	Folders   []bitwardenFolder `json:"folders"`
+	Items     []bitwardenItem   `json:"items"`
+}
+
+// card values which are kept protected
+var bitwardenSecretCardFields = map[string]bool{"number": true, "code": true}
+
+func parseBitwarden(r io.Reader) ([]format.Entry, error) {
+	var export bitwardenExport
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return nil, errors.Wrap(err, "bitwarden json decode failed")
+	}
+
+	if export.Encrypted {
+		return nil, errors.New("encrypted bitwarden exports are not supported, export as unencrypted json")
+	}
+
+	folders := make(map[string]string)
+	for _, f := range export.Folders {
+		folders[f.ID] = f.Name
+	}
+
+	var entries []format.Entry
+	for _, item := range export.Items {
+		var path []string
+		if item.FolderID != nil {
+			path = splitPath(folders[*item.FolderID], "/")
+		}
+
+		var username, password, rawURL, totp string
+		var additionalURLs []string
+		if item.Type == bitwardenItemLogin && item.Login != nil {
+			username = str(item.Login.Username)
+			password = str(item.Login.Password)
+			totp = str(item.Login.TOTP)
+			for i, u := range item.Login.URIs {
+				if i == 0 {
+					rawURL = u.URI
+				} else {
+					additionalURLs = append(additionalURLs, u.URI)
+				}
+			}
+		}
+
+		e := newEntry(path, item.Name, username, password, rawURL, str(item.Notes), totp)
+
+		for _, u := range additionalURLs {
+			addField(&e, additionalURLField, u, false)
+		}
+
+		switch item.Type {
+		case bitwardenItemCard:
+			addObjectFields(&e, "Card", item.Card, bitwardenSecretCardFields)
+		case bitwardenItemIdentity:
+			addObjectFields(&e, "Identity", item.Identity, nil)
+		case bitwardenItemLogin, bitwardenItemSecureNote:
+		default:
+			return nil, errors.Errorf("item %s has unknown type %d", item.Name, item.Type)
+		}
+
+		for _, f := range item.Fields {
+			addField(&e, f.Name, str(f.Value), f.Type == bitwardenFieldHidden)
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
+
+// addObjectFields keeps the non empty values of a card or identity in a stable order
+func addObjectFields(e *format.Entry, prefix string, object map[string]interface{}, secret map[string]bool) {
+	keys := make([]string, 0, len(object))
+	for k := range object {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if object[k] == nil {
+			continue
+		}
+		v := fmt.Sprint(object[k])
+		if len(v) == 0 {
+			continue
+		}
+		addField(e, prefix+" "+k, v, secret[k])
+	}
+}
+
+func str(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,206 @@
+package input
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/simonhayward/gkeepassxreader/format"
+)
+
+const (
+	//FieldGroup folder path column
+	FieldGroup = "group"
+	//FieldTitle title column
+	FieldTitle = "title"
+	//FieldUsername username column
+	FieldUsername = "username"
+	//FieldPassword password column
+	FieldPassword = "password"
+	//FieldURL URL column
+	FieldURL = "url"
+	//FieldNotes notes column
+	FieldNotes = "notes"
+	//FieldTOTP TOTP secret or otpauth URI column
+	FieldTOTP = "totp"
+)
+
+//MappingFields can be mapped to csv columns
+var MappingFields = []string{FieldGroup, FieldTitle, FieldUsername, FieldPassword, FieldURL, FieldNotes, FieldTOTP}
+
+// csvPreset describes the columns of a csv export, column names are matched
+// case insensitively. Columns which are neither mapped nor ignored are kept as
+// custom fields.
+type csvPreset struct {
+	columns        map[string][]string
+	ignore         []string
+	groupSeparator string
+	// URL used by secure notes
+	noteURL string
+}
+
+// some exports start with a byte order mark
+const utf8BOM = "\uFEFF"
+
+var csvPresets = map[string]csvPreset{
+	ImportFormatCSV: {
+		columns: map[string][]string{
+			FieldGroup:    {"group", "folder", "grouping", "path"},
+			FieldTitle:    {"title", "name"},
+			FieldUsername: {"username", "user name", "login", "login_username"},
+			FieldPassword: {"password", "login_password"},
+			FieldURL:      {"url", "website", "uri", "login_uri"},
+			FieldNotes:    {"notes", "note", "comments"},
+			FieldTOTP:     {"totp", "otp", "otpauth", "login_totp"},
+		},
+		ignore:         []string{"icon", "last modified", "created"},
+		groupSeparator: "/",
+	},
+	ImportFormat1PasswordCSV: {
+		columns: map[string][]string{
+			FieldTitle:    {"title"},
+			FieldUsername: {"username"},
+			FieldPassword: {"password"},
+			FieldURL:      {"url", "website"},
+			FieldNotes:    {"notes", "notesplain"},
+			FieldTOTP:     {"otpauth", "one-time password"},
+		},
+		ignore:         []string{"favorite", "archived", "tags", "type"},
+		groupSeparator: "/",
+	},
+	ImportFormatLastPassCSV: {
+		columns: map[string][]string{
+			FieldGroup:    {"grouping"},
+			FieldTitle:    {"name"},
+			FieldUsername: {"username"},
+			FieldPassword: {"password"},
+			FieldURL:      {"url"},
+			FieldNotes:    {"extra"},
+			FieldTOTP:     {"totp"},
+		},
+		ignore:         []string{"fav"},
+		groupSeparator: "\\",
+		noteURL:        "http://sn",
+	},
+}
+
+func parseCSV(r io.Reader, preset csvPreset, mapping map[string]string) ([]format.Entry, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read csv header")
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(strings.TrimPrefix(header[i], utf8BOM))
+	}
+
+	columns, err := mapColumns(header, preset, mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	ignored := make(map[int]bool)
+	for _, idx := range columns {
+		ignored[idx] = true
+	}
+	for i, name := range header {
+		for _, ignore := range preset.ignore {
+			if strings.EqualFold(name, ignore) {
+				ignored[i] = true
+			}
+		}
+	}
+
+	var entries []format.Entry
+	for line := 2; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "csv line %d", line)
+		}
+
+		column := func(field string) string {
+			idx, ok := columns[field]
+			if !ok || idx >= len(record) {
+				return ""
+			}
+			return record[idx]
+		}
+
+		rawURL := column(FieldURL)
+		if len(preset.noteURL) > 0 && rawURL == preset.noteURL {
+			rawURL = ""
+		}
+
+		e := newEntry(splitPath(column(FieldGroup), preset.groupSeparator), column(FieldTitle), column(FieldUsername),
+			column(FieldPassword), rawURL, column(FieldNotes), column(FieldTOTP))
+
+		for i, v := range record {
+			if i < len(header) && !ignored[i] && len(v) > 0 {
+				addField(&e, header[i], v, false)
+			}
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
+
+// mapColumns returns the column index of each field, a mapping takes
+// precedence over the preset
+func mapColumns(header []string, preset csvPreset, mapping map[string]string) (map[string]int, error) {
+	index := func(name string) int {
+		for i, h := range header {
+			if strings.EqualFold(h, name) {
+				return i
+			}
+		}
+		return -1
+	}
+
+	columns := make(map[string]int)
+	for field, aliases := range preset.columns {
+		for _, alias := range aliases {
+			if idx := index(alias); idx >= 0 {
+				columns[field] = idx
+				break
+			}
+		}
+	}
+
+	fields := make([]string, 0, len(mapping))
+	for field := range mapping {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		if !isMappingField(field) {
+			return nil, errors.Errorf("unknown field %s, fields are: %s", field, strings.Join(MappingFields, ", "))
+		}
+		idx := index(mapping[field])
+		if idx < 0 {
+			return nil, errors.Errorf("column %s not found for field %s", mapping[field], field)
+		}
+		columns[field] = idx
+	}
+
+	return columns, nil
+}
+
+func isMappingField(field string) bool {
+	for _, f := range MappingFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,151 @@
+package input
+
+import (
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/simonhayward/gkeepassxreader/format"
+)
+
+const (
+	//ImportFormatCSV generic csv, KeePassXC column names are recognised
+	ImportFormatCSV = "csv"
+	//ImportFormatBitwarden Bitwarden unencrypted json
+	ImportFormatBitwarden = "bitwarden"
+	//ImportFormat1PasswordCSV 1Password csv
+	ImportFormat1PasswordCSV = "1password-csv"
+	//ImportFormatLastPassCSV LastPass csv
+	ImportFormatLastPassCSV = "lastpass-csv"
+)
+
+//ImportFormats supported by Parse
+var ImportFormats = []string{ImportFormatCSV, ImportFormatBitwarden, ImportFormat1PasswordCSV, ImportFormatLastPassCSV}
+
+//Parse reads entries in the given format. Entry paths are folder names relative
+//to the group imported into. Mapping overrides csv columns, keyed by field name
+//(see MappingFields) with the column header as the value.
+func Parse(r io.Reader, importFormat string, mapping map[string]string) ([]format.Entry, error) {
+	switch importFormat {
+	case ImportFormatCSV, ImportFormat1PasswordCSV, ImportFormatLastPassCSV:
+		return parseCSV(r, csvPresets[importFormat], mapping)
+	case ImportFormatBitwarden:
+		if len(mapping) > 0 {
+			return nil, errors.New("column mapping only applies to csv formats")
+		}
+		return parseBitwarden(r)
+	}
+	return nil, errors.Errorf("unknown import format: %s", importFormat)
+}
+
+//Duplicates detects entries already present, matched by URL and username.
+//Entries without a URL are matched by title and username instead.
+type Duplicates struct {
+	seen map[string]bool
+}
+
+//NewDuplicates with the existing entries
+func NewDuplicates(entries []format.Entry) *Duplicates {
+	d := &Duplicates{seen: make(map[string]bool)}
+	for i := range entries {
+		d.seen[duplicateKey(&entries[i])] = true
+	}
+	return d
+}
+
+//Check reports whether e is a duplicate, otherwise e is remembered so later
+//entries are checked against it too
+func (d *Duplicates) Check(e *format.Entry) bool {
+	key := duplicateKey(e)
+	if d.seen[key] {
+		return true
+	}
+	d.seen[key] = true
+	return false
+}
+
+func duplicateKey(e *format.Entry) string {
+	if u := e.URL.String(); len(u) > 0 {
+		return "url\x00" + NormalizeURL(u) + "\x00" + e.Username.String()
+	}
+	return "title\x00" + e.Title.String() + "\x00" + e.Username.String()
+}
+
+//NormalizeURL lower cases the scheme and host and removes a trailing slash
+func NormalizeURL(rawURL string) string {
+	rawURL = strings.TrimSpace(rawURL)
+	u, err := url.Parse(rawURL)
+	if err != nil || len(u.Host) == 0 {
+		return strings.TrimSuffix(strings.ToLower(rawURL), "/")
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	return u.String()
+}
+
+// newEntry builds an entry from plain text values, the password is protected
+func newEntry(path []string, title, username, password, rawURL, notes, totp string) format.Entry {
+	e := format.Entry{
+		Path:     path,
+		Title:    &format.EntryValue{PlainText: title},
+		Username: &format.EntryValue{PlainText: username},
+		Password: &format.EntryValue{PlainText: password, Protected: true},
+		URL:      &format.EntryValue{PlainText: rawURL},
+		Notes:    &format.EntryValue{PlainText: notes},
+	}
+
+	if totp = strings.TrimSpace(totp); len(totp) > 0 {
+		addField(&e, format.OTPField, otpauthURI(totp, title), true)
+	}
+	return e
+}
+
+func addField(e *format.Entry, key, value string, protected bool) {
+	// keys must be unique within an entry
+	name := key
+	for i := 2; e.Field(name) != nil || isStandardField(name); i++ {
+		name = key + " " + strconv.Itoa(i)
+	}
+	e.Fields = append(e.Fields, format.Field{Key: name, Value: &format.EntryValue{PlainText: value, Protected: protected}})
+}
+
+func isStandardField(key string) bool {
+	switch key {
+	case "Title", "UserName", "Password", "URL", "Notes":
+		return true
+	}
+	return false
+}
+
+// otpauthURI converts a bare TOTP secret to an otpauth URI
+func otpauthURI(totp, title string) string {
+	if strings.HasPrefix(strings.ToLower(totp), "otpauth://") {
+		return totp
+	}
+
+	params := url.Values{}
+	params.Set("secret", strings.ToUpper(strings.Replace(totp, " ", "", -1)))
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + title,
+		RawQuery: params.Encode(),
+	}
+	return u.String()
+}
+
+// splitPath splits a folder path, empty names are dropped
+func splitPath(folder, separator string) []string {
+	var path []string
+	for _, name := range strings.Split(folder, separator) {
+		if name = strings.TrimSpace(name); len(name) > 0 {
+			path = append(path, name)
+		}
+	}
+	return path
+}
@@ -0,0 +1,180 @@
+package input_test
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/simonhayward/gkeepassxreader/format"
+	"github.com/simonhayward/gkeepassxreader/input"
+)
+
+var _ = Describe("Import", func() {
+
+	Context("when parsing a KeePassXC csv export", func() {
+		It("maps the standard columns and keeps the rest as custom fields", func() {
+			data := "Group,Title,Username,Password,URL,Notes,TOTP,Icon,PIN\n" +
+				"Root/Email,Mail,me,mailpw,https://mail.example.com,notes,otpauth://totp/Mail?secret=JBSWY3DP,0,1234\n"
+
+			entries, err := input.Parse(strings.NewReader(data), input.ImportFormatCSV, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entries).To(HaveLen(1))
+
+			e := entries[0]
+			Expect(e.Path).To(Equal([]string{"Root", "Email"}))
+			Expect(e.Title.String()).To(Equal("Mail"))
+			Expect(e.Username.String()).To(Equal("me"))
+			Expect(e.Password.String()).To(Equal("mailpw"))
+			Expect(e.Password.Protected).To(BeTrue())
+			Expect(e.URL.String()).To(Equal("https://mail.example.com"))
+			Expect(e.Notes.String()).To(Equal("notes"))
+			Expect(e.Field(format.OTPField).String()).To(Equal("otpauth://totp/Mail?secret=JBSWY3DP"))
+			Expect(e.Field(format.OTPField).Protected).To(BeTrue())
+			Expect(e.Field("PIN").String()).To(Equal("1234"))
+			Expect(e.Field("Icon")).To(BeNil())
+		})
+	})
+
+	Context("when parsing a csv with a column mapping", func() {
+		It("uses the mapped columns", func() {
+			data := "Site,Account,Secret,Folder\nexample.com,alice,pw,Work/Web\n"
+
+			entries, err := input.Parse(strings.NewReader(data), input.ImportFormatCSV, map[string]string{
+				input.FieldTitle:    "site",
+				input.FieldURL:      "Site",
+				input.FieldUsername: "Account",
+				input.FieldPassword: "Secret",
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entries).To(HaveLen(1))
+			Expect(entries[0].Title.String()).To(Equal("example.com"))
+			Expect(entries[0].URL.String()).To(Equal("example.com"))
+			Expect(entries[0].Username.String()).To(Equal("alice"))
+			Expect(entries[0].Password.String()).To(Equal("pw"))
+			Expect(entries[0].Path).To(Equal([]string{"Work", "Web"}))
+			Expect(entries[0].Fields).To(BeEmpty())
+		})
+
+		It("fails for an unknown field or column", func() {
+			data := "Site\nexample.com\n"
+
+			_, err := input.Parse(strings.NewReader(data), input.ImportFormatCSV, map[string]string{"colour": "Site"})
+			Expect(err).To(HaveOccurred())
+
+			_, err = input.Parse(strings.NewReader(data), input.ImportFormatCSV, map[string]string{input.FieldTitle: "Name"})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("when parsing a LastPass csv export", func() {
+		It("splits groupings and converts TOTP secrets", func() {
+			data := "url,username,password,totp,extra,name,grouping,fav\n" +
+				"https://mail.example.com,me,mailpw,jbsw y3dp,notes,Mail,Business\\Email,0\n" +
+				"http://sn,,,,note text,Note,,1\n"
+
+			entries, err := input.Parse(strings.NewReader(data), input.ImportFormatLastPassCSV, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entries).To(HaveLen(2))
+			Expect(entries[0].Path).To(Equal([]string{"Business", "Email"}))
+			Expect(entries[0].Title.String()).To(Equal("Mail"))
+			Expect(entries[0].Notes.String()).To(Equal("notes"))
+			Expect(entries[0].Field(format.OTPField).String()).To(Equal("otpauth://totp/Mail?secret=JBSWY3DP"))
+			Expect(entries[0].Fields).To(HaveLen(1))
+
+			Expect(entries[1].Path).To(BeEmpty())
+			Expect(entries[1].URL.String()).To(Equal(""))
+			Expect(entries[1].Notes.String()).To(Equal("note text"))
+		})
+	})
+
+	Context("when parsing a 1Password csv export", func() {
+		It("maps the columns", func() {
+			data := "Title,Url,Username,Password,OTPAuth,Favorite,Archived,Tags,Notes\n" +
+				"Mail,https://mail.example.com,me,mailpw,,false,false,work,notes\n"
+
+			entries, err := input.Parse(strings.NewReader(data), input.ImportFormat1PasswordCSV, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entries).To(HaveLen(1))
+			Expect(entries[0].Title.String()).To(Equal("Mail"))
+			Expect(entries[0].URL.String()).To(Equal("https://mail.example.com"))
+			Expect(entries[0].Password.String()).To(Equal("mailpw"))
+			Expect(entries[0].Notes.String()).To(Equal("notes"))
+			Expect(entries[0].Fields).To(BeEmpty())
+		})
+	})
+
+	Context("when parsing a Bitwarden json export", func() {
+		It("maps folders, logins, custom fields and cards", func() {
+			data := `{
+				"encrypted": false,
+				"folders": [{"id": "f1", "name": "Work/Email"}],
+				"items": [
+					{
+						"folderId": "f1", "type": 1, "name": "Mail", "notes": "notes",
+						"fields": [{"name": "PIN", "value": "1234", "type": 1}, {"name": "Colour", "value": "blue", "type": 0}],
+						"login": {
+							"uris": [{"uri": "https://mail.example.com"}, {"uri": "https://webmail.example.com"}],
+							"username": "me", "password": "mailpw", "totp": "otpauth://totp/Mail?secret=JBSWY3DP"
+						}
+					},
+					{
+						"folderId": null, "type": 3, "name": "Visa", "notes": null,
+						"card": {"cardholderName": "Me", "number": "4111111111111111", "code": "123", "brand": null}
+					}
+				]
+			}`
+
+			entries, err := input.Parse(strings.NewReader(data), input.ImportFormatBitwarden, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entries).To(HaveLen(2))
+
+			mail := entries[0]
+			Expect(mail.Path).To(Equal([]string{"Work", "Email"}))
+			Expect(mail.Username.String()).To(Equal("me"))
+			Expect(mail.Password.String()).To(Equal("mailpw"))
+			Expect(mail.URL.String()).To(Equal("https://mail.example.com"))
+			Expect(mail.Field("KP2A_URL").String()).To(Equal("https://webmail.example.com"))
+			Expect(mail.Field(format.OTPField).String()).To(Equal("otpauth://totp/Mail?secret=JBSWY3DP"))
+			Expect(mail.Field("PIN").Protected).To(BeTrue())
+			Expect(mail.Field("Colour").Protected).To(BeFalse())
+
+			card := entries[1]
+			Expect(card.Path).To(BeEmpty())
+			Expect(card.Field("Card number").String()).To(Equal("4111111111111111"))
+			Expect(card.Field("Card number").Protected).To(BeTrue())
+			Expect(card.Field("Card cardholderName").Protected).To(BeFalse())
+			Expect(card.Field("Card brand")).To(BeNil())
+		})
+
+		It("refuses an encrypted export", func() {
+			_, err := input.Parse(strings.NewReader(`{"encrypted": true}`), input.ImportFormatBitwarden, nil)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("when checking for duplicates", func() {
+		entry := func(title, username, url string) *format.Entry {
+			return &format.Entry{
+				Title:    &format.EntryValue{PlainText: title},
+				Username: &format.EntryValue{PlainText: username},
+				URL:      &format.EntryValue{PlainText: url},
+			}
+		}
+
+		It("matches by normalised URL and username", func() {
+			duplicates := input.NewDuplicates([]format.Entry{*entry("Mail", "me", "https://Mail.Example.com/")})
+
+			Expect(duplicates.Check(entry("Other title", "me", "https://mail.example.com"))).To(BeTrue())
+			Expect(duplicates.Check(entry("Mail", "you", "https://mail.example.com"))).To(BeFalse())
+			Expect(duplicates.Check(entry("Mail", "you", "https://mail.example.com"))).To(BeTrue())
+		})
+
+		It("matches entries without a URL by title and username", func() {
+			duplicates := input.NewDuplicates([]format.Entry{*entry("Note", "", "")})
+
+			Expect(duplicates.Check(entry("Note", "", ""))).To(BeTrue())
+			Expect(duplicates.Check(entry("Other note", "", ""))).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/simonhayward/gkeepassxreader/format"
+	"github.com/simonhayward/gkeepassxreader/keys"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// shortest timed transform, long enough to even out scheduling noise
+	benchmarkDuration = 500 * time.Millisecond
+)
+
+func benchmarkTransform() *keys.TransformBenchmark {
+	ctx, stop := interruptContext()
+	defer stop()
+
+	b, err := keys.BenchmarkTransform(ctx, benchmarkDuration)
+	if errors.Is(err, context.Canceled) {
+		log.Fatal("kdf benchmark interrupted")
+	}
+	if err != nil {
+		log.Fatalf("kdf benchmark error: %s", err)
+	}
+	return b
+}
+
+func kdfBench(target time.Duration) {
+	b := benchmarkTransform()
+
+	hardware := "no, software AES"
+	if len(b.HardwareAES) > 0 {
+		hardware = "yes, " + b.HardwareAES
+	}
+
+	fmt.Printf("%-20s%s\n", "KDF:", "AES-KDF")
+	fmt.Printf("%-20s%s\n", "Hardware AES:", hardware)
+	fmt.Printf("%-20s%d rounds in %s\n", "Timed:", b.Rounds, b.Duration.Round(time.Millisecond))
+	fmt.Printf("%-20s%.0f rounds/s, %.1f ns/round\n", "Throughput:", b.RoundsPerSec, b.NanosPerRound)
+	fmt.Printf("%-20s%d rounds for %s\n", "Suggested:", b.RoundsFor(target), target)
+}
+
+func kdfSet(reader *format.KeePass2Reader, masterKey func() *keys.CompositeKey, rounds uint64, target time.Duration) {
+	if target > 0 {
+		rounds = benchmarkTransform().RoundsFor(target)
+	}
+
+	xmlFile, err := reader.XMLReader.Decrypted()
+	if err != nil {
+		log.Fatalf("decrypt database error: %s", err)
+	}
+
+	previous := reader.Db.TransformRounds
+	reader.Db.TransformRounds = rounds
+	start := time.Now()
+	// the agent's cached key can't be transformed again, the master key is needed
+	if err := reader.Db.Rekey(masterKey()); err != nil {
+		log.Fatalf("master key error: %s", err)
+	}
+
+	saveDatabase((*db).Name(), reader, xmlFile)
+	fmt.Printf("transform rounds changed from %d to %d, unlocking takes about %s\n", previous, rounds, time.Since(start).Round(time.Millisecond))
+}
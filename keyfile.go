@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/simonhayward/gkeepassxreader/keys"
+	log "github.com/sirupsen/logrus"
+)
+
+func generateKeyFile(name, format string) {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		log.Fatalf("unable to create key file: %s", err)
+	}
+
+	if err := keys.GenerateKeyFile(f, format); err != nil {
+		f.Close()
+		os.Remove(name)
+		log.Fatalf("key file error: %s", err)
+	}
+
+	if err := f.Close(); err != nil {
+		log.Fatalf("unable to write key file: %s", err)
+	}
+
+	fmt.Printf("key file written to %s\n", name)
+}
@@ -0,0 +1,90 @@
+package keys
+
+import (
+	"context"
+	"crypto/rand"
+	"runtime"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/cpu"
+)
+
+const (
+	// rounds of the first timed transform, doubled until it takes long enough
+	benchmarkStartRounds = uint64(1 << 14)
+	// Transform requires at least one round
+	minTransformRounds = uint64(1)
+)
+
+//TransformBenchmark is the speed of the AES-KDF transform on this machine
+type TransformBenchmark struct {
+	Rounds        uint64
+	Duration      time.Duration
+	RoundsPerSec  float64
+	NanosPerRound float64
+	// the AES instructions used, empty when AES is implemented in software
+	HardwareAES string
+}
+
+//BenchmarkTransform times Transform with a random key and seed, the rounds
+//are doubled until a run takes at least minDuration or ctx is done
+func BenchmarkTransform(ctx context.Context, minDuration time.Duration) (*TransformBenchmark, error) {
+	seed := make([]byte, TransformSeedSize)
+	if _, err := rand.Read(seed); err != nil {
+		return nil, errors.Wrap(err, "unable to generate seed")
+	}
+	key := MasterKey("benchmark", nil)
+	defer key.Wipe()
+
+	rounds := benchmarkStartRounds
+	for {
+		start := time.Now()
+		if _, err := key.TransformContext(ctx, seed, rounds, nil); err != nil {
+			return nil, err
+		}
+		elapsed := time.Since(start)
+
+		if elapsed >= minDuration || rounds >= 1<<40 {
+			return &TransformBenchmark{
+				Rounds:        rounds,
+				Duration:      elapsed,
+				RoundsPerSec:  float64(rounds) / elapsed.Seconds(),
+				NanosPerRound: float64(elapsed.Nanoseconds()) / float64(rounds),
+				HardwareAES:   HardwareAES(),
+			}, nil
+		}
+		rounds *= 2
+	}
+}
+
+//RoundsFor returns the rounds which take about target to transform
+func (b *TransformBenchmark) RoundsFor(target time.Duration) uint64 {
+	rounds := uint64(b.RoundsPerSec * target.Seconds())
+	if rounds < minTransformRounds {
+		return minTransformRounds
+	}
+	return rounds
+}
+
+//HardwareAES names the AES instructions crypto/aes uses on this machine,
+//empty when AES is implemented in software
+func HardwareAES() string {
+	switch runtime.GOARCH {
+	case "amd64":
+		if cpu.X86.HasAES {
+			return "AES-NI"
+		}
+	case "arm64":
+		if cpu.ARM64.HasAES {
+			return "ARMv8 AES"
+		}
+	case "s390x":
+		if cpu.S390X.HasAES {
+			return "CPACF"
+		}
+	case "ppc64le":
+		return "POWER8 vcipher"
+	}
+	return ""
+}
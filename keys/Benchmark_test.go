@@ -0,0 +1,37 @@
+package keys_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/simonhayward/gkeepassxreader/keys"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Benchmark", func() {
+
+	It("times the transform", func() {
+		b, err := keys.BenchmarkTransform(context.Background(), time.Millisecond)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(b.Rounds).To(BeNumerically(">", 0))
+		Expect(b.Duration).To(BeNumerically(">=", time.Millisecond))
+		Expect(b.RoundsPerSec).To(BeNumerically(">", 0))
+		Expect(b.HardwareAES).To(Equal(keys.HardwareAES()))
+	})
+
+	It("stops when the context is cancelled", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := keys.BenchmarkTransform(ctx, time.Hour)
+		Expect(err).To(MatchError(context.Canceled))
+	})
+
+	It("suggests rounds for a target time", func() {
+		b := &keys.TransformBenchmark{RoundsPerSec: 2000000}
+		Expect(b.RoundsFor(time.Second)).To(Equal(uint64(2000000)))
+		Expect(b.RoundsFor(500 * time.Millisecond)).To(Equal(uint64(1000000)))
+		Expect(b.RoundsFor(0)).To(Equal(uint64(1)))
+	})
+})
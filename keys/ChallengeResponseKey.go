@@ -0,0 +1,173 @@
+package keys
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/simonhayward/gkeepassxreader/secure"
+)
+
+const (
+	//ChallengeSize the master seed is padded to, as sent to a YubiKey
+	ChallengeSize = 64
+
+	//ChallengePlaceholder in a command is replaced by the hex encoded challenge
+	ChallengePlaceholder = "{challenge}"
+
+	//HmacSha1SecretSize is the size of a YubiKey HMAC-SHA1 secret
+	HmacSha1SecretSize = 20
+)
+
+//ChallengeResponseKey is a key component whose contribution is the response to a
+//challenge derived from the database master seed, such as a YubiKey HMAC-SHA1 slot
+type ChallengeResponseKey interface {
+	Challenge(challenge []byte) ([]byte, error)
+}
+
+//HmacSha1Key computes the HMAC-SHA1 response in software from a known secret
+type HmacSha1Key struct {
+	//VariableLength strips the challenge padding as a YubiKey slot configured
+	//with variable input does, which is the default
+	VariableLength bool
+	secret         *secure.LockedBuffer
+}
+
+//NewHmacSha1Key with the secret, which is wiped
+func NewHmacSha1Key(secret []byte) (*HmacSha1Key, error) {
+	buf, err := secure.NewLockedBufferFromBytes(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return &HmacSha1Key{
+		VariableLength: true,
+		secret:         buf,
+	}, nil
+}
+
+//NewHmacSha1KeyFromFile reads a hex encoded secret, as used to program a YubiKey,
+//which must be 20 bytes. Any other content, without surrounding whitespace, is
+//used as the raw secret.
+func NewHmacSha1KeyFromFile(name string) (*HmacSha1Key, error) {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read secret: %s", err)
+	}
+	defer secure.Wipe(b)
+
+	trimmed := bytes.TrimSpace(b)
+	if len(trimmed) == 0 {
+		return nil, fmt.Errorf("secret file is empty")
+	}
+
+	secret := make([]byte, hex.DecodedLen(len(trimmed)))
+	if _, err := hex.Decode(secret, trimmed); err != nil {
+		secure.Wipe(secret)
+		secret = append([]byte(nil), trimmed...)
+	} else if len(secret) != HmacSha1SecretSize {
+		secure.Wipe(secret)
+		return nil, fmt.Errorf("hex secret is %d bytes, a YubiKey HMAC-SHA1 secret is %d", len(secret), HmacSha1SecretSize)
+	}
+
+	return NewHmacSha1Key(secret)
+}
+
+//Challenge returns the HMAC-SHA1 of the challenge
+func (k *HmacSha1Key) Challenge(challenge []byte) ([]byte, error) {
+	if k.secret.Size() == 0 {
+		return nil, fmt.Errorf("missing secret")
+	}
+
+	if k.VariableLength && len(challenge) == ChallengeSize {
+		challenge = stripPadding(challenge)
+	}
+
+	mac := hmac.New(sha1.New, k.secret.Bytes())
+	mac.Write(challenge)
+	return mac.Sum(nil), nil
+}
+
+//Wipe destroys the secret
+func (k *HmacSha1Key) Wipe() {
+	k.secret.Destroy()
+}
+
+//CommandKey obtains the response from an external command, such as ykchalresp.
+//The hex encoded challenge replaces {challenge} in the command, or is written
+//to stdin when there is no placeholder. The first line of output is the hex
+//encoded response.
+type CommandKey struct {
+	Command string
+}
+
+//Challenge runs the command
+func (k *CommandKey) Challenge(challenge []byte) ([]byte, error) {
+	encoded := hex.EncodeToString(challenge)
+
+	command := k.Command
+	var stdin string
+	if strings.Contains(command, ChallengePlaceholder) {
+		command = strings.Replace(command, ChallengePlaceholder, encoded, -1)
+	} else {
+		stdin = encoded + "\n"
+	}
+
+	shell, flag := "sh", "-c"
+	if runtime.GOOS == "windows" {
+		shell, flag = "cmd", "/C"
+	}
+
+	var stdout bytes.Buffer
+	cmd := exec.Command(shell, flag, command)
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("challenge-response command failed: %s", err)
+	}
+
+	line, err := firstLine(&stdout)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := hex.DecodeString(strings.TrimSpace(line))
+	if err != nil {
+		return nil, fmt.Errorf("challenge-response command output is not hex: %s", err)
+	}
+	if len(response) == 0 {
+		return nil, fmt.Errorf("challenge-response command returned no response")
+	}
+
+	return response, nil
+}
+
+// padChallenge to 64 bytes with PKCS#7 padding, as KeePassXC sends to a YubiKey
+func padChallenge(seed []byte) []byte {
+	challenge := append([]byte(nil), seed...)
+	padLen := ChallengeSize - len(challenge)
+	for i := 0; i < padLen; i++ {
+		challenge = append(challenge, byte(padLen))
+	}
+	return challenge
+}
+
+// stripPadding removes trailing bytes equal to the last byte, as a YubiKey does
+// in variable input mode
+func stripPadding(challenge []byte) []byte {
+	last := challenge[len(challenge)-1]
+	i := len(challenge)
+	for i > 0 && challenge[i-1] == last {
+		i--
+	}
+	return challenge[:i]
+}
@@ -0,0 +1,186 @@
+package keys_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/simonhayward/gkeepassxreader/keys"
+)
+
+type fixedResponseKey struct {
+	challenges [][]byte
+	response   []byte
+}
+
+func (f *fixedResponseKey) Challenge(challenge []byte) ([]byte, error) {
+	f.challenges = append(f.challenges, challenge)
+	return append([]byte(nil), f.response...), nil
+}
+
+var _ = Describe("ChallengeResponseKey", func() {
+
+	var (
+		seed   []byte
+		secret []byte
+	)
+
+	BeforeEach(func() {
+		seed = []byte("abcdefghijklmnopqrstuvwxyz123456")
+		secret, _ = hex.DecodeString("0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b")
+	})
+
+	Describe("HmacSha1Key", func() {
+		It("matches the RFC 2202 test vector", func() {
+			key, err := keys.NewHmacSha1Key(append([]byte(nil), secret...))
+			Expect(err).ToNot(HaveOccurred())
+
+			response, err := key.Challenge([]byte("Hi There"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hex.EncodeToString(response)).To(Equal("b617318655057264e28bc0b6fb378c8ef146be00"))
+		})
+
+		It("strips the padding of a variable length challenge", func() {
+			key, err := keys.NewHmacSha1Key(append([]byte(nil), secret...))
+			Expect(err).ToNot(HaveOccurred())
+
+			padded := append([]byte(nil), seed...)
+			for len(padded) < keys.ChallengeSize {
+				padded = append(padded, 32)
+			}
+
+			mac := hmac.New(sha1.New, secret)
+			mac.Write(seed)
+
+			response, err := key.Challenge(padded)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(response).To(Equal(mac.Sum(nil)))
+
+			key.VariableLength = false
+			response, err = key.Challenge(padded)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(response).ToNot(Equal(mac.Sum(nil)))
+		})
+
+		It("reads a hex encoded secret from a file", func() {
+			tmpFile, err := ioutil.TempFile("", "secret")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(tmpFile.Name())
+
+			_, err = tmpFile.WriteString(hex.EncodeToString(secret) + "\n")
+			Expect(err).ToNot(HaveOccurred())
+			tmpFile.Close()
+
+			key, err := keys.NewHmacSha1KeyFromFile(tmpFile.Name())
+			Expect(err).ToNot(HaveOccurred())
+
+			response, err := key.Challenge([]byte("Hi There"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hex.EncodeToString(response)).To(Equal("b617318655057264e28bc0b6fb378c8ef146be00"))
+		})
+
+		It("reads a raw secret from a file without the trailing newline", func() {
+			tmpFile, err := ioutil.TempFile("", "secret")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(tmpFile.Name())
+
+			_, err = tmpFile.WriteString("not a hex secret\n")
+			Expect(err).ToNot(HaveOccurred())
+			tmpFile.Close()
+
+			key, err := keys.NewHmacSha1KeyFromFile(tmpFile.Name())
+			Expect(err).ToNot(HaveOccurred())
+
+			mac := hmac.New(sha1.New, []byte("not a hex secret"))
+			mac.Write([]byte("Hi There"))
+			response, err := key.Challenge([]byte("Hi There"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(response).To(Equal(mac.Sum(nil)))
+		})
+
+		It("returns an error for a hex secret which isn't 20 bytes", func() {
+			tmpFile, err := ioutil.TempFile("", "secret")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(tmpFile.Name())
+
+			_, err = tmpFile.WriteString("0b0b0b0b\n")
+			Expect(err).ToNot(HaveOccurred())
+			tmpFile.Close()
+
+			_, err = keys.NewHmacSha1KeyFromFile(tmpFile.Name())
+			Expect(err).To(MatchError(ContainSubstring("hex secret is 4 bytes")))
+		})
+
+		It("returns an error once wiped", func() {
+			key, err := keys.NewHmacSha1Key(append([]byte(nil), secret...))
+			Expect(err).ToNot(HaveOccurred())
+
+			key.Wipe()
+			_, err = key.Challenge([]byte("Hi There"))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("CommandKey", func() {
+		It("replaces the placeholder with the hex challenge", func() {
+			key := &keys.CommandKey{Command: "echo {challenge}"}
+
+			response, err := key.Challenge([]byte{1, 2, 3})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(response).To(Equal([]byte{1, 2, 3}))
+		})
+
+		It("writes the hex challenge to stdin without a placeholder", func() {
+			key := &keys.CommandKey{Command: "cat"}
+
+			response, err := key.Challenge([]byte{4, 5, 6})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(response).To(Equal([]byte{4, 5, 6}))
+		})
+
+		It("returns an error when the output is not hex", func() {
+			key := &keys.CommandKey{Command: "echo not hex"}
+
+			_, err := key.Challenge([]byte{1})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("returns an error when the command fails", func() {
+			key := &keys.CommandKey{Command: "exit 1"}
+
+			_, err := key.Challenge([]byte{1})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("CompositeKey", func() {
+		It("returns nothing without challenge-response components", func() {
+			response, err := keys.NewCompositeKey().Challenge(seed)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(response).To(BeEmpty())
+		})
+
+		It("challenges with the padded seed and hashes the responses", func() {
+			provider := &fixedResponseKey{response: []byte("response")}
+			compositeKey := keys.NewCompositeKey()
+			compositeKey.AddChallengeResponseKey(provider)
+
+			response, err := compositeKey.Challenge(seed)
+			Expect(err).ToNot(HaveOccurred())
+
+			expected := sha256.Sum256([]byte("response"))
+			Expect(response).To(Equal(expected[:]))
+
+			Expect(provider.challenges).To(HaveLen(1))
+			Expect(provider.challenges[0]).To(HaveLen(keys.ChallengeSize))
+			Expect(provider.challenges[0][:32]).To(Equal(seed))
+			Expect(provider.challenges[0][63]).To(Equal(byte(32)))
+		})
+	})
+})
@@ -1,11 +1,13 @@
 package keys
 
 import (
+	"context"
 	"crypto/sha256"
 	"fmt"
 	"sync"
 
 	"github.com/simonhayward/gkeepassxreader/cryptos"
+	"github.com/simonhayward/gkeepassxreader/secure"
 )
 
 const (
@@ -15,8 +17,9 @@ const (
 
 //CompositeKey holds key combinations and encypter to apply
 type CompositeKey struct {
-	keys      []Key
-	Encrypter cryptos.Encrypt
+	keys                  []Key
+	challengeResponseKeys []ChallengeResponseKey
+	Encrypter             cryptos.Encrypt
 }
 
 //NewCompositeKey defaults to AES/ECB encryption
@@ -31,8 +34,62 @@ func (c *CompositeKey) AddKey(k Key) {
 	c.keys = append(c.keys, k)
 }
 
+//AddChallengeResponseKey appends a challenge-response component
+func (c *CompositeKey) AddChallengeResponseKey(k ChallengeResponseKey) {
+	c.challengeResponseKeys = append(c.challengeResponseKeys, k)
+}
+
+//HasChallengeResponse reports whether there are challenge-response components
+func (c *CompositeKey) HasChallengeResponse() bool {
+	return c != nil && len(c.challengeResponseKeys) > 0
+}
+
+//Challenge each challenge-response component with the master seed, returning the
+//checksum of all responses or nothing when there are no such components
+func (c *CompositeKey) Challenge(seed []byte) ([]byte, error) {
+	if c == nil || len(c.challengeResponseKeys) == 0 {
+		return []byte{}, nil
+	}
+
+	challenge := padChallenge(seed)
+
+	h := sha256.New()
+	for _, key := range c.challengeResponseKeys {
+		response, err := key.Challenge(challenge)
+		if err != nil {
+			return []byte{}, err
+		}
+		h.Write(response)
+		secure.Wipe(response)
+	}
+	return h.Sum(nil), nil
+}
+
 //Transform the composite key by performing encryption and returning a checksum
 func (c *CompositeKey) Transform(seed []byte, rounds uint64) ([]byte, error) {
+	return c.TransformContext(context.Background(), seed, rounds, nil)
+}
+
+//TransformContext is Transform stopping early with ctx's error when ctx is
+//done, progress is called with the rounds done when not nil
+func (c *CompositeKey) TransformContext(ctx context.Context, seed []byte, rounds uint64, progress cryptos.RoundsProgress) ([]byte, error) {
+	return c.transform(ctx, c.RawKey(), seed, rounds, progress)
+}
+
+//TransformLegacy transforms the key combined as KeePass 1.x does
+func (c *CompositeKey) TransformLegacy(seed []byte, rounds uint64) ([]byte, error) {
+	return c.TransformLegacyContext(context.Background(), seed, rounds, nil)
+}
+
+//TransformLegacyContext is TransformLegacy stopping early with ctx's error when
+//ctx is done, progress is called with the rounds done when not nil
+func (c *CompositeKey) TransformLegacyContext(ctx context.Context, seed []byte, rounds uint64, progress cryptos.RoundsProgress) ([]byte, error) {
+	return c.transform(ctx, c.LegacyRawKey(), seed, rounds, progress)
+}
+
+func (c *CompositeKey) transform(ctx context.Context, rawKey []byte, seed []byte, rounds uint64, progress cryptos.RoundsProgress) ([]byte, error) {
+	defer secure.Wipe(rawKey)
+
 	if len(seed) != TransformSeedSize {
 		return []byte{}, fmt.Errorf("seed size error, expected: %d received: %d", TransformSeedSize, len(seed))
 	}
@@ -41,26 +98,46 @@ func (c *CompositeKey) Transform(seed []byte, rounds uint64) ([]byte, error) {
 		return []byte{}, fmt.Errorf("rounds error, expected greater than zero")
 	}
 
+	// both halves in one loop, see cryptos.AesKdf
+	if t, ok := c.Encrypter.(cryptos.KeyTransformer); ok {
+		transformed, err := t.TransformKey(ctx, rawKey, seed, rounds, progress)
+		if err != nil {
+			return []byte{}, err
+		}
+		defer secure.Wipe(transformed)
+
+		h := sha256.New()
+		h.Write(transformed)
+		return h.Sum(nil), nil
+	}
+
 	var resultLeft, resultRight []byte
 	var wg sync.WaitGroup
 
 	errc := make(chan error, 2)
-	splitKey := len(c.RawKey()) / 2
+	splitKey := len(rawKey) / 2
 
 	wg.Add(2)
-	go c.Encrypt(c.RawKey()[:splitKey], seed, rounds, &resultLeft, errc, &wg)
-	go c.Encrypt(c.RawKey()[splitKey:], seed, rounds, &resultRight, errc, &wg)
+	go c.Encrypt(rawKey[:splitKey], seed, rounds, &resultLeft, errc, &wg)
+	go c.Encrypt(rawKey[splitKey:], seed, rounds, &resultRight, errc, &wg)
 	wg.Wait()
 	close(errc)
+	defer secure.Wipe(resultLeft)
+	defer secure.Wipe(resultRight)
 
 	for e := range errc {
 		if e != nil {
 			return []byte{}, e
 		}
 	}
+	if progress != nil {
+		progress(rounds)
+	}
 
-	transformed := resultLeft
+	transformed := make([]byte, 0, len(resultLeft)+len(resultRight))
+	transformed = append(transformed, resultLeft...)
 	transformed = append(transformed, resultRight...)
+	defer secure.Wipe(transformed)
 
 	h := sha256.New()
 	h.Write(transformed)
@@ -83,3 +160,53 @@ func (c *CompositeKey) RawKey() []byte {
 	}
 	return h.Sum(nil)
 }
+
+//LegacyRawKey combines keys as KeePass 1.x does, a single key is used as is
+//rather than hashed again
+func (c *CompositeKey) LegacyRawKey() []byte {
+	if len(c.keys) == 1 {
+		return append([]byte(nil), c.keys[0].RawKey()...)
+	}
+	return c.RawKey()
+}
+
+//Windows1252 returns the composite key with its passwords encoded as
+//Windows-1252, sharing the key material of the other keys, or nil when no
+//password encodes differently
+func (c *CompositeKey) Windows1252() *CompositeKey {
+	if c == nil {
+		return nil
+	}
+
+	var found bool
+	legacy := &CompositeKey{Encrypter: c.Encrypter}
+	for _, key := range c.keys {
+		if pk, ok := key.(*PasswordKey); ok {
+			if w := pk.Windows1252(); w != nil {
+				key = w
+				found = true
+			}
+		}
+		legacy.keys = append(legacy.keys, key)
+	}
+	if !found {
+		return nil
+	}
+	return legacy
+}
+
+//Wipe destroys the key material of all keys
+func (c *CompositeKey) Wipe() {
+	for _, key := range c.keys {
+		if w, ok := key.(Wiper); ok {
+			w.Wipe()
+		}
+	}
+	for _, key := range c.challengeResponseKeys {
+		if w, ok := key.(Wiper); ok {
+			w.Wipe()
+		}
+	}
+	c.keys = nil
+	c.challengeResponseKeys = nil
+}
@@ -1,6 +1,7 @@
 package keys_test
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"fmt"
 
@@ -139,6 +140,29 @@ var _ = Describe("CompositeKey", func() {
 				Expect(out).To(Equal(expected[:]))
 			})
 		})
+
+		Context("when the password is encoded as Windows-1252", func() {
+			It("replaces the password key and keeps the others", func() {
+				passwordKey.SetPassword("pässwörd")
+				compositeKey.AddKey(passwordKey)
+				fakeFileKey.RawKeyReturns(bytes.Repeat([]byte{0x44}, 32))
+				compositeKey.AddKey(fakeFileKey)
+
+				windows1252 := compositeKey.Windows1252()
+				Expect(windows1252).ToNot(BeNil())
+
+				h := sha256.New()
+				h.Write(passwordKey.Windows1252().RawKey())
+				h.Write(fakeFileKey.RawKey())
+				Expect(windows1252.RawKey()).To(Equal(h.Sum(nil)))
+			})
+
+			It("is nil when the password is ASCII", func() {
+				passwordKey.SetPassword("my password")
+				compositeKey.AddKey(passwordKey)
+				Expect(compositeKey.Windows1252()).To(BeNil())
+			})
+		})
 	})
 
 })
@@ -1,6 +1,7 @@
 package keys
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
@@ -8,26 +9,40 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strings"
 
+	"github.com/simonhayward/gkeepassxreader/secure"
 	log "github.com/sirupsen/logrus"
 )
 
 const (
-	xmlMetaVersion = "1.00"
+	xmlMetaVersion       = "1.00"
+	xmlMetaVersion2      = "2.0"
+	xmlMetaVersion2Major = "2."
+	xmlHashSize          = 4
 	//HexSize length
 	HexSize = 64
 	//KeySize length
 	KeySize = 32
 )
 
+var (
+	errResetFailed = fmt.Errorf("unable to seek to start of key file")
+)
+
 type xmlMeta struct {
 	XMLName xml.Name `xml:"Meta"`
 	Version string   `xml:"Version"`
 }
 
+type xmlData struct {
+	Hash  string `xml:"Hash,attr,omitempty"`
+	Value string `xml:",chardata"`
+}
+
 type xmlKey struct {
 	XMLName xml.Name `xml:"Key"`
-	Data    string   `xml:"Data"`
+	Data    xmlData  `xml:"Data"`
 }
 
 type xmlKeyFile struct {
@@ -39,6 +54,7 @@ type xmlKeyFile struct {
 //FileKey represents a file key
 type FileKey struct {
 	Key []byte
+	buf *secure.LockedBuffer
 }
 
 // RawKey represents key as byte slice
@@ -46,51 +62,79 @@ func (fk *FileKey) RawKey() []byte {
 	return fk.Key
 }
 
+//Wipe destroys the key
+func (fk *FileKey) Wipe() {
+	fk.buf.Destroy()
+	fk.buf = nil
+	fk.Key = nil
+}
+
+// setKey moves k into locked memory
+func (fk *FileKey) setKey(k []byte) bool {
+	buf, err := secure.NewLockedBufferFromBytes(k)
+	if err != nil {
+		log.Errorf("unable to allocate file key: %s", err)
+		return false
+	}
+
+	fk.Wipe()
+	fk.buf = buf
+	fk.Key = buf.Bytes()
+	return true
+}
+
 // Load keyfile
 func (fk *FileKey) Load(f *os.File) bool {
+	if err := fk.LoadFile(f); err != nil {
+		log.Debugf("key file not loaded: %s", err)
+		return false
+	}
+	return true
+}
+
+//LoadFile loads the key file, returning why it could not be loaded
+func (fk *FileKey) LoadFile(f *os.File) error {
 	fi, err := f.Stat()
 	if err != nil {
-		return false
+		return fmt.Errorf("unable to stat key file: %s", err)
 	}
 
 	if fi.Size() == 0 {
-		return false
+		return fmt.Errorf("key file is empty")
 	}
 
 	// try different key file formats
 	if !reset(f) {
-		return false
+		return errResetFailed
 	}
 
 	if fk.validXML(f) {
 		if !reset(f) {
-			return false
-		}
-		if fk.loadXML(f) {
-			return true
-		}
-	} else {
-		if !reset(f) {
-			return false
-		}
-		if fk.loadBinary(f) {
-			return true
-		}
-		if !reset(f) {
-			return false
-		}
-		if fk.loadHex(f) {
-			return true
-		}
-		if !reset(f) {
-			return false
-		}
-		if fk.loadHashed(f) {
-			return true
+			return errResetFailed
 		}
+		return fk.loadXML(f)
 	}
 
-	return false
+	if !reset(f) {
+		return errResetFailed
+	}
+	if fk.loadBinary(f) {
+		return nil
+	}
+	if !reset(f) {
+		return errResetFailed
+	}
+	if fk.loadHex(f) {
+		return nil
+	}
+	if !reset(f) {
+		return errResetFailed
+	}
+	if fk.loadHashed(f) {
+		return nil
+	}
+
+	return fmt.Errorf("unable to load key file")
 }
 
 func reset(f *os.File) bool {
@@ -112,39 +156,38 @@ func (fk *FileKey) validXML(f *os.File) bool {
 	return false
 }
 
-func (fk *FileKey) loadXML(f *os.File) bool {
+func (fk *FileKey) loadXML(f *os.File) error {
 	xmlFile := &xmlKeyFile{}
 
 	b, err := ioutil.ReadAll(f)
 	if err != nil {
-		log.Errorf("xml read failed: %s", err)
-		return false
+		return fmt.Errorf("xml read failed: %s", err)
 	}
 
 	err = xml.Unmarshal(b, xmlFile)
 	if err != nil {
-		log.Errorf("xml unmarshal failed: %s", err)
-		return false
+		return fmt.Errorf("xml unmarshal failed: %s", err)
 	}
 
 	if xmlFile.XMLName.Local != "KeyFile" {
-		return false
-	}
-
-	// check meta version
-	if xmlFile.Meta.Version != xmlMetaVersion {
-		return false
+		return fmt.Errorf("xml key file has no KeyFile element")
 	}
 
 	// check key
-	if len(xmlFile.Key.Data) == 0 {
-		return false
+	data := strings.TrimSpace(xmlFile.Key.Data.Value)
+	if len(data) == 0 {
+		return fmt.Errorf("xml key file has no key data")
 	}
-	if fk.loadxmlKey(xmlFile.Key.Data) == nil {
-		return true
+
+	// check meta version
+	switch {
+	case xmlFile.Meta.Version == xmlMetaVersion || xmlFile.Meta.Version == "1.0":
+		return fk.loadxmlKey(data)
+	case strings.HasPrefix(xmlFile.Meta.Version, xmlMetaVersion2Major):
+		return fk.loadxmlKeyV2(data, xmlFile.Key.Data.Hash)
 	}
 
-	return false
+	return fmt.Errorf("unsupported xml key file version: %s", xmlFile.Meta.Version)
 }
 
 func (fk *FileKey) loadxmlKey(k string) error {
@@ -154,7 +197,38 @@ func (fk *FileKey) loadxmlKey(k string) error {
 		return fmt.Errorf("base64 decoding failed: %s", err)
 	}
 
-	fk.Key = data
+	if !fk.setKey(data) {
+		return fmt.Errorf("unable to set key")
+	}
+	return nil
+}
+
+// loadxmlKeyV2 decodes whitespace separated hex data and verifies it against
+// the first 4 bytes of its SHA-256 hash
+func (fk *FileKey) loadxmlKeyV2(k string, hash string) error {
+
+	data, err := hex.DecodeString(strings.Join(strings.Fields(k), ""))
+	if err != nil {
+		return fmt.Errorf("hex decoding failed: %s", err)
+	}
+
+	if len(hash) > 0 {
+		expected, err := hex.DecodeString(hash)
+		if err != nil {
+			secure.Wipe(data)
+			return fmt.Errorf("hash attribute decoding failed: %s", err)
+		}
+
+		sum := sha256.Sum256(data)
+		if len(expected) != xmlHashSize || !bytes.Equal(sum[:xmlHashSize], expected) {
+			secure.Wipe(data)
+			return fmt.Errorf("key file hash mismatch, the key file is corrupt")
+		}
+	}
+
+	if !fk.setKey(data) {
+		return fmt.Errorf("unable to set key")
+	}
 	return nil
 }
 
@@ -168,8 +242,7 @@ func (fk *FileKey) loadBinary(f *os.File) bool {
 		return false
 	}
 
-	fk.Key = append([]byte(nil), b...)
-	return true
+	return fk.setKey(b)
 }
 
 func (fk *FileKey) loadHex(f *os.File) bool {
@@ -193,8 +266,8 @@ func (fk *FileKey) loadHex(f *os.File) bool {
 		return false
 	}
 
-	fk.Key = append([]byte(nil), dst...)
-	return true
+	secure.Wipe(b)
+	return fk.setKey(dst)
 }
 
 func (fk *FileKey) loadHashed(f *os.File) bool {
@@ -206,6 +279,6 @@ func (fk *FileKey) loadHashed(f *os.File) bool {
 
 	h := sha256.New()
 	h.Write(b)
-	fk.Key = h.Sum(nil)
-	return true
+	secure.Wipe(b)
+	return fk.setKey(h.Sum(nil))
 }
@@ -182,4 +182,85 @@ var _ = Describe("FileKey", func() {
 
 		})
 	})
+
+	Context("when given a version 2.0 xml file", func() {
+		It("returns true and decodes the hex key", func() {
+			file := `<?xml version="1.0" encoding="utf-8"?>
+			<KeyFile>
+				<Meta>
+					<Version>2.0</Version>
+				</Meta>
+				<Key>
+					<Data Hash="1E9289A0">
+						32AE50B4 57C296B0 5241FED2 5B5E97FA
+						692FD0D6 24CE49B1 59F9164E 1706D155
+					</Data>
+				</Key>
+			</KeyFile>`
+
+			expected, err := hex.DecodeString("32AE50B457C296B05241FED25B5E97FA692FD0D624CE49B159F9164E1706D155")
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = tmpFile.Write([]byte(file))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fk.LoadFile(tmpFile)).To(Succeed())
+			Expect(fk.Key).To(Equal(expected))
+		})
+
+		It("returns an error when the hash does not match", func() {
+			file := `<?xml version="1.0" encoding="utf-8"?>
+			<KeyFile>
+				<Meta>
+					<Version>2.0</Version>
+				</Meta>
+				<Key>
+					<Data Hash="00000000">
+						32AE50B4 57C296B0 5241FED2 5B5E97FA
+						692FD0D6 24CE49B1 59F9164E 1706D155
+					</Data>
+				</Key>
+			</KeyFile>`
+
+			_, err = tmpFile.Write([]byte(file))
+			Expect(err).ToNot(HaveOccurred())
+
+			err = fk.LoadFile(tmpFile)
+			Expect(err).To(MatchError(ContainSubstring("hash mismatch")))
+			Expect(fk.Key).To(BeEmpty())
+		})
+
+		It("returns an error when the data is not hex", func() {
+			file := `<?xml version="1.0" encoding="utf-8"?>
+			<KeyFile>
+				<Meta>
+					<Version>2.0</Version>
+				</Meta>
+				<Key>
+					<Data Hash="1E9289A0">VbM4cH69dgdelucJwa+u6g038mMrxCTHbUr1a9haLBY=</Data>
+				</Key>
+			</KeyFile>`
+
+			_, err = tmpFile.Write([]byte(file))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fk.LoadFile(tmpFile)).ToNot(Succeed())
+		})
+	})
+
+	Context("when given an xml file with an unsupported version", func() {
+		It("returns an error", func() {
+			file := `<?xml version="1.0" encoding="utf-8"?>
+			<KeyFile>
+				<Meta>
+					<Version>3.0</Version>
+				</Meta>
+				<Key>
+					<Data>VbM4cH69dgdelucJwa+u6g038mMrxCTHbUr1a9haLBY=</Data>
+				</Key>
+			</KeyFile>`
+
+			_, err = tmpFile.Write([]byte(file))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fk.LoadFile(tmpFile)).To(MatchError(ContainSubstring("unsupported xml key file version")))
+		})
+	})
 })
@@ -0,0 +1,63 @@
+package keys_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/simonhayward/gkeepassxreader/keys"
+)
+
+func FuzzFileKey(f *testing.F) {
+	f.Add([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<KeyFile>
+	<Meta>
+		<Version>1.00</Version>
+	</Meta>
+	<Key>
+		<Data>VbM4cH69dgdelucJwa+u6g038mMrxCTHbUr1a9haLBY=</Data>
+	</Key>
+</KeyFile>`))
+	f.Add([]byte(`<?xml version="1.0" encoding="utf-8"?>
+<KeyFile>
+	<Meta>
+		<Version>2.0</Version>
+	</Meta>
+	<Key>
+		<Data Hash="1E9289A0">
+			32AE50B4 57C296B0 5241FED2 5B5E97FA
+			692FD0D6 24CE49B1 59F9164E 1706D155
+		</Data>
+	</Key>
+</KeyFile>`))
+	f.Add(bytes.Repeat([]byte{1}, keys.KeySize))
+	f.Add(bytes.Repeat([]byte("a1"), keys.KeySize))
+	f.Add([]byte("any other file is hashed"))
+
+	dir := f.TempDir()
+	f.Fuzz(func(t *testing.T, data []byte) {
+		keyFile, err := ioutil.TempFile(dir, "filekey")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(keyFile.Name())
+		defer keyFile.Close()
+		if _, err := keyFile.Write(data); err != nil {
+			t.Fatal(err)
+		}
+
+		fk := &keys.FileKey{}
+		defer fk.Wipe()
+
+		loaded := fk.Load(keyFile)
+		if loaded && len(fk.Key) == 0 {
+			t.Fatal("key file loaded without a key")
+		}
+		// only an empty or broken xml key file isn't loaded, anything else is
+		// at worst hashed
+		if !loaded && len(data) > 0 && !bytes.Contains(data, []byte("KeyFile")) {
+			t.Fatal("key file not loaded")
+		}
+	})
+}
@@ -3,3 +3,8 @@ package keys
 type Key interface {
 	RawKey() []byte
 }
+
+//Wiper is implemented by keys which can destroy their key material
+type Wiper interface {
+	Wipe()
+}
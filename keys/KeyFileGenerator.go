@@ -0,0 +1,101 @@
+package keys
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/simonhayward/gkeepassxreader/secure"
+)
+
+const (
+	//KeyFileFormatV2 is the KeePass 2.47+ XML format with hex data and a hash
+	KeyFileFormatV2 = "v2"
+	//KeyFileFormatV1 is the KeePass XML format with base64 data
+	KeyFileFormatV1 = "v1"
+	//KeyFileFormatBinary is 32 raw bytes
+	KeyFileFormatBinary = "binary"
+	//KeyFileFormatHex is 64 hex characters
+	KeyFileFormatHex = "hex"
+
+	hexGroupSize     = 8
+	hexGroupsPerLine = 4
+
+	xmlKeyFileTemplate = `<?xml version="1.0" encoding="UTF-8"?>
+<KeyFile>
+	<Meta>
+		<Version>%s</Version>
+	</Meta>
+	<Key>
+		<Data%s>%s</Data>
+	</Key>
+</KeyFile>
+`
+)
+
+var (
+	//KeyFileFormats supported by GenerateKeyFile
+	KeyFileFormats = []string{KeyFileFormatV2, KeyFileFormatV1, KeyFileFormatBinary, KeyFileFormatHex}
+)
+
+//GenerateKeyFile writes a new random key file in the given format
+func GenerateKeyFile(w io.Writer, format string) error {
+	key := make([]byte, KeySize)
+	defer secure.Wipe(key)
+
+	if _, err := rand.Read(key); err != nil {
+		return fmt.Errorf("unable to generate key: %s", err)
+	}
+
+	var out []byte
+
+	switch format {
+	case KeyFileFormatV2:
+		out = xmlKeyFileV2(key)
+	case KeyFileFormatV1:
+		out = xmlKeyFileV1(key)
+	case KeyFileFormatBinary:
+		out = append([]byte(nil), key...)
+	case KeyFileFormatHex:
+		out = make([]byte, HexSize)
+		hex.Encode(out, key)
+	default:
+		return fmt.Errorf("unsupported key file format: %s", format)
+	}
+	defer secure.Wipe(out)
+
+	if _, err := w.Write(out); err != nil {
+		return fmt.Errorf("unable to write key file: %s", err)
+	}
+
+	return nil
+}
+
+func xmlKeyFileV1(key []byte) []byte {
+	return []byte(fmt.Sprintf(xmlKeyFileTemplate, xmlMetaVersion, "", base64.StdEncoding.EncodeToString(key)))
+}
+
+// xmlKeyFileV2 formats the key as KeePass does, in groups of 8 hex characters
+func xmlKeyFileV2(key []byte) []byte {
+	sum := sha256.Sum256(key)
+	encoded := strings.ToUpper(hex.EncodeToString(key))
+
+	var lines []string
+	var groups []string
+	for i := 0; i < len(encoded); i += hexGroupSize {
+		groups = append(groups, encoded[i:i+hexGroupSize])
+		if len(groups) == hexGroupsPerLine {
+			lines = append(lines, strings.Join(groups, " "))
+			groups = nil
+		}
+	}
+
+	hash := fmt.Sprintf(" Hash=\"%s\"", strings.ToUpper(hex.EncodeToString(sum[:xmlHashSize])))
+	data := "\n\t\t\t" + strings.Join(lines, "\n\t\t\t") + "\n\t\t"
+
+	return []byte(fmt.Sprintf(xmlKeyFileTemplate, xmlMetaVersion2, hash, data))
+}
@@ -0,0 +1,60 @@
+package keys_test
+
+import (
+	"io/ioutil"
+	"os"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/simonhayward/gkeepassxreader/keys"
+)
+
+var _ = Describe("KeyFileGenerator", func() {
+
+	var (
+		tmpFile *os.File
+		err     error
+	)
+
+	BeforeEach(func() {
+		tmpFile, err = ioutil.TempFile("", "keyfile")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	})
+
+	for _, format := range keys.KeyFileFormats {
+		format := format
+
+		Context("when generating a "+format+" key file", func() {
+			It("can be loaded", func() {
+				Expect(keys.GenerateKeyFile(tmpFile, format)).To(Succeed())
+
+				fk := &keys.FileKey{}
+				Expect(fk.LoadFile(tmpFile)).To(Succeed())
+				Expect(fk.Key).To(HaveLen(keys.KeySize))
+			})
+		})
+	}
+
+	Context("when generating a version 2.0 key file", func() {
+		It("includes the hash", func() {
+			Expect(keys.GenerateKeyFile(tmpFile, keys.KeyFileFormatV2)).To(Succeed())
+
+			b, err := ioutil.ReadFile(tmpFile.Name())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(b)).To(ContainSubstring("<Version>2.0</Version>"))
+			Expect(string(b)).To(MatchRegexp(`<Data Hash="[0-9A-F]{8}">`))
+		})
+	})
+
+	Context("when generating an unknown format", func() {
+		It("returns an error", func() {
+			Expect(keys.GenerateKeyFile(tmpFile, "unknown")).ToNot(Succeed())
+		})
+	})
+})
@@ -1,6 +1,7 @@
 package keys
 
 import (
+	"fmt"
 	"os"
 
 	log "github.com/sirupsen/logrus"
@@ -8,6 +9,17 @@ import (
 
 //MasterKey from password and file key
 func MasterKey(password string, keyFile *os.File) *CompositeKey {
+	masterKey, err := NewMasterKey(password, keyFile)
+	if err != nil {
+		log.Warn(err)
+		return &CompositeKey{}
+	}
+
+	return masterKey
+}
+
+//NewMasterKey from password and file key, returning an error if the key file can't be loaded
+func NewMasterKey(password string, keyFile *os.File) (*CompositeKey, error) {
 
 	masterKey := NewCompositeKey()
 
@@ -19,12 +31,12 @@ func MasterKey(password string, keyFile *os.File) *CompositeKey {
 
 	if keyFile != nil {
 		kf := &FileKey{}
-		if !kf.Load(keyFile) {
-			log.Warn("unable to load key file")
-			return &CompositeKey{}
+		if err := kf.LoadFile(keyFile); err != nil {
+			masterKey.Wipe()
+			return nil, fmt.Errorf("unable to load key file: %s", err)
 		}
 		masterKey.AddKey(kf)
 	}
 
-	return masterKey
+	return masterKey, nil
 }
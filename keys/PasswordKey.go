@@ -2,20 +2,97 @@ package keys
 
 import (
 	"crypto/sha256"
+	"unicode/utf8"
+
+	"github.com/simonhayward/gkeepassxreader/secure"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/text/encoding/charmap"
 )
 
-//PasswordKey represents a password key
+//PasswordKey represents a password key. A password which isn't ASCII also
+//keeps the key of its Windows-1252 encoding, which KeePass 1.x and KeePassX
+//0.4 hash rather than UTF-8.
 type PasswordKey struct {
-	key []byte
+	key            *secure.LockedBuffer
+	windows1252Key *secure.LockedBuffer
 }
 
 //RawKey returns the key in bytes
 func (p *PasswordKey) RawKey() []byte {
-	return p.key
+	return p.key.Bytes()
 }
 
 //SetPassword creates the key from a checksum hash
 func (p *PasswordKey) SetPassword(password string) {
 	b := sha256.Sum256([]byte(password))
-	p.key = b[:]
+
+	key, err := secure.NewLockedBufferFromBytes(b[:])
+	if err != nil {
+		log.Errorf("unable to allocate password key: %s", err)
+		return
+	}
+
+	p.Wipe()
+	p.key = key
+	p.windows1252Key = windows1252Key(password)
+}
+
+//Windows1252 returns the key of the password encoded as Windows-1252, nil when
+//that is no different from UTF-8 or the password can't be encoded
+func (p *PasswordKey) Windows1252() Key {
+	if p.windows1252Key == nil {
+		return nil
+	}
+	return &windows1252PasswordKey{p}
+}
+
+//Wipe destroys the key
+func (p *PasswordKey) Wipe() {
+	p.key.Destroy()
+	p.key = nil
+	p.windows1252Key.Destroy()
+	p.windows1252Key = nil
+}
+
+// windows1252Key hashes the Windows-1252 encoding of a password which isn't ASCII
+func windows1252Key(password string) *secure.LockedBuffer {
+	ascii := true
+	for i := 0; i < len(password); i++ {
+		if password[i] >= utf8.RuneSelf {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return nil
+	}
+
+	encoded, err := charmap.Windows1252.NewEncoder().Bytes([]byte(password))
+	if err != nil {
+		log.Debugf("password can't be encoded as Windows-1252: %s", err)
+		return nil
+	}
+	b := sha256.Sum256(encoded)
+	secure.Wipe(encoded)
+
+	key, err := secure.NewLockedBufferFromBytes(b[:])
+	if err != nil {
+		log.Errorf("unable to allocate password key: %s", err)
+		return nil
+	}
+	return key
+}
+
+// windows1252PasswordKey is the Windows-1252 key of a password key, wiping
+// either wipes both
+type windows1252PasswordKey struct {
+	p *PasswordKey
+}
+
+func (w *windows1252PasswordKey) RawKey() []byte {
+	return w.p.windows1252Key.Bytes()
+}
+
+func (w *windows1252PasswordKey) Wipe() {
+	w.p.Wipe()
 }
@@ -1,6 +1,7 @@
 package keys_test
 
 import (
+	"crypto/sha256"
 	"encoding/hex"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -23,4 +24,45 @@ var _ = Describe("PasswordKey", func() {
 		Expect(pk.RawKey()).To(Equal(expected), "password is expected to be equal")
 	})
 
+	It("has no Windows-1252 key for an ASCII password", func() {
+		pk := &keys.PasswordKey{}
+		pk.SetPassword("my secret password")
+		Expect(pk.Windows1252()).To(BeNil())
+	})
+
+	It("hashes a password which isn't ASCII as Windows-1252 too", func() {
+		pk := &keys.PasswordKey{}
+		pk.SetPassword("pässwörd€")
+		expected := sha256.Sum256([]byte("p\xe4ssw\xf6rd\x80"))
+
+		Expect(pk.Windows1252()).ToNot(BeNil())
+		Expect(pk.Windows1252().RawKey()).To(Equal(expected[:]))
+		Expect(pk.RawKey()).ToNot(Equal(expected[:]))
+	})
+
+	It("has no Windows-1252 key for a password which can't be encoded", func() {
+		pk := &keys.PasswordKey{}
+		pk.SetPassword("密码")
+		Expect(pk.Windows1252()).To(BeNil())
+	})
+
+	It("wipes the key", func() {
+		pk := &keys.PasswordKey{}
+		pk.SetPassword("my secret password")
+		Expect(pk.RawKey()).To(HaveLen(32))
+
+		pk.Wipe()
+		Expect(pk.RawKey()).To(BeEmpty())
+	})
+
+	It("wipes the Windows-1252 key", func() {
+		pk := &keys.PasswordKey{}
+		pk.SetPassword("pässwörd")
+		windows1252 := pk.Windows1252()
+
+		pk.Wipe()
+		Expect(windows1252.RawKey()).To(BeEmpty())
+		Expect(pk.Windows1252()).To(BeNil())
+	})
+
 })
@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package keys
+
+import (
+	"io"
+	"os"
+)
+
+// openTerminal opens the controlling terminal so a prompt works even when
+// stdin or stdout have been redirected
+func openTerminal() (*os.File, io.Writer, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tty, tty, nil
+}
@@ -0,0 +1,19 @@
+//go:build windows
+// +build windows
+
+package keys
+
+import (
+	"io"
+	"os"
+)
+
+// openTerminal opens the console input buffer so a prompt works even when
+// stdin has been redirected
+func openTerminal() (*os.File, io.Writer, error) {
+	conin, err := os.OpenFile("CONIN$", os.O_RDWR, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	return conin, os.Stderr, nil
+}
@@ -0,0 +1,170 @@
+package keys
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+const (
+	//NoPasswordFd is used when no file descriptor has been supplied
+	NoPasswordFd = -1
+
+	defaultPasswordPrompt = "Password (press enter for no password): "
+)
+
+//PasswordSource describes where the master password is read from.
+//
+//At most one of None, Fd, File, Env and Command may be set, without any of
+//them the password is prompted for on the controlling terminal.
+type PasswordSource struct {
+	None    bool
+	Fd      int
+	File    string
+	Env     string
+	Command string
+	Prompt  string
+}
+
+//NewPasswordSource defaults to prompting on the terminal
+func NewPasswordSource() *PasswordSource {
+	return &PasswordSource{
+		Fd:     NoPasswordFd,
+		Prompt: defaultPasswordPrompt,
+	}
+}
+
+//Password returns the master password from the source which is set, it is an
+//error to set more than one
+func (p *PasswordSource) Password() (string, error) {
+	if sources := p.sources(); len(sources) > 1 {
+		return "", fmt.Errorf("only one password source can be given, got %s", strings.Join(sources, ", "))
+	}
+
+	switch {
+	case p.None:
+		log.Debug("password source: none")
+		return "", nil
+	case p.Fd != NoPasswordFd:
+		log.Debugf("password source: fd %d", p.Fd)
+		return passwordFromFd(p.Fd)
+	case len(p.File) > 0:
+		log.Debugf("password source: file %s", p.File)
+		return passwordFromFile(p.File)
+	case len(p.Env) > 0:
+		log.Debugf("password source: env %s", p.Env)
+		return passwordFromEnv(p.Env)
+	case len(p.Command) > 0:
+		log.Debug("password source: command")
+		return passwordFromCommand(p.Command)
+	}
+
+	log.Debug("password source: terminal prompt")
+	return passwordFromTerminal(p.Prompt)
+}
+
+// sources names each source which is set
+func (p *PasswordSource) sources() []string {
+	var sources []string
+	if p.None {
+		sources = append(sources, "no password")
+	}
+	if p.Fd != NoPasswordFd {
+		sources = append(sources, "fd")
+	}
+	if len(p.File) > 0 {
+		sources = append(sources, "file")
+	}
+	if len(p.Env) > 0 {
+		sources = append(sources, "env")
+	}
+	if len(p.Command) > 0 {
+		sources = append(sources, "command")
+	}
+	return sources
+}
+
+func passwordFromFd(fd int) (string, error) {
+	if fd < 0 {
+		return "", fmt.Errorf("invalid file descriptor: %d", fd)
+	}
+
+	f := os.NewFile(uintptr(fd), fmt.Sprintf("fd%d", fd))
+	if f == nil {
+		return "", fmt.Errorf("invalid file descriptor: %d", fd)
+	}
+	defer f.Close()
+
+	return firstLine(f)
+}
+
+func passwordFromFile(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", fmt.Errorf("unable to open password file: %s", err)
+	}
+	defer f.Close()
+
+	return firstLine(f)
+}
+
+func passwordFromEnv(name string) (string, error) {
+	password, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable not set: %s", name)
+	}
+	return password, nil
+}
+
+func passwordFromCommand(command string) (string, error) {
+	shell, flag := "sh", "-c"
+	if runtime.GOOS == "windows" {
+		shell, flag = "cmd", "/C"
+	}
+
+	var stdout bytes.Buffer
+	cmd := exec.Command(shell, flag, command)
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("password command failed: %s", err)
+	}
+
+	return firstLine(&stdout)
+}
+
+func passwordFromTerminal(prompt string) (string, error) {
+	in, out, err := openTerminal()
+	if err != nil {
+		return "", fmt.Errorf("no terminal available to prompt for a password, use a --password-* flag or --no-password: %s", err)
+	}
+	defer in.Close()
+
+	fmt.Fprint(out, prompt)
+	password, err := terminal.ReadPassword(int(in.Fd()))
+	fmt.Fprint(out, "\n")
+
+	if err != nil {
+		return "", fmt.Errorf("error reading password from terminal: %s", err)
+	}
+
+	return string(password), nil
+}
+
+// firstLine reads up to the first newline, which is not included
+func firstLine(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("password read failed: %s", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
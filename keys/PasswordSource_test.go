@@ -0,0 +1,136 @@
+package keys_test
+
+import (
+	"io/ioutil"
+	"os"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/simonhayward/gkeepassxreader/keys"
+)
+
+var _ = Describe("PasswordSource", func() {
+
+	var (
+		source *keys.PasswordSource
+	)
+
+	BeforeEach(func() {
+		source = keys.NewPasswordSource()
+	})
+
+	Context("when no password is requested", func() {
+		It("returns an empty password", func() {
+			source.None = true
+
+			password, err := source.Password()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(password).To(Equal(""))
+		})
+
+		It("returns an error when another source is given", func() {
+			source.None = true
+			source.Env = "GKEEPASSXREADER_TEST_PASSWORD"
+			os.Setenv("GKEEPASSXREADER_TEST_PASSWORD", "from env")
+			defer os.Unsetenv("GKEEPASSXREADER_TEST_PASSWORD")
+
+			_, err := source.Password()
+			Expect(err).To(MatchError("only one password source can be given, got no password, env"))
+		})
+	})
+
+	Context("when reading from an environment variable", func() {
+		It("returns the value", func() {
+			source.Env = "GKEEPASSXREADER_TEST_PASSWORD"
+			os.Setenv("GKEEPASSXREADER_TEST_PASSWORD", "from env")
+			defer os.Unsetenv("GKEEPASSXREADER_TEST_PASSWORD")
+
+			password, err := source.Password()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(password).To(Equal("from env"))
+		})
+
+		It("returns an error when the variable is not set", func() {
+			source.Env = "GKEEPASSXREADER_TEST_PASSWORD_UNSET"
+
+			_, err := source.Password()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("when reading from a file", func() {
+		It("returns the first line without the line ending", func() {
+			tmpFile, err := ioutil.TempFile("", "password")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(tmpFile.Name())
+
+			_, err = tmpFile.WriteString("from file\r\nsecond line\n")
+			Expect(err).ToNot(HaveOccurred())
+			tmpFile.Close()
+
+			source.File = tmpFile.Name()
+			password, err := source.Password()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(password).To(Equal("from file"))
+		})
+
+		It("returns an error when an environment variable is also given", func() {
+			tmpFile, err := ioutil.TempFile("", "password")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(tmpFile.Name())
+
+			_, err = tmpFile.WriteString("from file")
+			Expect(err).ToNot(HaveOccurred())
+			tmpFile.Close()
+
+			source.File = tmpFile.Name()
+			source.Env = "GKEEPASSXREADER_TEST_PASSWORD"
+			os.Setenv("GKEEPASSXREADER_TEST_PASSWORD", "from env")
+			defer os.Unsetenv("GKEEPASSXREADER_TEST_PASSWORD")
+
+			_, err = source.Password()
+			Expect(err).To(MatchError("only one password source can be given, got file, env"))
+		})
+
+		It("returns an error when the file does not exist", func() {
+			source.File = "does-not-exist"
+
+			_, err := source.Password()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("when reading from a file descriptor", func() {
+		It("returns the first line", func() {
+			r, w, err := os.Pipe()
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = w.WriteString("from fd\n")
+			Expect(err).ToNot(HaveOccurred())
+			w.Close()
+
+			source.Fd = int(r.Fd())
+			password, err := source.Password()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(password).To(Equal("from fd"))
+		})
+	})
+
+	Context("when reading from a command", func() {
+		It("returns the first line of output", func() {
+			source.Command = "echo from command; echo second line"
+
+			password, err := source.Password()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(password).To(Equal("from command"))
+		})
+
+		It("returns an error when the command fails", func() {
+			source.Command = "exit 3"
+
+			_, err := source.Password()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
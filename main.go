@@ -1,15 +1,25 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
-	"syscall"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 
+	"github.com/simonhayward/gkeepassxreader/audit"
+	"github.com/simonhayward/gkeepassxreader/diff"
 	"github.com/simonhayward/gkeepassxreader/format"
+	"github.com/simonhayward/gkeepassxreader/input"
 	"github.com/simonhayward/gkeepassxreader/keys"
 	"github.com/simonhayward/gkeepassxreader/output"
+	"github.com/simonhayward/gkeepassxreader/secure"
 	log "github.com/sirupsen/logrus"
-	"golang.org/x/crypto/ssh/terminal"
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
 )
 
@@ -18,22 +28,159 @@ const (
 )
 
 var (
-	db      = kingpin.Flag("db", "Keepassx database").Required().File()
-	keyfile = kingpin.Flag("keyfile", "Key file").Short('k').File()
-	debug   = kingpin.Flag("debug", "Enable debug mode").Short('d').Bool()
-	history = kingpin.Flag("history", "Include historical entries").Short('h').Bool()
+	db          = kingpin.Flag("db", "Keepassx database").File()
+	keyfile     = kingpin.Flag("keyfile", "Key file").Short('k').File()
+	debug       = kingpin.Flag("debug", "Enable debug mode").Short('d').Bool()
+	history     = kingpin.Flag("history", "Include historical entries").Short('h').Bool()
+	recycled    = kingpin.Flag("include-recycled", "Include entries in the recycle bin").Bool()
+	agentSocket = kingpin.Flag("agent-socket", "Agent socket path").PlaceHolder("PATH").String()
+	noAgent     = kingpin.Flag("no-agent", "Do not use a running agent").Bool()
+	strict      = kingpin.Flag("strict", "Fail when the database forces a master key change").Bool()
+
+	passwordEnv     = kingpin.Flag("password-env", "Read the password from an environment variable").PlaceHolder("VAR").String()
+	passwordFile    = kingpin.Flag("password-file", "Read the password from the first line of a file").PlaceHolder("FILE").String()
+	passwordFd      = kingpin.Flag("password-fd", "Read the password from the first line of a file descriptor").PlaceHolder("N").Default("-1").Int()
+	passwordCommand = kingpin.Flag("password-command", "Read the password from the first line of a command's output").PlaceHolder("CMD").String()
+	noPassword      = kingpin.Flag("no-password", "Open the database without a password").Bool()
+
+	challengeResponseSecret  = kingpin.Flag("challenge-response-secret", "Challenge-response HMAC-SHA1 secret file").PlaceHolder("FILE").String()
+	challengeResponseCommand = kingpin.Flag("challenge-response-command", "Challenge-response command, {challenge} is replaced by the hex challenge").PlaceHolder("CMD").String()
 
 	cmdSearch       = kingpin.Command("search", "Search for an entry")
 	searchTerm      = cmdSearch.Arg("term", "Search by title or UUID").Required().String()
 	searchChrs      = cmdSearch.Flag("chrs", "Copy selected characters from password [2,6,7..]").Short('c').String()
 	searchClipboard = cmdSearch.Flag("clipboard", "Copy to clipboard").Short('x').Bool()
 
-	cmdList = kingpin.Command("list", "List entries")
+	cmdList     = kingpin.Command("list", "List entries")
+	listSort    = cmdList.Flag("sort", "Sort by "+strings.Join(format.SortFields, ", ")+", dates newest first").Enum(format.SortFields...)
+	listColumns = cmdList.Flag("columns", "Comma separated columns, from "+strings.Join(output.Columns, ", ")).Default(strings.Join(output.DefaultColumns, ",")).String()
+	listTags    = cmdList.Flag("tag", "Only entries with the tag, !TAG for entries without it, repeatable").PlaceHolder("TAG").Strings()
+
+	cmdTags  = kingpin.Command("tags", "List tags with the number of entries using each")
+	tagsJSON = cmdTags.Flag("json", "Write the tags as JSON").Bool()
+
+	cmdAgent         = kingpin.Command("agent", "Run an agent caching transformed master keys")
+	agentIdleTimeout = cmdAgent.Flag("idle-timeout", "Wipe a cached key after this long unused").Default("15m").Duration()
+
+	cmdUnlock = kingpin.Command("unlock", "Add the database key to the agent")
+	cmdLock   = kingpin.Command("lock", "Wipe all keys held by the agent")
+	cmdStatus = kingpin.Command("status", "Show the agent status")
+
+	cmdKeyFile         = kingpin.Command("keyfile", "Key file management")
+	cmdKeyFileGenerate = cmdKeyFile.Command("generate", "Generate a new random key file")
+	keyFileFormat      = cmdKeyFileGenerate.Flag("format", "Key file format").Default(keys.KeyFileFormatV2).Enum(keys.KeyFileFormats...)
+	keyFileOutput      = cmdKeyFileGenerate.Arg("file", "Key file to create").Required().String()
+
+	cmdExport       = kingpin.Command("export", "Export the decrypted database")
+	exportFormat    = cmdExport.Flag("format", "Export format").Default(output.ExportFormatXML).Enum(output.ExportFormats...)
+	exportPlaintext = cmdExport.Flag("i-understand-plaintext", "Acknowledge that the export is written unencrypted").Bool()
+	exportOutput    = cmdExport.Arg("file", "File to write, created with mode 0600").Required().String()
+
+	cmdImport     = kingpin.Command("import", "Import entries from another password manager")
+	importFormat  = cmdImport.Flag("format", "Import format").Default(input.ImportFormatCSV).Enum(input.ImportFormats...)
+	importMapping = cmdImport.Flag("map", "CSV column for a field, FIELD=COLUMN, fields are "+strings.Join(input.MappingFields, ", ")).PlaceHolder("FIELD=COLUMN").StringMap()
+	importGroup   = cmdImport.Flag("group", "Group to import into, relative to the root group").PlaceHolder("PATH").String()
+	importDryRun  = cmdImport.Flag("dry-run", "Show what would be imported without changing the database").Bool()
+	importFile    = cmdImport.Arg("file", "File to import").Required().ExistingFile()
+
+	cmdDiff          = kingpin.Command("diff", "Compare two databases, groups and entries are matched by UUID")
+	diffA            = cmdDiff.Arg("a", "First database, opened with the global credentials").Required().File()
+	diffB            = cmdDiff.Arg("b", "Second database, opened with the --b-* credentials or those of the first").File()
+	diffSecrets      = cmdDiff.Flag("secrets", "Show secrets masked, as a hash or revealed").Default(diff.SecretsMask).Enum(diff.SecretModes...)
+	diffJSON         = cmdDiff.Flag("json", "Write the changes as JSON").Bool()
+	diffTextconv     = cmdDiff.Flag("textconv", "Write a plain text listing of the first database, for use as a git textconv filter").Bool()
+	diffBCredentials = newCredentials(cmdDiff, "b", "second database")
+
+	cmdMerge               = kingpin.Command("merge", "Synchronise a source database into a target database")
+	mergeInto              = cmdMerge.Flag("into", "Target database, opened with the global credentials").Required().File()
+	mergeSource            = cmdMerge.Arg("source", "Source database, opened with the --source-* credentials or those of the target").Required().File()
+	mergeSourceCredentials = newCredentials(cmdMerge, "source", "source database")
+	mergeDryRun            = cmdMerge.Flag("dry-run", "Show the changes without writing the target").Bool()
+
+	cmdExpiring    = kingpin.Command("expiring", "List entries which have expired or expire soon")
+	expiringWithin = cmdExpiring.Flag("within", "Include entries expiring within this many days (30d), weeks (2w) or a duration").Default("0d").String()
+	expiringJSON   = cmdExpiring.Flag("json", "Write the entries as JSON").Bool()
+
+	cmdStale       = kingpin.Command("stale", "List entries whose password has not changed for a while")
+	staleOlderThan = cmdStale.Flag("older-than", "Include passwords unchanged for longer than this many days (365d), weeks (52w) or a duration").Default("365d").String()
+	staleJSON      = cmdStale.Flag("json", "Write the entries as JSON").Bool()
+
+	cmdAudit         = kingpin.Command("audit", "Check passwords for reuse and weakness, passwords are never shown")
+	auditMinLength   = cmdAudit.Flag("min-length", "Passwords with fewer characters are short").Default(strconv.Itoa(audit.DefaultOptions.MinLength)).Int()
+	auditMinScore    = cmdAudit.Flag("min-score", "Passwords with a lower strength score, 0 to 4, are weak").Default(strconv.Itoa(audit.DefaultOptions.MinScore)).Int()
+	auditMaxDistance = cmdAudit.Flag("max-distance", "Passwords this many edits or fewer apart are similar, 0 disables the check").Default(strconv.Itoa(audit.DefaultOptions.MaxDistance)).Int()
+	auditBreached    = cmdAudit.Flag("breached-file", "Pwned Passwords SHA-1 or NTLM file ordered by hash, or a directory of range files").PlaceHolder("PATH").ExistingFileOrDir()
+	auditJSON        = cmdAudit.Flag("json", "Write the summary and findings as JSON").Bool()
+
+	cmdGenerate       = kingpin.Command("generate", "Generate a password or passphrase")
+	generateFlags     = newGeneratorFlags(cmdGenerate, "")
+	generateClipboard = cmdGenerate.Flag("clipboard", "Copy to clipboard").Short('x').Bool()
+
+	cmdAdd          = kingpin.Command("add", "Add an entry")
+	addTitle        = cmdAdd.Arg("title", "Entry title").Required().String()
+	addGroup        = cmdAdd.Flag("group", "Group to add to, relative to the root group").PlaceHolder("PATH").String()
+	addUsername     = optionalFlag(cmdAdd.Flag("username", "User name"))
+	addURL          = optionalFlag(cmdAdd.Flag("url", "URL"))
+	addNotes        = optionalFlag(cmdAdd.Flag("notes", "Notes"))
+	addTags         = cmdAdd.Flag("tag", "Tag, repeatable").PlaceHolder("TAG").Strings()
+	addGenerate     = cmdAdd.Flag("generate", "Generate the password instead of prompting for it").Bool()
+	addGenerateWith = newGeneratorFlags(cmdAdd, "generate-")
+	addClipboard    = cmdAdd.Flag("clipboard", "Copy a generated password to clipboard").Short('x').Bool()
+
+	cmdEdit          = kingpin.Command("edit", "Edit an entry, the previous version is kept in history")
+	editTerm         = cmdEdit.Arg("term", "Search by title or UUID").Required().String()
+	editTitle        = optionalFlag(cmdEdit.Flag("title", "New title"))
+	editUsername     = optionalFlag(cmdEdit.Flag("username", "New user name"))
+	editURL          = optionalFlag(cmdEdit.Flag("url", "New URL"))
+	editNotes        = optionalFlag(cmdEdit.Flag("notes", "New notes"))
+	editTags         = cmdEdit.Flag("tag", "Add a tag, repeatable").PlaceHolder("TAG").Strings()
+	editUntags       = cmdEdit.Flag("untag", "Remove a tag, repeatable").PlaceHolder("TAG").Strings()
+	editPassword     = cmdEdit.Flag("password", "Prompt for a new password").Bool()
+	editGenerate     = cmdEdit.Flag("generate", "Generate a new password").Bool()
+	editGenerateWith = newGeneratorFlags(cmdEdit, "generate-")
+	editClipboard    = cmdEdit.Flag("clipboard", "Copy a generated password to clipboard").Short('x').Bool()
+
+	cmdHistory     = kingpin.Command("history", "Show every revision of an entry and the fields changed")
+	historyTerm    = cmdHistory.Arg("term", "Search by title or UUID").Required().String()
+	historySecrets = cmdHistory.Flag("secrets", "Show secrets masked, as a hash or revealed").Default(diff.SecretsMask).Enum(diff.SecretModes...)
+	historyJSON    = cmdHistory.Flag("json", "Write the revisions as JSON").Bool()
+
+	cmdShow       = kingpin.Command("show", "Show an entry or one of its previous revisions")
+	showTerm      = cmdShow.Arg("term", "Search by title or UUID").Required().String()
+	showRevision  = cmdShow.Flag("revision", "Revision to show, 0 is current, 1 the version before and so on").Short('r').Default("0").Int()
+	showChrs      = cmdShow.Flag("chrs", "Copy selected characters from password [2,6,7..]").Short('c').String()
+	showClipboard = cmdShow.Flag("clipboard", "Copy to clipboard").Short('x').Bool()
+
+	cmdInfo  = kingpin.Command("info", "Show the database format, encryption settings, metadata and counts")
+	infoJSON = cmdInfo.Flag("json", "Write the information as JSON").Bool()
+
+	cmdPasswd = kingpin.Command("passwd", "Change the master key, new master and transform seeds are generated")
+	passwdNew = newCredentials(cmdPasswd, "new", "new master key")
+
+	cmdKdf         = kingpin.Command("kdf", "Key derivation settings")
+	cmdKdfBench    = cmdKdf.Command("bench", "Time the key transform on this machine and suggest rounds")
+	kdfBenchTarget = cmdKdfBench.Flag("target", "Unlock time to suggest rounds for").Default("1s").Duration()
+	cmdKdfSet      = cmdKdf.Command("set", "Change the transform rounds, a new transform seed is generated")
+	kdfSetRounds   = cmdKdfSet.Flag("rounds", "Transform rounds").Uint64()
+	kdfSetTarget   = cmdKdfSet.Flag("target", "Choose the rounds which take this long on this machine").Duration()
+
+	cmdRemove  = kingpin.Command("rm", "Move an entry to the recycle bin, an entry already there is deleted")
+	removeTerm = cmdRemove.Arg("term", "Search by title or UUID").Required().String()
+
+	cmdPurge = kingpin.Command("purge", "Delete everything in the recycle bin")
+
+	cmdVerify  = kingpin.Command("verify", "Check every block of the payload, the header hash and the xml")
+	verifyJSON = cmdVerify.Flag("json", "Write the report as JSON").Bool()
+
+	cmdRecover    = kingpin.Command("recover", "Salvage the entries of a damaged database into a new database")
+	recoverOutput = cmdRecover.Arg("output", "New database, written with the same master key").Required().String()
+	recoverJSON   = cmdRecover.Flag("json", "Write the report as JSON").Bool()
 )
 
 func main() {
 	kingpin.Version(version)
-	kingpin.Parse()
+	kingpin.CommandLine.Terminate(exit)
+	command := kingpin.Parse()
 
 	level := log.InfoLevel
 	if *debug == true {
@@ -42,79 +189,466 @@ func main() {
 	log.SetLevel(level)
 	log.SetOutput(os.Stdout)
 
-	var entryService format.EntryService
-	var password string
+	log.RegisterExitHandler(closeReaders)
 
-	if terminal.IsTerminal(int(os.Stdout.Fd())) {
-		fmt.Fprint(os.Stderr, "Password (press enter for no password): ")
-		stdinPassword, err := terminal.ReadPassword(int(syscall.Stdin))
-		fmt.Fprint(os.Stderr, "\n")
+	if err := secure.DisableCoreDumps(); err != nil {
+		log.Warnf("unable to disable core dumps: %s", err)
+	}
 
+	switch command {
+	case cmdSearch.FullCommand():
+		reader := openDatabase()
+		defer reader.Close()
+		search(reader)
+	case cmdList.FullCommand():
+		reader := openDatabase()
+		defer reader.Close()
+		list(reader)
+	case cmdTags.FullCommand():
+		reader := openDatabase()
+		defer reader.Close()
+		tags(reader, *tagsJSON)
+	case cmdAgent.FullCommand():
+		runAgent(*agentIdleTimeout)
+	case cmdUnlock.FullCommand():
+		unlock()
+	case cmdLock.FullCommand():
+		lock()
+	case cmdStatus.FullCommand():
+		status()
+	case cmdKeyFileGenerate.FullCommand():
+		generateKeyFile(*keyFileOutput, *keyFileFormat)
+	case cmdExport.FullCommand():
+		if !*exportPlaintext {
+			kingpin.Fatalf("the export is written unencrypted, pass --i-understand-plaintext to continue")
+		}
+		reader := openDatabase()
+		defer reader.Close()
+		export(reader, *exportOutput, *exportFormat)
+	case cmdImport.FullCommand():
+		reader := openDatabase()
+		defer reader.Close()
+		importEntries(reader, *importFile, *importFormat, *importMapping, *importGroup, *importDryRun)
+	case cmdDiff.FullCommand():
+		if *diffTextconv {
+			textconv(*diffA, *diffSecrets)
+		} else {
+			if *diffB == nil {
+				kingpin.Fatalf("a second database is required unless --textconv is given")
+			}
+			diffDatabases(*diffA, *diffB, *diffSecrets, *diffJSON)
+		}
+	case cmdMerge.FullCommand():
+		merge(*mergeInto, *mergeSource, *mergeDryRun)
+	case cmdExpiring.FullCommand():
+		reader := openDatabase()
+		defer reader.Close()
+		expiring(reader, *expiringWithin, *expiringJSON)
+	case cmdStale.FullCommand():
+		reader := openDatabase()
+		defer reader.Close()
+		stale(reader, *staleOlderThan, *staleJSON)
+	case cmdAudit.FullCommand():
+		reader := openDatabase()
+		defer reader.Close()
+		auditDatabase(reader, audit.Options{MinLength: *auditMinLength, MinScore: *auditMinScore, MaxDistance: *auditMaxDistance}, *auditBreached, *auditJSON)
+	case cmdGenerate.FullCommand():
+		generatePassword(generateFlags, *generateClipboard)
+	case cmdAdd.FullCommand():
+		reader := openDatabase()
+		defer reader.Close()
+		addEntry(reader, *addTitle, *addGroup, addUsername, addURL, addNotes, *addTags, *addGenerate, addGenerateWith, *addClipboard)
+	case cmdEdit.FullCommand():
+		reader := openDatabase()
+		defer reader.Close()
+		editEntry(reader, *editTerm, editTitle, editUsername, editURL, editNotes, *editTags, *editUntags, *editPassword, *editGenerate, editGenerateWith, *editClipboard)
+	case cmdHistory.FullCommand():
+		reader := openDatabase()
+		defer reader.Close()
+		entryHistory(reader, *historyTerm, *historySecrets, *historyJSON)
+	case cmdShow.FullCommand():
+		reader := openDatabase()
+		defer reader.Close()
+		showRevisionOf(reader, *showTerm, *showRevision, *showChrs, *showClipboard)
+	case cmdInfo.FullCommand():
+		reader := openDatabase()
+		defer reader.Close()
+		info(reader, *infoJSON)
+	case cmdPasswd.FullCommand():
+		if *db == nil {
+			kingpin.Fatalf("required flag --db not provided")
+		}
+		// a forced change must not prevent the change itself
+		reader := openDatabaseFile(*db, masterKey)
+		defer reader.Close()
+		passwd(reader, passwdNew)
+	case cmdKdfBench.FullCommand():
+		kdfBench(*kdfBenchTarget)
+	case cmdKdfSet.FullCommand():
+		if (*kdfSetRounds == 0) == (*kdfSetTarget == 0) {
+			kingpin.Fatalf("one of --rounds or --target is required")
+		}
+		if *db == nil {
+			kingpin.Fatalf("required flag --db not provided")
+		}
+		key := sharedKey(masterKey)
+		reader := openDatabaseFile(*db, key)
+		defer reader.Close()
+		kdfSet(reader, key, *kdfSetRounds, *kdfSetTarget)
+	case cmdRemove.FullCommand():
+		reader := openDatabase()
+		defer reader.Close()
+		removeEntry(reader, *removeTerm)
+	case cmdPurge.FullCommand():
+		reader := openDatabase()
+		defer reader.Close()
+		purge(reader)
+	case cmdVerify.FullCommand():
+		if *db == nil {
+			kingpin.Fatalf("required flag --db not provided")
+		}
+		verify(*db, *verifyJSON)
+	case cmdRecover.FullCommand():
+		if *db == nil {
+			kingpin.Fatalf("required flag --db not provided")
+		}
+		recoverDatabase(*db, *recoverOutput, *recoverJSON)
+	}
+}
+
+// openReaders are closed, wiping their key material, when a fatal error exits
+// the process as deferred calls don't run then
+var openReaders struct {
+	sync.Mutex
+	readers []*format.KeePass2Reader
+}
+
+// closeOnExit closes reader should the process exit through log.Fatal,
+// kingpin.Fatalf or exit
+func closeOnExit(reader *format.KeePass2Reader) {
+	openReaders.Lock()
+	defer openReaders.Unlock()
+	openReaders.readers = append(openReaders.readers, reader)
+}
+
+func closeReaders() {
+	openReaders.Lock()
+	defer openReaders.Unlock()
+	for _, reader := range openReaders.readers {
+		reader.Close()
+	}
+	openReaders.readers = nil
+}
+
+// exit closes the open readers before exiting with code
+func exit(code int) {
+	closeReaders()
+	os.Exit(code)
+}
+
+// interruptContext is cancelled by Ctrl-C, so a long key transform stops
+// promptly and wipes its key material instead of the process being killed
+func interruptContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt)
+}
+
+func passwordSource() *keys.PasswordSource {
+	source := keys.NewPasswordSource()
+	source.None = *noPassword
+	source.Fd = *passwordFd
+	source.File = *passwordFile
+	source.Env = *passwordEnv
+	source.Command = *passwordCommand
+	return source
+}
+
+func masterKey() *keys.CompositeKey {
+	password, err := passwordSource().Password()
+	if err != nil {
+		log.Fatalf("password error: %s", err)
+	}
+	key, err := keys.NewMasterKey(password, *keyfile)
+	if err != nil {
+		log.Fatalf("master key error: %s", err)
+	}
+	addChallengeResponseKeys(key)
+	return key
+}
+
+// credentials of a database other than --db, given by flags with a prefix
+type credentials struct {
+	keyfile         **os.File
+	passwordEnv     *string
+	passwordFile    *string
+	passwordCommand *string
+	noPassword      *bool
+}
+
+func newCredentials(cmd *kingpin.CmdClause, prefix, database string) *credentials {
+	return &credentials{
+		keyfile:         cmd.Flag(prefix+"-keyfile", "Key file of the "+database).PlaceHolder("FILE").File(),
+		passwordEnv:     cmd.Flag(prefix+"-password-env", "Read the password of the "+database+" from an environment variable").PlaceHolder("VAR").String(),
+		passwordFile:    cmd.Flag(prefix+"-password-file", "Read the password of the "+database+" from the first line of a file").PlaceHolder("FILE").String(),
+		passwordCommand: cmd.Flag(prefix+"-password-command", "Read the password of the "+database+" from the first line of a command's output").PlaceHolder("CMD").String(),
+		noPassword:      cmd.Flag(prefix+"-no-password", "Open the "+database+" without a password").Bool(),
+	}
+}
+
+// key returns the master key of the named database, fallback is used when
+// none of the credential flags were given
+func (c *credentials) key(name string, fallback func() *keys.CompositeKey) func() *keys.CompositeKey {
+	if *c.keyfile == nil && !*c.noPassword && len(*c.passwordEnv) == 0 &&
+		len(*c.passwordFile) == 0 && len(*c.passwordCommand) == 0 {
+		return fallback
+	}
+
+	return func() *keys.CompositeKey {
+		source := keys.NewPasswordSource()
+		source.None = *c.noPassword
+		source.File = *c.passwordFile
+		source.Env = *c.passwordEnv
+		source.Command = *c.passwordCommand
+		source.Prompt = "Password for " + name + " (press enter for no password): "
+
+		password, err := source.Password()
 		if err != nil {
-			log.Fatalf("error reading password from stdin: %s\n", err)
+			log.Fatalf("password error: %s", err)
 		}
+		key, err := keys.NewMasterKey(password, *c.keyfile)
+		if err != nil {
+			log.Fatalf("master key error: %s", err)
+		}
+		// challenge-response components are shared with the first database
+		addChallengeResponseKeys(key)
+		return key
+	}
+}
 
-		password = string(stdinPassword)
+// sharedKey reads the master key once, it is reused by later calls
+func sharedKey(masterKey func() *keys.CompositeKey) func() *keys.CompositeKey {
+	var key *keys.CompositeKey
+	return func() *keys.CompositeKey {
+		if key == nil {
+			key = masterKey()
+		}
+		return key
+	}
+}
+
+func addChallengeResponseKeys(key *keys.CompositeKey) {
+	if len(*challengeResponseSecret) > 0 {
+		crKey, err := keys.NewHmacSha1KeyFromFile(*challengeResponseSecret)
+		if err != nil {
+			log.Fatalf("challenge-response error: %s", err)
+		}
+		key.AddChallengeResponseKey(crKey)
 	}
 
-	reader, err := format.OpenDatabase(keys.MasterKey(password, *keyfile), *db)
+	if len(*challengeResponseCommand) > 0 {
+		key.AddChallengeResponseKey(&keys.CommandKey{Command: *challengeResponseCommand})
+	}
+}
+
+func openDatabase() *format.KeePass2Reader {
+	if *db == nil {
+		kingpin.Fatalf("required flag --db not provided")
+	}
+	reader := openDatabaseFile(*db, masterKey)
+	checkMasterKey(reader)
+	return reader
+}
+
+// openDatabaseFile uses a key cached by the agent when available,
+// otherwise the master key is read and transformed
+func openDatabaseFile(f *os.File, masterKey func() *keys.CompositeKey) *format.KeePass2Reader {
+	return unlockDatabaseFile(f, masterKey, func(ctx context.Context, reader *format.KeePass2Reader, key *keys.CompositeKey, progress format.ProgressFunc) error {
+		return reader.ReadPayloadContext(ctx, f, key, progress)
+	})
+}
+
+// unlockDatabaseFile reads the header and transforms the key as
+// openDatabaseFile does, the payload is then left to read
+func unlockDatabaseFile(f *os.File, masterKey func() *keys.CompositeKey, read func(ctx context.Context, reader *format.KeePass2Reader, key *keys.CompositeKey, progress format.ProgressFunc) error) *format.KeePass2Reader {
+	reader := format.NewKeePass2Reader()
+	closeOnExit(reader)
+	if err := reader.ReadHeader(f); err != nil {
+		log.Fatalf("open database error: %s", err)
+	}
+
+	var compositeKey *keys.CompositeKey
+	cached := agentKey(reader.Db)
+	if cached != nil {
+		if err := reader.Db.SetTransformedMasterKey(cached); err != nil {
+			log.Fatalf("open database error: %s", err)
+		}
+		// challenge-response components depend on the master seed so can't be cached
+		compositeKey = keys.NewCompositeKey()
+		addChallengeResponseKeys(compositeKey)
+		reader.Db.Key = compositeKey
+	} else {
+		compositeKey = masterKey()
+	}
+
+	// created after the password prompt so Ctrl-C there isn't swallowed
+	ctx, stop := interruptContext()
+	defer stop()
+	progress, clearProgress := newProgress()
+
+	var err error
+	if cached == nil {
+		err = reader.TransformKey(ctx, compositeKey, progress)
+	}
+	if err == nil {
+		err = read(ctx, reader, compositeKey, progress)
+	}
+	clearProgress()
+
+	if errors.Is(err, context.Canceled) {
+		log.Fatal("open database interrupted")
+	}
 	if err != nil {
 		log.Fatalf("open database error: %s", err)
 	}
 
-	entryService = &format.EntryServiceOp{
+	return reader
+}
+
+// saveDatabase replaces the database file, the new file is written alongside
+// and renamed over the original so a failed write leaves it intact
+func saveDatabase(name string, reader *format.KeePass2Reader, xmlFile *format.KeePass2XmlFile) {
+	fi, err := os.Stat(name)
+	if err != nil {
+		log.Fatalf("save database error: %s", err)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(name), filepath.Base(name)+".tmp")
+	if err != nil {
+		log.Fatalf("save database error: %s", err)
+	}
+
+	if err := format.NewKeePass2Writer(reader.Db).WriteDatabase(tmp, xmlFile); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		log.Fatalf("save database error: %s", err)
+	}
+
+	if err := tmp.Chmod(fi.Mode().Perm()); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		log.Fatalf("save database error: %s", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		log.Fatalf("save database error: %s", err)
+	}
+
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		os.Remove(tmp.Name())
+		log.Fatalf("save database error: %s", err)
+	}
+}
+
+func entryService(reader *format.KeePass2Reader) format.EntryService {
+	return &format.EntryServiceOp{
 		XMLReader:         reader.XMLReader,
 		HistoricalEntries: *history,
+		RecycledEntries:   *recycled,
 	}
+}
 
-	switch kingpin.Parse() {
-	case cmdSearch.FullCommand():
-		entry, err := entryService.SearchByTerm(*searchTerm)
+func search(reader *format.KeePass2Reader) {
+	entry, err := entryService(reader).SearchByTerm(*searchTerm)
+	if err != nil {
+		log.Fatalf("search database error: %s", err)
+	}
+
+	if entry == nil {
+		log.Fatalf("Search term: '%s' not found\n", *searchTerm)
+	}
+
+	showEntry(entry, *searchChrs, *searchClipboard)
+}
+
+// showEntry writes the entry with its password, or the selected characters
+// of it, unless the password is copied to the clipboard
+func showEntry(entry *format.Entry, chrs string, clipboard bool) {
+	fields := output.NewDefaults()
+	fields.Entries([]format.Entry{*entry})
+
+	// Extract characters from password
+	if len(chrs) > 0 {
+		err := output.Extract(entry, chrs)
 		if err != nil {
-			log.Fatalf("search database error: %s", err)
+			log.Fatalf("unable to extract characters: %s", err)
 		}
+	}
 
-		if entry == nil {
-			log.Fatalf("Search term: '%s' not found\n", *searchTerm)
-		} else {
-			fields := output.NewDefaults()
-			fields.Entries([]format.Entry{*entry})
-
-			// Extract characters from password
-			if len(*searchChrs) > 0 {
-				err := output.Extract(entry, *searchChrs)
-				if err != nil {
-					log.Fatalf("unable to extract characters: %s", err)
-				}
-			}
+	// Copy password to clipboard
+	if clipboard {
+		copyToClipboard(entry.Password.String())
+		fmt.Println("password copied to clipboard")
+	} else {
+		fields.Data[0] = append(fields.Data[0], entry.Password.String())
+		fields.Header = append(fields.Header, "Password")
+	}
 
-			// Copy password to clipboard
-			if *searchClipboard {
-				cp := output.GetClipboard()
-				if cp == nil {
-					log.Fatalf("unable to identify os to copy to clipboard")
-				}
-
-				if err := cp.CopyProcess(entry.Password.PlainText); err != nil {
-					log.Fatalf("unable to copy password to clipboard: %s", err)
-				}
-
-				fmt.Println("password copied to clipboard")
-			} else {
-				fields.Data[0] = append(fields.Data[0], entry.Password.PlainText)
-				fields.Header = append(fields.Header, "Password")
-			}
+	output.Table(fields.Header, fields.Data)
+}
 
-			output.Table(fields.Header, fields.Data)
-		}
-	case cmdList.FullCommand():
-		allEntries, err := entryService.List()
-		if err != nil {
+func copyToClipboard(password string) {
+	cp := output.GetClipboard()
+	if cp == nil {
+		log.Fatalf("unable to identify os to copy to clipboard")
+	}
+
+	if err := cp.CopyProcess(password); err != nil {
+		log.Fatalf("unable to copy password to clipboard: %s", err)
+	}
+}
+
+func list(reader *format.KeePass2Reader) {
+	allEntries, err := entryService(reader).List()
+	if err != nil {
+		log.Fatalf("list database error: %s", err)
+	}
+
+	if len(*listTags) > 0 {
+		allEntries = format.FilterByTags(allEntries, *listTags)
+	}
+
+	if len(*listSort) > 0 {
+		if err := format.SortEntries(allEntries, *listSort); err != nil {
 			log.Fatalf("list database error: %s", err)
 		}
+	}
+
+	fields, err := output.NewColumns(strings.Split(*listColumns, ","))
+	if err != nil {
+		kingpin.Fatalf("%s", err)
+	}
+	fields.Entries(allEntries)
+	output.Table(fields.Header, fields.Data)
+}
+
+func tags(reader *format.KeePass2Reader, asJSON bool) {
+	entries, err := entryService(reader).List()
+	if err != nil {
+		log.Fatalf("list database error: %s", err)
+	}
+
+	counts := format.CountTags(entries)
+	if asJSON {
+		if counts == nil {
+			counts = []format.TagCount{}
+		}
+		writeJSON(counts)
+		return
+	}
 
-		fields := output.NewDefaults()
-		fields.Entries(allEntries)
-		output.Table(fields.Header, fields.Data)
+	data := &output.Data{Header: []string{"Tag", "Entries"}}
+	for _, c := range counts {
+		data.Data = append(data.Data, []string{c.Tag, strconv.Itoa(c.Count)})
 	}
+	output.Table(data.Header, data.Data)
 }
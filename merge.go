@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/simonhayward/gkeepassxreader/output"
+	log "github.com/sirupsen/logrus"
+)
+
+func merge(target, source *os.File, dryRun bool) {
+	targetKey := sharedKey(masterKey)
+	targetReader := openDatabaseFile(target, targetKey)
+	defer targetReader.Close()
+
+	// the source shares the target's key unless its own is given
+	sourceReader := openDatabaseFile(source, mergeSourceCredentials.key(source.Name(), targetKey))
+	defer sourceReader.Close()
+
+	targetFile, err := targetReader.XMLReader.Decrypted()
+	if err != nil {
+		log.Fatalf("decrypt database error: %s: %s", target.Name(), err)
+	}
+	sourceFile, err := sourceReader.XMLReader.Decrypted()
+	if err != nil {
+		log.Fatalf("decrypt database error: %s: %s", source.Name(), err)
+	}
+
+	changes, err := targetFile.Merge(sourceFile)
+	if err != nil {
+		log.Fatalf("merge error: %s", err)
+	}
+
+	if len(changes) == 0 {
+		fmt.Println("nothing to merge")
+		return
+	}
+
+	fields := &output.Data{Header: []string{"Action", "Kind", "Group", "Title", "Conflict"}}
+	conflicts := 0
+	for _, c := range changes {
+		var conflict string
+		if c.Conflict {
+			conflict = "yes"
+			conflicts++
+		}
+		fields.Data = append(fields.Data, []string{c.Action, c.Kind, strings.Join(c.Path, "/"), c.Title, conflict})
+	}
+	output.Table(fields.Header, fields.Data)
+
+	if dryRun {
+		fmt.Printf("dry run: %d changes would be merged, %d conflicts\n", len(changes), conflicts)
+		return
+	}
+
+	saveDatabase(target.Name(), targetReader, targetFile)
+	fmt.Printf("%d changes merged into %s, %d conflicts\n", len(changes), target.Name(), conflicts)
+}
+
@@ -0,0 +1,245 @@
+package output
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/simonhayward/gkeepassxreader/format"
+)
+
+const (
+	//ExportFormatXML unencrypted KeePass 2 xml
+	ExportFormatXML = "xml"
+	//ExportFormatKeePassXCCSV KeePassXC csv
+	ExportFormatKeePassXCCSV = "keepassxc-csv"
+	//ExportFormatBitwarden Bitwarden unencrypted json
+	ExportFormatBitwarden = "bitwarden"
+	//ExportFormat1PasswordCSV 1Password csv
+	ExportFormat1PasswordCSV = "1password-csv"
+)
+
+//ExportFormats supported by Export
+var ExportFormats = []string{ExportFormatXML, ExportFormatKeePassXCCSV, ExportFormatBitwarden, ExportFormat1PasswordCSV}
+
+var (
+	keePassXCCSVHeader = []string{"Group", "Title", "Username", "Password", "URL", "Notes", "TOTP"}
+	onePasswordHeader  = []string{"Title", "Url", "Username", "Password", "OTPAuth", "Favorite", "Archived", "Tags", "Notes"}
+)
+
+//Export writes the decrypted database in the given format, history is only
+//included in the xml format
+func Export(w io.Writer, xmlReader *format.KeePass2XmlReader, exportFormat string) error {
+	if exportFormat == ExportFormatXML {
+		f, err := xmlReader.Decrypted()
+		if err != nil {
+			return errors.Wrap(err, "decrypt failed")
+		}
+		return f.WriteXML(w)
+	}
+
+	entryService := &format.EntryServiceOp{XMLReader: xmlReader}
+	entries, err := entryService.List()
+	if err != nil {
+		return errors.Wrap(err, "list entries failed")
+	}
+	if err := entryService.Decode(entries); err != nil {
+		return errors.Wrap(err, "decode entries failed")
+	}
+
+	switch exportFormat {
+	case ExportFormatKeePassXCCSV:
+		return exportKeePassXCCSV(w, entries)
+	case ExportFormatBitwarden:
+		return exportBitwarden(w, entries)
+	case ExportFormat1PasswordCSV:
+		return export1PasswordCSV(w, entries)
+	}
+	return errors.Errorf("unknown export format: %s", exportFormat)
+}
+
+func exportKeePassXCCSV(w io.Writer, entries []format.Entry) error {
+	cw := csv.NewWriter(w)
+	cw.Write(keePassXCCSVHeader)
+	for _, e := range entries {
+		cw.Write([]string{
+			strings.Join(e.Path, "/"),
+			e.Title.String(),
+			e.Username.String(),
+			e.Password.String(),
+			e.URL.String(),
+			e.Notes.String(),
+			TOTP(&e),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func export1PasswordCSV(w io.Writer, entries []format.Entry) error {
+	cw := csv.NewWriter(w)
+	cw.Write(onePasswordHeader)
+	for _, e := range entries {
+		cw.Write([]string{
+			e.Title.String(),
+			e.URL.String(),
+			e.Username.String(),
+			e.Password.String(),
+			TOTP(&e),
+			"false",
+			"false",
+			strings.Join(e.Tags, ","),
+			e.Notes.String(),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+type bitwardenFolder struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type bitwardenField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	Type  int    `json:"type"`
+}
+
+type bitwardenURI struct {
+	Match *int   `json:"match"`
+	URI   string `json:"uri"`
+}
+
+type bitwardenLogin struct {
+	URIs     []bitwardenURI `json:"uris,omitempty"`
+	Username string         `json:"username"`
+	Password string         `json:"password"`
+	TOTP     string         `json:"totp"`
+}
+
+type bitwardenItem struct {
+	ID       string           `json:"id"`
+	FolderID *string          `json:"folderId"`
+	Type     int              `json:"type"`
+	Name     string           `json:"name"`
+	Notes    string           `json:"notes"`
+	Favorite bool             `json:"favorite"`
+	Fields   []bitwardenField `json:"fields,omitempty"`
+	Login    bitwardenLogin   `json:"login"`
+}
+
+type bitwardenExport struct {
+	Encrypted bool              `json:"encrypted"`
+	Folders   []bitwardenFolder `json:"folders"`
+	Items     []bitwardenItem   `json:"items"`
+}
+
+const (
+	bitwardenItemLogin   = 1
+	bitwardenFieldText   = 0
+	bitwardenFieldHidden = 1
+)
+
+func exportBitwarden(w io.Writer, entries []format.Entry) error {
+	export := bitwardenExport{
+		Folders: []bitwardenFolder{},
+		Items:   []bitwardenItem{},
+	}
+	folders := make(map[string]bool)
+
+	for _, e := range entries {
+		item := bitwardenItem{
+			ID:    FormatUUID(e.UUID),
+			Type:  bitwardenItemLogin,
+			Name:  e.Title.String(),
+			Notes: e.Notes.String(),
+			Login: bitwardenLogin{
+				Username: e.Username.String(),
+				Password: e.Password.String(),
+				TOTP:     TOTP(&e),
+			},
+		}
+
+		// the root group is not a folder
+		if len(e.Path) > 1 {
+			folderID := FormatUUID(e.GroupUUID)
+			if !folders[folderID] {
+				folders[folderID] = true
+				export.Folders = append(export.Folders, bitwardenFolder{ID: folderID, Name: strings.Join(e.Path[1:], "/")})
+			}
+			item.FolderID = &folderID
+		}
+
+		if u := e.URL.String(); len(u) > 0 {
+			item.Login.URIs = []bitwardenURI{{URI: u}}
+		}
+
+		for _, f := range e.Fields {
+			if isTOTPField(f.Key) {
+				continue
+			}
+			fieldType := bitwardenFieldText
+			if f.Value.Protected {
+				fieldType = bitwardenFieldHidden
+			}
+			item.Fields = append(item.Fields, bitwardenField{Name: f.Key, Value: f.Value.String(), Type: fieldType})
+		}
+
+		export.Items = append(export.Items, item)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(export)
+}
+
+//TOTP returns the entry's TOTP as an otpauth URI, legacy KeePassXC seeds are
+//converted
+func TOTP(e *format.Entry) string {
+	if otp := e.Field(format.OTPField); otp != nil && len(otp.String()) > 0 {
+		return otp.String()
+	}
+
+	seed := e.Field(format.TOTPSeedField)
+	if seed == nil || len(seed.String()) == 0 {
+		return ""
+	}
+
+	params := url.Values{}
+	params.Set("secret", strings.ToUpper(strings.Replace(seed.String(), " ", "", -1)))
+	if settings := e.Field(format.TOTPSettingsField); settings != nil {
+		// period;digits
+		parts := strings.Split(settings.String(), ";")
+		if len(parts) == 2 {
+			params.Set("period", parts[0])
+			params.Set("digits", parts[1])
+		}
+	}
+
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + e.Title.String(),
+		RawQuery: params.Encode(),
+	}
+	return u.String()
+}
+
+func isTOTPField(key string) bool {
+	return key == format.OTPField || key == format.TOTPSeedField || key == format.TOTPSettingsField
+}
+
+//FormatUUID formats a hex UUID as 8-4-4-4-12
+func FormatUUID(uuid string) string {
+	if len(uuid) != 32 {
+		return uuid
+	}
+	return fmt.Sprintf("%s-%s-%s-%s-%s", uuid[0:8], uuid[8:12], uuid[12:16], uuid[16:20], uuid[20:32])
+}
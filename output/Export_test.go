@@ -0,0 +1,136 @@
+package output_test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/simonhayward/gkeepassxreader/format"
+	"github.com/simonhayward/gkeepassxreader/keys"
+	"github.com/simonhayward/gkeepassxreader/output"
+)
+
+var _ = Describe("Export", func() {
+
+	var (
+		reader *format.KeePass2Reader
+		buf    *bytes.Buffer
+	)
+
+	BeforeEach(func() {
+		db, err := os.Open("../format/test_data/ProtectedStrings.kdbx")
+		Expect(err).ToNot(HaveOccurred())
+		defer db.Close()
+
+		reader, err = format.OpenDatabase(keys.MasterKey("masterpw", nil), db)
+		Expect(err).ToNot(HaveOccurred())
+		buf = &bytes.Buffer{}
+	})
+
+	AfterEach(func() {
+		reader.Close()
+	})
+
+	Context("when exporting to xml", func() {
+		It("decrypts protected values and keeps the rest of the document", func() {
+			Expect(output.Export(buf, reader.XMLReader, output.ExportFormatXML)).To(Succeed())
+
+			xml := buf.String()
+			Expect(xml).To(HavePrefix("<?xml"))
+			Expect(xml).To(ContainSubstring(`<Value ProtectInMemory="True">ProtectedPassword</Value>`))
+			Expect(xml).To(ContainSubstring(`<Value ProtectInMemory="True">ABC</Value>`))
+			Expect(xml).To(ContainSubstring(`<DatabaseName>Protected Strings Test</DatabaseName>`))
+			Expect(xml).To(ContainSubstring(`<DeletedObjects>`))
+			Expect(xml).ToNot(ContainSubstring(`Protected="True"`))
+
+			// the encrypted model is left untouched
+			entry, err := (&format.EntryServiceOp{XMLReader: reader.XMLReader}).SearchByTerm("Sample Entry")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entry.Password.String()).To(Equal("ProtectedPassword"))
+		})
+	})
+
+	Context("when exporting to KeePassXC csv", func() {
+		It("writes a header and one row per entry", func() {
+			Expect(output.Export(buf, reader.XMLReader, output.ExportFormatKeePassXCCSV)).To(Succeed())
+
+			records, err := csv.NewReader(buf).ReadAll()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(records).To(Equal([][]string{
+				{"Group", "Title", "Username", "Password", "URL", "Notes", "TOTP"},
+				{"Protected", "Sample Entry", "Protected User Name", "ProtectedPassword", "http://www.somesite.com/", "Notes", ""},
+			}))
+		})
+	})
+
+	Context("when exporting to 1Password csv", func() {
+		It("writes a header and one row per entry", func() {
+			Expect(output.Export(buf, reader.XMLReader, output.ExportFormat1PasswordCSV)).To(Succeed())
+
+			records, err := csv.NewReader(buf).ReadAll()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(records).To(HaveLen(2))
+			Expect(records[0][0]).To(Equal("Title"))
+			Expect(records[1][:4]).To(Equal([]string{"Sample Entry", "http://www.somesite.com/", "Protected User Name", "ProtectedPassword"}))
+		})
+	})
+
+	Context("when exporting to Bitwarden json", func() {
+		It("writes login items with custom fields", func() {
+			Expect(output.Export(buf, reader.XMLReader, output.ExportFormatBitwarden)).To(Succeed())
+
+			var export struct {
+				Encrypted bool
+				Items     []struct {
+					ID     string
+					Name   string
+					Fields []struct {
+						Name  string
+						Value string
+						Type  int
+					}
+					Login struct {
+						Username string
+						Password string
+						URIs     []struct{ URI string }
+					}
+				}
+			}
+			Expect(json.Unmarshal(buf.Bytes(), &export)).To(Succeed())
+			Expect(export.Encrypted).To(BeFalse())
+			Expect(export.Items).To(HaveLen(1))
+
+			item := export.Items[0]
+			Expect(item.ID).To(Equal("a8370aa8-8afd-3c45-93ce-981eafb789c8"))
+			Expect(item.Name).To(Equal("Sample Entry"))
+			Expect(item.Login.Username).To(Equal("Protected User Name"))
+			Expect(item.Login.Password).To(Equal("ProtectedPassword"))
+			Expect(item.Login.URIs[0].URI).To(Equal("http://www.somesite.com/"))
+			Expect(item.Fields).To(HaveLen(2))
+			Expect(item.Fields[0].Name).To(Equal("TestProtected"))
+			Expect(item.Fields[0].Value).To(Equal("ABC"))
+			Expect(item.Fields[0].Type).To(Equal(1))
+		})
+	})
+
+	Context("when converting a legacy TOTP seed", func() {
+		It("returns an otpauth URI", func() {
+			entry := &format.Entry{
+				Title: &format.EntryValue{PlainText: "Mail"},
+				Fields: []format.Field{
+					{Key: format.TOTPSeedField, Value: &format.EntryValue{PlainText: "jbsw y3dp"}},
+					{Key: format.TOTPSettingsField, Value: &format.EntryValue{PlainText: "30;6"}},
+				},
+			}
+			totp := output.TOTP(entry)
+			Expect(strings.HasPrefix(totp, "otpauth://totp/Mail?")).To(BeTrue())
+			Expect(totp).To(ContainSubstring("secret=JBSWY3DP"))
+			Expect(totp).To(ContainSubstring("digits=6"))
+		})
+	})
+})
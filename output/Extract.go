@@ -1,24 +1,25 @@
 package output
 
 import (
-	"bytes"
 	"strconv"
 	"strings"
 
 	"github.com/pkg/errors"
 
 	"github.com/simonhayward/gkeepassxreader/format"
+	"github.com/simonhayward/gkeepassxreader/secure"
 )
 
 const whitespace = " \t"
 
 //Extract specific characters from string
 func Extract(entry *format.Entry, chrs string) error {
-	var buffer bytes.Buffer
-
 	chrs = strings.Trim(chrs, whitespace)
 	chrs = strings.Trim(chrs, ",")
 	idxs := strings.Split(chrs, ",")
+	password := entry.Password.Bytes()
+	extracted := make([]byte, 0, len(idxs))
+	defer func() { secure.Wipe(extracted) }()
 
 	for _, strIdx := range idxs {
 		strIdx = strings.Trim(strIdx, whitespace)
@@ -28,16 +29,14 @@ func Extract(entry *format.Entry, chrs string) error {
 			return errors.Wrap(err, "failure to convert string to int")
 		}
 
-		if idx <= 0 || idx > len(entry.Password.PlainText) {
-			return errors.Errorf("index out of range: %d max value allowed is: %d", idx, len(entry.Password.PlainText))
+		if idx <= 0 || idx > len(password) {
+			return errors.Errorf("index out of range: %d max value allowed is: %d", idx, len(password))
 		}
 
 		idx--
 
-		buffer.WriteByte(entry.Password.PlainText[idx])
+		extracted = append(extracted, password[idx])
 	}
 
-	entry.Password.PlainText = buffer.String()
-
-	return nil
+	return entry.Password.SetPlainText(extracted)
 }
@@ -24,7 +24,7 @@ var _ = Describe("Extract", func() {
 			err := output.Extract(entry, "1,2,3")
 			Expect(err).ToNot(HaveOccurred())
 
-			Expect(entry.Password.PlainText).To(Equal("thi"))
+			Expect(entry.Password.String()).To(Equal("thi"))
 		})
 	})
 
@@ -33,7 +33,7 @@ var _ = Describe("Extract", func() {
 			err := output.Extract(entry, "19,1,2,3,19")
 			Expect(err).ToNot(HaveOccurred())
 
-			Expect(entry.Password.PlainText).To(Equal("dthid"))
+			Expect(entry.Password.String()).To(Equal("dthid"))
 		})
 	})
 
@@ -42,7 +42,7 @@ var _ = Describe("Extract", func() {
 			err := output.Extract(entry, " 1, 2 ,	3	")
 			Expect(err).ToNot(HaveOccurred())
 
-			Expect(entry.Password.PlainText).To(Equal("thi"))
+			Expect(entry.Password.String()).To(Equal("thi"))
 		})
 	})
 
@@ -51,7 +51,7 @@ var _ = Describe("Extract", func() {
 			err := output.Extract(entry, "1,2,")
 			Expect(err).ToNot(HaveOccurred())
 
-			Expect(entry.Password.PlainText).To(Equal("th"))
+			Expect(entry.Password.String()).To(Equal("th"))
 		})
 	})
 
@@ -60,7 +60,7 @@ var _ = Describe("Extract", func() {
 			err := output.Extract(entry, ",1,2")
 			Expect(err).ToNot(HaveOccurred())
 
-			Expect(entry.Password.PlainText).To(Equal("th"))
+			Expect(entry.Password.String()).To(Equal("th"))
 		})
 	})
 
@@ -69,7 +69,7 @@ var _ = Describe("Extract", func() {
 			err := output.Extract(entry, " , 1,2")
 			Expect(err).ToNot(HaveOccurred())
 
-			Expect(entry.Password.PlainText).To(Equal("th"))
+			Expect(entry.Password.String()).To(Equal("th"))
 		})
 	})
 
@@ -78,12 +78,12 @@ var _ = Describe("Extract", func() {
 			err := output.Extract(entry, "0,2,3")
 			Expect(err).To(HaveOccurred())
 
-			Expect(entry.Password.PlainText).To(Equal("this is my password"))
+			Expect(entry.Password.String()).To(Equal("this is my password"))
 
 			err = output.Extract(entry, "1, 2, 199")
 			Expect(err).To(HaveOccurred())
 
-			Expect(entry.Password.PlainText).To(Equal("this is my password"))
+			Expect(entry.Password.String()).To(Equal("this is my password"))
 		})
 	})
 
@@ -92,7 +92,7 @@ var _ = Describe("Extract", func() {
 			err := output.Extract(entry, "1,2,-3")
 			Expect(err).To(HaveOccurred())
 
-			Expect(entry.Password.PlainText).To(Equal("this is my password"))
+			Expect(entry.Password.String()).To(Equal("this is my password"))
 		})
 	})
 
@@ -101,12 +101,12 @@ var _ = Describe("Extract", func() {
 			err := output.Extract(entry, "1,2,P")
 			Expect(err).To(HaveOccurred())
 
-			Expect(entry.Password.PlainText).To(Equal("this is my password"))
+			Expect(entry.Password.String()).To(Equal("this is my password"))
 
 			err = output.Extract(entry, "1,A,2")
 			Expect(err).To(HaveOccurred())
 
-			Expect(entry.Password.PlainText).To(Equal("this is my password"))
+			Expect(entry.Password.String()).To(Equal("this is my password"))
 		})
 	})
 
@@ -115,7 +115,7 @@ var _ = Describe("Extract", func() {
 			err := output.Extract(entry, "")
 			Expect(err).To(HaveOccurred())
 
-			Expect(entry.Password.PlainText).To(Equal("this is my password"))
+			Expect(entry.Password.String()).To(Equal("this is my password"))
 		})
 	})
 
@@ -2,45 +2,120 @@ package output
 
 import (
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/olekukonko/tablewriter"
+	"github.com/pkg/errors"
 	"github.com/simonhayward/gkeepassxreader/format"
 )
 
+const (
+	timeFormat = "2006-01-02 15:04"
+)
+
+//Columns which can be listed
+var Columns = []string{"uuid", "group", "path", "title", "username", "url", "notes", "tags", "created", "modified", "accessed", "expires", "usage"}
+
+//DefaultColumns listed when none are given
+var DefaultColumns = []string{"uuid", "group", "title", "username", "url", "notes", "tags"}
+
+var columnHeaders = map[string]string{
+	"uuid":     "UUID",
+	"group":    "Group",
+	"path":     "Path",
+	"title":    "Title",
+	"username": "Username",
+	"url":      "URL",
+	"notes":    "Notes",
+	"tags":     "Tags",
+	"created":  "Created",
+	"modified": "Modified",
+	"accessed": "Accessed",
+	"expires":  "Expires",
+	"usage":    "Usage",
+}
+
 //Data header/data
 type Data struct {
-	Header []string
-	Data   [][]string
+	Header  []string
+	Data    [][]string
+	columns []string
 }
 
 //NewDefaults entries
 func NewDefaults() *Data {
-	return &Data{
-		Header: []string{"UUID", "Group", "Title", "Username", "URL", "Notes"},
+	d, _ := NewColumns(DefaultColumns)
+	return d
+}
+
+//NewColumns entries with the given columns, see Columns
+func NewColumns(columns []string) (*Data, error) {
+	d := &Data{}
+	for _, c := range columns {
+		c = strings.ToLower(strings.TrimSpace(c))
+		header, ok := columnHeaders[c]
+		if !ok {
+			return nil, errors.Errorf("unknown column %s, columns are: %s", c, strings.Join(Columns, ", "))
+		}
+		d.Header = append(d.Header, header)
+		d.columns = append(d.columns, c)
 	}
+	return d, nil
 }
 
 //Entries fields to display
 func (d *Data) Entries(entries []format.Entry) {
 	for _, entry := range entries {
-
-		var url, notes string
-		if entry.Notes != nil {
-			notes = entry.Notes.PlainText
+		row := make([]string, len(d.columns))
+		for i, c := range d.columns {
+			row[i] = column(&entry, c)
 		}
-		if entry.URL != nil {
-			url = entry.URL.PlainText
+		d.Data = append(d.Data, row)
+	}
+}
+
+func column(entry *format.Entry, c string) string {
+	switch c {
+	case "uuid":
+		return entry.UUID
+	case "group":
+		return entry.Group
+	case "path":
+		return strings.Join(entry.Path, "/")
+	case "title":
+		return entry.Title.String()
+	case "username":
+		return entry.Username.String()
+	case "url":
+		return entry.URL.String()
+	case "notes":
+		return entry.Notes.String()
+	case "tags":
+		return strings.Join(entry.Tags, ", ")
+	case "created":
+		return formatTime(entry.Times.Created)
+	case "modified":
+		return formatTime(entry.Times.Modified)
+	case "accessed":
+		return formatTime(entry.Times.Accessed)
+	case "expires":
+		if !entry.Times.Expires {
+			return "never"
 		}
+		return formatTime(entry.Times.Expiry)
+	case "usage":
+		return strconv.Itoa(entry.Times.UsageCount)
+	}
+	return ""
+}
 
-		d.Data = append(d.Data, []string{
-			entry.UUID,
-			entry.Group,
-			entry.Title.PlainText,
-			entry.Username.PlainText,
-			url,
-			notes,
-		})
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
 	}
+	return t.Local().Format(timeFormat)
 }
 
 //Table entries in ascii table
@@ -0,0 +1,50 @@
+package output_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/simonhayward/gkeepassxreader/format"
+	"github.com/simonhayward/gkeepassxreader/output"
+)
+
+var _ = Describe("Table", func() {
+
+	entry := format.Entry{
+		UUID:  "a8370aa88afd3c4593ce981eafb789c8",
+		Group: "Email",
+		Path:  []string{"Root", "Email"},
+		Title: &format.EntryValue{PlainText: "Mail"},
+		Tags:  []string{"prod", "shared"},
+		Times: format.Times{
+			Modified:   time.Date(2020, 1, 2, 3, 4, 0, 0, time.Local),
+			UsageCount: 3,
+		},
+	}
+
+	Context("when using the default columns", func() {
+		It("shows the uuid, group, title, username, url, notes and tags", func() {
+			fields := output.NewDefaults()
+			fields.Entries([]format.Entry{entry})
+			Expect(fields.Header).To(Equal([]string{"UUID", "Group", "Title", "Username", "URL", "Notes", "Tags"}))
+			Expect(fields.Data).To(Equal([][]string{{"a8370aa88afd3c4593ce981eafb789c8", "Email", "Mail", "", "", "", "prod, shared"}}))
+		})
+	})
+
+	Context("when choosing columns", func() {
+		It("shows the given columns in order", func() {
+			fields, err := output.NewColumns([]string{"title", "Path", "modified", "created", "expires", "usage"})
+			Expect(err).ToNot(HaveOccurred())
+			fields.Entries([]format.Entry{entry})
+			Expect(fields.Header).To(Equal([]string{"Title", "Path", "Modified", "Created", "Expires", "Usage"}))
+			Expect(fields.Data).To(Equal([][]string{{"Mail", "Root/Email", "2020-01-02 03:04", "", "never", "3"}}))
+		})
+
+		It("fails for an unknown column", func() {
+			_, err := output.NewColumns([]string{"title", "colour"})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/simonhayward/gkeepassxreader/format"
+	"github.com/simonhayward/gkeepassxreader/keys"
+	log "github.com/sirupsen/logrus"
+)
+
+// checkMasterKey warns on stderr when the database recommends or forces a
+// master key change, with --strict a forced change is an error
+func checkMasterKey(reader *format.KeePass2Reader) {
+	status, err := reader.XMLReader.MasterKeyStatus(time.Now())
+	if err != nil {
+		log.Warnf("master key status error: %s", err)
+		return
+	}
+
+	since := ""
+	if !status.Changed.IsZero() {
+		since = fmt.Sprintf(", last changed %s (%d days ago)", status.Changed.Local().Format("2006-01-02"), status.Days)
+	}
+
+	switch {
+	case status.Forced && *strict:
+		fmt.Fprintf(os.Stderr, "error: the master key must be changed%s, run passwd\n", since)
+		exit(1)
+	case status.Forced:
+		fmt.Fprintf(os.Stderr, "warning: the master key must be changed%s, run passwd\n", since)
+	case status.Recommended:
+		fmt.Fprintf(os.Stderr, "warning: changing the master key is recommended%s, run passwd\n", since)
+	}
+}
+
+func passwd(reader *format.KeePass2Reader, c *credentials) {
+	xmlFile, err := reader.XMLReader.Decrypted()
+	if err != nil {
+		log.Fatalf("decrypt database error: %s", err)
+	}
+
+	if err := reader.Db.Rekey(newMasterKey(c)); err != nil {
+		log.Fatalf("master key error: %s", err)
+	}
+	xmlFile.SetMasterKeyChanged(time.Now())
+
+	saveDatabase((*db).Name(), reader, xmlFile)
+	fmt.Println("master key changed")
+}
+
+// newMasterKey reads the new key from the given flags, a password typed at
+// the terminal is asked for twice
+func newMasterKey(c *credentials) *keys.CompositeKey {
+	source := keys.NewPasswordSource()
+	source.None = *c.noPassword
+	source.File = *c.passwordFile
+	source.Env = *c.passwordEnv
+	source.Command = *c.passwordCommand
+	source.Prompt = "New password (press enter for no password): "
+
+	password, err := source.Password()
+	if err != nil {
+		log.Fatalf("password error: %s", err)
+	}
+
+	if !source.None && len(source.File) == 0 && len(source.Env) == 0 && len(source.Command) == 0 {
+		source.Prompt = "Repeat new password: "
+		repeated, err := source.Password()
+		if err != nil {
+			log.Fatalf("password error: %s", err)
+		}
+		if repeated != password {
+			log.Fatalf("passwords do not match")
+		}
+	}
+
+	key, err := keys.NewMasterKey(password, *c.keyfile)
+	if err != nil {
+		log.Fatalf("master key error: %s", err)
+	}
+	addChallengeResponseKeys(key)
+	return key
+}
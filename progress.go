@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/simonhayward/gkeepassxreader/format"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+const (
+	// shortest time between redraws of the same stage
+	progressInterval = 100 * time.Millisecond
+	progressBarWidth = 30
+)
+
+var spinner = []string{"|", "/", "-", "\\"}
+
+// progressLine redraws a single line of stderr as a database is opened
+type progressLine struct {
+	out   io.Writer
+	stage string
+	drawn time.Time
+	spin  int
+}
+
+// newProgress returns a progress callback drawing on stderr and a function
+// clearing the line, the callback is nil unless stderr is a terminal
+func newProgress() (format.ProgressFunc, func()) {
+	if *debug || !terminal.IsTerminal(int(os.Stderr.Fd())) {
+		return nil, func() {}
+	}
+	p := &progressLine{out: os.Stderr}
+	return p.update, p.clear
+}
+
+func (p *progressLine) update(progress format.Progress) {
+	now := time.Now()
+	if progress.Stage == p.stage && now.Sub(p.drawn) < progressInterval {
+		return
+	}
+	p.stage = progress.Stage
+	p.drawn = now
+	p.spin = (p.spin + 1) % len(spinner)
+
+	var line string
+	switch progress.Stage {
+	case format.StageKDF:
+		percent := progress.KDFPercent()
+		filled := int(percent / 100 * progressBarWidth)
+		line = fmt.Sprintf("Deriving key [%s%s] %3.0f%%", strings.Repeat("#", filled), strings.Repeat(".", progressBarWidth-filled), percent)
+	case format.StageDecrypt:
+		line = fmt.Sprintf("Decrypting %s %s", spinner[p.spin], byteSize(progress.BytesDecrypted))
+	case format.StageParse:
+		line = fmt.Sprintf("Parsing %s %d entries", spinner[p.spin], progress.EntriesParsed)
+	}
+	fmt.Fprintf(p.out, "\r\033[K%s", line)
+}
+
+func (p *progressLine) clear() {
+	if !p.drawn.IsZero() {
+		fmt.Fprint(p.out, "\r\033[K")
+	}
+}
+
+func byteSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/simonhayward/gkeepassxreader/format"
+	log "github.com/sirupsen/logrus"
+)
+
+func removeEntry(reader *format.KeePass2Reader, term string) {
+	// an entry in the recycle bin is only found with --include-recycled
+	service := &format.EntryServiceOp{XMLReader: reader.XMLReader, RecycledEntries: *recycled}
+	entry, err := service.SearchByTerm(term)
+	if err != nil {
+		log.Fatalf("search database error: %s", err)
+	}
+	if entry == nil {
+		log.Fatalf("Search term: '%s' not found\n", term)
+	}
+
+	xmlFile, err := reader.XMLReader.Decrypted()
+	if err != nil {
+		log.Fatalf("decrypt database error: %s", err)
+	}
+	moved, err := xmlFile.RemoveEntry(entry.UUID)
+	if err != nil {
+		log.Fatalf("remove entry error: %s", err)
+	}
+
+	saveDatabase((*db).Name(), reader, xmlFile)
+	if moved {
+		fmt.Printf("moved %s [%s] to the recycle bin\n", entry.Title.String(), entry.UUID)
+	} else {
+		fmt.Printf("deleted %s [%s]\n", entry.Title.String(), entry.UUID)
+	}
+}
+
+func purge(reader *format.KeePass2Reader) {
+	xmlFile, err := reader.XMLReader.Decrypted()
+	if err != nil {
+		log.Fatalf("decrypt database error: %s", err)
+	}
+
+	entries, groups := xmlFile.EmptyRecycleBin()
+	if entries == 0 && groups == 0 {
+		fmt.Println("the recycle bin is empty")
+		return
+	}
+
+	saveDatabase((*db).Name(), reader, xmlFile)
+	fmt.Printf("deleted %d entries and %d groups from the recycle bin\n", entries, groups)
+}
@@ -0,0 +1,83 @@
+package secure
+
+import (
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// arenaSize is the locked memory of an arena. Small shared buffers are
+	// carved from arenas so a database of thousands of values maps and locks
+	// a few arenas rather than pages and guard pages for each value.
+	arenaSize = 64 * 1024
+	// buffers larger than this have memory of their own
+	arenaMaxBuffer = arenaSize / 8
+)
+
+var (
+	arenas struct {
+		sync.Mutex
+		current *arena
+	}
+)
+
+// arena is locked memory between two guard pages which buffers are taken from
+// in turn, a full arena is released once its last buffer is destroyed
+type arena struct {
+	memory []byte
+	data   []byte
+	used   int
+	live   int
+}
+
+// allocateFromArena takes size bytes from the current arena, starting a new
+// one when it is full
+func allocateFromArena(size int) (*arena, []byte, error) {
+	arenas.Lock()
+	defer arenas.Unlock()
+
+	a := arenas.current
+	if a == nil || a.used+size > len(a.data) {
+		memory, data, err := allocate(arenaSize)
+		if err != nil {
+			return nil, nil, err
+		}
+		if a != nil && a.live == 0 {
+			a.release()
+		}
+		a = &arena{memory: memory, data: data}
+		arenas.current = a
+	}
+
+	data := a.data[a.used : a.used+size : a.used+size]
+	a.used += size
+	a.live++
+	return a, data, nil
+}
+
+// free returns a wiped buffer to the arena
+func (a *arena) free() {
+	arenas.Lock()
+	defer arenas.Unlock()
+
+	a.live--
+	if a.live > 0 {
+		return
+	}
+
+	// the current arena is reused from the start, its buffers are wiped
+	if a == arenas.current {
+		a.used = 0
+		return
+	}
+	a.release()
+}
+
+func (a *arena) release() {
+	if err := release(a.memory, a.data); err != nil {
+		log.Debugf("unable to release locked memory: %s", err)
+	}
+	a.memory = nil
+	a.data = nil
+}
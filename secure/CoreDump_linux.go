@@ -0,0 +1,23 @@
+//go:build linux
+// +build linux
+
+package secure
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+//DisableCoreDumps stops the process from writing core dumps or being attached to by other processes
+func DisableCoreDumps() error {
+	if err := unix.Setrlimit(unix.RLIMIT_CORE, &unix.Rlimit{Cur: 0, Max: 0}); err != nil {
+		return fmt.Errorf("setrlimit failed: %s", err)
+	}
+
+	if err := unix.Prctl(unix.PR_SET_DUMPABLE, 0, 0, 0, 0); err != nil {
+		return fmt.Errorf("prctl failed: %s", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package secure
+
+//DisableCoreDumps is not supported on this platform
+func DisableCoreDumps() error {
+	return nil
+}
@@ -0,0 +1,147 @@
+package secure
+
+import (
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	warnOnce sync.Once
+)
+
+//LockedBuffer holds secrets in memory which is locked against swapping,
+//surrounded by guard pages and zeroised when destroyed. Shared buffers, meant
+//for the many values of a database rather than key material, are taken from
+//arenas whose guard pages surround all of their buffers. Memory which can't be
+//locked is still used, with a warning.
+type LockedBuffer struct {
+	mu        sync.Mutex
+	memory    []byte
+	data      []byte
+	arena     *arena
+	destroyed bool
+}
+
+//NewLockedBuffer allocates a zeroed buffer of the given size between guard
+//pages of its own
+func NewLockedBuffer(size int) (*LockedBuffer, error) {
+	if size < 0 {
+		size = 0
+	}
+
+	memory, data, err := allocate(size)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LockedBuffer{
+		memory: memory,
+		data:   data,
+	}, nil
+}
+
+//NewLockedBufferFromBytes moves b into a locked buffer, b is wiped
+func NewLockedBufferFromBytes(b []byte) (*LockedBuffer, error) {
+	return fromBytes(NewLockedBuffer, b)
+}
+
+//NewSharedLockedBuffer allocates a zeroed buffer of the given size, a small
+//one from an arena shared with other buffers
+func NewSharedLockedBuffer(size int) (*LockedBuffer, error) {
+	if size < 0 {
+		size = 0
+	}
+	if size > arenaMaxBuffer {
+		return NewLockedBuffer(size)
+	}
+
+	a, data, err := allocateFromArena(size)
+	if err != nil {
+		return nil, err
+	}
+	return &LockedBuffer{
+		data:  data,
+		arena: a,
+	}, nil
+}
+
+//NewSharedLockedBufferFromBytes moves b into a shared locked buffer, b is wiped
+func NewSharedLockedBufferFromBytes(b []byte) (*LockedBuffer, error) {
+	return fromBytes(NewSharedLockedBuffer, b)
+}
+
+func fromBytes(newBuffer func(int) (*LockedBuffer, error), b []byte) (*LockedBuffer, error) {
+	buf, err := newBuffer(len(b))
+	if err != nil {
+		Wipe(b)
+		return nil, err
+	}
+
+	copy(buf.data, b)
+	Wipe(b)
+
+	return buf, nil
+}
+
+//Bytes returns the buffer contents, only valid until Destroy is called
+func (b *LockedBuffer) Bytes() []byte {
+	if b == nil {
+		return nil
+	}
+	return b.data
+}
+
+//Size of the buffer
+func (b *LockedBuffer) Size() int {
+	if b == nil {
+		return 0
+	}
+	return len(b.data)
+}
+
+//Destroyed reports whether the buffer has been wiped and released
+func (b *LockedBuffer) Destroyed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.destroyed
+}
+
+//Destroy zeroises and releases the buffer
+func (b *LockedBuffer) Destroy() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.destroyed {
+		return
+	}
+
+	Wipe(b.data)
+	if b.arena != nil {
+		b.arena.free()
+	} else if err := release(b.memory, b.data); err != nil {
+		log.Debugf("unable to release locked memory: %s", err)
+	}
+
+	b.memory = nil
+	b.arena = nil
+	b.data = nil
+	b.destroyed = true
+}
+
+//Wipe zeroises b
+func Wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+func warnNotLocked(err error) {
+	warnOnce.Do(func() {
+		log.Warnf("unable to lock memory, secrets may be swapped to disk: %s", err)
+	})
+}
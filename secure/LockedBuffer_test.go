@@ -0,0 +1,113 @@
+package secure_test
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/simonhayward/gkeepassxreader/secure"
+)
+
+var _ = Describe("LockedBuffer", func() {
+
+	Context("when created from bytes", func() {
+		It("holds a copy and wipes the source", func() {
+			src := []byte("my secret password")
+
+			buf, err := secure.NewLockedBufferFromBytes(src)
+			Expect(err).ToNot(HaveOccurred())
+			defer buf.Destroy()
+
+			Expect(string(buf.Bytes())).To(Equal("my secret password"))
+			Expect(buf.Bytes()).To(Equal([]byte("my secret password")))
+			Expect(buf.Size()).To(Equal(18))
+			Expect(src).To(Equal(make([]byte, 18)))
+		})
+	})
+
+	Context("when created with a size", func() {
+		It("is zeroed and writable", func() {
+			buf, err := secure.NewLockedBuffer(64)
+			Expect(err).ToNot(HaveOccurred())
+			defer buf.Destroy()
+
+			Expect(buf.Bytes()).To(Equal(make([]byte, 64)))
+			copy(buf.Bytes(), "secret")
+			Expect(string(buf.Bytes())[:6]).To(Equal("secret"))
+		})
+
+		It("allows an empty buffer", func() {
+			buf, err := secure.NewLockedBuffer(0)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(buf.Bytes())).To(Equal(""))
+			buf.Destroy()
+		})
+
+		It("allows a buffer larger than a page", func() {
+			buf, err := secure.NewLockedBuffer(10000)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(buf.Size()).To(Equal(10000))
+			buf.Bytes()[9999] = 1
+			buf.Destroy()
+		})
+	})
+
+	Context("when many small shared buffers are allocated", func() {
+		It("shares locked memory between them", func() {
+			// far more than the mappings a process may have if each buffer
+			// had its own
+			buffers := make([]*secure.LockedBuffer, 100000)
+			for i := range buffers {
+				buf, err := secure.NewSharedLockedBufferFromBytes([]byte(fmt.Sprintf("secret %d", i)))
+				Expect(err).ToNot(HaveOccurred())
+				buffers[i] = buf
+			}
+
+			for i, buf := range buffers {
+				if i%2 == 0 {
+					buf.Destroy()
+				}
+			}
+			for i, buf := range buffers {
+				if i%2 == 1 {
+					Expect(string(buf.Bytes())).To(Equal(fmt.Sprintf("secret %d", i)))
+					buf.Destroy()
+				}
+			}
+		})
+	})
+
+	Context("when a large shared buffer is allocated", func() {
+		It("has memory of its own", func() {
+			buf, err := secure.NewSharedLockedBuffer(100000)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(buf.Size()).To(Equal(100000))
+			buf.Bytes()[99999] = 1
+			buf.Destroy()
+			Expect(buf.Destroyed()).To(BeTrue())
+		})
+	})
+
+	Context("when destroyed", func() {
+		It("releases the contents and can be destroyed again", func() {
+			buf, err := secure.NewLockedBufferFromBytes([]byte("secret"))
+			Expect(err).ToNot(HaveOccurred())
+
+			buf.Destroy()
+			Expect(buf.Destroyed()).To(BeTrue())
+			Expect(buf.Bytes()).To(BeEmpty())
+			Expect(string(buf.Bytes())).To(Equal(""))
+
+			buf.Destroy()
+		})
+	})
+
+	Context("when wiping a slice", func() {
+		It("zeroes every byte", func() {
+			b := []byte{1, 2, 3}
+			secure.Wipe(b)
+			Expect(b).To(Equal([]byte{0, 0, 0}))
+		})
+	})
+})
@@ -0,0 +1,19 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package secure
+
+import (
+	"errors"
+)
+
+// allocate falls back to ordinary memory which is still wiped on Destroy
+func allocate(size int) ([]byte, []byte, error) {
+	warnNotLocked(errors.New("not supported on this platform"))
+	data := make([]byte, size)
+	return data, data, nil
+}
+
+func release(memory, data []byte) error {
+	return nil
+}
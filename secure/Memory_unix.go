@@ -0,0 +1,61 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package secure
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+var (
+	pageSize = os.Getpagesize()
+)
+
+// allocate maps the data pages between two inaccessible guard pages, the data
+// is placed at the end of its pages so an overflow faults on the guard page
+func allocate(size int) ([]byte, []byte, error) {
+	dataPages := roundToPage(size)
+	if dataPages == 0 {
+		dataPages = pageSize
+	}
+
+	memory, err := unix.Mmap(-1, 0, dataPages+2*pageSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_PRIVATE|unix.MAP_ANON)
+	if err != nil {
+		return nil, nil, fmt.Errorf("mmap failed: %s", err)
+	}
+
+	if err := unix.Mprotect(memory[:pageSize], unix.PROT_NONE); err != nil {
+		unix.Munmap(memory)
+		return nil, nil, fmt.Errorf("mprotect failed: %s", err)
+	}
+	if err := unix.Mprotect(memory[pageSize+dataPages:], unix.PROT_NONE); err != nil {
+		unix.Munmap(memory)
+		return nil, nil, fmt.Errorf("mprotect failed: %s", err)
+	}
+
+	pages := memory[pageSize : pageSize+dataPages]
+	if err := unix.Mlock(pages); err != nil {
+		warnNotLocked(err)
+	}
+
+	end := pageSize + dataPages
+	return memory, memory[end-size : end : end], nil
+}
+
+func release(memory, data []byte) error {
+	if len(memory) == 0 {
+		return nil
+	}
+
+	pages := memory[pageSize : len(memory)-pageSize]
+	unix.Munlock(pages)
+
+	return unix.Munmap(memory)
+}
+
+func roundToPage(size int) int {
+	return (size + pageSize - 1) / pageSize * pageSize
+}
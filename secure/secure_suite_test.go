@@ -0,0 +1,13 @@
+package secure_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestSecure(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Secure Suite")
+}
@@ -2,27 +2,63 @@ package streams
 
 import (
 	"bytes"
+	"context"
 	"crypto/cipher"
 	"crypto/sha256"
 	"encoding/binary"
 	"fmt"
 )
 
+const (
+	//DefaultMaxBlockSize is the largest block read, KeePass writes blocks of
+	//1 MiB
+	DefaultMaxBlockSize = 64 * 1024 * 1024
+
+	// data of a block is read in chunks so a size which the stream can't
+	// fill isn't allocated up front
+	blockReadChunk = 64 * 1024
+)
+
 // HashedBlock represents a hashed block
 type HashedBlock struct {
+	//MaxBlockSize is the largest block size accepted, larger blocks are an
+	//error
+	MaxBlockSize uint32
+
 	buffer       []byte
 	blockIndex   uint32
 	bufferPos    int
 	mode         cipher.BlockMode
 	cipherStream *SymmetricCipherStream
 	eof          bool
+	ctx          context.Context
+	// bytes read from the cipher stream
+	offset int64
+}
+
+//BlockInfo describes a block of a hashed block stream
+type BlockInfo struct {
+	Index uint32
+	// offset of the block in the decrypted stream
+	Offset int64
+	Size   uint32
+	// whether the data matches the hash
+	Valid bool
 }
 
 //NewHashedBlock create new hashed block
 func NewHashedBlock(mode cipher.BlockMode, stream *SymmetricCipherStream) *HashedBlock {
+	return NewHashedBlockContext(context.Background(), mode, stream)
+}
+
+//NewHashedBlockContext creates a hashed block which stops reading with ctx's
+//error once ctx is done
+func NewHashedBlockContext(ctx context.Context, mode cipher.BlockMode, stream *SymmetricCipherStream) *HashedBlock {
 	return &HashedBlock{
+		MaxBlockSize: DefaultMaxBlockSize,
 		mode:         mode,
 		cipherStream: stream,
+		ctx:          ctx,
 	}
 }
 
@@ -76,81 +112,109 @@ func (hb *HashedBlock) ReadData(data *[]byte, maxSize int) (int, error) {
 }
 
 func (hb *HashedBlock) readHashedBlock() (bool, error) {
-	indexBytes := make([]byte, 4)
-	_, err := hb.cipherStream.ReadData(&indexBytes, 4)
+	if err := hb.ctx.Err(); err != nil {
+		return false, err
+	}
 
+	block, data, err := hb.ReadBlock()
 	if err != nil {
-		return false, fmt.Errorf("unable to read block index: %s", err)
+		return false, err
 	}
 
-	var index uint32
-	bufIndex := bytes.NewReader(indexBytes)
-	if err := binary.Read(bufIndex, binary.LittleEndian, &index); err != nil {
-		return false, fmt.Errorf("index read failed: %s", err)
+	if block == nil {
+		// EOF
+		hb.eof = true
+		return false, nil
 	}
 
-	if index != hb.blockIndex {
-		return false, fmt.Errorf("invalid block index: %d -> %d", index, hb.blockIndex)
+	if !block.Valid {
+		return false, fmt.Errorf("mismatch between hash and data of block %d", block.Index)
 	}
 
-	hash := make([]byte, 32)
-	_, err = hb.cipherStream.ReadData(&hash, 32)
+	hb.buffer = data
+	hb.bufferPos = 0
+
+	return true, nil
+}
+
+//ReadBlock reads the next block whether or not its data matches its hash,
+//nil is returned for the final block. After an error the following blocks
+//can't be found.
+func (hb *HashedBlock) ReadBlock() (*BlockInfo, []byte, error) {
+	offset := hb.offset
 
+	indexBytes, err := hb.read(4)
 	if err != nil {
-		return false, fmt.Errorf("unable to read hash: %s", err)
+		return nil, nil, fmt.Errorf("unable to read block index: %s", err)
 	}
 
-	if len(hash) != 32 {
-		return false, fmt.Errorf("invalid hash size: %d %v ", len(hash), hash)
+	index := binary.LittleEndian.Uint32(indexBytes)
+	if index != hb.blockIndex {
+		return nil, nil, fmt.Errorf("invalid block index: %d -> %d", index, hb.blockIndex)
 	}
 
-	blockSizeBytes := make([]byte, 4)
-	_, err = hb.cipherStream.ReadData(&blockSizeBytes, 4)
-
+	hash, err := hb.read(sha256.Size)
 	if err != nil {
-		return false, fmt.Errorf("unable to read block size: %s", err)
+		return nil, nil, fmt.Errorf("unable to read hash: %s", err)
 	}
 
-	var blockSize uint32
-	bufBlockSize := bytes.NewReader(blockSizeBytes)
-	if err := binary.Read(bufBlockSize, binary.LittleEndian, &blockSize); err != nil {
-		return false, fmt.Errorf("block size read failed: %s", err)
-	}
-
-	if blockSize < 0 {
-		return false, fmt.Errorf("invalid block size")
+	blockSizeBytes, err := hb.read(4)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read block size: %s", err)
 	}
+	blockSize := binary.LittleEndian.Uint32(blockSizeBytes)
 
 	if blockSize == 0 {
-		if bytes.Count(hash, []byte{0}) != 32 {
-			return false, fmt.Errorf("invalid hash of final block")
+		if bytes.Count(hash, []byte{0}) != sha256.Size {
+			return nil, nil, fmt.Errorf("invalid hash of final block")
 		}
-
-		// EOF
-		hb.eof = true
-		return false, nil
+		return nil, nil, nil
 	}
 
-	_, err = hb.cipherStream.ReadData(&hb.buffer, int(blockSize))
+	if blockSize > hb.MaxBlockSize {
+		return nil, nil, fmt.Errorf("block size %d exceeds the limit of %d", blockSize, hb.MaxBlockSize)
+	}
 
+	data, err := hb.read(int(blockSize))
 	if err != nil {
-		return false, fmt.Errorf("unable to buffer: %s", err)
+		return nil, nil, fmt.Errorf("unable to buffer: %s", err)
 	}
 
-	if len(hb.buffer) != int(blockSize) {
-		return false, fmt.Errorf("block too short")
-	}
+	bufferHash := sha256.Sum256(data)
+	hb.blockIndex++
 
-	h := sha256.New()
-	h.Write(hb.buffer)
-	bufferHash := h.Sum(nil)
+	return &BlockInfo{
+		Index:  index,
+		Offset: offset,
+		Size:   blockSize,
+		Valid:  bytes.Equal(hash, bufferHash[:]),
+	}, data, nil
+}
 
-	if !bytes.Equal(hash, bufferHash) {
-		return false, fmt.Errorf("mismatch between hash and data")
+// read reads exactly n bytes from the cipher stream
+func (hb *HashedBlock) read(n int) ([]byte, error) {
+	chunk := n
+	if chunk > blockReadChunk {
+		chunk = blockReadChunk
 	}
 
-	hb.bufferPos = 0
-	hb.blockIndex++
+	data := make([]byte, 0, chunk)
+	for len(data) < n {
+		if n-len(data) < chunk {
+			chunk = n - len(data)
+		}
 
-	return true, nil
+		buf := make([]byte, chunk)
+		read, err := hb.cipherStream.ReadData(&buf, chunk)
+		if err != nil {
+			return nil, err
+		}
+		if read != chunk {
+			return nil, fmt.Errorf("block too short")
+		}
+		data = append(data, buf...)
+	}
+
+	hb.offset += int64(n)
+	return data, nil
 }
@@ -25,3 +25,10 @@ func NewSalsa20Stream(nonce []byte, key *[32]byte) *Salsa20Stream {
 func (s *Salsa20Stream) ProcessInPlace(data []byte) {
 	salsa20.XORKeyStream(data, data, s.nonce, s.key)
 }
+
+//Wipe zeroises the key
+func (s *Salsa20Stream) Wipe() {
+	for i := range s.key {
+		s.key[i] = 0
+	}
+}
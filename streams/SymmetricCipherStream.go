@@ -3,7 +3,6 @@ package streams
 import (
 	"crypto/cipher"
 	"io"
-	"os"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -23,11 +22,11 @@ type SymmetricCipherStream struct {
 	bufferFilling bool
 	Block         cipher.Block
 	BlockMode     cipher.BlockMode
-	db            *os.File
+	db            io.Reader
 }
 
 //NewSymmetricCipherStream new stream
-func NewSymmetricCipherStream(block cipher.Block, encryptionIV []byte, db *os.File, direction int) (*SymmetricCipherStream, error) {
+func NewSymmetricCipherStream(block cipher.Block, encryptionIV []byte, db io.Reader, direction int) (*SymmetricCipherStream, error) {
 	var blockMode cipher.BlockMode
 
 	if direction == DirectionEncrypt {
@@ -59,6 +58,11 @@ func (s *SymmetricCipherStream) ReadData(data *[]byte, maxSize int) (int, error)
 		if (s.bufferPos == len(s.buffer)) || s.bufferFilling {
 			res, err := s.readBlock()
 			if res == false {
+				// what was read before the end is returned, the end with
+				// the next read
+				if err == io.EOF && bytesRemaining < maxSize {
+					return maxSize - bytesRemaining, nil
+				}
 				if err != nil {
 					return 0, err
 				}
@@ -98,6 +102,7 @@ func (s *SymmetricCipherStream) readBlock() (bool, error) {
 		newData = make([]byte, s.Block.BlockSize()-len(s.buffer))
 	} else {
 		s.buffer = nil
+		s.bufferPos = 0
 		newData = make([]byte, s.Block.BlockSize())
 	}
 
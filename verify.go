@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/simonhayward/gkeepassxreader/format"
+	"github.com/simonhayward/gkeepassxreader/keys"
+	log "github.com/sirupsen/logrus"
+)
+
+func verify(f *os.File, asJSON bool) {
+	var report *format.VerifyReport
+	reader := unlockDatabaseFile(f, masterKey, func(ctx context.Context, reader *format.KeePass2Reader, key *keys.CompositeKey, progress format.ProgressFunc) error {
+		var err error
+		report, err = reader.Verify(ctx, f, key)
+		return err
+	})
+	reader.Close()
+
+	if asJSON {
+		writeJSON(report)
+	} else {
+		printBlocks(report.Blocks, report.CorruptBlocks, report.StreamError)
+
+		xml := "well formed"
+		if !report.XMLWellFormed {
+			xml = report.XMLError
+		}
+		fmt.Printf("%-20s%s\n", "Header hash:", report.HeaderHash)
+		fmt.Printf("%-20s%s\n", "XML:", xml)
+
+		result := "ok"
+		if !report.OK() {
+			result = "damaged, recover can salvage the entries which are intact"
+		}
+		fmt.Printf("%-20s%s\n", "Result:", result)
+	}
+
+	if !report.OK() {
+		exit(1)
+	}
+}
+
+func recoverDatabase(f *os.File, output string, asJSON bool) {
+	// never replace an existing file, least of all the damaged database
+	if _, err := os.Stat(output); err == nil {
+		log.Fatalf("recover error: %s already exists", output)
+	}
+
+	var xmlFile *format.KeePass2XmlFile
+	var report *format.RecoverReport
+	reader := unlockDatabaseFile(f, masterKey, func(ctx context.Context, reader *format.KeePass2Reader, key *keys.CompositeKey, progress format.ProgressFunc) error {
+		var err error
+		xmlFile, report, err = reader.Recover(ctx, f, key)
+		return err
+	})
+	defer reader.Close()
+
+	out, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		log.Fatalf("recover error: %s", err)
+	}
+	err = format.NewKeePass2Writer(reader.Db).WriteDatabase(out, xmlFile)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(output)
+		log.Fatalf("recover error: %s", err)
+	}
+
+	if asJSON {
+		writeJSON(report)
+		return
+	}
+
+	printBlocks(report.Blocks, report.CorruptBlocks, report.StreamError)
+	if len(report.XMLError) > 0 {
+		fmt.Printf("%-20s%s\n", "XML:", report.XMLError)
+	}
+	fmt.Printf("%-20s%d, %d fragments unparsed\n", "Entries:", report.Entries, report.UnparsedFragments)
+	fmt.Printf("%-20s%d\n", "Lost values:", report.LostValues)
+	fmt.Printf("%-20s%d recovered, %d lost\n", "Attachments:", report.RecoveredBinaries, report.LostAttachments)
+	fmt.Printf("recovered %d entries to %s\n", report.Entries, output)
+}
+
+func printBlocks(blocks int, corrupt []format.CorruptBlock, streamError string) {
+	fmt.Printf("%-20s%d\n", "Blocks:", blocks)
+	fmt.Printf("%-20s%d\n", "Corrupt blocks:", len(corrupt))
+	for _, b := range corrupt {
+		fmt.Printf("%-20sblock %d at offset %d, %d bytes\n", "", b.Index, b.Offset, b.Size)
+	}
+	if len(streamError) > 0 {
+		fmt.Printf("%-20s%s\n", "Block stream:", streamError)
+	}
+}